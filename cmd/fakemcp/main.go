@@ -11,6 +11,9 @@
 //	./fakemcp --crash-on=toolname    # Exit(1) when toolname is called (simulate crash)
 //	./fakemcp --error-on=toolname    # Return JSON-RPC error when toolname is called
 //	./fakemcp --require-env=VAR      # Require env var(s) for tool calls
+//	./fakemcp --slow-on=toolname     # Delay the response by --slow-delay (simulate hang)
+//	./fakemcp --stderr-lines=N       # Write N log lines to stderr at startup
+//	./fakemcp --spin-on=toolname     # Burn CPU without responding (simulate runaway)
 //
 // The server reads JSON-RPC from stdin and writes responses to stdout.
 // It responds to: initialize, tools/list, tools/call
@@ -24,6 +27,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/peakyragnar/subluminal/pkg/testharness"
 )
@@ -36,8 +40,16 @@ func main() {
 	crashOn := flag.String("crash-on", "", "Exit immediately when this tool is called (simulate crash)")
 	errorOn := flag.String("error-on", "", "Return error when this tool is called (comma-separated)")
 	requireEnv := flag.String("require-env", "", "Require env vars for tool calls (comma-separated)")
+	slowOn := flag.String("slow-on", "", "Delay the response when these tools are called (comma-separated)")
+	slowDelay := flag.Duration("slow-delay", 2*time.Second, "Delay applied by --slow-on")
+	stderrLines := flag.Int("stderr-lines", 0, "Write this many log lines to stderr at startup")
+	spinOn := flag.String("spin-on", "", "Burn CPU for up to a minute without responding when this tool is called")
 	flag.Parse()
 
+	for i := 1; i <= *stderrLines; i++ {
+		fmt.Fprintf(os.Stderr, "fakemcp: log line %d\n", i)
+	}
+
 	// Parse error-on tools into a set
 	errorTools := make(map[string]bool)
 	if *errorOn != "" {
@@ -46,6 +58,14 @@ func main() {
 		}
 	}
 
+	// Parse slow-on tools into a set
+	slowTools := make(map[string]bool)
+	if *slowOn != "" {
+		for _, name := range strings.Split(*slowOn, ",") {
+			slowTools[strings.TrimSpace(name)] = true
+		}
+	}
+
 	// Create server
 	server := testharness.NewFakeMCPServer()
 	if *requireEnv != "" {
@@ -68,10 +88,27 @@ func main() {
 
 		if name == *crashOn {
 			// Crash mode: exit immediately when this tool is called
+			crashTool := name
 			server.AddTool(name, "Test tool (crashes)", func(args map[string]any) (string, error) {
+				fmt.Fprintf(os.Stderr, "fakemcp: crashing on %s\n", crashTool)
 				os.Exit(1) // Simulate crash - no response sent
 				return "", nil
 			})
+		} else if name == *spinOn {
+			// Spin mode: burn CPU until a limit stops the process
+			server.AddTool(name, "Test tool (spins)", func(args map[string]any) (string, error) {
+				deadline := time.Now().Add(time.Minute)
+				for time.Now().Before(deadline) {
+				}
+				return "", errors.New("spun for a minute")
+			})
+		} else if slowTools[name] {
+			// Slow mode: respond only after the configured delay
+			delay := *slowDelay
+			server.AddTool(name, "Test tool (slow)", func(args map[string]any) (string, error) {
+				time.Sleep(delay)
+				return "ok", nil
+			})
 		} else if errorTools[name] {
 			// Error mode: return an error for this tool
 			server.AddTool(name, "Test tool (errors)", func(args map[string]any) (string, error) {
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/adapter/mcphttp"
+	"github.com/peakyragnar/subluminal/pkg/core"
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+// stdioOnlyFlags configure the stdio upstream process; --upstream-url
+// rejects them rather than ignoring them.
+var stdioOnlyFlags = []string{
+	"call-timeout",
+	"tools-list",
+	"upstream-stderr",
+	"restart-upstream",
+	"restart-max",
+	"restart-window",
+	"limit-memory",
+	"limit-cpu",
+	"limit-files",
+	"limit-procs",
+	"cgroup",
+}
+
+// stdioOnlyFlag returns the first stdio-only flag set on the command
+// line, or "".
+func stdioOnlyFlag() string {
+	name := ""
+	flag.Visit(func(f *flag.Flag) {
+		if name == "" && slices.Contains(stdioOnlyFlags, f.Name) {
+			name = f.Name
+		}
+	})
+	return name
+}
+
+// runHTTP serves the mcp_http adapter on listenAddr until SIGINT/SIGTERM.
+// Events are written to events. Returns the process exit code.
+func runHTTP(serverName, upstreamURL, listenAddr string, policyReload time.Duration, state stateConfig, events io.Writer) int {
+	identity := core.ReadIdentityFromEnv()
+	source := core.GenerateSource()
+
+	stateStore, err := openStateStore(state, identity.RunID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	emitter := core.NewEmitter(events)
+	emitter.Start()
+	defer emitter.Close()
+
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listening on %s: %v\n", listenAddr, err)
+		return 1
+	}
+
+	proxy := mcphttp.NewProxy(upstreamURL, emitter, serverName, identity, source, nil)
+	if path := policy.FilePathFromEnv(); path != "" {
+		proxy.WatchPolicyFile(path, policyReload)
+	}
+	if stateStore != nil {
+		proxy.SetStateStore(stateStore)
+	}
+	server := &http.Server{
+		Handler:           proxy,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	watchParent()
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-sigCh
+		proxy.Cancel()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	proxy.Start()
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		// Serve returns as soon as Shutdown begins; wait for in-flight
+		// calls so run_end stays the last event.
+		<-drained
+	}
+	proxy.Close()
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "HTTP proxy error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -9,6 +9,23 @@
 // Usage:
 //
 //	./shim --server-name=<name> -- <upstream-command> [args...]
+//	./shim --server-name=<name> --upstream-url=<url> [--listen=<addr>]
+//
+// With --upstream-url the shim proxies an MCP Streamable HTTP server instead
+// of spawning a stdio subprocess; MCP clients connect to --listen. Flags that
+// configure the subprocess (--call-timeout, --tools-list, --upstream-stderr,
+// --restart-*, --limit-* and --cgroup) are rejected in that mode.
+//
+// The shim also shuts down when the agent client that started it dies, even
+// if its stdin stays open, so neither it nor the upstream is orphaned.
+//
+// With --restart-upstream a crashed stdio upstream is started again; calls in
+// flight fail as retryable and the agent's initialize handshake is replayed.
+//
+// The --limit-* flags cap the stdio upstream's memory, CPU time, open files
+// and processes with rlimits; --cgroup also confines it to a cgroup v2
+// subtree where one is writable. Breaches are reported as upstream_limit
+// events.
 //
 // Example:
 //
@@ -23,31 +40,124 @@
 //	SUB_ENV        - Environment: dev|ci|prod|unknown
 //	SUB_PRINCIPAL  - Optional principal identity (user/service)
 //	SUB_WORKLOAD   - Optional JSON object describing workload context
+//
+// Ledger:
+//
+//	SUB_LEDGER_ADDR      - ledgerd socket (unix:///path); events also go to stderr
+//	SUB_COORDINATOR_ADDR - ledgerd coordinator socket (unix:///path) holding
+//	                       run-wide policy state shared by every server's shim
+//
+// Policy:
+//
+//	SUB_POLICY_FILE - Path to a YAML/JSON policy bundle, hot reloaded on change
+//	SUB_POLICY_JSON - Inline JSON policy bundle (used when SUB_POLICY_FILE is unset)
+//	SUB_STATE_DIR   - Persist budget/rate-limit/breaker/dedupe state per run_id here,
+//	                  shared across shim restarts and every shim of the run
 package main
 
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/peakyragnar/subluminal/pkg/adapter/mcpstdio"
+	"github.com/peakyragnar/subluminal/pkg/coord"
 	"github.com/peakyragnar/subluminal/pkg/core"
+	"github.com/peakyragnar/subluminal/pkg/policy"
 	"github.com/peakyragnar/subluminal/pkg/secret"
 )
 
+// upstreamStopGrace is how long the upstream gets to exit before SIGKILL.
+const upstreamStopGrace = 5 * time.Second
+
 func main() {
+	// A shim started to set an upstream's rlimits execs the upstream here
+	mcpstdio.LimitTrampoline()
+	// Before anything slow, so the agent client cannot die unnoticed
+	trackParent()
+
+	os.Exit(run())
+}
+
+// run is the shim proper. It returns the exit code rather than exiting, so
+// deferred cleanup flushes buffered events on every path.
+func run() int {
 	// Parse flags
 	serverName := flag.String("server-name", "", "Server name for events (required)")
+	policyReload := flag.Duration("policy-reload-interval", policy.DefaultReloadInterval, "Poll interval for SUB_POLICY_FILE changes")
+	callTimeout := flag.Duration("call-timeout", 0, "Upstream deadline per tools/call; 0 disables (rules may set effect.timeout_ms)")
+	upstreamURL := flag.String("upstream-url", "", "Proxy this MCP Streamable HTTP endpoint instead of a stdio command")
+	listenAddr := flag.String("listen", "127.0.0.1:8931", "Listen address for --upstream-url mode")
+	ledgerAddr := flag.String("ledger-addr", os.Getenv("SUB_LEDGER_ADDR"), "Also send events to a `sub ledgerd --listen` socket (unix:///path)")
+	stateDir := flag.String("state-dir", os.Getenv(policy.StateEnvDir), "Persist enforcement state per run_id in this directory")
+	coordAddr := flag.String("coordinator-addr", os.Getenv(coord.EnvAddr), "Share policy state with every shim of the run via a `sub ledgerd --coordinator` socket; overrides --state-dir")
+	toolsList := flag.String("tools-list", mcpstdio.ToolsListPassthrough, "Rewrite tools/list responses in stdio mode: passthrough, hide or annotate policy-denied tools")
+	upstreamStderr := flag.String("upstream-stderr", mcpstdio.UpstreamStderrEvent, "Surface upstream stderr lines as upstream_log events (event) or prefixed on the shim's stderr (passthrough)")
+	restartUpstream := flag.Bool("restart-upstream", false, "Restart a crashed stdio upstream with backoff, replaying the initialize handshake")
+	restartMax := flag.Int("restart-max", mcpstdio.DefaultRestartPolicy.MaxRestarts, "Give up after this many restarts within --restart-window")
+	restartWindow := flag.Duration("restart-window", mcpstdio.DefaultRestartPolicy.Window, "Crash-loop window for --restart-max")
+	limitMemory := flag.String("limit-memory", "", "Cap the stdio upstream's address space, e.g. 512M or 2G")
+	limitCPU := flag.Duration("limit-cpu", 0, "Cap the stdio upstream's CPU time (whole seconds); 0 disables")
+	limitFiles := flag.Uint64("limit-files", 0, "Cap the stdio upstream's open file descriptors; 0 disables")
+	limitProcs := flag.Uint64("limit-procs", 0, "Cap processes (per user as an rlimit, per upstream in a cgroup); 0 disables")
+	useCgroup := flag.Bool("cgroup", false, "Also confine the stdio upstream to a cgroup v2 subtree when one is writable")
 	flag.Parse()
 
 	// Validate required flags
 	if *serverName == "" {
 		fmt.Fprintln(os.Stderr, "Error: --server-name is required")
 		flag.Usage()
-		os.Exit(1)
+		return 1
+	}
+
+	if *upstreamURL != "" {
+		if name := stdioOnlyFlag(); name != "" {
+			fmt.Fprintf(os.Stderr, "Error: --%s applies to stdio upstreams only and cannot be used with --upstream-url\n", name)
+			return 1
+		}
+	}
+
+	listMode, err := mcpstdio.ParseToolsListMode(*toolsList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --tools-list: %v\n", err)
+		return 1
+	}
+	stderrMode, err := mcpstdio.ParseUpstreamStderrMode(*upstreamStderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --upstream-stderr: %v\n", err)
+		return 1
+	}
+
+	limits := mcpstdio.Limits{
+		CPU:       *limitCPU,
+		OpenFiles: *limitFiles,
+		Processes: *limitProcs,
+		Cgroup:    *useCgroup,
+	}
+	if *limitMemory != "" {
+		if limits.MemoryBytes, err = mcpstdio.ParseByteSize(*limitMemory); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --limit-memory: %v\n", err)
+			return 1
+		}
+	}
+	if *limitCPU < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --limit-cpu must not be negative")
+		return 1
+	}
+
+	events, closeEvents, err := eventWriter(*ledgerAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --ledger-addr: %v\n", err)
+		return 1
+	}
+	defer closeEvents()
+
+	if *upstreamURL != "" {
+		return runHTTP(*serverName, *upstreamURL, *listenAddr, *policyReload, stateConfig{dir: *stateDir, coordinator: *coordAddr}, events)
 	}
 
 	// Get upstream command (everything after --)
@@ -55,15 +165,21 @@ func main() {
 	if len(upstreamArgs) == 0 {
 		fmt.Fprintln(os.Stderr, "Error: upstream command is required after --")
 		fmt.Fprintln(os.Stderr, "Usage: shim --server-name=<name> -- <command> [args...]")
-		os.Exit(1)
+		return 1
 	}
 
 	// Initialize identity from environment
 	identity := core.ReadIdentityFromEnv()
 	source := core.GenerateSource()
 
-	// Create emitter (writes to stderr)
-	emitter := core.NewEmitter(os.Stderr)
+	stateStore, err := openStateStore(stateConfig{dir: *stateDir, coordinator: *coordAddr}, identity.RunID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Create emitter (writes to stderr, plus ledgerd if configured)
+	emitter := core.NewEmitter(events)
 	emitter.Start()
 	defer emitter.Close()
 
@@ -97,21 +213,33 @@ func main() {
 		}
 	}
 
-	redactor := mcpstdio.NewRedactor(redactValues)
+	redactor := core.NewRedactor(redactValues)
 
 	// Start upstream process
 	upstream := mcpstdio.NewUpstreamProcess(upstreamArgs[0], upstreamArgs[1:])
 	if len(injectEnv) > 0 {
 		upstream.SetEnv(injectEnv)
 	}
+	if *restartUpstream {
+		upstream.SetRestartPolicy(mcpstdio.RestartPolicy{
+			MaxRestarts: *restartMax,
+			Window:      *restartWindow,
+		})
+	}
+	if !limits.IsZero() {
+		if err := upstream.SetLimits(limits); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: upstream limits: %v\n", err)
+		}
+	}
 	if err := upstream.Start(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error starting upstream: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
 
 	// Set up signal handling
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	watchParent()
 
 	// Create proxy
 	proxy := mcpstdio.NewProxy(
@@ -125,14 +253,31 @@ func main() {
 		redactor,
 		secretEvents,
 	)
+	if path := policy.FilePathFromEnv(); path != "" {
+		proxy.WatchPolicyFile(path, *policyReload)
+	}
+	if stateStore != nil {
+		proxy.SetStateStore(stateStore)
+	}
+	proxy.SetCallTimeout(*callTimeout)
+	proxy.SetToolsListMode(listMode)
+	proxy.SetUpstreamStderr(stderrMode, os.Stderr)
 
 	// Handle signals in background
 	go func() {
 		sig := <-sigCh
+		// Stop proxy first, so run_end reports CANCELLED rather than the
+		// upstream exit the signal causes
+		proxy.Cancel()
 		// Forward signal to upstream
 		upstream.Signal(sig)
-		// Stop proxy
-		proxy.Stop()
+		// An upstream that ignores it, or children it left, must not
+		// outlive the shim
+		select {
+		case <-upstream.Exited():
+		case <-time.After(upstreamStopGrace):
+		}
+		upstream.Stop(upstreamStopGrace)
 	}()
 
 	// Run proxy (blocks until stdin EOF or signal)
@@ -141,5 +286,46 @@ func main() {
 	}
 
 	// Clean shutdown
-	upstream.Stop(5 * time.Second)
+	upstream.Stop(upstreamStopGrace)
+	upstream.Release()
+	return 0
+}
+
+// eventWriter returns the event destination: stderr, teed to a ledgerd
+// socket when addr is set. Call the returned func after the emitter closes.
+func eventWriter(addr string) (io.Writer, func(), error) {
+	if addr == "" {
+		return os.Stderr, func() {}, nil
+	}
+	sink, err := core.NewSocketSink(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.MultiWriter(os.Stderr, sink), func() { sink.Close() }, nil
+}
+
+// stateConfig selects where enforcement state lives beyond this process.
+type stateConfig struct {
+	dir         string // --state-dir
+	coordinator string // --coordinator-addr; takes precedence
+}
+
+// openStateStore returns the state store for runID, or nil when neither a
+// coordinator nor a state dir is configured.
+func openStateStore(cfg stateConfig, runID string) (policy.StateStore, error) {
+	if cfg.coordinator != "" {
+		client, err := coord.NewClient(cfg.coordinator, runID)
+		if err != nil {
+			return nil, fmt.Errorf("--coordinator-addr: %w", err)
+		}
+		return client, nil
+	}
+	if cfg.dir == "" {
+		return nil, nil
+	}
+	store, err := policy.NewFileStateStore(cfg.dir, runID)
+	if err != nil {
+		return nil, fmt.Errorf("--state-dir: %w", err)
+	}
+	return store, nil
 }
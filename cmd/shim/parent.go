@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// parentPollInterval is how often the watchdog checks the parent PID.
+	parentPollInterval = time.Second
+
+	// parentDeathSignal is what the kernel sends when the parent exits. It
+	// also comes when only the thread that started the shim exits, so it
+	// just triggers a parent PID check.
+	parentDeathSignal = syscall.SIGUSR2
+)
+
+var (
+	// parentPID is the agent client that started the shim.
+	parentPID int
+
+	// getppid reads the current parent PID; tests replace it.
+	getppid = os.Getppid
+
+	// parentDied receives parentDeathSignal from the start, so one sent
+	// before watchParent runs is not lost.
+	parentDied = make(chan os.Signal, 1)
+)
+
+// trackParent records the shim's parent and asks the kernel for
+// parentDeathSignal when it exits (Linux). Call it first in main: a parent
+// that dies before the PID is read goes unnoticed, as the shim already
+// looks reparented.
+func trackParent() {
+	parentPID = getppid()
+	signal.Notify(parentDied, parentDeathSignal)
+	setParentDeathSignal(parentDeathSignal)
+}
+
+// parentGone reports whether the shim has been reparented, to init or to
+// a subreaper. A parent that is PID 1 from the start, such as a container's
+// init or systemd, is a live parent.
+func parentGone() bool {
+	return getppid() != parentPID
+}
+
+// watchParent makes the shim shut down as on SIGTERM once the agent client
+// that started it dies, even if something still holds its stdin open: the
+// kernel signals the shim where it can (Linux), and a watchdog notices the
+// shim being reparented. Call it once SIGTERM is handled.
+func watchParent() {
+	go func() {
+		ticker := time.NewTicker(parentPollInterval)
+		defer ticker.Stop()
+		for !parentGone() {
+			select {
+			case <-parentDied:
+			case <-ticker.C:
+			}
+		}
+		if self, err := os.FindProcess(os.Getpid()); err == nil {
+			self.Signal(syscall.SIGTERM)
+		}
+	}()
+}
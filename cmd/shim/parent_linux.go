@@ -0,0 +1,12 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// setParentDeathSignal asks the kernel for sig when the parent exits
+// (PR_SET_PDEATHSIG). A parent that died before this call is left to the
+// watchdog.
+func setParentDeathSignal(sig syscall.Signal) {
+	syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_PDEATHSIG, uintptr(sig), 0)
+}
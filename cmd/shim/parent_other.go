@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+import "syscall"
+
+// Parent-death signals are Linux only; the watchdog covers other systems.
+func setParentDeathSignal(sig syscall.Signal) {}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestParentGone(t *testing.T) {
+	defer func(pid int, get func() int) { parentPID, getppid = pid, get }(parentPID, getppid)
+
+	tests := []struct {
+		name     string
+		recorded int
+		current  int
+		gone     bool
+	}{
+		{"same parent", 4242, 4242, false},
+		{"started by init", 1, 1, false},
+		{"reparented to init", 4242, 1, true},
+		{"reparented to a subreaper", 4242, 77, true},
+	}
+	for _, tt := range tests {
+		current := tt.current
+		getppid = func() int { return current }
+		parentPID = tt.recorded
+		if got := parentGone(); got != tt.gone {
+			t.Errorf("%s: parentGone() = %v, want %v", tt.name, got, tt.gone)
+		}
+	}
+}
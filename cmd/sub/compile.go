@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+const policyCompileUsage = "Usage: sub policy compile -o FILE [--sign] [--key NAME|PATH] <bundle>"
+
+// runPolicyCompile lints a bundle, expands its defaults and writes the
+// canonical snapshot the shim loads as-is, optionally with a detached
+// signature next to it. The printed policy_hash is the one every event of a
+// shim running the snapshot carries.
+func runPolicyCompile(args []string) int {
+	flags := flag.NewFlagSet("policy compile", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	out := flags.String("o", "", "Snapshot output file")
+	sign := flags.Bool("sign", false, "Write a detached signature to <file>.sig")
+	keyRef := flags.String("key", defaultKeyName, "Signing key name or .key path")
+	jsonOnly := flags.Bool("json", false, "Output JSON only")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || *out == "" {
+		fmt.Fprintln(os.Stderr, policyCompileUsage)
+		return 2
+	}
+
+	spec, err := policy.LoadBundleFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compile error: %v\n", err)
+		return 1
+	}
+	issues := policy.LintBundle(spec)
+	if hasLintError(issues) {
+		if *jsonOnly {
+			emitJSON(issues)
+		} else {
+			printLintIssues(issues)
+		}
+		fmt.Fprintln(os.Stderr, "compile error: bundle has lint errors")
+		return 1
+	}
+	compiled, err := policy.CompileBundle(policy.ExpandDefaults(spec))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compile error: %v\n", err)
+		return 1
+	}
+
+	// A signing key that cannot load must not leave an unsigned snapshot.
+	var key ed25519.PrivateKey
+	if *sign {
+		if key, err = loadSigningKey(*keyRef); err != nil {
+			fmt.Fprintf(os.Stderr, "compile error: %v\n", err)
+			return 1
+		}
+	}
+	if err := os.WriteFile(*out, append(compiled.Snapshot, '\n'), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "compile error: %v\n", err)
+		return 1
+	}
+	// Remove a signature left from an earlier compile so it cannot vouch for
+	// different content.
+	if err := os.Remove(policy.SignaturePath(*out)); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "compile error: %v\n", err)
+		return 1
+	}
+
+	output := compileOutput{Policy: compiled.Bundle.Info, Snapshot: *out, Issues: issues}
+	if key != nil {
+		sig, err := policy.SignFile(*out, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "compile error: %v\n", err)
+			return 1
+		}
+		output.Signature = policy.SignaturePath(*out)
+		output.KeyID = sig.KeyID
+	}
+
+	if *jsonOnly {
+		return emitJSON(output)
+	}
+	printLintIssues(issues)
+	fmt.Fprintf(os.Stderr, "Wrote %s (policy %s@%s, hash %s)\n",
+		output.Snapshot, output.Policy.PolicyID, output.Policy.PolicyVersion, output.Policy.PolicyHash)
+	if output.Signature != "" {
+		fmt.Fprintf(os.Stderr, "Signed %s with key %s\n", output.Signature, output.KeyID)
+	}
+	return 0
+}
+
+type compileOutput struct {
+	Policy    event.PolicyInfo   `json:"policy"`
+	Snapshot  string             `json:"snapshot"`
+	Signature string             `json:"signature,omitempty"`
+	KeyID     string             `json:"key_id,omitempty"`
+	Issues    []policy.LintIssue `json:"issues,omitempty"` // Lint warnings; errors stop the compile
+}
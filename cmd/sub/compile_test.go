@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+func TestRunPolicyCompile(t *testing.T) {
+	dir := t.TempDir()
+	bundlePath := filepath.Join(dir, "bundle.yaml")
+	os.WriteFile(bundlePath, []byte(`policy_id: ci
+version: "1"
+mode: guardrails
+rules:
+  - rule_id: no-drop
+    kind: deny
+    match:
+      tool_name:
+        glob: ["drop"]
+`), 0o644)
+	out := filepath.Join(dir, "snapshot.json")
+
+	if code := runPolicyCompile([]string{"-o", out, bundlePath}); code != 0 {
+		t.Fatalf("compile exited %d", code)
+	}
+	spec, err := policy.LoadBundleFile(bundlePath)
+	if err != nil {
+		t.Fatalf("LoadBundleFile: %v", err)
+	}
+	want, err := policy.CompileBundle(policy.ExpandDefaults(spec))
+	if err != nil {
+		t.Fatalf("CompileBundle: %v", err)
+	}
+	loaded, err := policy.LoadFile(out)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if loaded.Info.PolicyHash != want.Hash {
+		t.Fatalf("expected the shim to load the pinned hash %s, got %s", want.Hash, loaded.Info.PolicyHash)
+	}
+
+	// Lint errors stop the compile and leave no snapshot behind.
+	os.WriteFile(bundlePath, []byte("mode: guardrails\nrules: []\n"), 0o644)
+	broken := filepath.Join(dir, "broken.json")
+	if code := runPolicyCompile([]string{"-o", broken, bundlePath}); code != 1 {
+		t.Fatalf("expected exit 1 for a bundle with lint errors, got %d", code)
+	}
+	if _, err := os.Stat(broken); !os.IsNotExist(err) {
+		t.Fatalf("expected no snapshot for a failed compile, got %v", err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+
+	"github.com/peakyragnar/subluminal/pkg/ledger"
 )
 
 func runDoctor(args []string) int {
@@ -30,12 +32,12 @@ func runDoctor(args []string) int {
 	}
 
 	ok := true
-	sqlitePath, err := exec.LookPath("sqlite3")
-	if err != nil {
-		fmt.Fprintln(os.Stdout, "sqlite3: missing")
-		ok = false
+
+	// The ledger uses an embedded driver; the CLI is only for manual inspection.
+	if sqlitePath, err := exec.LookPath("sqlite3"); err != nil {
+		fmt.Fprintln(os.Stdout, "sqlite3 cli: not found (optional)")
 	} else {
-		fmt.Fprintf(os.Stdout, "sqlite3: %s\n", sqlitePath)
+		fmt.Fprintf(os.Stdout, "sqlite3 cli: %s\n", sqlitePath)
 	}
 
 	if info, err := os.Stat(dbPath); err != nil {
@@ -51,6 +53,12 @@ func runDoctor(args []string) int {
 		ok = false
 	} else {
 		fmt.Fprintf(os.Stdout, "ledger db: %s\n", dbPath)
+		if err := checkLedger(dbPath); err != nil {
+			fmt.Fprintf(os.Stdout, "ledger schema: %v\n", err)
+			ok = false
+		} else {
+			fmt.Fprintln(os.Stdout, "ledger schema: ok")
+		}
 	}
 
 	if ok {
@@ -60,3 +68,14 @@ func runDoctor(args []string) int {
 	fmt.Fprintln(os.Stdout, "doctor: issues found")
 	return 1
 }
+
+// checkLedger opens the ledger read-only and runs a trivial query.
+func checkLedger(dbPath string) error {
+	store, err := ledger.OpenReadOnly(dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	_, err = store.ToolCalls(ledger.ToolCallQuery{Limit: 1})
+	return err
+}
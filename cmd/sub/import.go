@@ -1,25 +1,85 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/peakyragnar/subluminal/pkg/adapter/mcpstdio"
 	"github.com/peakyragnar/subluminal/pkg/importer"
 )
 
+const importUsage = "Usage: sub import [--limit-memory SIZE] [--limit-cpu DUR] [--limit-files N] [--limit-procs N] [--cgroup] [--servers a,b] <claude|codex>"
+
 func runImport(args []string) int {
-	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "Usage: sub import <claude|codex>")
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	limitMemory := flags.String("limit-memory", "", "Cap each upstream's address space, e.g. 512M or 2G")
+	limitCPU := flags.Duration("limit-cpu", 0, "Cap each upstream's CPU time")
+	limitFiles := flags.Uint64("limit-files", 0, "Cap each upstream's open file descriptors")
+	limitProcs := flags.Uint64("limit-procs", 0, "Cap processes")
+	useCgroup := flags.Bool("cgroup", false, "Also confine each upstream to a cgroup v2 subtree when one is writable")
+	servers := flags.String("servers", "", "Comma-separated servers the limits apply to (default all)")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, importUsage)
 		return 2
 	}
 
-	client, err := importer.ParseClient(args[0])
+	client, err := importer.ParseClient(flags.Arg(0))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 2
 	}
 
-	result, err := importer.Import(importer.Options{Client: client})
+	// Limits become shim flags in each server's args, so the shim validates
+	// them again at start; catch typos here instead
+	var shimArgs []string
+	if *limitMemory != "" {
+		if _, err := mcpstdio.ParseByteSize(*limitMemory); err != nil {
+			fmt.Fprintf(os.Stderr, "import error: --limit-memory: %v\n", err)
+			return 2
+		}
+		shimArgs = append(shimArgs, "--limit-memory="+*limitMemory)
+	}
+	if *limitCPU < 0 {
+		fmt.Fprintln(os.Stderr, "import error: --limit-cpu must not be negative")
+		return 2
+	}
+	if *limitCPU > 0 {
+		shimArgs = append(shimArgs, "--limit-cpu="+limitCPU.String())
+	}
+	if *limitFiles > 0 {
+		shimArgs = append(shimArgs, fmt.Sprintf("--limit-files=%d", *limitFiles))
+	}
+	if *limitProcs > 0 {
+		shimArgs = append(shimArgs, fmt.Sprintf("--limit-procs=%d", *limitProcs))
+	}
+	if *useCgroup {
+		shimArgs = append(shimArgs, "--cgroup")
+	}
+	var shimArgsServers []string
+	if *servers != "" {
+		if len(shimArgs) == 0 {
+			fmt.Fprintln(os.Stderr, "import error: --servers needs a --limit-* or --cgroup flag")
+			return 2
+		}
+		for _, name := range strings.Split(*servers, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				shimArgsServers = append(shimArgsServers, name)
+			}
+		}
+	}
+
+	result, err := importer.Import(importer.Options{
+		Client:          client,
+		ShimArgs:        shimArgs,
+		ShimArgsServers: shimArgsServers,
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
 		return 1
@@ -3,8 +3,13 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/peakyragnar/subluminal/pkg/coord"
+	"github.com/peakyragnar/subluminal/pkg/core"
 	"github.com/peakyragnar/subluminal/pkg/ledger"
 )
 
@@ -12,6 +17,12 @@ func runLedgerd(args []string) int {
 	flags := flag.NewFlagSet("ledgerd", flag.ContinueOnError)
 	flags.SetOutput(os.Stderr)
 	dbPath := flags.String("db", "", "Path to SQLite ledger database")
+	listen := flags.String("listen", "", "Serve shims on a unix socket (unix:///path/to/ledgerd.sock) instead of reading stdin")
+	batchSize := flags.Int("batch-size", ledger.DefaultBatchSize, "Max events per transaction")
+	flushInterval := flags.Duration("flush-interval", ledger.DefaultFlushInterval, "Max wait before committing a partial batch")
+	queueSize := flags.Int("queue-size", ledger.DefaultQueueSize, "Max buffered events before backpressure")
+	coordAddr := flags.String("coordinator", "", "Also serve run-wide policy state to shims on this unix socket (unix:///path/to/coord.sock)")
+	stateDir := flags.String("state-dir", "", "Persist coordinator state per run_id in this directory (default: memory)")
 
 	if err := flags.Parse(args); err != nil {
 		return 2
@@ -21,10 +32,133 @@ func runLedgerd(args []string) int {
 		flags.Usage()
 		return 2
 	}
+	if *coordAddr != "" && *listen == "" {
+		fmt.Fprintln(os.Stderr, "Error: --coordinator requires --listen")
+		return 2
+	}
+
+	store, err := ledger.Open(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ledgerd error: %v\n", err)
+		return 1
+	}
+	defer store.Close()
 
-	if err := ledger.IngestJSONL(os.Stdin, *dbPath); err != nil {
+	server := ledger.NewServer(store, ledger.ServerOptions{
+		BatchSize:     *batchSize,
+		FlushInterval: *flushInterval,
+		QueueSize:     *queueSize,
+		NoDrop:        *listen == "", // stdin can wait for the writer
+	})
+
+	if *listen == "" {
+		err := server.ServeReader(os.Stdin)
+		server.Close()
+		stats := server.Stats()
+		if stats.Malformed > 0 || stats.EventsDropped > 0 || stats.Failed > 0 {
+			reportLedgerdStats(stats)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ledgerd error: %v\n", err)
+			return 1
+		}
+		if stats.Failed > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	ln, err := listenLedgerd(*listen)
+	if err != nil {
+		server.Close()
 		fmt.Fprintf(os.Stderr, "ledgerd error: %v\n", err)
 		return 1
 	}
+
+	var coordinator *coord.Server
+	if *coordAddr != "" {
+		coordLn, err := listenLedgerd(*coordAddr)
+		if err != nil {
+			ln.Close()
+			server.Close()
+			fmt.Fprintf(os.Stderr, "ledgerd error: --coordinator: %v\n", err)
+			return 1
+		}
+		opener := coord.MemoryStores()
+		if *stateDir != "" {
+			dir, err := expandPath(*stateDir)
+			if err != nil {
+				coordLn.Close()
+				ln.Close()
+				server.Close()
+				fmt.Fprintf(os.Stderr, "ledgerd error: --state-dir: %v\n", err)
+				return 1
+			}
+			opener = coord.FileStores(dir)
+		}
+		coordinator = coord.NewServer(opener)
+		go coordinator.Serve(coordLn)
+		defer coordinator.Close()
+		fmt.Fprintf(os.Stderr, "ledgerd: coordinating run state on %s\n", *coordAddr)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		<-sigCh
+		if coordinator != nil {
+			coordinator.Close()
+		}
+		server.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "ledgerd: listening on %s\n", *listen)
+	serveErr := server.Serve(ln)
+	server.Close()
+	reportLedgerdStats(server.Stats())
+	if serveErr != nil {
+		fmt.Fprintf(os.Stderr, "ledgerd error: %v\n", serveErr)
+		return 1
+	}
 	return 0
 }
+
+// listenLedgerd binds the unix socket, replacing a stale socket file left
+// by a previous daemon but refusing to steal a live one.
+func listenLedgerd(addr string) (net.Listener, error) {
+	network, path, err := core.ParseSocketAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial(network, path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another ledgerd is listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+
+	// Events carry previews; keep the socket private to this user from the
+	// moment it exists, and chmod in case the umask had no effect.
+	var ln net.Listener
+	err = withPrivateUmask(func() (err error) {
+		ln, err = net.Listen(network, path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+	return ln, nil
+}
+
+func reportLedgerdStats(stats ledger.ServerStats) {
+	fmt.Fprintf(os.Stderr, "ledgerd: committed=%d malformed=%d previews_dropped=%d events_dropped=%d failed=%d\n",
+		stats.Committed, stats.Malformed, stats.PreviewsDropped, stats.EventsDropped, stats.Failed)
+}
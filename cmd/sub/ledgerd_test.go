@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenLedgerdSocketIsPrivate(t *testing.T) {
+	dir := t.TempDir()
+	before := filepath.Join(dir, "before")
+	if err := os.WriteFile(before, nil, 0o666); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	path := filepath.Join(dir, "ledgerd.sock")
+	ln, err := listenLedgerd("unix://" + path)
+	if err != nil {
+		t.Fatalf("listenLedgerd: %v", err)
+	}
+	defer ln.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("expected socket mode 0600, got %#o", perm)
+	}
+
+	// The private umask applies to the socket only
+	after := filepath.Join(dir, "after")
+	if err := os.WriteFile(after, nil, 0o666); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	beforeInfo, _ := os.Stat(before)
+	afterInfo, _ := os.Stat(after)
+	if beforeInfo.Mode().Perm() != afterInfo.Mode().Perm() {
+		t.Fatalf("umask not restored: file mode %#o before listen, %#o after", beforeInfo.Mode().Perm(), afterInfo.Mode().Perm())
+	}
+}
@@ -25,6 +25,18 @@ func runPolicy(args []string) int {
 		return runPolicyDiff(args[1:])
 	case "explain":
 		return runPolicyExplain(args[1:])
+	case "promote":
+		return runPolicyPromote(args[1:])
+	case "simulate":
+		return runPolicySimulate(args[1:])
+	case "test":
+		return runPolicyTest(args[1:])
+	case "compile":
+		return runPolicyCompile(args[1:])
+	case "keygen":
+		return runPolicyKeygen(args[1:])
+	case "sign":
+		return runPolicySign(args[1:])
 	case "-h", "--help", "help":
 		policyUsage()
 		return 0
@@ -36,11 +48,17 @@ func runPolicy(args []string) int {
 }
 
 func policyUsage() {
-	fmt.Fprintln(os.Stderr, "Usage: sub policy <lint|diff|explain> [options]")
+	fmt.Fprintln(os.Stderr, "Usage: sub policy <lint|diff|explain|promote|simulate|test|compile|keygen|sign> [options]")
 	fmt.Fprintln(os.Stderr, "Commands:")
 	fmt.Fprintln(os.Stderr, "  lint <bundle>")
 	fmt.Fprintln(os.Stderr, "  diff <old> <new>")
-	fmt.Fprintln(os.Stderr, "  explain <bundle> --server NAME --tool NAME [--args JSON]")
+	fmt.Fprintln(os.Stderr, "  explain <bundle|layer set> --server NAME --tool NAME [--args JSON]")
+	fmt.Fprintln(os.Stderr, "  promote --call ID [--any-args] [--bundle FILE --out FILE]")
+	fmt.Fprintln(os.Stderr, "  simulate <bundle> (--run ID | --since TIME)")
+	fmt.Fprintln(os.Stderr, "  test <bundle> <cases>")
+	fmt.Fprintln(os.Stderr, "  compile -o FILE [--sign] [--key NAME|PATH] <bundle>")
+	fmt.Fprintln(os.Stderr, "  keygen [--name NAME] [--dir DIR]")
+	fmt.Fprintln(os.Stderr, "  sign [--key NAME|PATH] <file>...")
 }
 
 func runPolicyLint(args []string) int {
@@ -67,21 +85,30 @@ func runPolicyLint(args []string) int {
 		return emitJSON(issues)
 	}
 
-	hasError := false
 	if len(issues) == 0 {
 		fmt.Fprintln(os.Stderr, "OK: no issues found")
 		return 0
 	}
+	printLintIssues(issues)
+	if hasLintError(issues) {
+		return 1
+	}
+	return 0
+}
+
+func printLintIssues(issues []policy.LintIssue) {
 	for _, issue := range issues {
-		if issue.Level == "error" {
-			hasError = true
-		}
 		fmt.Fprintf(os.Stderr, "%s: %s (%s)\n", issue.Level, issue.Message, issue.Field)
 	}
-	if hasError {
-		return 1
+}
+
+func hasLintError(issues []policy.LintIssue) bool {
+	for _, issue := range issues {
+		if issue.Level == "error" {
+			return true
+		}
 	}
-	return 0
+	return false
 }
 
 func runPolicyDiff(args []string) int {
@@ -140,17 +167,11 @@ func runPolicyExplain(args []string) int {
 		return 2
 	}
 	if flags.NArg() != 1 || *serverName == "" || *toolName == "" {
-		fmt.Fprintln(os.Stderr, "Usage: sub policy explain <bundle> --server NAME --tool NAME [--args JSON]")
+		fmt.Fprintln(os.Stderr, "Usage: sub policy explain <bundle|layer set> --server NAME --tool NAME [--args JSON]")
 		return 2
 	}
 
-	spec, err := policy.LoadBundleFile(flags.Arg(0))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "explain error: %v\n", err)
-		return 1
-	}
-
-	compiled, err := policy.CompileBundle(spec)
+	bundle, err := policy.LoadFile(flags.Arg(0))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "explain error: %v\n", err)
 		return 1
@@ -186,7 +207,7 @@ func runPolicyExplain(args []string) int {
 		Workload: workload,
 	}
 
-	decision := compiled.Bundle.DecideWithContext(policy.DecisionContext{
+	decision := bundle.DecideWithContext(policy.DecisionContext{
 		ServerName: *serverName,
 		ToolName:   *toolName,
 		ArgsHash:   argsHash,
@@ -208,8 +229,11 @@ func runPolicyExplain(args []string) int {
 			Severity:   decision.Severity,
 			BackoffMS:  decision.BackoffMS,
 			Hint:       decision.Hint,
+			Budgets:    decision.Budgets,
+			Layer:      decision.Layer,
 		},
-		Policy: compiled.Bundle.Info,
+		Policy: bundle.Info,
+		Layers: explainLayers(decision.Layers),
 	}
 
 	if !*jsonOnly {
@@ -217,7 +241,28 @@ func runPolicyExplain(args []string) int {
 		if decision.RuleID != nil {
 			fmt.Fprintf(os.Stderr, "Rule: %s\n", *decision.RuleID)
 		}
+		if decision.Layer != nil {
+			fmt.Fprintf(os.Stderr, "Layer: %s (policy_hash %s)\n", decision.Layer.Name, decision.Layer.PolicyHash)
+		}
 		fmt.Fprintf(os.Stderr, "Reason: %s\n", decision.ReasonCode)
+		for _, budget := range decision.Budgets {
+			name := budget.RuleID
+			if budget.Layer != "" {
+				name = budget.Layer + "/" + budget.RuleID
+			}
+			fmt.Fprintf(os.Stderr, "Budget %s: %d/%d %s used, %d remaining\n",
+				name, budget.Used, budget.Limit, budget.Unit, budget.Remaining)
+		}
+		if len(output.Layers) > 0 {
+			fmt.Fprintln(os.Stderr, "Layers (lowest precedence first):")
+			for _, l := range output.Layers {
+				rule := ""
+				if l.RuleID != nil {
+					rule = " (" + *l.RuleID + ")"
+				}
+				fmt.Fprintf(os.Stderr, "- %s [%s, %s]: %s%s %s\n", l.Name, l.Mode, l.Status, l.Action, rule, l.ReasonCode)
+			}
+		}
 	}
 
 	return emitJSON(output)
@@ -237,12 +282,40 @@ type decisionOutput struct {
 	Severity   event.Severity       `json:"severity"`
 	BackoffMS  int                  `json:"backoff_ms,omitempty"`
 	Hint       *event.Hint          `json:"hint,omitempty"`
+	Budgets    []event.BudgetUsage  `json:"budgets,omitempty"`
+	Layer      *event.LayerInfo     `json:"layer,omitempty"`
+}
+
+// explainLayer is how one layer of a layer set decided the call.
+type explainLayer struct {
+	event.LayerInfo
+	Mode       event.RunMode        `json:"mode"`
+	Status     string               `json:"status"`
+	Action     event.DecisionAction `json:"action"`
+	RuleID     *string              `json:"rule_id,omitempty"`
+	ReasonCode string               `json:"reason_code"`
 }
 
 type explainOutput struct {
 	Input    explainInput     `json:"input"`
 	Decision decisionOutput   `json:"decision"`
 	Policy   event.PolicyInfo `json:"policy"`
+	Layers   []explainLayer   `json:"layers,omitempty"`
+}
+
+func explainLayers(results []policy.LayerResult) []explainLayer {
+	var layers []explainLayer
+	for _, result := range results {
+		layers = append(layers, explainLayer{
+			LayerInfo:  result.Layer,
+			Mode:       result.Mode,
+			Status:     result.Status,
+			Action:     result.Decision.Action,
+			RuleID:     result.Decision.RuleID,
+			ReasonCode: result.Decision.ReasonCode,
+		})
+	}
+	return layers
 }
 
 func emitJSON(value any) int {
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+const policyTestUsage = "Usage: sub policy test <bundle> <cases>"
+
+// runPolicyTest runs a case file against a bundle and reports failing cases
+// the way `go test` does. It exits 1 if any case fails.
+func runPolicyTest(args []string) int {
+	flags := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	verbose := flags.Bool("v", false, "Also list passing cases")
+	jsonOnly := flags.Bool("json", false, "Output JSON only")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, policyTestUsage)
+		return 2
+	}
+
+	spec, err := policy.LoadBundleFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "test error: %v\n", err)
+		return 1
+	}
+	data, err := os.ReadFile(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "test error: read cases: %v\n", err)
+		return 1
+	}
+	file, err := policy.ParseTestFile(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "test error: %s: %v\n", flags.Arg(1), err)
+		return 1
+	}
+
+	report, err := policy.RunTests(spec, file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "test error: %v\n", err)
+		return 1
+	}
+
+	if *jsonOnly {
+		if code := emitJSON(report); code != 0 {
+			return code
+		}
+	} else {
+		printTestReport(os.Stderr, report, *verbose)
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printTestReport(w io.Writer, report policy.TestReport, verbose bool) {
+	for _, result := range report.Results {
+		if result.Passed {
+			if verbose {
+				fmt.Fprintf(w, "--- PASS: %s\n", result.Name)
+			}
+			continue
+		}
+		fmt.Fprintf(w, "--- FAIL: %s\n", result.Name)
+		for _, failure := range result.Failures {
+			fmt.Fprintf(w, "    call %d: %s: got %q, want %q\n", failure.Call, failure.Field, failure.Got, failure.Want)
+		}
+	}
+	if report.Failed > 0 {
+		fmt.Fprintf(w, "FAIL (%d of %d cases failed)\n", report.Failed, report.Passed+report.Failed)
+		return
+	}
+	fmt.Fprintf(w, "PASS (%d cases)\n", report.Passed)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+func TestPrintTestReport(t *testing.T) {
+	report := policy.TestReport{
+		Passed: 1,
+		Failed: 1,
+		Results: []policy.TestResult{
+			{Name: "allows reads", Passed: true},
+			{Name: "blocks drops", Failures: []policy.TestFailure{
+				{Call: 2, Field: "rule_id", Want: "no-drop", Got: ""},
+			}},
+		},
+	}
+
+	var quiet bytes.Buffer
+	printTestReport(&quiet, report, false)
+	want := "--- FAIL: blocks drops\n    call 2: rule_id: got \"\", want \"no-drop\"\nFAIL (1 of 2 cases failed)\n"
+	if quiet.String() != want {
+		t.Fatalf("unexpected output:\n%s", quiet.String())
+	}
+
+	var verbose bytes.Buffer
+	printTestReport(&verbose, report, true)
+	if !strings.HasPrefix(verbose.String(), "--- PASS: allows reads\n") {
+		t.Fatalf("expected -v to list passing cases, got:\n%s", verbose.String())
+	}
+}
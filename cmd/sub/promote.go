@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/canonical"
+	"github.com/peakyragnar/subluminal/pkg/coord"
+	"github.com/peakyragnar/subluminal/pkg/event"
+	"github.com/peakyragnar/subluminal/pkg/ledger"
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+const promoteUsage = "Usage: sub policy promote --call ID [--any-args] [--bundle FILE --out FILE]"
+
+// runPolicyPromote turns a blocked call from the ledger into an allow rule.
+// By default the rule is added to the call's run, where every shim of the
+// run picks it up on its next decision; with --bundle it is written into a
+// patched copy of the bundle for review with `sub policy diff`.
+func runPolicyPromote(args []string) int {
+	flags := flag.NewFlagSet("policy promote", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	callID := flags.String("call", "", "call_id of the blocked call")
+	dbPath := flags.String("db", "", "Path to SQLite ledger database")
+	anyArgs := flags.Bool("any-args", false, "Allow the tool with any args, not just the blocked call's")
+	bundlePath := flags.String("bundle", "", "Write a patched copy of this bundle instead of a session rule")
+	outPath := flags.String("out", "", "Where --bundle writes the patched bundle")
+	stateDir := flags.String("state-dir", os.Getenv(policy.StateEnvDir), "State dir of the running shims")
+	coordAddr := flags.String("coordinator-addr", os.Getenv(coord.EnvAddr), "Coordinator socket of the running shims; overrides --state-dir")
+	jsonOnly := flags.Bool("json", false, "Output JSON only")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 || strings.TrimSpace(*callID) == "" || (*bundlePath == "") != (*outPath == "") {
+		fmt.Fprintln(os.Stderr, promoteUsage)
+		return 2
+	}
+
+	resolved, err := resolveLedgerPath(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "promote error: %v\n", err)
+		return 1
+	}
+	store, err := ledger.OpenReadOnly(resolved)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "promote error: %v\n", err)
+		return 1
+	}
+	call, err := store.Call(*callID)
+	store.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "promote error: %v\n", err)
+		return 1
+	}
+
+	rule, err := promotedRule(call, *anyArgs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "promote error: %v\n", err)
+		return 1
+	}
+
+	output := promoteOutput{
+		Call: promotedCall{
+			CallID:     call.CallID,
+			RunID:      call.RunID,
+			ServerName: call.ServerName,
+			ToolName:   call.ToolName,
+			Decision:   call.Decision,
+			RuleID:     call.RuleID,
+		},
+		Hint: promoteHint(call),
+		Rule: rule,
+	}
+
+	if *bundlePath != "" {
+		if err := writePromotedBundle(*bundlePath, *outPath, rule); err != nil {
+			fmt.Fprintf(os.Stderr, "promote error: %v\n", err)
+			return 1
+		}
+		output.Scope = "bundle"
+		output.Bundle = *outPath
+	} else {
+		stateStore, err := openRunState(*stateDir, *coordAddr, call.RunID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "promote error: %v\n", err)
+			return 1
+		}
+		promotion := policy.Promotion{CallID: call.CallID, Rule: rule, CreatedAt: time.Now().UTC()}
+		if err := policy.AddPromotion(stateStore, promotion); err != nil {
+			fmt.Fprintf(os.Stderr, "promote error: %v\n", err)
+			return 1
+		}
+		output.Scope = "session"
+		output.RunID = call.RunID
+	}
+
+	if !*jsonOnly {
+		fmt.Fprintf(os.Stderr, "Promoted %s (%s on %s/%s) to rule %s\n",
+			call.CallID, call.Decision, call.ServerName, call.ToolName, rule.RuleID)
+		if output.Hint != nil && output.Hint.HintText != "" {
+			fmt.Fprintf(os.Stderr, "Hint was: %s\n", output.Hint.HintText)
+		}
+		if output.Scope == "bundle" {
+			fmt.Fprintf(os.Stderr, "Review with: sub policy diff %s %s\n", *bundlePath, *outPath)
+		} else {
+			fmt.Fprintf(os.Stderr, "Allowed for run %s\n", call.RunID)
+		}
+	}
+
+	return emitJSON(output)
+}
+
+// promotedRule builds the allow rule for a blocked call. Unless anyArgs is
+// set it pins the call's exact args, which must be complete in the ledger.
+func promotedRule(call ledger.CallDetail, anyArgs bool) (policy.Rule, error) {
+	switch event.DecisionAction(call.Decision) {
+	case event.DecisionBlock, event.DecisionRejectWithHint:
+	default:
+		return policy.Rule{}, fmt.Errorf("call %s was not blocked (decision %q)", call.CallID, call.Decision)
+	}
+	if call.ServerName == "" || call.ToolName == "" {
+		return policy.Rule{}, fmt.Errorf("call %s has no tool_call_start in the ledger", call.CallID)
+	}
+
+	ruleID := policy.PromotedRuleID(call.CallID)
+	if anyArgs {
+		return policy.PromoteRule(ruleID, call.ServerName, call.ToolName, nil), nil
+	}
+
+	args, complete := previewArgs(call)
+	if !complete {
+		return policy.Rule{}, fmt.Errorf("args of call %s are not fully in the ledger (preview missing, truncated or redacted); pass --any-args to allow any args", call.CallID)
+	}
+	return policy.PromoteRule(ruleID, call.ServerName, call.ToolName, args), nil
+}
+
+// previewArgs recovers a call's args from its preview. complete is false when
+// the preview is missing, truncated or redacted (it no longer hashes to the
+// recorded args_hash); args-based rules then see what is left.
+func previewArgs(call ledger.CallDetail) (map[string]any, bool) {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(call.ArgsPreview), &args); err != nil || args == nil {
+		return nil, false
+	}
+	if call.PreviewTruncated {
+		return args, false
+	}
+	hash, err := canonical.ArgsHash(args)
+	return args, err == nil && (call.ArgsHash == "" || hash == call.ArgsHash)
+}
+
+// promoteHint decodes the hint recorded with the call, if any.
+func promoteHint(call ledger.CallDetail) *promotedHint {
+	if call.HintText == "" && call.SuggestedArgsJSON == "" {
+		return nil
+	}
+	hint := &promotedHint{HintText: call.HintText}
+	if call.SuggestedArgsJSON != "" {
+		json.Unmarshal([]byte(call.SuggestedArgsJSON), &hint.SuggestedArgs)
+	}
+	return hint
+}
+
+// writePromotedBundle writes bundlePath with rule prepended to outPath as
+// JSON. The rule goes first so it wins over the rule that blocked the call.
+func writePromotedBundle(bundlePath, outPath string, rule policy.Rule) error {
+	spec, err := policy.LoadBundleFile(bundlePath)
+	if err != nil {
+		return err
+	}
+	for _, existing := range spec.Rules {
+		if existing.RuleID == rule.RuleID {
+			return fmt.Errorf("%s already has rule %s", bundlePath, rule.RuleID)
+		}
+	}
+	spec.Rules = append([]policy.Rule{rule}, spec.Rules...)
+	if _, err := policy.CompileBundle(spec); err != nil {
+		return err
+	}
+
+	payload, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode bundle: %w", err)
+	}
+	if err := os.WriteFile(outPath, append(payload, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+	return nil
+}
+
+// openRunState opens the state of runID the way the shim does
+// (see cmd/shim openStateStore).
+func openRunState(dir, coordAddr, runID string) (policy.StateStore, error) {
+	if strings.TrimSpace(runID) == "" {
+		return nil, errors.New("call has no run_id")
+	}
+	if coordAddr != "" {
+		client, err := coord.NewClient(coordAddr, runID)
+		if err != nil {
+			return nil, fmt.Errorf("--coordinator-addr: %w", err)
+		}
+		return client, nil
+	}
+	if dir == "" {
+		return nil, errors.New("session promotion needs the shims' --state-dir or --coordinator-addr (or use --bundle)")
+	}
+	dir, err := expandPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	store, err := policy.NewFileStateStore(dir, runID)
+	if err != nil {
+		return nil, fmt.Errorf("--state-dir: %w", err)
+	}
+	return store, nil
+}
+
+type promotedCall struct {
+	CallID     string `json:"call_id"`
+	RunID      string `json:"run_id"`
+	ServerName string `json:"server_name"`
+	ToolName   string `json:"tool_name"`
+	Decision   string `json:"decision"`
+	RuleID     string `json:"rule_id,omitempty"`
+}
+
+type promotedHint struct {
+	HintText      string         `json:"hint_text"`
+	SuggestedArgs map[string]any `json:"suggested_args,omitempty"`
+}
+
+type promoteOutput struct {
+	Call   promotedCall  `json:"call"`
+	Hint   *promotedHint `json:"hint,omitempty"`
+	Scope  string        `json:"scope"` // session or bundle
+	RunID  string        `json:"run_id,omitempty"`
+	Bundle string        `json:"bundle,omitempty"`
+	Rule   policy.Rule   `json:"rule"`
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/canonical"
+	"github.com/peakyragnar/subluminal/pkg/ledger"
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+func blockedCall(t *testing.T, preview string) ledger.CallDetail {
+	t.Helper()
+	call := ledger.CallDetail{
+		ToolCall: ledger.ToolCall{
+			CallID:     "call-1",
+			RunID:      "run-1",
+			ServerName: "git",
+			ToolName:   "push",
+			Decision:   "REJECT_WITH_HINT",
+		},
+		RuleID:      "no-push",
+		ArgsPreview: preview,
+	}
+	hash, err := canonical.ArgsHash(map[string]any{"branch": "main"})
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	call.ArgsHash = hash
+	return call
+}
+
+func TestPromotedRule(t *testing.T) {
+	rule, err := promotedRule(blockedCall(t, `{"branch":"main"}`), false)
+	if err != nil {
+		t.Fatalf("promotedRule: %v", err)
+	}
+	if rule.RuleID != "promoted-call-1" || rule.Match.Args == nil || rule.Match.Args.KeyEquals["branch"] != "main" {
+		t.Fatalf("unexpected rule: %+v", rule)
+	}
+
+	// A redacted preview no longer hashes to args_hash.
+	if _, err := promotedRule(blockedCall(t, `{"branch":"[REDACTED]"}`), false); err == nil || !strings.Contains(err.Error(), "--any-args") {
+		t.Fatalf("expected an args_hash mismatch error, got %v", err)
+	}
+	truncated := blockedCall(t, `{"branch":"main"}`)
+	truncated.PreviewTruncated = true
+	if _, err := promotedRule(truncated, false); err == nil {
+		t.Fatal("expected an error for a truncated preview")
+	}
+	if rule, err := promotedRule(truncated, true); err != nil || rule.Match.Args != nil || rule.When != "" {
+		t.Fatalf("expected an any-args rule, got %+v, %v", rule, err)
+	}
+
+	allowed := blockedCall(t, `{"branch":"main"}`)
+	allowed.Decision = "ALLOW"
+	if _, err := promotedRule(allowed, true); err == nil {
+		t.Fatal("expected an error for an allowed call")
+	}
+}
+
+func TestWritePromotedBundle(t *testing.T) {
+	dir := t.TempDir()
+	bundlePath := filepath.Join(dir, "policy.yaml")
+	bundle := `policy_id: promote
+version: "1"
+mode: control
+rules:
+  - rule_id: no-push
+    kind: deny
+    match:
+      tool_name:
+        glob: ["push"]
+`
+	if err := os.WriteFile(bundlePath, []byte(bundle), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	rule, err := promotedRule(blockedCall(t, `{"branch":"main"}`), false)
+	if err != nil {
+		t.Fatalf("promotedRule: %v", err)
+	}
+	outPath := filepath.Join(dir, "policy.promoted.json")
+	if err := writePromotedBundle(bundlePath, outPath, rule); err != nil {
+		t.Fatalf("writePromotedBundle: %v", err)
+	}
+	if err := writePromotedBundle(outPath, filepath.Join(dir, "again.json"), rule); err == nil {
+		t.Fatal("expected an error promoting the same call twice")
+	}
+
+	oldSpec, err := policy.LoadBundleFile(bundlePath)
+	if err != nil {
+		t.Fatalf("load old: %v", err)
+	}
+	newSpec, err := policy.LoadBundleFile(outPath)
+	if err != nil {
+		t.Fatalf("load patched: %v", err)
+	}
+	if len(newSpec.Rules) != 2 || newSpec.Rules[0].RuleID != "promoted-call-1" {
+		t.Fatalf("expected the promoted rule first, got %+v", newSpec.Rules)
+	}
+
+	diff := policy.DiffBundles(oldSpec, newSpec)
+	if len(diff.Changes) != 1 || diff.Changes[0].RuleID != "promoted-call-1" {
+		t.Fatalf("expected one change for the promoted rule, got %+v", diff.Changes)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"github.com/peakyragnar/subluminal/pkg/ledger"
 )
 
 func runQuery(args []string) int {
@@ -39,14 +41,12 @@ func runQuery(args []string) int {
 		return 1
 	}
 
-	if err := ensureSQLiteAvailable(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
-	}
-	if err := ensureLedgerExists(dbPath); err != nil {
+	store, err := ledger.OpenReadOnly(dbPath)
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
+	defer store.Close()
 
 	filters := toolCallFilters{
 		RunID:    strings.TrimSpace(*runIDFlag),
@@ -56,14 +56,7 @@ func runQuery(args []string) int {
 		Status:   normalizeEnum(*statusFlag),
 	}
 
-	query := buildToolCallQuery(toolCallColumns, filters, true, *limitFlag)
-	output, err := runSQLiteQuery(dbPath, query)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
-	}
-
-	rows, err := parseToolCallRows(output)
+	rows, err := listToolCalls(store, filters, true, *limitFlag)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
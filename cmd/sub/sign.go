@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+const (
+	policyKeygenUsage = "Usage: sub policy keygen [--name NAME] [--dir DIR]"
+	policySignUsage   = "Usage: sub policy sign [--key NAME|PATH] <file>..."
+)
+
+const defaultKeyName = "default"
+
+// runPolicyKeygen creates an ed25519 signing key pair under
+// ~/.subluminal/keys. The .pub file is what shims trust.
+func runPolicyKeygen(args []string) int {
+	flags := flag.NewFlagSet("policy keygen", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	name := flags.String("name", defaultKeyName, "Key name")
+	dir := flags.String("dir", "", "Key directory (default ~/.subluminal/keys)")
+	jsonOnly := flags.Bool("json", false, "Output JSON only")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, policyKeygenUsage)
+		return 2
+	}
+
+	keyDir, err := resolveKeyDir(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "keygen error: %v\n", err)
+		return 1
+	}
+	key, err := policy.GenerateKey(keyDir, *name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "keygen error: %v\n", err)
+		return 1
+	}
+
+	output := keygenOutput{
+		KeyID:      key.KeyID,
+		PrivateKey: filepath.Join(keyDir, *name+".key"),
+		PublicKey:  filepath.Join(keyDir, *name+".pub"),
+	}
+	if *jsonOnly {
+		return emitJSON(output)
+	}
+	fmt.Fprintf(os.Stderr, "Key ID: %s\n", output.KeyID)
+	fmt.Fprintf(os.Stderr, "Signing key: %s\n", output.PrivateKey)
+	fmt.Fprintf(os.Stderr, "Public key: %s (trust with SUB_POLICY_TRUSTED_KEYS)\n", output.PublicKey)
+	return 0
+}
+
+type keygenOutput struct {
+	KeyID      string `json:"key_id"`
+	PrivateKey string `json:"private_key"`
+	PublicKey  string `json:"public_key"`
+}
+
+// runPolicySign writes detached signatures for policy files as they are,
+// such as a layer set and its layer files.
+func runPolicySign(args []string) int {
+	flags := flag.NewFlagSet("policy sign", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	keyRef := flags.String("key", defaultKeyName, "Signing key name or .key path")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, policySignUsage)
+		return 2
+	}
+
+	key, err := loadSigningKey(*keyRef)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sign error: %v\n", err)
+		return 1
+	}
+	for _, path := range flags.Args() {
+		sig, err := policy.SignFile(path, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sign error: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Signed %s with key %s\n", policy.SignaturePath(path), sig.KeyID)
+	}
+	return 0
+}
+
+// loadSigningKey loads a .key file by path, or by name from the default
+// key directory.
+func loadSigningKey(ref string) (ed25519.PrivateKey, error) {
+	path := ref
+	if !strings.ContainsAny(ref, `/\`) && !strings.HasSuffix(ref, ".key") {
+		dir, err := resolveKeyDir("")
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, ref+".key")
+	}
+	path, err := expandPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return policy.LoadSigningKey(path)
+}
+
+func resolveKeyDir(dir string) (string, error) {
+	if dir != "" {
+		return expandPath(dir)
+	}
+	return policy.DefaultKeyDir()
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+	"github.com/peakyragnar/subluminal/pkg/ledger"
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+const simulateUsage = "Usage: sub policy simulate <bundle> (--run ID | --since TIME)"
+
+// runPolicySimulate replays recorded tool calls through a bundle and reports
+// every call whose decision would change.
+func runPolicySimulate(args []string) int {
+	flags := flag.NewFlagSet("policy simulate", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	runID := flags.String("run", "", "Replay the calls of this run_id")
+	since := flags.String("since", "", "Replay calls created at or after this time (RFC 3339) or duration ago (e.g. 24h)")
+	dbPath := flags.String("db", "", "Path to SQLite ledger database")
+	jsonOnly := flags.Bool("json", false, "Output JSON only")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || (*runID == "" && *since == "") {
+		fmt.Fprintln(os.Stderr, simulateUsage)
+		return 2
+	}
+
+	sinceTS := ""
+	if *since != "" {
+		ts, err := parseSince(*since, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "simulate error: --since: %v\n", err)
+			return 2
+		}
+		sinceTS = ts
+	}
+
+	spec, err := policy.LoadBundleFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate error: %v\n", err)
+		return 1
+	}
+	compiled, err := policy.CompileBundle(spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate error: %v\n", err)
+		return 1
+	}
+
+	resolved, err := resolveLedgerPath(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate error: %v\n", err)
+		return 1
+	}
+	store, err := ledger.OpenReadOnly(resolved)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate error: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	calls, err := store.CallDetails(ledger.ToolCallQuery{RunID: *runID, Since: sinceTS})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate error: %v\n", err)
+		return 1
+	}
+
+	output, err := simulateCalls(spec, calls, store.Run)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate error: %v\n", err)
+		return 1
+	}
+	output.Policy = compiled.Bundle.Info
+
+	if !*jsonOnly {
+		fmt.Fprintf(os.Stderr, "Replayed %d calls from %d runs: %d decisions change\n", output.Calls, output.Runs, output.Changed)
+		for _, change := range output.Changes {
+			note := ""
+			if change.ArgsIncomplete {
+				note = " (args incomplete)"
+			}
+			fmt.Fprintf(os.Stderr, "- %s %s/%s: %s -> %s%s\n", change.CallID, change.ServerName, change.ToolName,
+				describeDecision(change.Recorded), describeDecision(change.Simulated), note)
+		}
+	}
+
+	return emitJSON(output)
+}
+
+// parseSince accepts an RFC 3339 time or a duration before now.
+func parseSince(value string, now time.Time) (string, error) {
+	if ago, err := time.ParseDuration(value); err == nil {
+		return now.Add(-ago).UTC().Format(time.RFC3339Nano), nil
+	}
+	ts, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return "", fmt.Errorf("want an RFC 3339 time or a duration, got %q", value)
+	}
+	return ts.UTC().Format(time.RFC3339Nano), nil
+}
+
+// replayStep is a decision, or the outcome of an allowed call, at a point
+// in recorded time.
+type replayStep struct {
+	at      time.Time
+	call    int
+	outcome bool
+}
+
+// simulateCalls replays calls in recorded time order through a fresh bundle
+// per run, so budget, rate-limit, dedupe and breaker state build up as they
+// would have. State is run-wide, as with a state dir or coordinator. Calls
+// the new bundle allows feed their recorded outcome back to breakers.
+func simulateCalls(spec policy.BundleSpec, calls []ledger.CallDetail, lookupRun func(string) (ledger.Run, error)) (simulateOutput, error) {
+	output := simulateOutput{Changes: []simulatedChange{}}
+
+	steps := make([]replayStep, 0, 2*len(calls))
+	for i, call := range calls {
+		at, err := time.Parse(time.RFC3339Nano, call.CreatedAt)
+		if err != nil {
+			return output, fmt.Errorf("call %s: created_at %q: %w", call.CallID, call.CreatedAt, err)
+		}
+		steps = append(steps, replayStep{at: at, call: i})
+		if call.Status != "" {
+			end := at.Add(time.Duration(call.LatencyMS.Int64) * time.Millisecond)
+			steps = append(steps, replayStep{at: end, call: i, outcome: true})
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].at.Before(steps[j].at) })
+
+	bundles := map[string]*policy.Bundle{}
+	targets := map[string]policy.SelectorTarget{}
+	contexts := make([]policy.DecisionContext, len(calls))
+	allowed := make([]bool, len(calls))
+
+	for _, step := range steps {
+		call := calls[step.call]
+		bundle, ok := bundles[call.RunID]
+		if !ok {
+			compiled, err := policy.CompileBundle(spec)
+			if err != nil {
+				return output, err
+			}
+			bundle = compiled.Bundle
+			bundles[call.RunID] = bundle
+			targets[call.RunID] = runTarget(call.RunID, lookupRun)
+		}
+
+		if step.outcome {
+			if allowed[step.call] {
+				ctx := contexts[step.call]
+				ctx.Now = step.at
+				latency := time.Duration(call.LatencyMS.Int64) * time.Millisecond
+				bundle.RecordOutcome(ctx, policy.Outcome{Status: event.CallStatus(call.Status), Latency: latency})
+			}
+			continue
+		}
+
+		args, complete := previewArgs(call)
+		ctx := policy.DecisionContext{
+			ServerName: call.ServerName,
+			ToolName:   call.ToolName,
+			ArgsHash:   call.ArgsHash,
+			Args:       args,
+			Target:     targets[call.RunID],
+			Now:        step.at,
+		}
+		contexts[step.call] = ctx
+		decision := bundle.DecideWithContext(ctx)
+		// Observe mode forwards every call; otherwise only allowed ones run.
+		allowed[step.call] = decision.Action == event.DecisionAllow || bundle.Mode == event.RunModeObserve
+		output.Calls++
+
+		if call.Decision == "" || call.Decision == string(decision.Action) {
+			continue
+		}
+		simulated := simulatedDecision{Action: string(decision.Action), ReasonCode: decision.ReasonCode}
+		if decision.RuleID != nil {
+			simulated.RuleID = *decision.RuleID
+		}
+		output.Changes = append(output.Changes, simulatedChange{
+			CallID:         call.CallID,
+			RunID:          call.RunID,
+			CreatedAt:      call.CreatedAt,
+			ServerName:     call.ServerName,
+			ToolName:       call.ToolName,
+			Recorded:       simulatedDecision{Action: call.Decision, RuleID: call.RuleID},
+			Simulated:      simulated,
+			ArgsIncomplete: !complete,
+		})
+	}
+
+	output.Runs = len(bundles)
+	output.Changed = len(output.Changes)
+	return output, nil
+}
+
+// runTarget returns the recorded identity of runID; workload context is not
+// kept in the ledger.
+func runTarget(runID string, lookupRun func(string) (ledger.Run, error)) policy.SelectorTarget {
+	run, err := lookupRun(runID)
+	if err != nil {
+		if !errors.Is(err, ledger.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "simulate: run %s: %v\n", runID, err)
+		}
+		return policy.SelectorTarget{}
+	}
+	return policy.SelectorTarget{Env: run.Env, AgentID: run.AgentID, Client: run.Client}
+}
+
+func describeDecision(d simulatedDecision) string {
+	if d.RuleID == "" {
+		return d.Action
+	}
+	return fmt.Sprintf("%s (%s)", d.Action, d.RuleID)
+}
+
+type simulatedDecision struct {
+	Action     string `json:"action"`
+	RuleID     string `json:"rule_id,omitempty"`
+	ReasonCode string `json:"reason_code,omitempty"`
+}
+
+type simulatedChange struct {
+	CallID         string            `json:"call_id"`
+	RunID          string            `json:"run_id"`
+	CreatedAt      string            `json:"created_at"`
+	ServerName     string            `json:"server_name"`
+	ToolName       string            `json:"tool_name"`
+	Recorded       simulatedDecision `json:"recorded"`
+	Simulated      simulatedDecision `json:"simulated"`
+	ArgsIncomplete bool              `json:"args_incomplete,omitempty"`
+}
+
+type simulateOutput struct {
+	Policy  event.PolicyInfo  `json:"policy"`
+	Runs    int               `json:"runs"`
+	Calls   int               `json:"calls"`
+	Changed int               `json:"changed"`
+	Changes []simulatedChange `json:"changes"`
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/ledger"
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+func recordedCall(id, runID, tool, decision string, offset time.Duration) ledger.CallDetail {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return ledger.CallDetail{ToolCall: ledger.ToolCall{
+		CallID:     id,
+		RunID:      runID,
+		ServerName: "db",
+		ToolName:   tool,
+		Decision:   decision,
+		CreatedAt:  start.Add(offset).Format(time.RFC3339Nano),
+	}}
+}
+
+func noRuns(string) (ledger.Run, error) {
+	return ledger.Run{}, ledger.ErrNotFound
+}
+
+func TestSimulateCalls_ReplaysStatePerRunOnRecordedClock(t *testing.T) {
+	limit := 2
+	spec := policy.BundleSpec{
+		PolicyID: "tighter",
+		Version:  "2",
+		Mode:     "guardrails",
+		Rules: []policy.Rule{
+			{
+				RuleID: "query-budget",
+				Kind:   "budget",
+				Match:  policy.Match{ToolName: &policy.NameMatch{Glob: []string{"query"}}},
+				Effect: policy.Effect{Budget: &policy.BudgetEffect{Scope: "run", LimitCalls: &limit, OnExceed: "BLOCK"}},
+			},
+			{
+				RuleID: "export-rate",
+				Kind:   "rate_limit",
+				Match:  policy.Match{ToolName: &policy.NameMatch{Glob: []string{"export"}}},
+				Effect: policy.Effect{RateLimit: &policy.RateLimitEffect{
+					Scope: "tool", Capacity: 1, RefillTokens: 1, RefillPeriodMS: 1000, OnLimit: "THROTTLE",
+				}},
+			},
+		},
+	}
+	calls := []ledger.CallDetail{
+		recordedCall("c1", "run-1", "query", "ALLOW", 0),
+		recordedCall("c2", "run-1", "query", "ALLOW", time.Second),
+		recordedCall("c3", "run-1", "query", "ALLOW", 2*time.Second),
+		// A fresh bundle per run: run-2 starts with an unspent budget.
+		recordedCall("c4", "run-2", "query", "ALLOW", 3*time.Second),
+		// Rate limits follow recorded time, not the replay's wall clock.
+		recordedCall("e1", "run-1", "export", "ALLOW", 10*time.Second),
+		recordedCall("e2", "run-1", "export", "ALLOW", 10*time.Second+500*time.Millisecond),
+		recordedCall("e3", "run-1", "export", "ALLOW", 12*time.Second),
+	}
+
+	out, err := simulateCalls(spec, calls, noRuns)
+	if err != nil {
+		t.Fatalf("simulateCalls: %v", err)
+	}
+	if out.Runs != 2 || out.Calls != len(calls) {
+		t.Fatalf("expected 2 runs and %d calls, got %d and %d", len(calls), out.Runs, out.Calls)
+	}
+
+	got := map[string]string{}
+	for _, change := range out.Changes {
+		got[change.CallID] = change.Simulated.Action
+	}
+	want := map[string]string{"c3": "BLOCK", "e2": "THROTTLE"}
+	if len(got) != len(want) || got["c3"] != want["c3"] || got["e2"] != want["e2"] {
+		t.Fatalf("expected changes %v, got %v", want, got)
+	}
+	if !out.Changes[0].ArgsIncomplete {
+		t.Error("expected calls without an args preview to be marked args_incomplete")
+	}
+}
+
+func TestSimulateCalls_FeedsOutcomesToBreakers(t *testing.T) {
+	spec := policy.BundleSpec{
+		PolicyID: "breaker",
+		Version:  "1",
+		Mode:     "guardrails",
+		Rules: []policy.Rule{
+			{
+				RuleID: "flaky-db",
+				Kind:   "breaker",
+				Match:  policy.Match{ServerName: &policy.NameMatch{Glob: []string{"db"}}},
+				Effect: policy.Effect{Breaker: &policy.BreakerEffect{Scope: "server_tool", ErrorThreshold: 2, WindowMS: 60000, OnTrip: "BLOCK"}},
+			},
+		},
+	}
+	failed := func(c ledger.CallDetail) ledger.CallDetail {
+		c.Status = "ERROR"
+		c.LatencyMS = sql.NullInt64{Int64: 100, Valid: true}
+		return c
+	}
+	calls := []ledger.CallDetail{
+		failed(recordedCall("c1", "run-1", "query", "ALLOW", 0)),
+		failed(recordedCall("c2", "run-1", "query", "ALLOW", time.Second)),
+		recordedCall("c3", "run-1", "query", "ALLOW", 2*time.Second),
+	}
+
+	out, err := simulateCalls(spec, calls, noRuns)
+	if err != nil {
+		t.Fatalf("simulateCalls: %v", err)
+	}
+	if len(out.Changes) != 1 || out.Changes[0].CallID != "c3" || out.Changes[0].Simulated.ReasonCode != "BREAKER_OPEN" {
+		t.Fatalf("expected c3 to hit the open breaker, got %+v", out.Changes)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	if got, err := parseSince("24h", now); err != nil || got != "2024-01-01T00:00:00Z" {
+		t.Fatalf("parseSince(24h) = %q, %v", got, err)
+	}
+	if got, err := parseSince("2024-01-01T12:00:00+02:00", now); err != nil || got != "2024-01-01T10:00:00Z" {
+		t.Fatalf("parseSince(RFC 3339) = %q, %v", got, err)
+	}
+	if _, err := parseSince("yesterday", now); err == nil {
+		t.Fatal("expected an error for an unparseable value")
+	}
+}
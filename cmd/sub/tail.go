@@ -8,6 +8,8 @@ import (
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/ledger"
 )
 
 const defaultTailLimit = 200
@@ -44,14 +46,12 @@ func runTail(args []string) int {
 		return 1
 	}
 
-	if err := ensureSQLiteAvailable(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
-	}
-	if err := ensureLedgerExists(dbPath); err != nil {
+	store, err := ledger.OpenReadOnly(dbPath)
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
+	defer store.Close()
 
 	filters := toolCallFilters{RunID: strings.TrimSpace(*runIDFlag)}
 
@@ -70,7 +70,7 @@ func runTail(args []string) int {
 	defer ticker.Stop()
 
 	for {
-		recentRows, err := tailToolCallWindow(dbPath, filters, *limitFlag)
+		recentRows, err := tailToolCallWindow(store, filters, *limitFlag)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return 1
@@ -86,7 +86,7 @@ func runTail(args []string) int {
 			}
 		} else {
 			newRows, newCreatedAt, newCallID, err := fetchNewToolCalls(filters, *limitFlag, lastCreatedAt, lastCallID, func(paged toolCallFilters, limit int) ([]toolCallRow, error) {
-				return tailToolCalls(dbPath, paged, limit)
+				return listToolCalls(store, paged, false, limit)
 			})
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
@@ -110,25 +110,16 @@ func runTail(args []string) int {
 	}
 }
 
-func tailToolCalls(dbPath string, filters toolCallFilters, limit int) ([]toolCallRow, error) {
-	query := buildToolCallQuery(toolCallColumns, filters, false, limit)
-
-	output, err := runSQLiteQuery(dbPath, query)
+// tailToolCallWindow returns the newest limit rows, oldest first.
+func tailToolCallWindow(store ledger.Store, filters toolCallFilters, limit int) ([]toolCallRow, error) {
+	rows, err := listToolCalls(store, filters, true, limit)
 	if err != nil {
 		return nil, err
 	}
-	return parseToolCallRows(output)
-}
-
-func tailToolCallWindow(dbPath string, filters toolCallFilters, limit int) ([]toolCallRow, error) {
-	query := buildToolCallQuery(toolCallColumns, filters, true, limit)
-	query = fmt.Sprintf("SELECT * FROM (%s) ORDER BY created_at ASC, call_id ASC", query)
-
-	output, err := runSQLiteQuery(dbPath, query)
-	if err != nil {
-		return nil, err
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
 	}
-	return parseToolCallRows(output)
+	return rows, nil
 }
 
 func fetchNewToolCalls(filters toolCallFilters, limit int, lastCreatedAt, lastCallID string, fetch func(toolCallFilters, int) ([]toolCallRow, error)) ([]toolCallRow, string, string, error) {
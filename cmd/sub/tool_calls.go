@@ -1,24 +1,12 @@
 package main
 
 import (
-	"fmt"
+	"database/sql"
+	"strconv"
 	"strings"
-)
-
-const toolCallFieldCount = 10
 
-var toolCallColumns = []string{
-	"call_id",
-	"created_at",
-	"run_id",
-	"server_name",
-	"tool_name",
-	"decision",
-	"status",
-	"latency_ms",
-	"bytes_in",
-	"bytes_out",
-}
+	"github.com/peakyragnar/subluminal/pkg/ledger"
+)
 
 const toolCallHeader = "ts\trun_id\tserver\ttool\tdecision\tstatus\tlatency_ms\tbytes_in\tbytes_out\tcall_id"
 
@@ -76,86 +64,49 @@ func (r toolCallRow) format() string {
 	}, "\t")
 }
 
-func buildToolCallQuery(columns []string, filters toolCallFilters, orderDesc bool, limit int) string {
-	selectCols := strings.Join(columns, ", ")
-	query := "SELECT " + selectCols + " FROM tool_calls"
-
-	clauses := []string{}
-	if filters.RunID != "" {
-		clauses = append(clauses, "run_id="+sqlText(filters.RunID))
-	}
-	if filters.Server != "" {
-		clauses = append(clauses, "server_name="+sqlText(filters.Server))
-	}
-	if filters.Tool != "" {
-		clauses = append(clauses, "tool_name="+sqlText(filters.Tool))
-	}
-	if filters.Decision != "" {
-		clauses = append(clauses, "decision="+sqlText(filters.Decision))
-	}
-	if filters.Status != "" {
-		clauses = append(clauses, "status="+sqlText(filters.Status))
-	}
-	if filters.AfterCreatedAt != "" {
-		if filters.AfterCallID != "" {
-			clauses = append(clauses, fmt.Sprintf("(created_at > %s OR (created_at = %s AND call_id > %s))",
-				sqlText(filters.AfterCreatedAt),
-				sqlText(filters.AfterCreatedAt),
-				sqlText(filters.AfterCallID),
-			))
-		} else {
-			clauses = append(clauses, "created_at > "+sqlText(filters.AfterCreatedAt))
-		}
-	}
-
-	if len(clauses) > 0 {
-		query += " WHERE " + strings.Join(clauses, " AND ")
+// query converts filters into a ledger query.
+func (f toolCallFilters) query(desc bool, limit int) ledger.ToolCallQuery {
+	return ledger.ToolCallQuery{
+		RunID:          f.RunID,
+		Server:         f.Server,
+		Tool:           f.Tool,
+		Decision:       f.Decision,
+		Status:         f.Status,
+		AfterCreatedAt: f.AfterCreatedAt,
+		AfterCallID:    f.AfterCallID,
+		Desc:           desc,
+		Limit:          limit,
 	}
+}
 
-	if orderDesc {
-		query += " ORDER BY created_at DESC, call_id DESC"
-	} else {
-		query += " ORDER BY created_at ASC, call_id ASC"
+// listToolCalls runs filters against store and returns display rows.
+func listToolCalls(store ledger.Store, filters toolCallFilters, desc bool, limit int) ([]toolCallRow, error) {
+	calls, err := store.ToolCalls(filters.query(desc, limit))
+	if err != nil {
+		return nil, err
 	}
-
-	if limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", limit)
+	rows := make([]toolCallRow, 0, len(calls))
+	for _, call := range calls {
+		rows = append(rows, toolCallRow{
+			CallID:     call.CallID,
+			CreatedAt:  call.CreatedAt,
+			RunID:      call.RunID,
+			ServerName: call.ServerName,
+			ToolName:   call.ToolName,
+			Decision:   call.Decision,
+			Status:     call.Status,
+			LatencyMS:  formatNullInt(call.LatencyMS),
+			BytesIn:    formatNullInt(call.BytesIn),
+			BytesOut:   formatNullInt(call.BytesOut),
+		})
 	}
-
-	return query
+	return rows, nil
 }
 
-func parseToolCallRows(output string) ([]toolCallRow, error) {
-	output = strings.Trim(output, "\r\n")
-	if output == "" {
-		return nil, nil
+// formatNullInt renders NULL as an empty column, matching the sqlite3 CLI.
+func formatNullInt(value sql.NullInt64) string {
+	if !value.Valid {
+		return ""
 	}
-
-	lines := strings.Split(output, "\n")
-	rows := make([]toolCallRow, 0, len(lines))
-
-	for _, line := range lines {
-		line = strings.TrimRight(line, "\r")
-		if line == "" {
-			continue
-		}
-		fields := strings.Split(line, sqliteSeparator)
-		if len(fields) < toolCallFieldCount {
-			return nil, fmt.Errorf("expected %d columns, got %d", toolCallFieldCount, len(fields))
-		}
-		row := toolCallRow{
-			CallID:     fields[0],
-			CreatedAt:  fields[1],
-			RunID:      fields[2],
-			ServerName: fields[3],
-			ToolName:   fields[4],
-			Decision:   fields[5],
-			Status:     fields[6],
-			LatencyMS:  fields[7],
-			BytesIn:    fields[8],
-			BytesOut:   fields[9],
-		}
-		rows = append(rows, row)
-	}
-	return rows, nil
+	return strconv.FormatInt(value.Int64, 10)
 }
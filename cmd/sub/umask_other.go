@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// Without a umask, the socket is only restricted by the chmod after listen.
+
+func withPrivateUmask(fn func() error) error {
+	return fn()
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// withPrivateUmask runs fn with a umask that leaves new files readable and
+// writable by this user only, so a socket is never created open to others.
+func withPrivateUmask(fn func() error) error {
+	old := syscall.Umask(0o177)
+	defer syscall.Umask(old)
+	return fn()
+}
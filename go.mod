@@ -1,3 +1,5 @@
 module github.com/peakyragnar/subluminal
 
 go 1.21
+
+require github.com/mattn/go-sqlite3 v1.14.33
@@ -0,0 +1,548 @@
+// Package mcphttp implements the MCP Streamable HTTP adapter.
+//
+// This file implements a reverse proxy that:
+// - Listens locally for MCP client HTTP requests
+// - Intercepts tools/call POSTs to emit events and enforce policy
+// - Forwards allowed requests to the upstream MCP server URL
+// - Relays JSON and SSE (text/event-stream) responses without buffering streams
+// - Redacts secrets from upstream errors before relaying them
+// - Emits tool_call_end when the matching JSON-RPC response passes through
+// - Hot reloads the policy file, as the stdio adapter does
+//
+// Per Interface-Pack §7:
+// - Adapters extract (server_name, tool_name, args) for each tool call
+// - Adapters delegate to core for event emission
+// - Adapters forward allowed calls
+package mcphttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/adapter/mcpstdio"
+	"github.com/peakyragnar/subluminal/pkg/canonical"
+	"github.com/peakyragnar/subluminal/pkg/core"
+	"github.com/peakyragnar/subluminal/pkg/event"
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+// Transport is the call.transport value for events from this adapter.
+const Transport = "mcp_http"
+
+// maxRequestBytes bounds a single POSTed JSON-RPC message, matching the
+// stdio adapter's line limit.
+const maxRequestBytes = 10 * 1024 * 1024
+
+// hopHeaders are connection-scoped and never forwarded.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Proxy handles MCP Streamable HTTP proxying with event emission.
+type Proxy struct {
+	// Upstream MCP endpoint
+	upstreamURL string
+	client      *http.Client
+
+	// Policy, events and run status, shared with the stdio adapter
+	enforcer *core.Enforcer
+	state    *core.RunState
+	redactor *core.Redactor
+
+	// Closed by Close; stops the policy watcher
+	watchDone  chan struct{}
+	runEndOnce sync.Once
+}
+
+// toolCall tracks an allowed tools/call until its response is relayed.
+type toolCall struct {
+	id       any
+	callID   string
+	toolName string
+	argsHash string
+	args     map[string]any
+	done     bool
+}
+
+// NewProxy creates a proxy in front of upstreamURL.
+func NewProxy(
+	upstreamURL string,
+	emitter *core.Emitter,
+	serverName string,
+	identity core.Identity,
+	source core.Source,
+	redactor *core.Redactor,
+) *Proxy {
+	enforcer := core.NewEnforcer(emitter, serverName, Transport, identity, source, redactor)
+	return &Proxy{
+		upstreamURL: upstreamURL,
+		// No overall timeout: SSE streams stay open for the whole call.
+		client:    &http.Client{},
+		enforcer:  enforcer,
+		state:     enforcer.State(),
+		redactor:  enforcer.Redactor(),
+		watchDone: make(chan struct{}),
+	}
+}
+
+// SetStateStore persists budget, rate-limit, breaker and dedupe state in
+// store so it survives shim restarts. Call before Start.
+func (p *Proxy) SetStateStore(store policy.StateStore) {
+	p.enforcer.SetStateStore(store)
+}
+
+// WatchPolicyFile enables hot reload of the policy bundle at path.
+// Call before Start; the watcher stops on Close.
+func (p *Proxy) WatchPolicyFile(path string, interval time.Duration) {
+	p.enforcer.WatchPolicyFile(path, interval)
+}
+
+// Start emits run_start, policy_verification when trusted keys are
+// configured, and policy_loaded when the configured policy failed to load,
+// then starts the policy file watcher. Call before serving requests.
+func (p *Proxy) Start() {
+	p.enforcer.EmitRunStart()
+	p.enforcer.WatchPolicy(p.watchDone)
+}
+
+// Cancel records that the shim was asked to stop, such as on SIGINT, so
+// run_end reports CANCELLED unless the run was terminated by policy. Call
+// before shutting the HTTP server down.
+func (p *Proxy) Cancel() {
+	p.enforcer.Cancel()
+}
+
+// Close stops the policy watcher and emits run_end. Call after the HTTP
+// server has shut down so no tool call event follows it. Safe to call
+// more than once.
+func (p *Proxy) Close() {
+	p.runEndOnce.Do(func() {
+		close(p.watchDone)
+		p.enforcer.WaitPolicy()
+		p.enforcer.EmitRunEnd(p.enforcer.RunStatus(false), nil)
+	})
+}
+
+// ServeHTTP implements http.Handler.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		// GET opens the server-initiated SSE stream; DELETE ends the session.
+		p.forward(w, r, r.Body, nil)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxRequestBytes {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		// Batches would let tools/call bypass interception.
+		p.writeJSONRPC(w, mcpstdio.NewErrorResponse(nil, mcpstdio.ErrCodeInvalidRequest, "JSON-RPC batches are not supported", nil))
+		return
+	}
+
+	var req mcpstdio.JSONRPCRequest
+	if err := json.Unmarshal(body, &req); err != nil || !mcpstdio.IsToolsCall(&req) {
+		// Forward everything else as-is (let upstream handle errors)
+		p.forward(w, r, bytes.NewReader(body), nil)
+		return
+	}
+
+	call, rejection := p.interceptToolCall(&req, body)
+	if rejection != nil {
+		p.writeJSONRPC(w, rejection)
+		return
+	}
+	p.forward(w, r, bytes.NewReader(body), call)
+}
+
+// interceptToolCall evaluates policy for a tools/call and emits events.
+// Returns the call to track, or the JSON-RPC error to send instead of
+// forwarding. Both are nil for unparseable calls, which are forwarded.
+func (p *Proxy) interceptToolCall(req *mcpstdio.JSONRPCRequest, body []byte) (*toolCall, *mcpstdio.JSONRPCResponse) {
+	if termination := p.enforcer.Termination(); termination != nil {
+		return nil, p.terminatedResponse(req, termination)
+	}
+
+	toolName, args, err := mcpstdio.ParseToolsCallParams(req.Params)
+	if err != nil {
+		// Can't parse - still forward, just don't emit events
+		return nil, nil
+	}
+
+	argsHash, _ := canonical.ArgsHash(args)
+	callID := core.GenerateUUID()
+	callState := p.state.StartCall(callID)
+
+	verdict := p.enforcer.Decide(toolName, argsHash, args)
+	decision := verdict.Decision
+
+	p.enforcer.EmitToolCallStart(callID, toolName, argsHash, len(body), args, callState.Seq)
+	p.enforcer.EmitToolCallDecision(callID, toolName, argsHash, decision)
+
+	errCode := 0
+	if verdict.Enforced {
+		switch decision.Action {
+		case event.DecisionBlock:
+			errCode = mcpstdio.ErrCodePolicyBlocked
+		case event.DecisionThrottle:
+			errCode = mcpstdio.ErrCodePolicyThrottled
+		case event.DecisionRejectWithHint:
+			errCode = mcpstdio.ErrCodeRejectWithHint
+		case event.DecisionTerminateRun:
+			errCode = mcpstdio.ErrCodeRunTerminated
+		}
+	}
+
+	if errCode == 0 {
+		p.state.IncrementAllowed()
+		id, _ := mcpstdio.GetRequestID(req)
+		return &toolCall{id: id, callID: callID, toolName: toolName, argsHash: argsHash, args: args}, nil
+	}
+
+	if errCode == mcpstdio.ErrCodePolicyThrottled {
+		p.state.IncrementThrottled()
+	} else {
+		p.state.IncrementBlocked()
+	}
+	p.state.IncrementErrors()
+	latencyMS := p.state.EndCall(callID)
+
+	id, _ := mcpstdio.GetRequestID(req)
+	errData := p.enforcer.PolicyErrorData(callID, toolName, argsHash, decision)
+	resp := mcpstdio.NewErrorResponse(id, errCode, decision.Explain.Summary, errData)
+	bytesOut := 0
+	if payload, err := json.Marshal(resp); err == nil {
+		bytesOut = len(payload)
+	}
+	p.enforcer.EmitToolCallEnd(callID, toolName, argsHash, event.CallStatusError, latencyMS, bytesOut, event.ResultPreview{}, &event.ErrorDetail{
+		Class:   "policy_block",
+		Message: decision.Explain.Summary,
+		Code:    errCode,
+	})
+
+	if errCode == mcpstdio.ErrCodeRunTerminated {
+		p.enforcer.Terminate(decision)
+	}
+	return nil, resp
+}
+
+// forward relays the request to upstream and streams the response back.
+// If call is non-nil, the matching JSON-RPC response ends the call.
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, body io.Reader, call *toolCall) {
+	upReq, err := http.NewRequestWithContext(r.Context(), r.Method, p.upstreamURL, body)
+	if err != nil {
+		p.upstreamFailed(w, call, err)
+		return
+	}
+	upReq.Header = r.Header.Clone()
+	removeHopHeaders(upReq.Header)
+
+	resp, err := p.client.Do(upReq)
+	if err != nil {
+		p.upstreamFailed(w, call, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	header := w.Header()
+	for key, values := range resp.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	removeHopHeaders(header)
+	// Redaction can change the body's length; never trust it across a relay.
+	header.Del("Content-Length")
+	w.WriteHeader(resp.StatusCode)
+
+	var bytesOut int
+	if isEventStream(resp.Header) {
+		bytesOut = p.relaySSE(w, resp.Body, call)
+	} else {
+		bytesOut = p.relayJSON(w, resp.Body, call, resp.StatusCode)
+	}
+
+	if call != nil && !call.done {
+		// No JSON-RPC response for the call came back (HTTP error, 202, or
+		// a stream that closed early).
+		class := "transport"
+		message := "upstream returned no response for tool call"
+		var code any
+		if resp.StatusCode >= http.StatusBadRequest {
+			class = "upstream_error"
+			message = fmt.Sprintf("upstream HTTP status %d", resp.StatusCode)
+			code = resp.StatusCode
+		}
+		p.finishCall(call, event.CallStatusError, bytesOut, event.ResultPreview{}, &event.ErrorDetail{
+			Class:   class,
+			Message: message,
+			Code:    code,
+		})
+	}
+}
+
+// relayJSON forwards a single response body. Bodies up to MaxInspectBytes
+// are read whole so upstream errors can be redacted and matched to call;
+// larger ones are relayed as they arrive, uninspected.
+func (p *Proxy) relayJSON(w http.ResponseWriter, src io.Reader, call *toolCall, status int) int {
+	body, _ := io.ReadAll(io.LimitReader(src, core.MaxInspectBytes+1))
+	if len(body) > core.MaxInspectBytes {
+		n, _ := w.Write(body)
+		rest, _ := io.Copy(w, src)
+		total := n + int(rest)
+		if call != nil {
+			// Too large to inspect: the call completed, but status is unknown.
+			p.finishCall(call, event.CallStatusOK, total, event.ResultPreview{Truncated: true}, nil)
+		}
+		return total
+	}
+
+	msg := p.sanitizeMessage(body)
+	if status >= http.StatusBadRequest {
+		// HTTP error bodies are often plain text echoing the request
+		msg = []byte(p.redactor.Redact(string(msg)))
+	}
+	n, _ := w.Write(msg)
+	if call != nil {
+		p.matchMessage(call, msg, n)
+	}
+	return n
+}
+
+// relaySSE forwards an SSE stream, flushing at each event boundary. Each
+// event is held until its boundary so an upstream error in its data can
+// be redacted and matched to call; events over MaxInspectBytes are relayed
+// as they arrive, uninspected.
+func (p *Proxy) relaySSE(w http.ResponseWriter, src io.Reader, call *toolCall) int {
+	flusher, _ := w.(http.Flusher)
+	reader := bufio.NewReaderSize(src, 64*1024)
+	total := 0
+	write := func(b []byte) bool {
+		n, err := w.Write(b)
+		total += n
+		return err == nil
+	}
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	var held, other, data []byte // current event: raw, non-data lines, data
+	lineStart := 0               // where the current line begins in held
+	midLine := false             // the last read ended inside a long line
+	oversized := false           // current event exceeds the inspect ceiling
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		blank := !midLine && len(chunk) > 0 && len(bytes.TrimRight(chunk, "\r\n")) == 0
+		midLine = errors.Is(err, bufio.ErrBufferFull)
+		if oversized {
+			if !write(chunk) {
+				return total
+			}
+		} else {
+			held = append(held, chunk...)
+			if len(held) > core.MaxInspectBytes {
+				oversized = true
+				if !write(held) {
+					return total
+				}
+				held, other, data, lineStart = held[:0], other[:0], data[:0], 0
+			}
+		}
+		if midLine {
+			// Long line: keep reading, finish inspecting it later
+			continue
+		}
+		if err != nil {
+			// Stream ended: relay what is left of the last event
+			write(held)
+			flush()
+			return total
+		}
+
+		switch {
+		case oversized:
+			if blank {
+				oversized = false
+				flush()
+			}
+			continue
+		case blank:
+			// Event boundary
+			out := held
+			var msg []byte
+			if len(data) > 0 {
+				msg = p.sanitizeMessage(data)
+				if !bytes.Equal(msg, data) {
+					out = append(append([]byte(nil), other...), "data: "...)
+					out = append(append(append(out, msg...), '\n'), held[lineStart:]...)
+				}
+			}
+			if !write(out) {
+				return total
+			}
+			flush()
+			if call != nil && !call.done && len(msg) > 0 {
+				p.matchMessage(call, msg, total)
+			}
+			held, other, data, lineStart = held[:0], other[:0], data[:0], 0
+			continue
+		}
+
+		line := held[lineStart:]
+		field := strings.TrimRight(string(line), "\r\n")
+		if value, ok := strings.CutPrefix(field, "data:"); ok {
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(value, " ")...)
+		} else {
+			other = append(other, line...)
+		}
+		lineStart = len(held)
+	}
+}
+
+// sanitizeMessage redacts the error of a JSON-RPC response, as the stdio
+// adapter does before forwarding. Other messages are returned unchanged.
+func (p *Proxy) sanitizeMessage(msg []byte) []byte {
+	var resp mcpstdio.JSONRPCResponse
+	if err := json.Unmarshal(msg, &resp); err != nil || resp.Error == nil {
+		return msg
+	}
+	resp.Error.Message = p.redactor.Redact(resp.Error.Message)
+	if resp.Error.Data != nil {
+		resp.Error.Data = p.redactor.SanitizeValue(resp.Error.Data)
+	}
+	sanitized, err := json.Marshal(resp)
+	if err != nil {
+		return msg
+	}
+	return sanitized
+}
+
+// matchMessage ends call if msg is its JSON-RPC response.
+func (p *Proxy) matchMessage(call *toolCall, msg []byte, bytesOut int) {
+	var resp mcpstdio.JSONRPCResponse
+	if err := json.Unmarshal(msg, &resp); err != nil || resp.ID == nil || !sameID(resp.ID, call.id) {
+		return
+	}
+
+	status := event.CallStatusOK
+	var errDetail *event.ErrorDetail
+	if resp.Error != nil {
+		status = event.CallStatusError
+		errDetail = &event.ErrorDetail{
+			Class:   "upstream_error",
+			Message: p.redactor.Redact(resp.Error.Message),
+			Code:    resp.Error.Code,
+		}
+	}
+
+	preview := event.ResultPreview{}
+	if resp.Result != nil {
+		if b, err := json.Marshal(resp.Result); err == nil {
+			preview.ResultPreview, preview.Truncated = core.PreviewJSON(p.redactor, b)
+		}
+	}
+	p.finishCall(call, status, bytesOut, preview, errDetail)
+}
+
+func (p *Proxy) finishCall(call *toolCall, status event.CallStatus, bytesOut int, preview event.ResultPreview, errDetail *event.ErrorDetail) {
+	if call.done {
+		return
+	}
+	call.done = true
+	latencyMS := p.state.EndCall(call.callID)
+	if status != event.CallStatusOK {
+		p.state.IncrementErrors()
+	}
+	p.enforcer.RecordOutcome(call.toolName, call.argsHash, call.args, status, latencyMS)
+	p.enforcer.EmitToolCallEnd(call.callID, call.toolName, call.argsHash, status, latencyMS, bytesOut, preview, errDetail)
+}
+
+// upstreamFailed reports an upstream connection failure to the client.
+func (p *Proxy) upstreamFailed(w http.ResponseWriter, call *toolCall, err error) {
+	message := p.redactor.Redact(fmt.Sprintf("upstream request failed: %v", err))
+	if call == nil {
+		http.Error(w, message, http.StatusBadGateway)
+		return
+	}
+	resp := mcpstdio.NewErrorResponse(call.id, mcpstdio.ErrCodeInternalError, message, nil)
+	bytesOut := p.writeJSONRPC(w, resp)
+	p.finishCall(call, event.CallStatusError, bytesOut, event.ResultPreview{}, &event.ErrorDetail{
+		Class:     "transport",
+		Message:   message,
+		Retryable: true,
+	})
+}
+
+// writeJSONRPC writes resp as a 200 application/json body.
+func (p *Proxy) writeJSONRPC(w http.ResponseWriter, resp *mcpstdio.JSONRPCResponse) int {
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return 0
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+	return len(payload)
+}
+
+func (p *Proxy) terminatedResponse(req *mcpstdio.JSONRPCRequest, termination *event.RunTermination) *mcpstdio.JSONRPCResponse {
+	id, _ := mcpstdio.GetRequestID(req)
+	toolName, args, _ := mcpstdio.ParseToolsCallParams(req.Params)
+	argsHash, _ := canonical.ArgsHash(args)
+	decision := p.enforcer.TerminatedDecision(termination)
+	errData := p.enforcer.PolicyErrorData("", toolName, argsHash, decision)
+	return mcpstdio.NewErrorResponse(id, mcpstdio.ErrCodeRunTerminated, termination.TerminateMessage, errData)
+}
+
+func isEventStream(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, key := range hopHeaders {
+		header.Del(key)
+	}
+}
+
+// sameID compares JSON-RPC IDs by their JSON encoding, so 1 and 1.0 match.
+func sameID(a, b any) bool {
+	left, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	right, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(left, right)
+}
@@ -0,0 +1,372 @@
+package mcphttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/core"
+	"github.com/peakyragnar/subluminal/pkg/testharness"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+type proxyFixture struct {
+	upstream *testharness.FakeHTTPMCPServer
+	proxy    *Proxy
+	server   *httptest.Server
+	emitter  *core.Emitter
+	events   *syncBuffer
+}
+
+// newProxyFixture starts a fake upstream and a proxy in front of it. Each
+// setup func configures the proxy before Start.
+func newProxyFixture(t *testing.T, sse bool, policyJSON string, setup ...func(*Proxy)) *proxyFixture {
+	t.Helper()
+	t.Setenv("SUB_POLICY_FILE", "")
+	t.Setenv("SUB_POLICY_JSON", policyJSON)
+
+	upstream := testharness.NewFakeHTTPMCPServer()
+	upstream.SSE = sse
+	upstream.AddTool("read_file", "Read a file", nil)
+	upstream.AddTool("delete_repo", "Dangerous", nil)
+	upstream.Start()
+	t.Cleanup(upstream.Close)
+
+	events := &syncBuffer{}
+	emitter := core.NewEmitter(events)
+	emitter.Start()
+
+	proxy := NewProxy(upstream.URL(), emitter, "remote", core.Identity{RunID: "run-http", AgentID: "agent"}, core.GenerateSource(), nil)
+	for _, fn := range setup {
+		fn(proxy)
+	}
+	proxy.Start()
+	server := httptest.NewServer(proxy)
+	t.Cleanup(server.Close)
+
+	return &proxyFixture{upstream: upstream, proxy: proxy, server: server, emitter: emitter, events: events}
+}
+
+// finish shuts the proxy down and returns the emitted events.
+func (f *proxyFixture) finish(t *testing.T) []map[string]any {
+	t.Helper()
+	f.server.Close()
+	f.proxy.Close()
+	f.emitter.Close()
+
+	var events []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(f.events.buf.Bytes()))
+	for scanner.Scan() {
+		var evt map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &evt); err != nil {
+			t.Fatalf("invalid event line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, evt)
+	}
+	return events
+}
+
+func (f *proxyFixture) post(t *testing.T, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, f.server.URL, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	return resp
+}
+
+func eventsOfType(events []map[string]any, eventType string) []map[string]any {
+	var out []map[string]any
+	for _, evt := range events {
+		if evt["type"] == eventType {
+			out = append(out, evt)
+		}
+	}
+	return out
+}
+
+func field(evt map[string]any, path ...string) any {
+	var cur any = evt
+	for _, key := range path {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[key]
+	}
+	return cur
+}
+
+const toolCallBody = `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"read_file","arguments":{"path":"README.md"}}}`
+
+func TestProxy_JSONResponseEmitsToolCallEvents(t *testing.T) {
+	f := newProxyFixture(t, false, "")
+
+	resp := f.post(t, toolCallBody)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"id":7`) || strings.Contains(string(body), `"error"`) {
+		t.Fatalf("unexpected response body: %s", body)
+	}
+
+	events := f.finish(t)
+	starts := eventsOfType(events, "tool_call_start")
+	if len(starts) != 1 {
+		t.Fatalf("expected 1 tool_call_start, got %d", len(starts))
+	}
+	if got := field(starts[0], "call", "transport"); got != Transport {
+		t.Errorf("expected transport %q, got %v", Transport, got)
+	}
+	ends := eventsOfType(events, "tool_call_end")
+	if len(ends) != 1 {
+		t.Fatalf("expected 1 tool_call_end, got %d", len(ends))
+	}
+	if got := field(ends[0], "status"); got != "OK" {
+		t.Errorf("expected status OK, got %v", got)
+	}
+	if preview, _ := field(ends[0], "preview", "result_preview").(string); !strings.Contains(preview, "ok") {
+		t.Errorf("expected result preview from upstream, got %q", preview)
+	}
+	if last := events[len(events)-1]["type"]; last != "run_end" {
+		t.Errorf("expected run_end last, got %v", last)
+	}
+}
+
+func TestProxy_SSEResponseRelayedAndMatched(t *testing.T) {
+	f := newProxyFixture(t, true, "")
+
+	resp := f.post(t, toolCallBody)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected SSE content type, got %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "notifications/progress") {
+		t.Errorf("expected progress notification relayed, got %s", body)
+	}
+	if !strings.Contains(string(body), `"id":7`) {
+		t.Errorf("expected final response relayed, got %s", body)
+	}
+
+	events := f.finish(t)
+	ends := eventsOfType(events, "tool_call_end")
+	if len(ends) != 1 {
+		t.Fatalf("expected 1 tool_call_end, got %d", len(ends))
+	}
+	if got := field(ends[0], "status"); got != "OK" {
+		t.Errorf("expected status OK, got %v", got)
+	}
+}
+
+func TestProxy_BlockedCallNeverReachesUpstream(t *testing.T) {
+	f := newProxyFixture(t, false, `{
+		"mode": "guardrails",
+		"policy_id": "http-block",
+		"rules": [
+			{"rule_id": "deny-delete", "kind": "deny", "match": {"tool_name": {"glob": ["delete_repo"]}}, "effect": {"action": "BLOCK"}}
+		]
+	}`)
+
+	resp := f.post(t, `{"jsonrpc":"2.0","id":"a","method":"tools/call","params":{"name":"delete_repo","arguments":{}}}`)
+	var rpc struct {
+		Error *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&rpc)
+	resp.Body.Close()
+	if rpc.Error == nil || rpc.Error.Code != -32081 {
+		t.Fatalf("expected -32081 error, got %+v", rpc.Error)
+	}
+	if calls := f.upstream.GetCalls(); len(calls) != 0 {
+		t.Fatalf("blocked call reached upstream: %+v", calls)
+	}
+
+	events := f.finish(t)
+	decisions := eventsOfType(events, "tool_call_decision")
+	if len(decisions) != 1 || field(decisions[0], "decision", "action") != "BLOCK" {
+		t.Fatalf("expected BLOCK decision, got %+v", decisions)
+	}
+}
+
+func TestProxy_PassesSessionHeaderThrough(t *testing.T) {
+	f := newProxyFixture(t, false, "")
+
+	resp := f.post(t, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	resp.Body.Close()
+	if got := resp.Header.Get("Mcp-Session-Id"); got != testharness.FakeHTTPSessionID {
+		t.Fatalf("expected session header %q, got %q", testharness.FakeHTTPSessionID, got)
+	}
+
+	events := f.finish(t)
+	if n := len(eventsOfType(events, "tool_call_start")); n != 0 {
+		t.Fatalf("initialize should not emit tool call events, got %d", n)
+	}
+}
+
+func TestProxy_RedactsUpstreamErrors(t *testing.T) {
+	for _, sse := range []bool{false, true} {
+		f := newProxyFixture(t, sse, "")
+		f.upstream.AddTool("leaky", "Fails loudly", func(map[string]any) (string, error) {
+			return "", errors.New("token sk-live-abcdef123456 rejected")
+		})
+
+		resp := f.post(t, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"leaky","arguments":{}}}`)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if strings.Contains(string(body), "abcdef123456") {
+			t.Fatalf("sse=%v: secret relayed to client: %s", sse, body)
+		}
+		if !strings.Contains(string(body), "[REDACTED]") || !strings.Contains(string(body), `"id":3`) {
+			t.Fatalf("sse=%v: expected redacted error response, got %s", sse, body)
+		}
+
+		events := f.finish(t)
+		ends := eventsOfType(events, "tool_call_end")
+		if len(ends) != 1 || field(ends[0], "status") != "ERROR" {
+			t.Fatalf("sse=%v: expected 1 ERROR tool_call_end, got %+v", sse, ends)
+		}
+		if msg, _ := field(ends[0], "error", "message").(string); strings.Contains(msg, "abcdef123456") {
+			t.Fatalf("sse=%v: secret in tool_call_end: %q", sse, msg)
+		}
+	}
+}
+
+func TestProxy_RedactsUpstreamHTTPErrorBody(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad credentials ghp_abcdef123456", http.StatusUnauthorized)
+	}))
+	t.Cleanup(upstream.Close)
+
+	events := &syncBuffer{}
+	emitter := core.NewEmitter(events)
+	emitter.Start()
+	defer emitter.Close()
+	proxy := NewProxy(upstream.URL, emitter, "remote", core.Identity{RunID: "run-http"}, core.GenerateSource(), nil)
+	proxy.Start()
+	defer proxy.Close()
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(toolCallBody))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 relayed, got %d", resp.StatusCode)
+	}
+	if strings.Contains(string(body), "abcdef123456") || !strings.Contains(string(body), "[REDACTED]") {
+		t.Fatalf("expected redacted error body, got %q", body)
+	}
+}
+
+func TestProxy_HotReloadsPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	write := func(rules string) {
+		t.Helper()
+		bundle := `{"mode":"guardrails","policy_id":"http-reload","rules":[` + rules + `]}`
+		if err := os.WriteFile(path, []byte(bundle), 0o600); err != nil {
+			t.Fatalf("write policy: %v", err)
+		}
+	}
+	write("")
+	f := newProxyFixture(t, false, "", func(p *Proxy) {
+		p.WatchPolicyFile(path, 10*time.Millisecond)
+	})
+
+	deleteRepo := `{"jsonrpc":"2.0","id":"d","method":"tools/call","params":{"name":"delete_repo","arguments":{}}}`
+	errorCode := func() int {
+		resp := f.post(t, deleteRepo)
+		defer resp.Body.Close()
+		var rpc struct {
+			Error *struct {
+				Code int `json:"code"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&rpc)
+		if rpc.Error == nil {
+			return 0
+		}
+		return rpc.Error.Code
+	}
+	if code := errorCode(); code != 0 {
+		t.Fatalf("expected call allowed before reload, got error %d", code)
+	}
+
+	write(`{"rule_id":"deny-delete","kind":"deny","match":{"tool_name":{"glob":["delete_repo"]}},"effect":{"action":"BLOCK"}}`)
+	deadline := time.Now().Add(2 * time.Second)
+	for errorCode() != -32081 {
+		if time.Now().After(deadline) {
+			t.Fatal("reloaded deny rule never took effect")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	events := f.finish(t)
+	loaded := eventsOfType(events, "policy_loaded")
+	if len(loaded) == 0 || field(loaded[len(loaded)-1], "policy", "success") != true {
+		t.Fatalf("expected a successful policy_loaded, got %+v", loaded)
+	}
+}
+
+func TestProxy_RunEndStatus(t *testing.T) {
+	terminatePolicy := `{"mode":"guardrails","policy_id":"p","rules":[{"rule_id":"stop","kind":"breaker","match":{"tool_name":{"glob":["delete_repo"]}},"effect":{"breaker":{"scope":"tool","repeat_threshold":1,"repeat_window_ms":10000,"on_trip":"TERMINATE_RUN"}}}]}`
+	deleteBody := `{"jsonrpc":"2.0","id":8,"method":"tools/call","params":{"name":"delete_repo","arguments":{}}}`
+
+	tests := []struct {
+		name   string
+		policy string
+		call   string
+		cancel bool
+		want   string
+	}{
+		{"served until closed", "", toolCallBody, false, "SUCCEEDED"},
+		{"cancelled by a signal", "", toolCallBody, true, "CANCELLED"},
+		{"terminated wins over cancelled", terminatePolicy, deleteBody, true, "TERMINATED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newProxyFixture(t, false, tt.policy)
+			f.post(t, tt.call).Body.Close()
+			if tt.cancel {
+				f.proxy.Cancel()
+			}
+
+			runEnd := eventsOfType(f.finish(t), "run_end")
+			if len(runEnd) != 1 {
+				t.Fatalf("expected one run_end, got %d", len(runEnd))
+			}
+			if got := field(runEnd[0], "run", "status"); got != tt.want {
+				t.Errorf("run_end status = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -46,6 +46,10 @@ const (
 	ErrCodePolicyThrottled = -32082
 	ErrCodeRejectWithHint  = -32083
 	ErrCodeRunTerminated   = -32084
+
+	// Implementation-defined server errors (JSON-RPC reserves -32000 to -32099)
+	ErrCodeUpstreamTimeout = -32001
+	ErrCodeUpstreamExited  = -32002
 )
 
 // ToolsCallParams represents the params for a tools/call request.
@@ -72,6 +76,17 @@ func IsToolsCall(req *JSONRPCRequest) bool {
 	return req.Method == "tools/call"
 }
 
+// IsToolsList returns true if the request is a tools/list method.
+func IsToolsList(req *JSONRPCRequest) bool {
+	return req.Method == "tools/list"
+}
+
+// IsHandshake returns true for the initialize request and the
+// initialized notification that follows it.
+func IsHandshake(req *JSONRPCRequest) bool {
+	return req.Method == "initialize" || req.Method == "notifications/initialized"
+}
+
 // IsNotification returns true if the request is a notification (no ID).
 func IsNotification(req *JSONRPCRequest) bool {
 	return req.ID == nil
@@ -0,0 +1,209 @@
+// Package mcpstdio implements the MCP stdio adapter.
+//
+// This file defines the resource limits for upstream processes:
+// - Memory, CPU seconds, open files and processes, set as rlimits at exec
+// - Optionally a cgroup v2 subtree, where one is writable (Linux)
+// - Breaches, detected from exit signals, cgroup counters and stderr
+//
+// Per Interface-Pack §7.7
+package mcpstdio
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+// Limits caps the resources of an upstream process. Zero fields are
+// unlimited.
+type Limits struct {
+	MemoryBytes uint64        // Address space (RLIMIT_AS); memory.max in a cgroup
+	CPU         time.Duration // CPU time, whole seconds (RLIMIT_CPU)
+	OpenFiles   uint64        // Open file descriptors (RLIMIT_NOFILE)
+	Processes   uint64        // Processes of the user (RLIMIT_NPROC); pids.max in a cgroup
+	Cgroup      bool          // Also confine the upstream to a cgroup v2 subtree
+}
+
+// IsZero reports whether no limit is set.
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// ParseByteSize parses a size such as 512M, 2G or 1048576 (bytes).
+// Suffixes K, M, G and T are powers of 1024.
+func ParseByteSize(s string) (uint64, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "B"), "I")
+	shift := 0
+	if n := len(text); n > 0 {
+		switch text[n-1] {
+		case 'K':
+			shift = 10
+		case 'M':
+			shift = 20
+		case 'G':
+			shift = 30
+		case 'T':
+			shift = 40
+		}
+		if shift > 0 {
+			text = text[:n-1]
+		}
+	}
+	value, err := strconv.ParseUint(text, 10, 64)
+	if err != nil || value == 0 || value > math.MaxUint64>>shift {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 512M or 2G)", s)
+	}
+	return value << shift, nil
+}
+
+// stderrBreaches maps what runtimes print when a limit bites to the limit.
+// Matched lowercase; only limits that are set are reported.
+var stderrBreaches = []struct {
+	resource string
+	patterns []string
+}{
+	{event.LimitMemory, []string{"out of memory", "cannot allocate memory", "failed to reserve", "memoryerror", "bad_alloc"}},
+	{event.LimitFiles, []string{"too many open files"}},
+	{event.LimitProcesses, []string{"fork: resource temporarily unavailable", "can't start new thread", "failed to create new os thread"}},
+}
+
+// limitWatch reports the breaches of one UpstreamProcess, at most once
+// per resource and source for each process.
+type limitWatch struct {
+	limits Limits
+	report func(event.UpstreamLimitInfo)
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newLimitWatch(limits Limits) *limitWatch {
+	return &limitWatch{limits: limits, seen: make(map[string]bool)}
+}
+
+// value returns the configured limit for resource, in its event unit.
+func (w *limitWatch) value(resource string) uint64 {
+	switch resource {
+	case event.LimitMemory:
+		return w.limits.MemoryBytes
+	case event.LimitCPU:
+		return uint64(w.limits.CPU / time.Second)
+	case event.LimitFiles:
+		return w.limits.OpenFiles
+	case event.LimitProcesses:
+		return w.limits.Processes
+	}
+	return 0
+}
+
+func (w *limitWatch) breach(resource, source, detail string) {
+	limit := w.value(resource)
+	if limit == 0 {
+		return
+	}
+	// Reported under mu, so nothing is reported once OnLimitBreach(nil) returns
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := resource + "/" + source
+	if w.seen[key] || w.report == nil {
+		return
+	}
+	w.seen[key] = true
+	w.report(event.UpstreamLimitInfo{Resource: resource, Limit: limit, Source: source, Detail: detail})
+}
+
+// restarted forgets what was reported for the previous process.
+func (w *limitWatch) restarted() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seen = make(map[string]bool)
+}
+
+// stderrLine checks a redacted stderr line for a limit error.
+func (w *limitWatch) stderrLine(line string) {
+	lower := strings.ToLower(line)
+	for _, candidate := range stderrBreaches {
+		for _, pattern := range candidate.patterns {
+			if strings.Contains(lower, pattern) {
+				w.breach(candidate.resource, event.LimitSourceStderr, line)
+				break
+			}
+		}
+	}
+}
+
+// exited checks how the process ended: SIGXCPU, or a SIGKILL after using
+// up its CPU time, means the CPU limit.
+func (w *limitWatch) exited(state *os.ProcessState) {
+	if w.limits.CPU <= 0 || state == nil {
+		return
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return
+	}
+	used := state.UserTime() + state.SystemTime()
+	switch {
+	case status.Signal() == syscall.SIGXCPU:
+		w.breach(event.LimitCPU, event.LimitSourceSignal, "SIGXCPU")
+	case status.Signal() == syscall.SIGKILL && used >= w.limits.CPU:
+		w.breach(event.LimitCPU, event.LimitSourceSignal, "SIGKILL")
+	}
+}
+
+// LimitTrampoline must be the first call in main of a binary that starts
+// upstreams with limits. Start re-executes the binary in place of the
+// upstream; in that copy LimitTrampoline sets the rlimits and execs the
+// upstream, never returning, so the upstream runs limited from its first
+// instruction. Without the call, rlimits are set just after the upstream
+// starts, and anything it forks before then escapes them.
+func LimitTrampoline() {
+	limitTrampoline()
+}
+
+// SetLimits confines every process Start launches from now on. On Linux,
+// rlimits always apply and an error means the cgroup could not be set up;
+// elsewhere nothing applies and the error says so.
+func (up *UpstreamProcess) SetLimits(limits Limits) error {
+	up.mu.Lock()
+	up.limits = newLimitWatch(limits)
+	up.mu.Unlock()
+	if limits.IsZero() {
+		return nil
+	}
+	sb, err := newSandbox(limits)
+	up.mu.Lock()
+	up.sandbox = sb
+	up.mu.Unlock()
+	return err
+}
+
+// OnLimitBreach sets the function told about limit breaches; nil stops
+// reporting.
+func (up *UpstreamProcess) OnLimitBreach(report func(event.UpstreamLimitInfo)) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if up.limits != nil {
+		up.limits.mu.Lock()
+		up.limits.report = report
+		up.limits.mu.Unlock()
+	}
+}
+
+// CheckStderr reports a limit breach the upstream wrote to stderr.
+func (up *UpstreamProcess) CheckStderr(line string) {
+	up.mu.Lock()
+	w := up.limits
+	up.mu.Unlock()
+	if w != nil {
+		w.stderrLine(line)
+	}
+}
@@ -0,0 +1,355 @@
+//go:build linux
+
+package mcpstdio
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+// RLIMIT_NPROC is missing from package syscall; the MIPS ports number it 8.
+var rlimitNPROC = func() int {
+	switch runtime.GOARCH {
+	case "mips", "mipsle", "mips64", "mips64le":
+		return 8
+	}
+	return 6
+}()
+
+// cgroupPollInterval is how often cgroup event counters are read.
+const cgroupPollInterval = 500 * time.Millisecond
+
+// limitExecEnv marks a process started as the limit trampoline; its value
+// is the JSON list of rlimits to set before exec'ing the upstream.
+const limitExecEnv = "SUB_INTERNAL_RLIMITS"
+
+// trampolineReady is set once LimitTrampoline has run in this binary, so
+// re-executing it reaches the trampoline.
+var trampolineReady atomic.Bool
+
+// sandbox applies Limits to each upstream process: rlimits set by a
+// trampoline before the upstream's exec (or through prlimit(2) just after
+// it starts, when the binary has no trampoline), and a cgroup v2 subtree
+// it joins at fork, so nothing escapes it.
+type sandbox struct {
+	limits Limits
+
+	cgroup   string // Directory of the subtree; "" when not used
+	cgroupFD int
+
+	mu     sync.Mutex
+	counts map[string]uint64 // Last cgroup event counters seen
+}
+
+// newSandbox prepares the limits. The sandbox is usable even when the
+// cgroup cannot be set up; the error says why.
+func newSandbox(limits Limits) (*sandbox, error) {
+	sb := &sandbox{limits: limits, cgroupFD: -1, counts: make(map[string]uint64)}
+	if !limits.Cgroup {
+		return sb, nil
+	}
+	if err := sb.createCgroup(); err != nil {
+		return sb, fmt.Errorf("cgroup: %w; using rlimits only", err)
+	}
+	return sb, nil
+}
+
+// createCgroup makes a subtree next to the shim's own cgroup: the shim's
+// cgroup holds processes, so it cannot have children with controllers.
+func (sb *sandbox) createCgroup() error {
+	own, mount, err := cgroupV2Paths()
+	if err != nil {
+		return err
+	}
+	parent := filepath.Join(mount, filepath.Dir(own))
+	dir := filepath.Join(parent, fmt.Sprintf("subluminal-%d", os.Getpid()))
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return fmt.Errorf("%s is not writable: %w", parent, err)
+	}
+
+	settings := map[string]string{}
+	if sb.limits.MemoryBytes > 0 {
+		settings["memory.max"] = strconv.FormatUint(sb.limits.MemoryBytes, 10)
+	}
+	if sb.limits.Processes > 0 {
+		settings["pids.max"] = strconv.FormatUint(sb.limits.Processes, 10)
+	}
+	for file, value := range settings {
+		if err := writeCgroupFile(parent, dir, file, value); err != nil {
+			os.Remove(dir)
+			return err
+		}
+	}
+	if sb.limits.MemoryBytes > 0 {
+		// Without this a memory-bound upstream swaps instead of hitting the limit
+		os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0o644)
+	}
+
+	fd, err := syscall.Open(dir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		os.Remove(dir)
+		return err
+	}
+	sb.cgroup, sb.cgroupFD = dir, fd
+	return nil
+}
+
+// writeCgroupFile writes a controller setting, enabling the controller
+// in the parent first if it is not yet available.
+func writeCgroupFile(parent, dir, file, value string) error {
+	path := filepath.Join(dir, file)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		controller, _, _ := strings.Cut(file, ".")
+		os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+"+controller), 0o644)
+	}
+	if err := os.WriteFile(path, []byte(value), 0o644); err != nil {
+		return fmt.Errorf("set %s: %w", file, err)
+	}
+	return nil
+}
+
+// cgroupV2Paths returns the shim's cgroup v2 path and where the cgroup v2
+// hierarchy is mounted.
+func cgroupV2Paths() (own, mount string, err error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			own = path
+		}
+	}
+	if own == "" {
+		return "", "", fmt.Errorf("no cgroup v2 hierarchy")
+	}
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// ID parent major:minor root mount-point options ... - fstype source options
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" && len(fields) > 4 {
+				return own, fields[4], nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("cgroup v2 is not mounted")
+}
+
+// prepare makes the process join the cgroup at fork and, when the binary
+// has a trampoline, start as the trampoline so its rlimits are set before
+// the upstream's exec. Reports whether the rlimits are taken care of;
+// otherwise call apply once the process has started.
+func (sb *sandbox) prepare(cmd *exec.Cmd) bool {
+	if sb.cgroupFD >= 0 {
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = sb.cgroupFD
+	}
+	limits := sb.rlimits()
+	if len(limits) == 0 {
+		return true
+	}
+	if !trampolineReady.Load() || cmd.Err != nil {
+		return false
+	}
+	if _, err := exec.LookPath(cmd.Path); err != nil {
+		// Left for Start to report, as without limits
+		return false
+	}
+	spec, err := json.Marshal(limits)
+	if err != nil {
+		return false
+	}
+	// The trampoline gets the upstream's path, then its argv
+	cmd.Args = append([]string{cmd.Args[0], cmd.Path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+	cmd.Env = append(cmd.Env, limitExecEnv+"="+string(spec))
+	return true
+}
+
+// rlimit is one resource limit, as handed to the trampoline.
+type rlimit struct {
+	Name     string `json:"name"`
+	Resource int    `json:"resource"`
+	Soft     uint64 `json:"soft"`
+	Hard     uint64 `json:"hard"`
+}
+
+// rlimits lists the rlimits for Limits. Soft and hard limits are equal,
+// except CPU: SIGXCPU at the limit, SIGKILL a second later.
+func (sb *sandbox) rlimits() []rlimit {
+	var limits []rlimit
+	if n := sb.limits.MemoryBytes; n > 0 {
+		limits = append(limits, rlimit{"memory", syscall.RLIMIT_AS, n, n})
+	}
+	if d := sb.limits.CPU; d > 0 {
+		seconds := max(uint64((d+time.Second-1)/time.Second), 1)
+		limits = append(limits, rlimit{"cpu", syscall.RLIMIT_CPU, seconds, seconds + 1})
+	}
+	if n := sb.limits.OpenFiles; n > 0 {
+		limits = append(limits, rlimit{"files", syscall.RLIMIT_NOFILE, n, n})
+	}
+	if n := sb.limits.Processes; n > 0 {
+		limits = append(limits, rlimit{"processes", rlimitNPROC, n, n})
+	}
+	return limits
+}
+
+// apply sets the rlimits of a started process. Children it forked before
+// the call keep their old limits; prepare avoids that where it can.
+func (sb *sandbox) apply(pid int) error {
+	for _, l := range sb.rlimits() {
+		if err := prlimit(pid, l.Resource, &syscall.Rlimit{Cur: l.Soft, Max: l.Hard}); err != nil {
+			return fmt.Errorf("%s limit: %w", l.Name, err)
+		}
+	}
+	return nil
+}
+
+// limitTrampoline runs in a process prepare started: it sets the rlimits
+// and execs the upstream. Elsewhere it only records that it ran.
+func limitTrampoline() {
+	spec, ok := os.LookupEnv(limitExecEnv)
+	if !ok {
+		trampolineReady.Store(true)
+		return
+	}
+	os.Unsetenv(limitExecEnv)
+	err := execLimited(spec, os.Args[1:])
+	fmt.Fprintf(os.Stderr, "subluminal: cannot start upstream: %v\n", err)
+	os.Exit(126)
+}
+
+// execLimited sets the rlimits in spec, then execs argv[0] with argv[1:]
+// as its argv. Returns only on failure.
+func execLimited(spec string, argv []string) error {
+	var limits []rlimit
+	if err := json.Unmarshal([]byte(spec), &limits); err != nil {
+		return err
+	}
+	if len(argv) < 2 {
+		return errors.New("no upstream command")
+	}
+	// Convert everything first: once the memory limit is set, the
+	// runtime may be unable to allocate.
+	path, err := syscall.BytePtrFromString(argv[0])
+	if err != nil {
+		return err
+	}
+	args, err := syscall.SlicePtrFromStrings(argv[1:])
+	if err != nil {
+		return err
+	}
+	env, err := syscall.SlicePtrFromStrings(os.Environ())
+	if err != nil {
+		return err
+	}
+	for _, l := range limits {
+		// Setrlimit, unlike a raw prlimit, stops the runtime restoring
+		// its original open-files limit at exec
+		if err := syscall.Setrlimit(l.Resource, &syscall.Rlimit{Cur: l.Soft, Max: l.Hard}); err != nil {
+			return fmt.Errorf("%s limit: %w", l.Name, err)
+		}
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_EXECVE, uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(&args[0])), uintptr(unsafe.Pointer(&env[0])))
+	return fmt.Errorf("exec %s: %w", argv[0], errno)
+}
+
+func prlimit(pid, resource int, limit *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(limit)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// watch polls the cgroup counters until exited closes.
+func (sb *sandbox) watch(w *limitWatch, exited <-chan struct{}) {
+	if sb.cgroup == "" {
+		return
+	}
+	ticker := time.NewTicker(cgroupPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+			sb.check(w)
+		}
+	}
+}
+
+// check reports cgroup counters that went up since the last check.
+func (sb *sandbox) check(w *limitWatch) {
+	if sb.cgroup == "" {
+		return
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	counters := []struct {
+		file, key, resource string
+	}{
+		{"memory.events", "oom_kill", event.LimitMemory},
+		{"pids.events", "max", event.LimitProcesses},
+	}
+	for _, c := range counters {
+		n, ok := readCgroupCounter(filepath.Join(sb.cgroup, c.file), c.key)
+		if !ok || n <= sb.counts[c.file] {
+			continue
+		}
+		sb.counts[c.file] = n
+		w.breach(c.resource, event.LimitSourceCgroup, fmt.Sprintf("%s %s %d", c.file, c.key, n))
+	}
+}
+
+func readCgroupCounter(path, key string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, key+" "); ok {
+			n, err := strconv.ParseUint(value, 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+// close kills what is left in the cgroup and removes it.
+func (sb *sandbox) close() {
+	if sb.cgroup == "" {
+		return
+	}
+	os.WriteFile(filepath.Join(sb.cgroup, "cgroup.kill"), []byte("1"), 0o644)
+	syscall.Close(sb.cgroupFD)
+	for i := 0; i < 10; i++ {
+		if err := os.Remove(sb.cgroup); err == nil || errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	sb.cgroup, sb.cgroupFD = "", -1
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+
+package mcpstdio
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// Resource limits need prlimit(2) and cgroups; elsewhere the upstream
+// runs unconfined.
+
+type sandbox struct{}
+
+func newSandbox(limits Limits) (*sandbox, error) {
+	return nil, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
+
+func (sb *sandbox) prepare(cmd *exec.Cmd) bool {
+	return true
+}
+
+func (sb *sandbox) apply(pid int) error {
+	return nil
+}
+
+func (sb *sandbox) watch(w *limitWatch, exited <-chan struct{}) {}
+
+func (sb *sandbox) check(w *limitWatch) {}
+
+func (sb *sandbox) close() {}
+
+func limitTrampoline() {}
@@ -3,7 +3,7 @@
 // This file handles upstream process management:
 // - Spawning the upstream MCP server as a subprocess
 // - Signal forwarding (SIGINT, SIGTERM)
-// - Clean shutdown on EOF
+// - Clean shutdown on EOF, escalating to SIGKILL for the whole process group
 //
 // Per Interface-Pack §7.4:
 // - Adapters handle transport-specific process lifecycle
@@ -14,17 +14,38 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"sync"
 	"syscall"
 	"time"
 )
 
 // UpstreamProcess manages a subprocess running an MCP server.
 type UpstreamProcess struct {
+	// Current process; replaced on restart (supervisor.go)
+	mu     sync.Mutex
 	cmd    *exec.Cmd
+	pgid   int // Outlives the process while children it left are in the group
 	stdin  io.WriteCloser
 	stdout io.ReadCloser
 	stderr io.ReadCloser
 
+	// Serializes JSON-RPC lines written to stdin
+	writeMu sync.Mutex
+
+	// Closed once the current process has exited and exitState is set
+	exited    chan struct{}
+	exitState *os.ProcessState
+	exitErr   error
+
+	// Supervisor mode (optional)
+	restartPolicy *RestartPolicy
+	restarts      []time.Time // Restarts within the policy window
+	handshake     [][]byte    // Replayed to each restarted process
+
+	// Resource limits (optional, limits.go)
+	limits  *limitWatch
+	sandbox *sandbox
+
 	// Configuration
 	command string
 	args    []string
@@ -49,59 +70,138 @@ func (up *UpstreamProcess) SetEnv(env []string) {
 
 // Start launches the upstream process.
 func (up *UpstreamProcess) Start() error {
-	up.cmd = exec.Command(up.command, up.args...)
-	up.cmd.Env = up.env
+	cmd := exec.Command(up.command, up.args...)
+	cmd.Env = up.env
 
 	// Set process group so we can signal the whole group
-	up.cmd.SysProcAttr = &syscall.SysProcAttr{
+	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 	}
+	setParentDeathSignal(cmd.SysProcAttr)
+
+	up.mu.Lock()
+	limits, sb := up.limits, up.sandbox
+	up.mu.Unlock()
+	limitedAtExec := true
+	if sb != nil {
+		limitedAtExec = sb.prepare(cmd)
+	}
 
 	// Get pipes
-	var err error
-	up.stdin, err = up.cmd.StdinPipe()
+	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("failed to get stdin pipe: %w", err)
 	}
 
-	up.stdout, err = up.cmd.StdoutPipe()
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
 
-	up.stderr, err = up.cmd.StderrPipe()
+	stderr, err := cmd.StderrPipe()
 	if err != nil {
 		return fmt.Errorf("failed to get stderr pipe: %w", err)
 	}
 
 	// Start the process
-	if err := up.cmd.Start(); err != nil {
+	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start upstream process: %w", err)
 	}
+	if !limitedAtExec {
+		if err := sb.apply(cmd.Process.Pid); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return fmt.Errorf("failed to limit upstream process: %w", err)
+		}
+	}
+	if limits != nil {
+		limits.restarted()
+	}
+
+	// Reap the process as soon as it exits. Process.Wait, unlike cmd.Wait,
+	// leaves the pipes open for the proxy to drain.
+	exited := make(chan struct{})
+	up.mu.Lock()
+	up.cmd, up.stdin, up.stdout, up.stderr = cmd, stdin, stdout, stderr
+	up.pgid = cmd.Process.Pid // Setpgid makes the process its group's leader
+	up.exited, up.exitState, up.exitErr = exited, nil, nil
+	up.mu.Unlock()
+	go func() {
+		state, err := cmd.Process.Wait()
+		if sb != nil {
+			sb.check(limits)
+		}
+		if limits != nil {
+			limits.exited(state)
+		}
+		up.mu.Lock()
+		up.exitState, up.exitErr = state, err
+		up.mu.Unlock()
+		close(exited)
+	}()
+	if sb != nil && limits != nil {
+		go sb.watch(limits, exited)
+	}
 
 	return nil
 }
 
 // Stdin returns the write end of the upstream's stdin pipe.
 func (up *UpstreamProcess) Stdin() io.WriteCloser {
+	up.mu.Lock()
+	defer up.mu.Unlock()
 	return up.stdin
 }
 
 // Stdout returns the read end of the upstream's stdout pipe.
 func (up *UpstreamProcess) Stdout() io.ReadCloser {
+	up.mu.Lock()
+	defer up.mu.Unlock()
 	return up.stdout
 }
 
 // Stderr returns the read end of the upstream's stderr pipe.
 func (up *UpstreamProcess) Stderr() io.ReadCloser {
+	up.mu.Lock()
+	defer up.mu.Unlock()
 	return up.stderr
 }
 
+// Write sends one JSON-RPC line to the upstream. It fails once the
+// process has exited, until a restart replaces it.
+func (up *UpstreamProcess) Write(line []byte) error {
+	up.mu.Lock()
+	stdin, exited := up.stdin, up.exited
+	up.mu.Unlock()
+	if stdin == nil {
+		return fmt.Errorf("process not started")
+	}
+	select {
+	case <-exited:
+		return os.ErrProcessDone
+	default:
+	}
+
+	// A full pipe blocks here, so this must not hold mu
+	up.writeMu.Lock()
+	defer up.writeMu.Unlock()
+	_, err := stdin.Write(append(line[:len(line):len(line)], '\n'))
+	return err
+}
+
 // Signal sends a signal to the upstream process group.
 func (up *UpstreamProcess) Signal(sig os.Signal) error {
+	up.mu.Lock()
+	defer up.mu.Unlock()
 	if up.cmd == nil || up.cmd.Process == nil {
 		return nil
 	}
+	// A reaped PID may already belong to another process
+	select {
+	case <-up.exited:
+		return os.ErrProcessDone
+	default:
+	}
 
 	// Send to process group (negative PID)
 	pgid, err := syscall.Getpgid(up.cmd.Process.Pid)
@@ -114,63 +214,145 @@ func (up *UpstreamProcess) Signal(sig os.Signal) error {
 }
 
 // Wait waits for the upstream process to exit.
-// Returns the process state or error.
+// Returns the process state or error; safe to call more than once.
 func (up *UpstreamProcess) Wait() (*os.ProcessState, error) {
-	if up.cmd == nil {
+	exited := up.Exited()
+	if exited == nil {
 		return nil, fmt.Errorf("process not started")
 	}
-	return up.cmd.Process.Wait()
+	<-exited
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return up.exitState, up.exitErr
+}
+
+// Exited returns a channel closed once the upstream process has exited.
+// It is nil, and so never ready, before Start.
+func (up *UpstreamProcess) Exited() <-chan struct{} {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return up.exited
 }
 
-// Stop gracefully stops the upstream process.
-// Sends SIGTERM, waits for timeout, then SIGKILL if needed.
+// Stop gracefully stops the upstream's whole process group: stdin is
+// closed and the group gets SIGTERM. Whatever is left after timeout,
+// children the upstream left behind included, gets SIGKILL.
 func (up *UpstreamProcess) Stop(timeout time.Duration) error {
-	if up.cmd == nil || up.cmd.Process == nil {
+	exited := up.Exited()
+	if exited == nil {
 		return nil
 	}
 
 	// Close stdin to signal EOF
-	if up.stdin != nil {
-		up.stdin.Close()
+	up.CloseStdin()
+
+	up.mu.Lock()
+	pgid := up.pgid
+	up.mu.Unlock()
+	if !groupAlive(pgid) {
+		<-exited
+		return nil
 	}
 
-	// Send SIGTERM
-	if err := up.Signal(syscall.SIGTERM); err != nil {
-		// Process might already be gone
+	syscall.Kill(-pgid, syscall.SIGTERM)
+	if waitGroupExit(exited, pgid, timeout) {
 		return nil
 	}
 
-	// Wait for exit with timeout
-	done := make(chan error, 1)
-	go func() {
-		_, err := up.cmd.Process.Wait()
-		done <- err
-	}()
+	// Force kill
+	syscall.Kill(-pgid, syscall.SIGKILL)
+	<-exited
+	return nil
+}
+
+// groupPollInterval is how often Stop checks whether a group is empty.
+const groupPollInterval = 20 * time.Millisecond
 
+// groupAlive reports whether any process is left in the group.
+func groupAlive(pgid int) bool {
+	return pgid > 0 && syscall.Kill(-pgid, 0) == nil
+}
+
+// waitGroupExit waits up to timeout for the process to exit and its group
+// to empty.
+func waitGroupExit(exited <-chan struct{}, pgid int, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
 	select {
-	case <-done:
-		return nil
-	case <-time.After(timeout):
-		// Force kill
-		up.Signal(syscall.SIGKILL)
-		<-done
-		return nil
+	case <-exited:
+	case <-deadline.C:
+		return false
+	}
+	ticker := time.NewTicker(groupPollInterval)
+	defer ticker.Stop()
+	for groupAlive(pgid) {
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return false
+		}
+	}
+	return true
+}
+
+// Release removes what SetLimits set up outside the process, such as the
+// cgroup. Call it after the final Stop.
+func (up *UpstreamProcess) Release() {
+	up.mu.Lock()
+	sb := up.sandbox
+	up.sandbox = nil
+	up.mu.Unlock()
+	if sb != nil {
+		sb.close()
 	}
 }
 
 // CloseStdin closes the upstream's stdin pipe.
 // This signals EOF to the upstream process.
 func (up *UpstreamProcess) CloseStdin() error {
-	if up.stdin != nil {
-		return up.stdin.Close()
+	if stdin := up.Stdin(); stdin != nil {
+		return stdin.Close()
 	}
 	return nil
 }
 
 // Pid returns the process ID of the upstream process, or -1 if not started.
 func (up *UpstreamProcess) Pid() int {
+	up.mu.Lock()
+	defer up.mu.Unlock()
 	if up.cmd == nil || up.cmd.Process == nil {
 		return -1
 	}
 	return up.cmd.Process.Pid
 }
+
+// signalNames covers the signals that usually end an MCP server.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGXCPU: "SIGXCPU",
+	syscall.SIGXFSZ: "SIGXFSZ",
+}
+
+// exitSignal returns the name of the signal that killed the process,
+// or "" if it exited on its own.
+func exitSignal(state *os.ProcessState) string {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	sig := status.Signal()
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return fmt.Sprintf("SIG%d", int(sig))
+}
@@ -0,0 +1,11 @@
+//go:build linux
+
+package mcpstdio
+
+import "syscall"
+
+// setParentDeathSignal has the kernel kill the upstream if the shim dies
+// without stopping it, such as on SIGKILL.
+func setParentDeathSignal(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = syscall.SIGKILL
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package mcpstdio
+
+import "syscall"
+
+// Parent-death signals are Linux only; elsewhere Stop is the only cleanup.
+func setParentDeathSignal(attr *syscall.SysProcAttr) {}
@@ -6,6 +6,7 @@
 // - Forwards requests to upstream MCP server
 // - Reads responses from upstream
 // - Emits tool_call_end events
+// - Optionally hides or annotates policy-denied tools in tools/list
 // - Forwards responses to stdout (agent client)
 //
 // Per Interface-Pack §7:
@@ -17,7 +18,11 @@ package mcpstdio
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -28,38 +33,68 @@ import (
 	"github.com/peakyragnar/subluminal/pkg/secret"
 )
 
-const defaultThrottleBackoffMS = 1000
+// Transport is the call.transport value for events from this adapter.
+const Transport = "mcp_stdio"
+
+// terminateStopTimeout bounds how long a TERMINATE_RUN waits for the
+// upstream to exit after SIGTERM before escalating to SIGKILL.
+const terminateStopTimeout = 5 * time.Second
+
+// upstreamExitGrace bounds how long run_end waits for the upstream to exit
+// and finish writing stderr once its stdout has closed.
+const upstreamExitGrace = 500 * time.Millisecond
+
+// lateResponseTTL is how long a response to a timed-out or orphaned call
+// is still recognized and dropped; maxTimedOutIDs caps how many such IDs
+// are remembered.
+const (
+	lateResponseTTL = 10 * time.Minute
+	maxTimedOutIDs  = 4096
+)
 
 // Proxy handles bidirectional JSON-RPC proxying with event emission.
 type Proxy struct {
 	// Upstream process
 	upstream *UpstreamProcess
 
-	// Event emitter
-	emitter *core.Emitter
-
-	// Run state
-	state *core.RunState
-
-	// Identity
-	identity     core.Identity
-	source       core.Source
-	serverName   string
-	policy       policy.Bundle
-	policyTarget policy.SelectorTarget
-	redactor     *Redactor
+	// Policy, events and run status, shared with the other adapters
+	enforcer   *core.Enforcer
+	state      *core.RunState
+	serverName string
+	runID      string
+	redactor   *core.Redactor
 
 	// Secret injection metadata
 	secretEvents []secret.InjectionEvent
 
 	// I/O
-	agentIn  io.Reader
-	agentOut io.Writer
+	agentIn    io.Reader
+	agentOut   io.Writer
+	agentOutMu sync.Mutex
 
 	// Request tracking for response matching
 	pendingCalls map[any]*pendingCall
+	timedOut     map[any]time.Time // IDs whose late responses are dropped, until the given time
 	pendingMu    sync.RWMutex
 
+	// Default upstream deadline per call; 0 disables
+	callTimeout time.Duration
+
+	// tools/list rewrite mode and the request IDs awaiting rewrite
+	toolsListMode string
+	listRequests  map[any]struct{} // guarded by pendingMu
+
+	// Upstream stderr handling: event or passthrough to stderrOut
+	stderrMode string
+	stderrOut  io.Writer
+	stderrTap  *stderrTap
+	stderrDone <-chan struct{} // Current upstream's stderr drained; replaced on restart
+
+	// Supervisor mode: the agent's initialize ID, whose replayed response
+	// is dropped, and whether the agent has closed stdin
+	initID   any // guarded by pendingMu
+	agentEOF chan struct{}
+
 	// Shutdown coordination
 	done      chan struct{}
 	closeOnce sync.Once
@@ -70,7 +105,11 @@ type pendingCall struct {
 	callID   string
 	toolName string
 	argsHash string
+	args     map[string]any
 	startSeq int
+
+	timeout time.Duration
+	timer   *time.Timer // nil when no deadline applies
 }
 
 // NewProxy creates a new bidirectional proxy.
@@ -82,46 +121,75 @@ func NewProxy(
 	source core.Source,
 	agentIn io.Reader,
 	agentOut io.Writer,
-	redactor *Redactor,
+	redactor *core.Redactor,
 	secretEvents []secret.InjectionEvent,
 ) *Proxy {
-	policyBundle := policy.LoadFromEnv()
-	if redactor == nil {
-		redactor = NewRedactor(nil)
-	}
-	policyTarget := policy.SelectorTarget{
-		Env:     string(identity.Env),
-		AgentID: identity.AgentID,
-		Client:  string(identity.Client),
-	}
+	enforcer := core.NewEnforcer(emitter, serverName, Transport, identity, source, redactor)
 	return &Proxy{
-		upstream:     upstream,
-		emitter:      emitter,
-		state:        core.NewRunState(),
-		identity:     identity,
-		source:       source,
-		serverName:   serverName,
-		policy:       policyBundle,
-		policyTarget: policyTarget,
-		redactor:     redactor,
-		secretEvents: append([]secret.InjectionEvent{}, secretEvents...),
-		agentIn:      agentIn,
-		agentOut:     agentOut,
-		pendingCalls: make(map[any]*pendingCall),
-		done:         make(chan struct{}),
+		upstream:      upstream,
+		enforcer:      enforcer,
+		state:         enforcer.State(),
+		serverName:    serverName,
+		runID:         identity.RunID,
+		redactor:      enforcer.Redactor(),
+		secretEvents:  append([]secret.InjectionEvent{}, secretEvents...),
+		agentIn:       agentIn,
+		agentOut:      agentOut,
+		pendingCalls:  make(map[any]*pendingCall),
+		timedOut:      make(map[any]time.Time),
+		listRequests:  make(map[any]struct{}),
+		toolsListMode: ToolsListPassthrough,
+		stderrMode:    UpstreamStderrEvent,
+		agentEOF:      make(chan struct{}),
+		done:          make(chan struct{}),
 	}
 }
 
+// WatchPolicyFile enables hot reload of the policy bundle at path.
+// Must be called before Run; the watcher stops when the proxy stops.
+func (p *Proxy) WatchPolicyFile(path string, interval time.Duration) {
+	p.enforcer.WatchPolicyFile(path, interval)
+}
+
+// SetCallTimeout sets the default upstream deadline for each tools/call.
+// A rule's effect.timeout_ms overrides it; zero disables the deadline.
+// Must be called before Run.
+func (p *Proxy) SetCallTimeout(timeout time.Duration) {
+	p.callTimeout = timeout
+}
+
+// SetStateStore persists budget, rate-limit, breaker and dedupe state in
+// store so it survives shim restarts. Must be called before Run.
+func (p *Proxy) SetStateStore(store policy.StateStore) {
+	p.enforcer.SetStateStore(store)
+}
+
+// SetToolsListMode sets how tools/list responses are rewritten:
+// passthrough, hide or annotate. Must be called before Run.
+func (p *Proxy) SetToolsListMode(mode string) {
+	p.toolsListMode = mode
+}
+
+// SetUpstreamStderr sets how upstream stderr lines are surfaced: as
+// upstream_log events, or passed through to out with a prefix. Must be
+// called before Run.
+func (p *Proxy) SetUpstreamStderr(mode string, out io.Writer) {
+	p.stderrMode = mode
+	p.stderrOut = out
+}
+
 // Run starts the proxy and blocks until completion.
 // Returns when stdin closes OR upstream exits (whichever comes first).
 func (p *Proxy) Run() error {
 	// Emit run_start
-	p.emitRunStart()
+	p.enforcer.EmitRunStart()
 	p.emitSecretInjectionEvents()
+	p.upstream.OnLimitBreach(p.emitUpstreamLimit)
 
 	// Start goroutines with individual completion channels
 	agentDone := make(chan struct{})
 	upstreamDone := make(chan struct{})
+	p.stderrDone = p.drainUpstreamStderr()
 
 	go func() {
 		defer close(agentDone)
@@ -131,6 +199,7 @@ func (p *Proxy) Run() error {
 		defer close(upstreamDone)
 		p.readFromUpstream()
 	}()
+	p.enforcer.WatchPolicy(p.done)
 
 	// Wait for EITHER to complete first
 	// The completion path determines whether we need to wait for the other side
@@ -144,8 +213,16 @@ func (p *Proxy) Run() error {
 		// Agent may still have stdin open; we can't block on that
 	}
 
+	// Stop the policy watcher and call deadlines so nothing follows run_end
+	p.Stop()
+	p.enforcer.WaitPolicy()
+	p.stopCallTimers()
+	upstreamExit := p.upstreamExit(p.stderrDone)
+	p.upstream.OnLimitBreach(nil)
+	orphaned := p.failOrphanedCalls(upstreamExit, false)
+
 	// Emit run_end (guaranteed to be last for the events we can emit)
-	p.emitRunEnd()
+	p.enforcer.EmitRunEnd(p.enforcer.RunStatus(upstreamExit != nil || orphaned > 0), upstreamExit)
 
 	return nil
 }
@@ -157,9 +234,199 @@ func (p *Proxy) Stop() {
 	})
 }
 
+// Cancel stops the proxy because the shim itself was asked to stop, such as
+// on SIGINT. run_end then reports CANCELLED, unless the run was already
+// ending for another reason.
+func (p *Proxy) Cancel() {
+	p.closeOnce.Do(func() {
+		p.enforcer.Cancel()
+		close(p.done)
+	})
+}
+
+// drainUpstreamStderr reads the current upstream's stderr until EOF. The
+// returned channel closes when it is drained. One tap, and so one tail for
+// run_end, spans restarts.
+func (p *Proxy) drainUpstreamStderr() <-chan struct{} {
+	done := make(chan struct{})
+	if p.stderrTap == nil {
+		p.stderrTap = &stderrTap{
+			redactor: p.redactor,
+			emit:     p.emitUpstreamLog,
+			check:    p.upstream.CheckStderr,
+			prefix:   fmt.Sprintf("[upstream %s] ", p.serverName),
+		}
+		if p.stderrMode == UpstreamStderrPassthrough {
+			p.stderrTap.out = p.stderrOut
+		}
+	}
+	stderr := p.upstream.Stderr()
+	if stderr == nil {
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		p.stderrTap.run(stderr)
+	}()
+	return done
+}
+
+// upstreamExit waits briefly for the upstream to exit and its stderr to
+// drain, then stops stderr delivery. Returns the exit for run_end, or nil
+// if the upstream exited zero or is still running.
+func (p *Proxy) upstreamExit(stderrDone <-chan struct{}) *event.UpstreamExit {
+	grace := time.NewTimer(upstreamExitGrace)
+	defer grace.Stop()
+
+	exited := true
+	select {
+	case <-p.upstream.Exited():
+		select {
+		case <-stderrDone:
+		case <-grace.C:
+		}
+	case <-grace.C:
+		exited = false
+	}
+	tail := p.stderrTap.close()
+	if !exited {
+		return nil
+	}
+
+	state, err := p.upstream.Wait()
+	if err != nil || state.Success() {
+		return nil
+	}
+	exit := exitInfo(state)
+	exit.StderrTail = tail
+	return exit
+}
+
+// exitInfo describes how an upstream process exited.
+func exitInfo(state *os.ProcessState) *event.UpstreamExit {
+	return &event.UpstreamExit{
+		ExitCode: state.ExitCode(),
+		Signal:   exitSignal(state),
+	}
+}
+
+// failOrphanedCalls ends every call the upstream never answered:
+// tool_call_end reports a transport error and the agent gets a JSON-RPC
+// error, retryable when a restarted upstream takes over. Returns the
+// number of calls failed.
+func (p *Proxy) failOrphanedCalls(exit *event.UpstreamExit, retryable bool) int {
+	p.pendingMu.Lock()
+	keys := make([]any, 0, len(p.pendingCalls))
+	orphaned := make(map[any]*pendingCall, len(p.pendingCalls))
+	for key, pending := range p.pendingCalls {
+		keys = append(keys, key)
+		orphaned[key] = pending
+		delete(p.pendingCalls, key)
+		if pending.timer != nil {
+			pending.timer.Stop()
+		}
+		// Drop a late answer to a call that raced a restart
+		p.markTimedOut(key)
+	}
+	p.pendingMu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		return orphaned[keys[i]].startSeq < orphaned[keys[j]].startSeq
+	})
+
+	message := "Upstream closed its output before responding"
+	detail := map[string]any{}
+	switch {
+	case exit != nil && exit.Signal != "":
+		message = fmt.Sprintf("Upstream was killed by %s before responding", exit.Signal)
+		detail["signal"] = exit.Signal
+	case exit != nil:
+		message = fmt.Sprintf("Upstream exited with code %d before responding", exit.ExitCode)
+		detail["exit_code"] = exit.ExitCode
+	}
+	reasonCode := "UPSTREAM_EXITED"
+	if retryable {
+		message += "; it is restarting"
+		reasonCode = "UPSTREAM_RESTARTING"
+	}
+
+	for _, key := range keys {
+		p.failCall(key, orphaned[key], message, reasonCode, retryable, detail)
+	}
+	return len(keys)
+}
+
+// failUnsentCall ends a call that could not be written to the upstream,
+// such as while it restarts. The call must still be pending.
+func (p *Proxy) failUnsentCall(id any) {
+	key := normalizeID(id)
+	p.pendingMu.Lock()
+	pending, ok := p.pendingCalls[key]
+	if ok {
+		delete(p.pendingCalls, key)
+		if pending.timer != nil {
+			pending.timer.Stop()
+		}
+	}
+	p.pendingMu.Unlock()
+	if !ok {
+		return
+	}
+
+	retryable := p.upstream.Supervised()
+	message := "Upstream exited before the call was sent"
+	reasonCode := "UPSTREAM_EXITED"
+	if retryable {
+		message = "Upstream is restarting"
+		reasonCode = "UPSTREAM_RESTARTING"
+	}
+	p.failCall(key, pending, message, reasonCode, retryable, nil)
+}
+
+// failCall reports a call the upstream will never answer, already removed
+// from pendingCalls.
+func (p *Proxy) failCall(id any, pending *pendingCall, message, reasonCode string, retryable bool, detail map[string]any) {
+	latencyMS := p.state.EndCall(pending.callID)
+	p.state.IncrementErrors()
+	p.recordOutcome(pending, event.CallStatusError, latencyMS)
+
+	data := map[string]any{
+		"v":           core.InterfaceVersion,
+		"reason_code": reasonCode,
+		"summary":     message,
+		"run_id":      p.runID,
+		"call_id":     pending.callID,
+		"server_name": p.serverName,
+		"tool_name":   pending.toolName,
+		"args_hash":   pending.argsHash,
+		"retryable":   retryable,
+	}
+	for k, v := range detail {
+		data[k] = v
+	}
+
+	var payload []byte
+	resp := NewErrorResponse(id, ErrCodeUpstreamExited, message, map[string]any{"subluminal": data})
+	if b, err := json.Marshal(resp); err == nil {
+		payload = b
+	}
+
+	p.enforcer.EmitToolCallEnd(pending.callID, pending.toolName, pending.argsHash, event.CallStatusError, latencyMS, len(payload), event.ResultPreview{}, &event.ErrorDetail{
+		Class:     "transport",
+		Message:   message,
+		Code:      ErrCodeUpstreamExited,
+		Retryable: retryable,
+	})
+
+	if payload != nil {
+		p.forwardToAgent(payload)
+	}
+}
+
 // readFromAgent reads requests from agent stdin and forwards to upstream.
 func (p *Proxy) readFromAgent() {
 	defer p.upstream.CloseStdin() // Signal EOF to upstream when agent is done
+	defer close(p.agentEOF)       // No restarts once the agent is gone
 
 	scanner := bufio.NewScanner(p.agentIn)
 	// Increase buffer size for large payloads
@@ -185,6 +452,23 @@ func (p *Proxy) readFromAgent() {
 			continue
 		}
 
+		if IsToolsList(&req) && req.ID != nil && p.toolsListMode != ToolsListPassthrough {
+			p.pendingMu.Lock()
+			p.listRequests[normalizeID(req.ID)] = struct{}{}
+			p.pendingMu.Unlock()
+		}
+
+		// Keep the handshake for replay to a restarted upstream
+		if IsHandshake(&req) {
+			initialize := !IsNotification(&req)
+			p.upstream.RecordHandshake(line, initialize)
+			if initialize {
+				p.pendingMu.Lock()
+				p.initID = normalizeID(req.ID)
+				p.pendingMu.Unlock()
+			}
+		}
+
 		// Intercept tools/call
 		if IsToolsCall(&req) {
 			if !p.interceptToolCall(&req, line) {
@@ -193,12 +477,20 @@ func (p *Proxy) readFromAgent() {
 		}
 
 		// Forward to upstream
-		p.forwardToUpstream(line)
+		if err := p.forwardToUpstream(line); err != nil && IsToolsCall(&req) && req.ID != nil {
+			p.failUnsentCall(req.ID)
+		}
 	}
 }
 
 // interceptToolCall processes a tools/call request and emits events.
 func (p *Proxy) interceptToolCall(req *JSONRPCRequest, rawLine []byte) bool {
+	// A terminated run never reaches upstream again
+	if termination := p.enforcer.Termination(); termination != nil {
+		p.rejectTerminated(req, termination)
+		return false
+	}
+
 	// Parse params
 	toolName, args, err := ParseToolsCallParams(req.Params)
 	if err != nil {
@@ -215,52 +507,45 @@ func (p *Proxy) interceptToolCall(req *JSONRPCRequest, rawLine []byte) bool {
 	// Start tracking
 	callState := p.state.StartCall(callID)
 
-	policyDecision := p.policy.DecideWithContext(policy.DecisionContext{
-		ServerName: p.serverName,
-		ToolName:   toolName,
-		ArgsHash:   argsHash,
-		Args:       args,
-		Target:     p.policyTarget,
-	})
-	decisionSummary := p.redactor.Redact(policyDecision.Summary)
-	decision := event.Decision{
-		Action:   policyDecision.Action,
-		RuleID:   policyDecision.RuleID,
-		Severity: policyDecision.Severity,
-		Explain: event.DecisionExplain{
-			Summary:    decisionSummary,
-			ReasonCode: policyDecision.ReasonCode,
-		},
-		BackoffMS: policyDecision.BackoffMS,
-		Hint:      p.redactor.SanitizeHint(policyDecision.Hint),
-		Policy:    p.policy.Info,
-	}
-	if decision.Action == event.DecisionThrottle && decision.BackoffMS <= 0 {
-		decision.BackoffMS = defaultThrottleBackoffMS
-	}
+	verdict := p.enforcer.Decide(toolName, argsHash, args)
+	decision := verdict.Decision
 
-	enforced := p.policy.Mode != event.RunModeObserve
+	enforced := verdict.Enforced
 	blocked := enforced && (decision.Action == event.DecisionBlock || decision.Action == event.DecisionTerminateRun)
 	throttled := enforced && decision.Action == event.DecisionThrottle
 	hinted := enforced && decision.Action == event.DecisionRejectWithHint
+	terminated := enforced && decision.Action == event.DecisionTerminateRun
 
 	// Track pending call for response matching
-	if id, ok := GetRequestID(req); ok && !blocked && !throttled && !hinted {
-		p.pendingMu.Lock()
-		p.pendingCalls[normalizeID(id)] = &pendingCall{
+	id, hasID := GetRequestID(req)
+	var pending *pendingCall
+	if hasID && !blocked && !throttled && !hinted {
+		pending = &pendingCall{
 			callID:   callID,
 			toolName: toolName,
 			argsHash: argsHash,
+			args:     args,
 			startSeq: callState.Seq,
+			timeout:  p.callDeadline(verdict.TimeoutMS),
 		}
+		key := normalizeID(id)
+		p.pendingMu.Lock()
+		p.pendingCalls[key] = pending
+		delete(p.timedOut, key)
 		p.pendingMu.Unlock()
 	}
 
 	// Emit tool_call_start
-	p.emitToolCallStart(callID, toolName, argsHash, len(rawLine), args, callState.Seq)
+	p.enforcer.EmitToolCallStart(callID, toolName, argsHash, len(rawLine), args, callState.Seq)
 
 	// Emit tool_call_decision
-	p.emitToolCallDecision(callID, toolName, argsHash, decision)
+	p.enforcer.EmitToolCallDecision(callID, toolName, argsHash, decision)
+
+	// Arm the deadline only now, so a timeout's tool_call_end cannot
+	// precede tool_call_start
+	if pending != nil && pending.timeout > 0 {
+		p.armCallDeadline(normalizeID(id), id, pending)
+	}
 
 	if blocked || throttled || hinted {
 		if blocked || hinted {
@@ -275,6 +560,8 @@ func (p *Proxy) interceptToolCall(req *JSONRPCRequest, rawLine []byte) bool {
 			errCode = ErrCodePolicyThrottled
 		} else if hinted {
 			errCode = ErrCodeRejectWithHint
+		} else if terminated {
+			errCode = ErrCodeRunTerminated
 		}
 		errDetail := &event.ErrorDetail{
 			Class:   "policy_block",
@@ -284,7 +571,7 @@ func (p *Proxy) interceptToolCall(req *JSONRPCRequest, rawLine []byte) bool {
 
 		var payload []byte
 		if id, ok := GetRequestID(req); ok {
-			errData := p.policyErrorData(callID, toolName, argsHash, decision)
+			errData := p.enforcer.PolicyErrorData(callID, toolName, argsHash, decision)
 			resp := NewErrorResponse(id, errCode, decision.Explain.Summary, errData)
 			if p, err := json.Marshal(resp); err == nil {
 				payload = p
@@ -292,11 +579,14 @@ func (p *Proxy) interceptToolCall(req *JSONRPCRequest, rawLine []byte) bool {
 		}
 		bytesOut := len(payload)
 
-		p.emitToolCallEnd(callID, toolName, argsHash, event.CallStatusError, latencyMS, bytesOut, errDetail)
+		p.enforcer.EmitToolCallEnd(callID, toolName, argsHash, event.CallStatusError, latencyMS, bytesOut, event.ResultPreview{}, errDetail)
 
 		if payload != nil {
 			p.forwardToAgent(payload)
 		}
+		if terminated {
+			p.terminateRun(decision)
+		}
 		return false
 	}
 
@@ -305,13 +595,177 @@ func (p *Proxy) interceptToolCall(req *JSONRPCRequest, rawLine []byte) bool {
 	return true
 }
 
+// callDeadline returns the upstream deadline for a call: the matching
+// rule's timeout_ms if set, otherwise the shim default.
+func (p *Proxy) callDeadline(ruleTimeoutMS int) time.Duration {
+	if ruleTimeoutMS > 0 {
+		return time.Duration(ruleTimeoutMS) * time.Millisecond
+	}
+	return p.callTimeout
+}
+
+// armCallDeadline starts the upstream deadline for a call that is still
+// pending.
+func (p *Proxy) armCallDeadline(key, id any, pending *pendingCall) {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	if current, ok := p.pendingCalls[key]; !ok || current != pending {
+		return
+	}
+	pending.timer = time.AfterFunc(pending.timeout, func() {
+		p.expireCall(key, id, pending)
+	})
+}
+
+// markTimedOut records that a late response for key must be dropped. An
+// upstream may never answer, so entries lapse after lateResponseTTL and
+// the set is capped at maxTimedOutIDs. Callers hold pendingMu.
+func (p *Proxy) markTimedOut(key any) {
+	now := time.Now()
+	if len(p.timedOut) >= maxTimedOutIDs {
+		for k, expires := range p.timedOut {
+			if !now.Before(expires) {
+				delete(p.timedOut, k)
+			}
+		}
+		// Still full: forget arbitrary entries rather than grow
+		for k := range p.timedOut {
+			if len(p.timedOut) < maxTimedOutIDs {
+				break
+			}
+			delete(p.timedOut, k)
+		}
+	}
+	p.timedOut[key] = now.Add(lateResponseTTL)
+}
+
+// expireCall fires when upstream misses a call's deadline. The agent gets a
+// JSON-RPC error, tool_call_end reports TIMEOUT, and any late upstream
+// response for the same ID is dropped.
+func (p *Proxy) expireCall(key, id any, pending *pendingCall) {
+	p.pendingMu.Lock()
+	if current, ok := p.pendingCalls[key]; !ok || current != pending {
+		p.pendingMu.Unlock()
+		return
+	}
+	delete(p.pendingCalls, key)
+	p.markTimedOut(key)
+	p.pendingMu.Unlock()
+
+	latencyMS := p.state.EndCall(pending.callID)
+	p.state.IncrementErrors()
+	p.recordOutcome(pending, event.CallStatusTimeout, latencyMS)
+
+	timeoutMS := int(pending.timeout / time.Millisecond)
+	message := fmt.Sprintf("Upstream did not respond within %dms", timeoutMS)
+	errData := map[string]any{
+		"subluminal": map[string]any{
+			"v":           core.InterfaceVersion,
+			"reason_code": "UPSTREAM_TIMEOUT",
+			"summary":     message,
+			"run_id":      p.runID,
+			"call_id":     pending.callID,
+			"server_name": p.serverName,
+			"tool_name":   pending.toolName,
+			"args_hash":   pending.argsHash,
+			"timeout_ms":  timeoutMS,
+		},
+	}
+
+	var payload []byte
+	resp := NewErrorResponse(id, ErrCodeUpstreamTimeout, message, errData)
+	if b, err := json.Marshal(resp); err == nil {
+		payload = b
+	}
+
+	p.enforcer.EmitToolCallEnd(pending.callID, pending.toolName, pending.argsHash, event.CallStatusTimeout, latencyMS, len(payload), event.ResultPreview{}, &event.ErrorDetail{
+		Class:     "timeout",
+		Message:   message,
+		Code:      ErrCodeUpstreamTimeout,
+		Retryable: true,
+	})
+
+	if payload != nil {
+		p.forwardToAgent(payload)
+	}
+}
+
+// stopCallTimers cancels outstanding call deadlines at shutdown.
+func (p *Proxy) stopCallTimers() {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	for _, pending := range p.pendingCalls {
+		if pending.timer != nil {
+			pending.timer.Stop()
+		}
+	}
+}
+
+// terminateRun enforces a TERMINATE_RUN decision: later tools/call requests
+// are rejected with ErrCodeRunTerminated and the upstream is shut down.
+// Upstream exit ends Run, which emits run_end with status TERMINATED.
+func (p *Proxy) terminateRun(decision event.Decision) {
+	if p.enforcer.Terminate(decision) {
+		go p.upstream.Stop(terminateStopTimeout)
+	}
+}
+
+// rejectTerminated answers a tools/call that arrived after the run was
+// terminated. No events are emitted: the call never started.
+func (p *Proxy) rejectTerminated(req *JSONRPCRequest, termination *event.RunTermination) {
+	id, ok := GetRequestID(req)
+	if !ok {
+		return
+	}
+
+	toolName, args, _ := ParseToolsCallParams(req.Params)
+	argsHash, _ := canonical.ArgsHash(args)
+	decision := p.enforcer.TerminatedDecision(termination)
+
+	errData := p.enforcer.PolicyErrorData("", toolName, argsHash, decision)
+	resp := NewErrorResponse(id, ErrCodeRunTerminated, termination.TerminateMessage, errData)
+	if payload, err := json.Marshal(resp); err == nil {
+		p.forwardToAgent(payload)
+	}
+}
+
 // readFromUpstream reads responses from upstream and forwards to agent.
+// In supervisor mode it carries on with each restarted upstream.
 func (p *Proxy) readFromUpstream() {
 	defer p.Stop() // Signal shutdown when upstream exits
 
+	for {
+		p.relayUpstream()
+		if !p.restartUpstream() {
+			return
+		}
+	}
+}
+
+// relayUpstream forwards one upstream process's output until it closes.
+func (p *Proxy) relayUpstream() {
 	scanner := bufio.NewScanner(p.upstream.Stdout())
 	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
 
+	// Children the upstream left behind can hold stdout open after it
+	// exits; stop its process group so the relay ends
+	relayed := make(chan struct{})
+	defer close(relayed)
+	go func(exited <-chan struct{}) {
+		select {
+		case <-relayed:
+			return
+		case <-exited:
+		}
+		grace := time.NewTimer(upstreamExitGrace)
+		defer grace.Stop()
+		select {
+		case <-relayed:
+		case <-grace.C:
+			p.upstream.Stop(upstreamExitGrace)
+		}
+	}(p.upstream.Exited())
+
 	for scanner.Scan() {
 		select {
 		case <-p.done:
@@ -337,7 +791,13 @@ func (p *Proxy) readFromUpstream() {
 					sanitizedLine = sanitized
 				}
 			}
-			p.matchResponse(&resp, sanitizedLine)
+			if !p.matchResponse(&resp, sanitizedLine) {
+				// Late response for a call that already timed out
+				continue
+			}
+			if p.takeListRequest(resp.ID) && resp.Error == nil && resp.Result != nil {
+				sanitizedLine = p.rewriteToolsList(&resp, sanitizedLine)
+			}
 		}
 
 		// Forward to agent
@@ -345,17 +805,89 @@ func (p *Proxy) readFromUpstream() {
 	}
 }
 
+// restartUpstream replaces a crashed upstream in supervisor mode: calls in
+// flight fail as retryable, a new process starts after the backoff, and
+// upstream_restart reports the attempt. Returns false when the run should
+// end instead: supervisor mode is off, the upstream exited cleanly, the
+// run is ending, or the restart failed.
+func (p *Proxy) restartUpstream() bool {
+	if !p.upstream.Supervised() || p.enforcer.Termination() != nil {
+		return false
+	}
+	select {
+	case <-p.done:
+		return false
+	case <-p.agentEOF:
+		return false
+	default:
+	}
+
+	// Stdout closed; make sure the process is gone before replacing it
+	p.upstream.Stop(upstreamExitGrace)
+	state, err := p.upstream.Wait()
+	if err != nil || state.Success() {
+		return false
+	}
+	exit := exitInfo(state)
+	failed := p.failOrphanedCalls(exit, true)
+
+	restart, err := p.upstream.Restart(p.done)
+	info := event.UpstreamRestartInfo{
+		Result:      event.RestartResultRestarted,
+		Attempt:     restart.Attempt,
+		MaxRestarts: restart.Policy.MaxRestarts,
+		WindowMS:    int(restart.Policy.Window / time.Millisecond),
+		BackoffMS:   int(restart.Backoff / time.Millisecond),
+		ExitCode:    exit.ExitCode,
+		Signal:      exit.Signal,
+		CallsFailed: failed,
+	}
+	switch {
+	case errors.Is(err, errRestartCancelled):
+		return false
+	case errors.Is(err, ErrCrashLoop):
+		info.Result = event.RestartResultGaveUp
+		info.Error = err.Error()
+	case err != nil:
+		info.Result = event.RestartResultFailed
+		info.Error = p.redactor.Redact(err.Error())
+	}
+	p.emitUpstreamRestart(info)
+	if err != nil {
+		return false
+	}
+
+	p.pendingMu.Lock()
+	if p.initID != nil {
+		p.markTimedOut(p.initID) // The agent already has its answer
+	}
+	p.pendingMu.Unlock()
+	p.stderrDone = p.drainUpstreamStderr()
+	return true
+}
+
 // matchResponse matches a response to its request and emits tool_call_end.
-func (p *Proxy) matchResponse(resp *JSONRPCResponse, rawLine []byte) {
+// Returns false if the response belongs to a timed-out call and must not be
+// forwarded to the agent.
+func (p *Proxy) matchResponse(resp *JSONRPCResponse, rawLine []byte) bool {
+	key := normalizeID(resp.ID)
 	p.pendingMu.Lock()
-	pending, exists := p.pendingCalls[normalizeID(resp.ID)]
+	pending, exists := p.pendingCalls[key]
 	if exists {
-		delete(p.pendingCalls, normalizeID(resp.ID))
+		delete(p.pendingCalls, key)
+		if pending.timer != nil {
+			pending.timer.Stop()
+		}
+	}
+	expires, late := p.timedOut[key]
+	if late && !exists {
+		delete(p.timedOut, key)
+		late = time.Now().Before(expires)
 	}
 	p.pendingMu.Unlock()
 
 	if !exists {
-		return
+		return !late
 	}
 
 	// Calculate latency
@@ -373,225 +905,134 @@ func (p *Proxy) matchResponse(resp *JSONRPCResponse, rawLine []byte) {
 		}
 		p.state.IncrementErrors()
 	}
+	p.recordOutcome(pending, status, latencyMS)
+
+	// Build result preview; skip decoding anything past the inspect ceiling
+	preview := event.ResultPreview{}
+	if len(rawLine) > core.MaxInspectBytes {
+		preview.Truncated = true
+	} else if resp.Result != nil {
+		if b, err := json.Marshal(resp.Result); err == nil {
+			preview.ResultPreview, preview.Truncated = core.PreviewJSON(p.redactor, b)
+		}
+	}
 
 	// Emit tool_call_end
-	p.emitToolCallEnd(pending.callID, pending.toolName, pending.argsHash, status, latencyMS, len(rawLine), errDetail)
+	p.enforcer.EmitToolCallEnd(pending.callID, pending.toolName, pending.argsHash, status, latencyMS, len(rawLine), preview, errDetail)
+	return true
 }
 
-// forwardToUpstream writes data to the upstream stdin.
-func (p *Proxy) forwardToUpstream(data []byte) {
-	p.upstream.Stdin().Write(data)
-	p.upstream.Stdin().Write([]byte("\n"))
+// recordOutcome feeds a finished call to the policy's outcome breakers.
+func (p *Proxy) recordOutcome(pending *pendingCall, status event.CallStatus, latencyMS int) {
+	p.enforcer.RecordOutcome(pending.toolName, pending.argsHash, pending.args, status, latencyMS)
 }
 
-// forwardToAgent writes data to the agent stdout.
-func (p *Proxy) forwardToAgent(data []byte) {
-	p.agentOut.Write(data)
-	p.agentOut.Write([]byte("\n"))
+// takeListRequest reports whether id belongs to a tools/list request
+// awaiting rewrite, and forgets it.
+func (p *Proxy) takeListRequest(id any) bool {
+	key := normalizeID(id)
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	if _, ok := p.listRequests[key]; !ok {
+		return false
+	}
+	delete(p.listRequests, key)
+	return true
 }
 
-// Event emission helpers
+// rewriteToolsList applies the tools/list mode to a response and emits
+// tools_list_filtered if any tool was affected. On any decoding problem the
+// original line is forwarded unchanged.
+func (p *Proxy) rewriteToolsList(resp *JSONRPCResponse, rawLine []byte) []byte {
+	if len(rawLine) > core.MaxInspectBytes {
+		return rawLine
+	}
+	result, err := json.Marshal(resp.Result)
+	if err != nil {
+		return rawLine
+	}
+
+	bundle := p.enforcer.CurrentPolicy()
+	target := p.enforcer.PolicyTarget()
+	rewritten, affected, err := FilterToolsList(result, p.toolsListMode, func(toolName string) *policy.Restriction {
+		return bundle.ToolRestriction(p.serverName, toolName, target)
+	})
+	if err != nil || len(affected) == 0 {
+		return rawLine
+	}
 
-func (p *Proxy) makeEnvelope(eventType event.EventType) event.Envelope {
-	return event.Envelope{
-		V:         core.InterfaceVersion,
-		Type:      eventType,
-		TS:        time.Now().UTC().Format(time.RFC3339Nano),
-		RunID:     p.identity.RunID,
-		AgentID:   p.identity.AgentID,
-		Principal: p.identity.Principal,
-		Workload:  p.identity.Workload,
-		Client:    p.identity.Client,
-		Env:       p.identity.Env,
-		Source:    p.source.ToEventSource(),
+	out := *resp
+	out.Result = json.RawMessage(rewritten)
+	line, err := json.Marshal(out)
+	if err != nil {
+		return rawLine
 	}
-}
 
-func (p *Proxy) emitRunStart() {
-	evt := event.RunStartEvent{
-		Envelope: p.makeEnvelope(event.EventTypeRunStart),
-		Run: event.RunInfo{
-			StartedAt: p.state.StartTime().UTC().Format(time.RFC3339Nano),
-			Mode:      p.policy.Mode,
-			Policy:    p.policy.Info,
+	p.enforcer.Emit(event.ToolsListFilteredEvent{
+		Envelope: p.enforcer.Envelope(event.EventTypeToolsListFiltered),
+		Filter: event.ToolsListFilterInfo{
+			ServerName: p.serverName,
+			Mode:       p.toolsListMode,
+			Tools:      affected,
+			Policy:     bundle.Info,
 		},
-	}
-	p.emitter.Emit(evt)
+	})
+	return line
+}
+
+// forwardToUpstream writes data to the upstream stdin.
+func (p *Proxy) forwardToUpstream(data []byte) error {
+	return p.upstream.Write(data)
 }
 
+// forwardToAgent writes data to the agent stdout.
+// Serialized because responses come from the upstream reader, policy
+// rejections and call deadlines concurrently.
+func (p *Proxy) forwardToAgent(data []byte) {
+	p.agentOutMu.Lock()
+	defer p.agentOutMu.Unlock()
+	p.agentOut.Write(data)
+	p.agentOut.Write([]byte("\n"))
+}
+
+// Event emission helpers for the stdio-only events; the rest are the
+// enforcer's.
+
 func (p *Proxy) emitSecretInjectionEvents() {
 	for _, injection := range p.secretEvents {
 		evt := event.SecretInjectionEvent{
-			Envelope:  p.makeEnvelope(event.EventTypeSecretInjection),
+			Envelope:  p.enforcer.Envelope(event.EventTypeSecretInjection),
 			InjectAs:  injection.InjectAs,
 			SecretRef: injection.SecretRef,
 			Source:    injection.Source,
 			Success:   injection.Success,
 		}
-		p.emitter.Emit(evt)
-	}
-}
-
-func (p *Proxy) emitToolCallStart(callID, toolName, argsHash string, bytesIn int, args map[string]any, seq int) {
-	// Create preview (truncated args)
-	// Per Interface-Pack §1.10:
-	// - For small payloads: include full preview
-	// - For medium payloads (>1KB but <1MiB): include truncated preview with "..."
-	// - For large payloads (>1MiB): omit preview entirely, set truncated=true
-	const maxPreviewSize = 1024
-	const maxInspectBytes = 1024 * 1024 // 1 MiB
-
-	argsPreview := ""
-	truncated := false
-
-	if args != nil {
-		if b, err := json.Marshal(args); err == nil {
-			originalLen := len(b)
-			if originalLen > maxInspectBytes {
-				// Very large payload - omit preview
-				argsPreview = ""
-				truncated = true
-			} else {
-				previewSource := p.redactor.Redact(string(b))
-				if len(previewSource) > maxPreviewSize {
-					// Medium payload - truncate with "..."
-					argsPreview = previewSource[:maxPreviewSize] + "..."
-					truncated = true
-				} else {
-					// Small payload - full preview
-					argsPreview = previewSource
-					truncated = false
-				}
-			}
-		}
-	}
-
-	evt := event.ToolCallStartEvent{
-		Envelope: p.makeEnvelope(event.EventTypeToolCallStart),
-		Call: event.CallInfo{
-			CallID:     callID,
-			ServerName: p.serverName,
-			ToolName:   toolName,
-			Transport:  "mcp_stdio",
-			ArgsHash:   argsHash,
-			BytesIn:    bytesIn,
-			Preview: event.Preview{
-				Truncated:   truncated,
-				ArgsPreview: argsPreview,
-			},
-			Seq: seq,
-		},
+		p.enforcer.Emit(evt)
 	}
-	p.emitter.Emit(evt)
 }
 
-func (p *Proxy) policyErrorData(callID, toolName, argsHash string, decision event.Decision) map[string]any {
-	subluminal := map[string]any{
-		"v":           core.InterfaceVersion,
-		"action":      decision.Action,
-		"rule_id":     decision.RuleID,
-		"reason_code": decision.Explain.ReasonCode,
-		"summary":     decision.Explain.Summary,
-		"run_id":      p.identity.RunID,
-		"call_id":     callID,
-		"server_name": p.serverName,
-		"tool_name":   toolName,
-		"args_hash":   argsHash,
-		"policy": map[string]any{
-			"policy_id":      decision.Policy.PolicyID,
-			"policy_version": decision.Policy.PolicyVersion,
-			"policy_hash":    decision.Policy.PolicyHash,
-		},
-	}
-
-	if decision.Action == event.DecisionThrottle && decision.BackoffMS > 0 {
-		subluminal["backoff_ms"] = decision.BackoffMS
-	}
-	if decision.Action == event.DecisionRejectWithHint {
-		hintText := ""
-		hintKind := string(event.HintKindOther)
-		hint := map[string]any{}
-		if decision.Hint != nil {
-			hintText = decision.Hint.HintText
-			if decision.Hint.HintKind != "" {
-				hintKind = string(decision.Hint.HintKind)
-			}
-			if decision.Hint.SuggestedArgs != nil {
-				hint["suggested_args"] = p.redactor.SanitizeValue(decision.Hint.SuggestedArgs)
-			}
-			if decision.Hint.RetryAdvice != nil {
-				hint["retry_advice"] = p.redactor.Redact(*decision.Hint.RetryAdvice)
-			}
-		}
-		if hintText == "" {
-			hintText = decision.Explain.Summary
-		}
-		if hintText == "" {
-			hintText = "Rejected with hint"
-		}
-		hintText = p.redactor.Redact(hintText)
-		hint["hint_text"] = hintText
-		hint["hint_kind"] = hintKind
-		subluminal["hint"] = hint
-	}
-
-	return map[string]any{
-		"subluminal": subluminal,
+func (p *Proxy) emitUpstreamLog(info event.UpstreamLogInfo) {
+	evt := event.UpstreamLogEvent{
+		Envelope: p.enforcer.Envelope(event.EventTypeUpstreamLog),
+		Log:      info,
 	}
+	p.enforcer.Emit(evt)
 }
 
-func (p *Proxy) emitToolCallDecision(callID, toolName, argsHash string, decision event.Decision) {
-	evt := event.ToolCallDecisionEvent{
-		Envelope: p.makeEnvelope(event.EventTypeToolCallDecision),
-		Call: event.CallRef{
-			CallID:     callID,
-			ServerName: p.serverName,
-			ToolName:   toolName,
-			ArgsHash:   argsHash,
-		},
-		Decision: decision,
+func (p *Proxy) emitUpstreamRestart(info event.UpstreamRestartInfo) {
+	evt := event.UpstreamRestartEvent{
+		Envelope: p.enforcer.Envelope(event.EventTypeUpstreamRestart),
+		Restart:  info,
 	}
-	p.emitter.EmitSync(evt)
+	p.enforcer.Emit(evt)
 }
 
-func (p *Proxy) emitToolCallEnd(callID, toolName, argsHash string, status event.CallStatus, latencyMS, bytesOut int, errDetail *event.ErrorDetail) {
-	evt := event.ToolCallEndEvent{
-		Envelope: p.makeEnvelope(event.EventTypeToolCallEnd),
-		Call: event.CallRef{
-			CallID:     callID,
-			ServerName: p.serverName,
-			ToolName:   toolName,
-			ArgsHash:   argsHash,
-		},
-		Status:    status,
-		LatencyMS: latencyMS,
-		BytesOut:  bytesOut,
-		Preview: event.ResultPreview{
-			Truncated: false,
-		},
-		Error: errDetail,
-	}
-	p.emitter.Emit(evt)
-}
-
-func (p *Proxy) emitRunEnd() {
-	summary := p.state.GetSummary()
-	evt := event.RunEndEvent{
-		Envelope: p.makeEnvelope(event.EventTypeRunEnd),
-		Run: event.RunEndInfo{
-			EndedAt: time.Now().UTC().Format(time.RFC3339Nano),
-			Status:  event.RunStatusSucceeded,
-			Summary: event.RunSummary{
-				CallsTotal:     summary.CallsTotal,
-				CallsAllowed:   summary.CallsAllowed,
-				CallsBlocked:   summary.CallsBlocked,
-				CallsThrottled: summary.CallsThrottled,
-				ErrorsTotal:    summary.ErrorsTotal,
-				DurationMS:     p.state.DurationMS(),
-			},
-		},
+func (p *Proxy) emitUpstreamLimit(info event.UpstreamLimitInfo) {
+	evt := event.UpstreamLimitEvent{
+		Envelope: p.enforcer.Envelope(event.EventTypeUpstreamLimit),
+		Limit:    info,
 	}
-	p.emitter.Emit(evt)
+	p.enforcer.Emit(evt)
 }
 
 // normalizeID normalizes request/response IDs for map key comparison.
@@ -0,0 +1,144 @@
+// Package mcpstdio implements the MCP stdio adapter.
+//
+// This file drains the upstream's stderr so a chatty server cannot fill the
+// pipe and stall, and keeps what it wrote for diagnosis:
+// - Lines are capped in length, redacted and rate-limited
+// - Each line becomes an upstream_log event or a prefixed shim stderr line
+// - The last lines are kept for run_end when the upstream exits non-zero
+//
+// Per Interface-Pack §7.5
+package mcpstdio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/core"
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+const (
+	// UpstreamStderrEvent emits each stderr line as an upstream_log event (default).
+	UpstreamStderrEvent = "event"
+	// UpstreamStderrPassthrough writes each stderr line to the shim's stderr,
+	// prefixed with the server name.
+	UpstreamStderrPassthrough = "passthrough"
+)
+
+const (
+	stderrMaxLineBytes   = 4096 // Longer lines are truncated
+	stderrLinesPerSecond = 50   // Further lines in the same second are dropped
+	stderrTailLines      = 20   // Lines kept for run_end
+)
+
+// ParseUpstreamStderrMode validates an upstream stderr mode.
+// An empty value means event.
+func ParseUpstreamStderrMode(mode string) (string, error) {
+	switch mode {
+	case "", UpstreamStderrEvent:
+		return UpstreamStderrEvent, nil
+	case UpstreamStderrPassthrough:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown upstream stderr mode %q (want event or passthrough)", mode)
+	}
+}
+
+// stderrTap consumes upstream stderr line by line.
+type stderrTap struct {
+	redactor *core.Redactor
+	emit     func(event.UpstreamLogInfo) // Event mode
+	out      io.Writer                   // Passthrough mode; takes precedence
+	check    func(string)                // Sees every redacted line, for limit errors
+	prefix   string
+
+	mu       sync.Mutex
+	closed   bool // Set at run end; later lines only feed the tail
+	tail     []string
+	window   time.Time // Start of the current rate-limit second
+	inWindow int
+	dropped  int // Lines dropped since the last delivered one
+}
+
+// run reads r until EOF. Reading never stops early, so the upstream can
+// always write.
+func (t *stderrTap) run(r io.Reader) {
+	reader := bufio.NewReaderSize(r, stderrMaxLineBytes)
+	var line []byte
+	truncated := false
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if room := stderrMaxLineBytes - len(line); len(chunk) > room {
+			line = append(line, chunk[:room]...)
+			truncated = true
+		} else {
+			line = append(line, chunk...)
+		}
+		if err != nil {
+			if len(line) > 0 {
+				t.handle(line, truncated, time.Now())
+			}
+			return
+		}
+		if isPrefix {
+			continue
+		}
+		t.handle(line, truncated, time.Now())
+		line, truncated = line[:0], false
+	}
+}
+
+func (t *stderrTap) handle(raw []byte, truncated bool, now time.Time) {
+	text := strings.ToValidUTF8(strings.TrimSuffix(string(raw), "\r"), "�")
+	text = t.redactor.Redact(text)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tail = append(t.tail, text)
+	if len(t.tail) > stderrTailLines {
+		t.tail = t.tail[len(t.tail)-stderrTailLines:]
+	}
+	if t.closed {
+		return
+	}
+	if t.check != nil {
+		t.check(text)
+	}
+
+	if now.Sub(t.window) >= time.Second {
+		t.window = now
+		t.inWindow = 0
+	}
+	if t.inWindow >= stderrLinesPerSecond {
+		t.dropped++
+		return
+	}
+	t.inWindow++
+
+	info := event.UpstreamLogInfo{Line: text, Truncated: truncated, Dropped: t.dropped}
+	t.dropped = 0
+	if t.out != nil {
+		if info.Dropped > 0 {
+			fmt.Fprintf(t.out, "%s(%d lines dropped)\n", t.prefix, info.Dropped)
+		}
+		fmt.Fprintf(t.out, "%s%s\n", t.prefix, info.Line)
+		return
+	}
+	if t.emit != nil {
+		t.emit(info)
+	}
+}
+
+// close stops delivery, so nothing follows run_end, and returns the last
+// lines read.
+func (t *stderrTap) close() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return append([]string(nil), t.tail...)
+}
@@ -0,0 +1,144 @@
+// Package mcpstdio implements the MCP stdio adapter.
+//
+// This file adds the opt-in supervisor mode to UpstreamProcess:
+// - A crashed upstream is started again after an exponential backoff
+// - The agent's initialize handshake is replayed to the new process
+// - Too many restarts within a window is a crash loop; the supervisor gives up
+//
+// Per Interface-Pack §7.6
+package mcpstdio
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCrashLoop is returned by Restart when the restart budget is spent.
+var ErrCrashLoop = errors.New("upstream crash loop: restart limit reached")
+
+// errRestartCancelled is returned by Restart when cancelled during backoff.
+var errRestartCancelled = errors.New("restart cancelled")
+
+// RestartPolicy configures supervisor mode.
+type RestartPolicy struct {
+	MaxRestarts int           // Restarts allowed within Window before giving up
+	Window      time.Duration // Sliding window for MaxRestarts
+	Backoff     time.Duration // Delay before the first restart in the window
+	MaxBackoff  time.Duration // Cap for the doubling delay
+}
+
+// DefaultRestartPolicy is used for fields left zero.
+var DefaultRestartPolicy = RestartPolicy{
+	MaxRestarts: 5,
+	Window:      time.Minute,
+	Backoff:     100 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+}
+
+// RestartInfo describes one restart attempt.
+type RestartInfo struct {
+	Attempt int           // Restarts within the window, this one included
+	Backoff time.Duration // Delay waited before starting the new process
+	Policy  RestartPolicy
+}
+
+// SetRestartPolicy enables supervisor mode. Zero fields take their
+// DefaultRestartPolicy value.
+func (up *UpstreamProcess) SetRestartPolicy(policy RestartPolicy) {
+	if policy.MaxRestarts <= 0 {
+		policy.MaxRestarts = DefaultRestartPolicy.MaxRestarts
+	}
+	if policy.Window <= 0 {
+		policy.Window = DefaultRestartPolicy.Window
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = DefaultRestartPolicy.Backoff
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		policy.MaxBackoff = max(DefaultRestartPolicy.MaxBackoff, policy.Backoff)
+	}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	up.restartPolicy = &policy
+}
+
+// Supervised reports whether supervisor mode is on.
+func (up *UpstreamProcess) Supervised() bool {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return up.restartPolicy != nil
+}
+
+// RecordHandshake keeps a handshake line for replay to restarted
+// processes. An initialize request starts a new handshake.
+func (up *UpstreamProcess) RecordHandshake(line []byte, initialize bool) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if initialize {
+		up.handshake = nil
+	}
+	up.handshake = append(up.handshake, append([]byte(nil), line...))
+}
+
+// Restart starts a new process in place of the exited one, after a
+// backoff that doubles with each restart in the window, and replays the
+// recorded handshake to it. Returns ErrCrashLoop once MaxRestarts
+// restarts fall within the window. The caller must wait for the old
+// process to exit first.
+func (up *UpstreamProcess) Restart(cancel <-chan struct{}) (RestartInfo, error) {
+	up.mu.Lock()
+	policy := up.restartPolicy
+	if policy == nil {
+		up.mu.Unlock()
+		return RestartInfo{}, fmt.Errorf("supervisor mode is off")
+	}
+	now := time.Now()
+	recent := up.restarts[:0]
+	for _, at := range up.restarts {
+		if now.Sub(at) < policy.Window {
+			recent = append(recent, at)
+		}
+	}
+	up.restarts = recent
+	if len(recent) >= policy.MaxRestarts {
+		up.mu.Unlock()
+		return RestartInfo{Attempt: len(recent) + 1, Policy: *policy}, ErrCrashLoop
+	}
+	up.restarts = append(up.restarts, now)
+	info := RestartInfo{
+		Attempt: len(up.restarts),
+		Backoff: policy.backoff(len(up.restarts)),
+		Policy:  *policy,
+	}
+	handshake := up.handshake
+	up.mu.Unlock()
+
+	timer := time.NewTimer(info.Backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-cancel:
+		return info, errRestartCancelled
+	}
+
+	up.CloseStdin()
+	if err := up.Start(); err != nil {
+		return info, err
+	}
+	for _, line := range handshake {
+		if err := up.Write(line); err != nil {
+			return info, fmt.Errorf("replay handshake: %w", err)
+		}
+	}
+	return info, nil
+}
+
+// backoff returns the delay before the nth restart in the window.
+func (p *RestartPolicy) backoff(n int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < n && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxBackoff)
+}
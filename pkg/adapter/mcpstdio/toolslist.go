@@ -0,0 +1,104 @@
+// Package mcpstdio implements the MCP stdio adapter.
+//
+// This file rewrites tools/list results so agents do not discover tools
+// that policy would deny on every call. Transport-independent; other MCP
+// adapters can reuse it.
+package mcpstdio
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+// ToolsListPassthrough leaves tools/list responses untouched (default).
+const ToolsListPassthrough = "passthrough"
+
+// ParseToolsListMode validates a tools/list rewrite mode.
+// An empty value means passthrough.
+func ParseToolsListMode(mode string) (string, error) {
+	switch mode {
+	case "", ToolsListPassthrough:
+		return ToolsListPassthrough, nil
+	case event.ToolsListHide, event.ToolsListAnnotate:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown tools/list mode %q (want passthrough, hide or annotate)", mode)
+	}
+}
+
+// FilterToolsList rewrites a tools/list result according to mode.
+// restrict reports the policy restriction for a tool name, or nil.
+// Returns the rewritten result and the affected tools; if no tool is
+// affected the original result is returned unchanged.
+func FilterToolsList(result json.RawMessage, mode string, restrict func(toolName string) *policy.Restriction) (json.RawMessage, []event.FilteredTool, error) {
+	if mode != event.ToolsListHide && mode != event.ToolsListAnnotate {
+		return result, nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil {
+		return result, nil, err
+	}
+	rawTools, ok := fields["tools"]
+	if !ok {
+		return result, nil, nil
+	}
+	var tools []map[string]any
+	if err := json.Unmarshal(rawTools, &tools); err != nil {
+		return result, nil, err
+	}
+
+	var affected []event.FilteredTool
+	kept := make([]map[string]any, 0, len(tools))
+	for _, tool := range tools {
+		name, _ := tool["name"].(string)
+		restriction := restrict(name)
+		if restriction == nil {
+			kept = append(kept, tool)
+			continue
+		}
+
+		affected = append(affected, event.FilteredTool{
+			ToolName:   name,
+			RuleID:     restriction.RuleID,
+			Action:     restriction.Action,
+			ReasonCode: restriction.ReasonCode,
+		})
+		if mode == event.ToolsListHide {
+			continue
+		}
+		description, _ := tool["description"].(string)
+		tool["description"] = annotateDescription(description, restriction)
+		kept = append(kept, tool)
+	}
+	if len(affected) == 0 {
+		return result, nil, nil
+	}
+
+	rewritten, err := json.Marshal(kept)
+	if err != nil {
+		return result, nil, err
+	}
+	fields["tools"] = rewritten
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return result, nil, err
+	}
+	return out, affected, nil
+}
+
+// annotateDescription appends the restriction to a tool description.
+func annotateDescription(description string, restriction *policy.Restriction) string {
+	note := "[Subluminal: " + restriction.Summary
+	if restriction.RuleID != nil {
+		note += " (rule " + *restriction.RuleID + ")"
+	}
+	note += "]"
+	if description == "" {
+		return note
+	}
+	return description + " " + note
+}
@@ -0,0 +1,166 @@
+package coord
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/core"
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+const (
+	// DefaultClientTimeout bounds one state transaction, dial included.
+	// Every stateful decision waits on it, so it is kept short.
+	DefaultClientTimeout = time.Second
+
+	// clientRedialInterval is the minimum wait between dial attempts; calls
+	// in between fail fast and follow decision_on_error.
+	clientRedialInterval = time.Second
+)
+
+// Client is a policy.StateStore backed by a coordinator.
+type Client struct {
+	network string
+	address string
+	runID   string
+	timeout time.Duration
+
+	mu       sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+	nextDial time.Time
+}
+
+// NewClient creates a client for runID at addr (unix:///path). The
+// connection is dialed on first use.
+func NewClient(addr, runID string) (*Client, error) {
+	network, address, err := core.ParseSocketAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(runID) == "" {
+		return nil, errors.New("run id is required")
+	}
+	return &Client{
+		network: network,
+		address: address,
+		runID:   runID,
+		timeout: DefaultClientTimeout,
+	}, nil
+}
+
+// Update implements policy.StateStore.
+func (c *Client) Update(fn func(state *policy.StateSnapshot) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resp, err := c.begin()
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("coordinator: %s", resp.Error)
+	}
+	state := policy.StateSnapshot{}
+	if resp.State != nil {
+		state = *resp.State
+	}
+
+	commit := request{Op: opCommit, State: &state}
+	fnErr := fn(&state)
+	if fnErr != nil {
+		commit = request{Op: opAbort}
+	}
+	resp, err = c.roundTrip(commit)
+	if err != nil {
+		return err
+	}
+	if fnErr != nil {
+		return fnErr
+	}
+	if !resp.OK {
+		return fmt.Errorf("coordinator: %s", resp.Error)
+	}
+	return nil
+}
+
+// begin starts a transaction. A reused connection the coordinator has
+// since closed (for example across a ledgerd restart) is redialed once.
+func (c *Client) begin() (response, error) {
+	reused := c.conn != nil
+	if err := c.connect(); err != nil {
+		return response{}, err
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	resp, err := c.roundTrip(request{Op: opBegin, RunID: c.runID})
+	if err == nil || !reused {
+		return resp, err
+	}
+
+	c.nextDial = time.Time{}
+	if err := c.connect(); err != nil {
+		return response{}, err
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.roundTrip(request{Op: opBegin, RunID: c.runID})
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *Client) connect() error {
+	if c.conn != nil {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(c.nextDial) {
+		return errors.New("coordinator unavailable")
+	}
+	conn, err := net.DialTimeout(c.network, c.address, c.timeout)
+	if err != nil {
+		c.nextDial = now.Add(clientRedialInterval)
+		return fmt.Errorf("dial coordinator: %w", err)
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	return nil
+}
+
+// roundTrip sends req and reads one response. I/O errors drop the
+// connection; the server releases the run when it sees the close.
+func (c *Client) roundTrip(req request) (response, error) {
+	var resp response
+	data, err := json.Marshal(req)
+	if err == nil {
+		_, err = c.conn.Write(append(data, '\n'))
+	}
+	if err == nil {
+		var line []byte
+		line, err = c.reader.ReadBytes('\n')
+		if err == nil {
+			err = json.Unmarshal(line, &resp)
+		}
+	}
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		c.nextDial = time.Now().Add(clientRedialInterval)
+		return resp, fmt.Errorf("coordinator: %w", err)
+	}
+	return resp, nil
+}
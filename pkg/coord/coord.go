@@ -0,0 +1,39 @@
+// Package coord implements the run-state coordinator: a small unix-socket
+// service, hosted by `sub ledgerd --coordinator`, that holds budget,
+// rate-limit, breaker and dedupe state for every shim of a run.
+//
+// Without it each shim enforces limits for its own server only, so a
+// run-scoped budget multiplies by the number of MCP servers.
+//
+// Protocol (JSON lines, one transaction at a time per connection):
+//
+//	-> {"op":"begin","run_id":"..."}
+//	<- {"state":{...}}                 run locked for this connection
+//	-> {"op":"commit","state":{...}}   or {"op":"abort"}
+//	<- {"ok":true}                     run unlocked
+package coord
+
+import (
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+// EnvAddr names the coordinator address for shims.
+const EnvAddr = "SUB_COORDINATOR_ADDR"
+
+const (
+	opBegin  = "begin"
+	opCommit = "commit"
+	opAbort  = "abort"
+)
+
+type request struct {
+	Op    string                `json:"op"`
+	RunID string                `json:"run_id,omitempty"`
+	State *policy.StateSnapshot `json:"state,omitempty"`
+}
+
+type response struct {
+	OK    bool                  `json:"ok,omitempty"`
+	State *policy.StateSnapshot `json:"state,omitempty"`
+	Error string                `json:"error,omitempty"`
+}
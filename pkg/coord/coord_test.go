@@ -0,0 +1,123 @@
+package coord
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+func startServer(t *testing.T) string {
+	t.Helper()
+	// Unix socket paths are length-limited; keep it short.
+	dir, err := os.MkdirTemp("", "coord")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "c.sock")
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := NewServer(MemoryStores())
+	go server.Serve(ln)
+	t.Cleanup(server.Close)
+	return "unix://" + path
+}
+
+func increment(t *testing.T, client *Client) {
+	t.Helper()
+	err := client.Update(func(state *policy.StateSnapshot) error {
+		if state.Budgets == nil {
+			state.Budgets = map[string]int{}
+		}
+		state.Budgets["b|run"]++
+		return nil
+	})
+	if err != nil {
+		t.Errorf("update: %v", err)
+	}
+}
+
+func budget(t *testing.T, client *Client) int {
+	t.Helper()
+	count := 0
+	err := client.Update(func(state *policy.StateSnapshot) error {
+		count = state.Budgets["b|run"]
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return count
+}
+
+func TestClientsShareRunStateAtomically(t *testing.T) {
+	addr := startServer(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		client, err := NewClient(addr, "run-1")
+		if err != nil {
+			t.Fatalf("client: %v", err)
+		}
+		defer client.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				increment(t, client)
+			}
+		}()
+	}
+	wg.Wait()
+
+	reader, _ := NewClient(addr, "run-1")
+	defer reader.Close()
+	if got := budget(t, reader); got != 100 {
+		t.Fatalf("expected 100 increments, got %d", got)
+	}
+
+	other, _ := NewClient(addr, "run-2")
+	defer other.Close()
+	if got := budget(t, other); got != 0 {
+		t.Fatalf("expected run-2 isolated, got %d", got)
+	}
+}
+
+func TestAbortKeepsCommittedState(t *testing.T) {
+	addr := startServer(t)
+	client, _ := NewClient(addr, "run-1")
+	defer client.Close()
+	increment(t, client)
+
+	boom := errors.New("boom")
+	err := client.Update(func(state *policy.StateSnapshot) error {
+		state.Budgets["b|run"] = 99
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected fn error, got %v", err)
+	}
+	if got := budget(t, client); got != 1 {
+		t.Fatalf("expected aborted update discarded, got %d", got)
+	}
+}
+
+func TestClientReportsUnreachableCoordinator(t *testing.T) {
+	client, err := NewClient("unix://"+filepath.Join(t.TempDir(), "missing.sock"), "run-1")
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.Update(func(*policy.StateSnapshot) error { return nil }); err == nil {
+			t.Fatalf("attempt %d: expected error", i+1)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package coord
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+// DefaultTxnTimeout bounds how long a client may hold a run locked between
+// begin and commit.
+const DefaultTxnTimeout = 5 * time.Second
+
+var errAborted = errors.New("transaction aborted")
+
+// StoreOpener returns the state store for a run.
+type StoreOpener func(runID string) (policy.StateStore, error)
+
+// MemoryStores keeps each run's state in memory for the server's lifetime.
+func MemoryStores() StoreOpener {
+	return func(string) (policy.StateStore, error) {
+		return &policy.MemoryStateStore{}, nil
+	}
+}
+
+// FileStores keeps each run's state in dir, so it survives a restart.
+func FileStores(dir string) StoreOpener {
+	return func(runID string) (policy.StateStore, error) {
+		return policy.NewFileStateStore(dir, runID)
+	}
+}
+
+// Server serves run state to shims.
+type Server struct {
+	open       StoreOpener
+	txnTimeout time.Duration
+
+	mu        sync.Mutex
+	stores    map[string]policy.StateStore
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer creates a server whose runs are backed by open.
+func NewServer(open StoreOpener) *Server {
+	if open == nil {
+		open = MemoryStores()
+	}
+	return &Server{
+		open:       open,
+		txnTimeout: DefaultTxnTimeout,
+		stores:     make(map[string]policy.StateStore),
+		listeners:  make(map[net.Listener]struct{}),
+		conns:      make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on ln until Close is called.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, ln)
+			s.mu.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// Close stops accepting connections and closes open ones. A transaction in
+// flight is abandoned; its run keeps the last committed state.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	encoder := json.NewEncoder(conn)
+
+	for {
+		conn.SetReadDeadline(time.Time{})
+		req, err := readRequest(reader)
+		if err != nil {
+			return
+		}
+		if req.Op != opBegin {
+			encoder.Encode(response{Error: "expected begin, got " + req.Op})
+			return
+		}
+
+		store, err := s.store(req.RunID)
+		if err != nil {
+			if encoder.Encode(response{Error: err.Error()}) != nil {
+				return
+			}
+			continue
+		}
+
+		var ioErr error
+		err = store.Update(func(state *policy.StateSnapshot) error {
+			if ioErr = encoder.Encode(response{State: state}); ioErr != nil {
+				return ioErr
+			}
+			conn.SetReadDeadline(time.Now().Add(s.txnTimeout))
+			next, err := readRequest(reader)
+			if err != nil {
+				ioErr = err
+				return err
+			}
+			switch next.Op {
+			case opCommit:
+				if next.State != nil {
+					*state = *next.State
+				}
+				return nil
+			case opAbort:
+				return errAborted
+			default:
+				ioErr = errors.New("expected commit or abort")
+				return ioErr
+			}
+		})
+		if ioErr != nil {
+			return
+		}
+
+		resp := response{OK: err == nil}
+		if err != nil && !errors.Is(err, errAborted) {
+			resp.Error = err.Error()
+		}
+		if encoder.Encode(resp) != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) store(runID string) (policy.StateStore, error) {
+	runID = strings.TrimSpace(runID)
+	if runID == "" {
+		return nil, errors.New("run_id is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if store, ok := s.stores[runID]; ok {
+		return store, nil
+	}
+	store, err := s.open(runID)
+	if err != nil {
+		return nil, err
+	}
+	s.stores[runID] = store
+	return store, nil
+}
+
+func readRequest(reader *bufio.Reader) (request, error) {
+	var req request
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return req, err
+	}
+	if err := json.Unmarshal(line, &req); err != nil {
+		return req, err
+	}
+	return req, nil
+}
@@ -0,0 +1,495 @@
+// Package core provides protocol-agnostic enforcement core functionality.
+//
+// This file implements the run-level core every MCP adapter shares:
+// - The active policy bundle, its hot reload and state carry-over
+// - Policy decisions and outcomes, made under the policy read lock
+// - Event envelopes and emission of run and tool call events
+// - How the run ends: TERMINATED, CANCELLED, FAILED or SUCCEEDED
+//
+// Adapters own the transport: they extract tool calls, forward allowed
+// ones and match responses.
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+	"github.com/peakyragnar/subluminal/pkg/policy"
+)
+
+// DefaultThrottleBackoffMS is the backoff_ms of a THROTTLE decision whose
+// rule sets none.
+const DefaultThrottleBackoffMS = 1000
+
+// Enforcer applies policy to one run's tool calls and emits its events.
+type Enforcer struct {
+	emitter *Emitter
+	state   *RunState
+
+	// Identity
+	identity     Identity
+	source       Source
+	serverName   string
+	transport    string
+	policyTarget policy.SelectorTarget
+	redactor     *Redactor
+
+	// Active policy bundle; swapped on hot reload
+	policy   *policy.Bundle
+	policyMu sync.RWMutex
+
+	// Policy file hot reload (optional)
+	policyFile     string
+	reloadInterval time.Duration
+	watchWg        sync.WaitGroup
+
+	// Durable per-run enforcement state (optional); follows hot reloads
+	stateStore policy.StateStore
+
+	// Set once a TERMINATE_RUN decision is enforced, or the run is cancelled
+	termination *event.RunTermination
+	cancelled   bool
+	termMu      sync.Mutex
+}
+
+// CallDecision is the policy outcome for one tools/call, with its text
+// redacted for events and errors.
+type CallDecision struct {
+	event.Decision
+
+	// Enforced is false in observe mode, where every call proceeds.
+	Enforced bool
+
+	// TimeoutMS is the matching rule's timeout_ms; 0 when none applies.
+	TimeoutMS int
+}
+
+// NewEnforcer loads the policy from the environment for a run of
+// serverName, whose events report transport.
+func NewEnforcer(emitter *Emitter, serverName, transport string, identity Identity, source Source, redactor *Redactor) *Enforcer {
+	if redactor == nil {
+		redactor = NewRedactor(nil)
+	}
+	return &Enforcer{
+		emitter:    emitter,
+		state:      NewRunState(),
+		identity:   identity,
+		source:     source,
+		serverName: serverName,
+		transport:  transport,
+		policyTarget: policy.SelectorTarget{
+			Env:      string(identity.Env),
+			AgentID:  identity.AgentID,
+			Client:   string(identity.Client),
+			Workload: policy.WorkloadFromEvent(identity.Workload),
+		},
+		redactor: redactor,
+		policy:   policy.LoadFromEnv(),
+	}
+}
+
+// State returns the run's call tracking and summary counters.
+func (e *Enforcer) State() *RunState {
+	return e.state
+}
+
+// Redactor returns the redactor applied to everything the run emits.
+func (e *Enforcer) Redactor() *Redactor {
+	return e.redactor
+}
+
+// ServerName returns the server_name the run's events carry.
+func (e *Enforcer) ServerName() string {
+	return e.serverName
+}
+
+// PolicyTarget returns the identity and workload policy selectors see.
+func (e *Enforcer) PolicyTarget() policy.SelectorTarget {
+	return e.policyTarget
+}
+
+// SetStateStore persists budget, rate-limit, breaker and dedupe state in
+// store so it survives shim restarts. Call before the run starts.
+func (e *Enforcer) SetStateStore(store policy.StateStore) {
+	e.stateStore = store
+	e.policy.SetStateStore(store)
+}
+
+// WatchPolicyFile enables hot reload of the policy bundle at path once
+// WatchPolicy runs. Call before the run starts.
+func (e *Enforcer) WatchPolicyFile(path string, interval time.Duration) {
+	e.policyFile = path
+	e.reloadInterval = interval
+}
+
+// WatchPolicy starts the policy file watcher, if one is configured, until
+// done closes. WaitPolicy waits for it to stop.
+func (e *Enforcer) WatchPolicy(done <-chan struct{}) {
+	if e.policyFile == "" {
+		return
+	}
+	e.watchWg.Add(1)
+	go func() {
+		defer e.watchWg.Done()
+		policy.WatchFile(e.policyFile, e.reloadInterval, done, e.applyPolicyFile)
+	}()
+}
+
+// WaitPolicy waits for the policy watcher to stop, so no policy_loaded
+// follows run_end.
+func (e *Enforcer) WaitPolicy() {
+	e.watchWg.Wait()
+}
+
+// CurrentPolicy returns the active policy bundle.
+func (e *Enforcer) CurrentPolicy() *policy.Bundle {
+	e.policyMu.RLock()
+	defer e.policyMu.RUnlock()
+	return e.policy
+}
+
+// SwapPolicy atomically replaces the active policy bundle.
+// Budget, rate-limit, breaker and dedupe state carries over for rules whose
+// rule_id is unchanged. Emits policy_loaded; a bundle with the same
+// policy_hash as the active one is ignored. Returns true if swapped.
+func (e *Enforcer) SwapPolicy(next *policy.Bundle, source string) bool {
+	if next == nil {
+		return false
+	}
+
+	e.policyMu.Lock()
+	prev := e.policy
+	if prev != nil && prev.Info.PolicyHash == next.Info.PolicyHash {
+		e.policyMu.Unlock()
+		return false
+	}
+	carried := next.InheritState(prev)
+	if e.stateStore != nil {
+		next.SetStateStore(e.stateStore)
+	}
+	e.policy = next
+	e.policyMu.Unlock()
+
+	info := event.PolicyLoadInfo{
+		Source:       source,
+		Success:      true,
+		Mode:         next.Mode,
+		Current:      next.Info,
+		CarriedRules: carried,
+	}
+	if prev != nil {
+		info.Previous = prev.Info
+	}
+	e.EmitPolicyLoaded(info)
+	return true
+}
+
+// applyPolicyFile is the WatchFile callback for the configured policy file.
+// A reload that fails to load or verify keeps the active policy.
+func (e *Enforcer) applyPolicyFile(next *policy.Bundle, err error) {
+	if err != nil {
+		current := e.CurrentPolicy()
+		var verr *policy.VerifyError
+		if errors.As(err, &verr) {
+			e.EmitPolicyVerification(verr.Info(e.policyFile, event.VerifyFallbackKeep, current.Info))
+		}
+		e.EmitPolicyLoaded(event.PolicyLoadInfo{
+			Source:   e.policyFile,
+			Success:  false,
+			Error:    e.redactor.Redact(err.Error()),
+			Severity: event.SeverityWarn,
+			Mode:     current.Mode,
+			Previous: current.Info,
+			Current:  current.Info,
+		})
+		return
+	}
+	if e.SwapPolicy(next, e.policyFile) && next.Verification != nil {
+		e.EmitPolicyVerification(*next.Verification)
+	}
+}
+
+// Decide evaluates the policy for one tools/call. The read lock is held
+// across the decision so a concurrent reload cannot copy state out from
+// under an in-flight evaluation.
+func (e *Enforcer) Decide(toolName, argsHash string, args map[string]any) CallDecision {
+	e.policyMu.RLock()
+	bundle := e.policy
+	decided := bundle.DecideWithContext(policy.DecisionContext{
+		ServerName: e.serverName,
+		ToolName:   toolName,
+		ArgsHash:   argsHash,
+		Args:       args,
+		Target:     e.policyTarget,
+	})
+	e.policyMu.RUnlock()
+
+	decision := event.Decision{
+		Action:   decided.Action,
+		RuleID:   decided.RuleID,
+		Severity: decided.Severity,
+		Explain: event.DecisionExplain{
+			Summary:    e.redactor.Redact(decided.Summary),
+			ReasonCode: decided.ReasonCode,
+			Budgets:    decided.Budgets,
+		},
+		BackoffMS: decided.BackoffMS,
+		Hint:      e.redactor.SanitizeHint(decided.Hint),
+		Policy:    bundle.Info,
+		Layer:     decided.Layer,
+	}
+	if decided.Terminate != nil {
+		decision.Terminate = &event.Terminate{
+			TerminateCode:    decided.Terminate.TerminateCode,
+			TerminateMessage: e.redactor.Redact(decided.Terminate.TerminateMessage),
+		}
+	}
+	if decision.Action == event.DecisionThrottle && decision.BackoffMS <= 0 {
+		decision.BackoffMS = DefaultThrottleBackoffMS
+	}
+	return CallDecision{
+		Decision:  decision,
+		Enforced:  bundle.Mode != event.RunModeObserve,
+		TimeoutMS: decided.TimeoutMS,
+	}
+}
+
+// RecordOutcome feeds a finished call to the policy's outcome breakers.
+func (e *Enforcer) RecordOutcome(toolName, argsHash string, args map[string]any, status event.CallStatus, latencyMS int) {
+	e.policyMu.RLock()
+	defer e.policyMu.RUnlock()
+	e.policy.RecordOutcome(policy.DecisionContext{
+		ServerName: e.serverName,
+		ToolName:   toolName,
+		ArgsHash:   argsHash,
+		Args:       args,
+		Target:     e.policyTarget,
+	}, policy.Outcome{
+		Status:  status,
+		Latency: time.Duration(latencyMS) * time.Millisecond,
+	})
+}
+
+// PolicyErrorData builds the error.data payload for a policy rejection.
+func (e *Enforcer) PolicyErrorData(callID, toolName, argsHash string, decision event.Decision) map[string]any {
+	return PolicyErrorData(e.redactor, e.identity.RunID, e.serverName, callID, toolName, argsHash, decision)
+}
+
+// Terminate records a TERMINATE_RUN decision: later calls are rejected and
+// run_end reports TERMINATED. Returns false if the run was already
+// terminated.
+func (e *Enforcer) Terminate(decision event.Decision) bool {
+	e.termMu.Lock()
+	defer e.termMu.Unlock()
+	if e.termination != nil {
+		return false
+	}
+	e.termination = &event.RunTermination{
+		RuleID:           decision.RuleID,
+		TerminateCode:    decision.Explain.ReasonCode,
+		TerminateMessage: decision.Explain.Summary,
+	}
+	if decision.Terminate != nil {
+		e.termination.TerminateCode = decision.Terminate.TerminateCode
+		e.termination.TerminateMessage = decision.Terminate.TerminateMessage
+	}
+	return true
+}
+
+// Termination returns the enforced TERMINATE_RUN, or nil.
+func (e *Enforcer) Termination() *event.RunTermination {
+	e.termMu.Lock()
+	defer e.termMu.Unlock()
+	return e.termination
+}
+
+// TerminatedDecision is the decision reported to a tools/call that arrives
+// after the run was terminated.
+func (e *Enforcer) TerminatedDecision(termination *event.RunTermination) event.Decision {
+	return event.Decision{
+		Action:   event.DecisionTerminateRun,
+		RuleID:   termination.RuleID,
+		Severity: event.SeverityCritical,
+		Explain: event.DecisionExplain{
+			Summary:    termination.TerminateMessage,
+			ReasonCode: "RUN_TERMINATED",
+		},
+		Terminate: &event.Terminate{
+			TerminateCode:    termination.TerminateCode,
+			TerminateMessage: termination.TerminateMessage,
+		},
+		Policy: e.CurrentPolicy().Info,
+	}
+}
+
+// Cancel records that the shim itself was asked to stop, such as on
+// SIGINT, so run_end reports CANCELLED.
+func (e *Enforcer) Cancel() {
+	e.termMu.Lock()
+	defer e.termMu.Unlock()
+	e.cancelled = true
+}
+
+// RunStatus reports how the run ended: TERMINATED by policy, CANCELLED by
+// a signal to the shim, FAILED when the adapter saw the upstream fail, or
+// SUCCEEDED.
+func (e *Enforcer) RunStatus(failed bool) event.RunStatus {
+	e.termMu.Lock()
+	defer e.termMu.Unlock()
+	switch {
+	case e.termination != nil:
+		return event.RunStatusTerminated
+	case e.cancelled:
+		return event.RunStatusCancelled
+	case failed:
+		return event.RunStatusFailed
+	default:
+		return event.RunStatusSucceeded
+	}
+}
+
+// Event emission helpers
+
+// Envelope returns the common fields for an event of eventType.
+func (e *Enforcer) Envelope(eventType event.EventType) event.Envelope {
+	return event.Envelope{
+		V:         InterfaceVersion,
+		Type:      eventType,
+		TS:        time.Now().UTC().Format(time.RFC3339Nano),
+		RunID:     e.identity.RunID,
+		AgentID:   e.identity.AgentID,
+		Principal: e.identity.Principal,
+		Workload:  e.identity.Workload,
+		Client:    e.identity.Client,
+		Env:       e.identity.Env,
+		Source:    e.source.ToEventSource(),
+	}
+}
+
+// Emit queues evt without blocking.
+func (e *Enforcer) Emit(evt any) {
+	e.emitter.Emit(evt)
+}
+
+// EmitRunStart emits run_start, then policy_verification when trusted keys
+// are configured and policy_loaded when the configured policy failed to
+// load.
+func (e *Enforcer) EmitRunStart() {
+	bundle := e.CurrentPolicy()
+	e.emitter.Emit(event.RunStartEvent{
+		Envelope: e.Envelope(event.EventTypeRunStart),
+		Run: event.RunInfo{
+			StartedAt: e.state.StartTime().UTC().Format(time.RFC3339Nano),
+			Mode:      bundle.Mode,
+			Policy:    bundle.Info,
+		},
+	})
+	if v := bundle.Verification; v != nil {
+		e.EmitPolicyVerification(*v)
+	}
+	if failure := bundle.LoadFailure; failure != nil {
+		info := *failure
+		info.Error = e.redactor.Redact(info.Error)
+		e.EmitPolicyLoaded(info)
+	}
+}
+
+func (e *Enforcer) EmitPolicyLoaded(info event.PolicyLoadInfo) {
+	e.emitter.Emit(event.PolicyLoadedEvent{
+		Envelope: e.Envelope(event.EventTypePolicyLoaded),
+		Policy:   info,
+	})
+}
+
+func (e *Enforcer) EmitPolicyVerification(info event.PolicyVerificationInfo) {
+	e.emitter.Emit(event.PolicyVerificationEvent{
+		Envelope:     e.Envelope(event.EventTypePolicyVerified),
+		Verification: info,
+	})
+}
+
+func (e *Enforcer) EmitToolCallStart(callID, toolName, argsHash string, bytesIn int, args map[string]any, seq int) {
+	// Create preview (truncated args)
+	argsPreview := ""
+	truncated := false
+	if args != nil {
+		if b, err := json.Marshal(args); err == nil {
+			argsPreview, truncated = PreviewJSON(e.redactor, b)
+		}
+	}
+
+	e.emitter.Emit(event.ToolCallStartEvent{
+		Envelope: e.Envelope(event.EventTypeToolCallStart),
+		Call: event.CallInfo{
+			CallID:     callID,
+			ServerName: e.serverName,
+			ToolName:   toolName,
+			Transport:  e.transport,
+			ArgsHash:   argsHash,
+			BytesIn:    bytesIn,
+			Preview: event.Preview{
+				Truncated:   truncated,
+				ArgsPreview: argsPreview,
+			},
+			Seq: seq,
+		},
+	})
+}
+
+// EmitToolCallDecision waits until the decision is queued, so it is never
+// dropped under backpressure.
+func (e *Enforcer) EmitToolCallDecision(callID, toolName, argsHash string, decision event.Decision) {
+	e.emitter.EmitSync(event.ToolCallDecisionEvent{
+		Envelope: e.Envelope(event.EventTypeToolCallDecision),
+		Call: event.CallRef{
+			CallID:     callID,
+			ServerName: e.serverName,
+			ToolName:   toolName,
+			ArgsHash:   argsHash,
+		},
+		Decision: decision,
+	})
+}
+
+func (e *Enforcer) EmitToolCallEnd(callID, toolName, argsHash string, status event.CallStatus, latencyMS, bytesOut int, preview event.ResultPreview, errDetail *event.ErrorDetail) {
+	e.emitter.Emit(event.ToolCallEndEvent{
+		Envelope: e.Envelope(event.EventTypeToolCallEnd),
+		Call: event.CallRef{
+			CallID:     callID,
+			ServerName: e.serverName,
+			ToolName:   toolName,
+			ArgsHash:   argsHash,
+		},
+		Status:    status,
+		LatencyMS: latencyMS,
+		BytesOut:  bytesOut,
+		Preview:   preview,
+		Error:     errDetail,
+	})
+}
+
+// EmitRunEnd emits run_end with the run's summary. upstream is the stdio
+// upstream's exit, or nil.
+func (e *Enforcer) EmitRunEnd(status event.RunStatus, upstream *event.UpstreamExit) {
+	summary := e.state.GetSummary()
+	e.emitter.Emit(event.RunEndEvent{
+		Envelope: e.Envelope(event.EventTypeRunEnd),
+		Run: event.RunEndInfo{
+			EndedAt:   time.Now().UTC().Format(time.RFC3339Nano),
+			Status:    status,
+			Terminate: e.Termination(),
+			Upstream:  upstream,
+			Summary: event.RunSummary{
+				CallsTotal:     summary.CallsTotal,
+				CallsAllowed:   summary.CallsAllowed,
+				CallsBlocked:   summary.CallsBlocked,
+				CallsThrottled: summary.CallsThrottled,
+				ErrorsTotal:    summary.ErrorsTotal,
+				DurationMS:     e.state.DurationMS(),
+			},
+		},
+	})
+}
@@ -0,0 +1,95 @@
+// Package core provides protocol-agnostic enforcement core functionality.
+//
+// This file builds transport-independent payloads (previews, policy error
+// data) so every MCP adapter produces identical events and errors.
+package core
+
+import "github.com/peakyragnar/subluminal/pkg/event"
+
+// Preview limits per Interface-Pack §1.10:
+// - For small payloads: include full preview
+// - For medium payloads (>1KB but <1MiB): include truncated preview with "..."
+// - For large payloads (>1MiB): omit preview entirely, set truncated=true
+const (
+	MaxPreviewSize  = 1024
+	MaxInspectBytes = 1024 * 1024 // 1 MiB
+)
+
+// PreviewJSON returns the redacted, size-limited preview of a JSON payload
+// and whether it was truncated.
+func PreviewJSON(redactor *Redactor, b []byte) (string, bool) {
+	if len(b) > MaxInspectBytes {
+		// Very large payload - omit preview
+		return "", true
+	}
+	previewSource := redactor.Redact(string(b))
+	if len(previewSource) > MaxPreviewSize {
+		// Medium payload - truncate with "..."
+		return previewSource[:MaxPreviewSize] + "...", true
+	}
+	// Small payload - full preview
+	return previewSource, false
+}
+
+// PolicyErrorData builds the error.data payload for a policy rejection.
+// Per Interface-Pack §3.2.2; shared by all MCP adapters.
+func PolicyErrorData(redactor *Redactor, runID, serverName, callID, toolName, argsHash string, decision event.Decision) map[string]any {
+	subluminal := map[string]any{
+		"v":           InterfaceVersion,
+		"action":      decision.Action,
+		"rule_id":     decision.RuleID,
+		"reason_code": decision.Explain.ReasonCode,
+		"summary":     decision.Explain.Summary,
+		"run_id":      runID,
+		"call_id":     callID,
+		"server_name": serverName,
+		"tool_name":   toolName,
+		"args_hash":   argsHash,
+		"policy": map[string]any{
+			"policy_id":      decision.Policy.PolicyID,
+			"policy_version": decision.Policy.PolicyVersion,
+			"policy_hash":    decision.Policy.PolicyHash,
+		},
+	}
+
+	if decision.Action == event.DecisionThrottle && decision.BackoffMS > 0 {
+		subluminal["backoff_ms"] = decision.BackoffMS
+	}
+	if decision.Action == event.DecisionTerminateRun && decision.Terminate != nil {
+		subluminal["terminate"] = map[string]any{
+			"terminate_code":    decision.Terminate.TerminateCode,
+			"terminate_message": decision.Terminate.TerminateMessage,
+		}
+	}
+	if decision.Action == event.DecisionRejectWithHint {
+		hintText := ""
+		hintKind := string(event.HintKindOther)
+		hint := map[string]any{}
+		if decision.Hint != nil {
+			hintText = decision.Hint.HintText
+			if decision.Hint.HintKind != "" {
+				hintKind = string(decision.Hint.HintKind)
+			}
+			if decision.Hint.SuggestedArgs != nil {
+				hint["suggested_args"] = redactor.SanitizeValue(decision.Hint.SuggestedArgs)
+			}
+			if decision.Hint.RetryAdvice != nil {
+				hint["retry_advice"] = redactor.Redact(*decision.Hint.RetryAdvice)
+			}
+		}
+		if hintText == "" {
+			hintText = decision.Explain.Summary
+		}
+		if hintText == "" {
+			hintText = "Rejected with hint"
+		}
+		hintText = redactor.Redact(hintText)
+		hint["hint_text"] = hintText
+		hint["hint_kind"] = hintKind
+		subluminal["hint"] = hint
+	}
+
+	return map[string]any{
+		"subluminal": subluminal,
+	}
+}
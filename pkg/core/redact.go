@@ -1,4 +1,8 @@
-package mcpstdio
+// Package core provides protocol-agnostic enforcement core functionality.
+//
+// This file implements secret redaction for everything the shim emits or
+// relays: event text, hints and upstream errors.
+package core
 
 import (
 	"regexp"
@@ -94,17 +98,3 @@ func (r *Redactor) SanitizeHint(hint *event.Hint) *event.Hint {
 
 	return &sanitized
 }
-
-var defaultRedactor = NewRedactor(nil)
-
-func redactSecrets(input string) string {
-	return defaultRedactor.Redact(input)
-}
-
-func sanitizeValue(value any) any {
-	return defaultRedactor.SanitizeValue(value)
-}
-
-func sanitizeHint(hint *event.Hint) *event.Hint {
-	return defaultRedactor.SanitizeHint(hint)
-}
@@ -0,0 +1,166 @@
+// Package core provides protocol-agnostic enforcement core functionality.
+//
+// This file implements the ledgerd socket sink: an io.Writer that forwards
+// serialized events to a local `sub ledgerd --listen` daemon.
+//
+// The sink is best-effort like the rest of event emission: a missing or
+// stalled daemon must never stop the shim. Writes only queue the event; a
+// background writer delivers it, and events that find the queue full or
+// fail to send are counted and the connection is re-dialed later.
+package core
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultSinkWriteTimeout bounds how long the background writer waits
+	// on one event before dropping the connection.
+	DefaultSinkWriteTimeout = 2 * time.Second
+
+	// DefaultSinkQueueSize is how many events may wait for the daemon;
+	// more are dropped rather than delaying tool calls.
+	DefaultSinkQueueSize = 1000
+
+	// sinkRedialInterval is the minimum wait between dial attempts.
+	sinkRedialInterval = time.Second
+)
+
+// ParseSocketAddr parses a ledgerd address of the form unix:///path/to.sock.
+// Returns the network and address for net.Dial / net.Listen.
+func ParseSocketAddr(addr string) (string, string, error) {
+	const unixScheme = "unix://"
+	addr = strings.TrimSpace(addr)
+	if !strings.HasPrefix(addr, unixScheme) {
+		return "", "", fmt.Errorf("unsupported address %q (want unix:///path)", addr)
+	}
+	path := strings.TrimPrefix(addr, unixScheme)
+	if path == "" {
+		return "", "", fmt.Errorf("missing socket path in %q", addr)
+	}
+	return "unix", path, nil
+}
+
+// SocketSink writes JSONL events to a ledgerd socket.
+type SocketSink struct {
+	network string
+	address string
+	timeout time.Duration
+
+	queue   chan []byte
+	done    chan struct{} // Closed once the writer has flushed and exited
+	dropped atomic.Uint64
+
+	mu     sync.Mutex // Guards closed against sends on a closed queue
+	closed bool
+
+	// Owned by the writer goroutine
+	conn     net.Conn
+	nextDial time.Time
+	closeErr error
+}
+
+// NewSocketSink creates a sink for addr (unix:///path). The connection is
+// dialed on first write, so the daemon may start after the shim.
+func NewSocketSink(addr string) (*SocketSink, error) {
+	network, address, err := ParseSocketAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &SocketSink{
+		network: network,
+		address: address,
+		timeout: DefaultSinkWriteTimeout,
+		queue:   make(chan []byte, DefaultSinkQueueSize),
+		done:    make(chan struct{}),
+	}
+	go s.writeLoop()
+	return s, nil
+}
+
+// Write queues one serialized event without blocking. It always reports
+// success so it can sit behind an io.MultiWriter; events that find the
+// queue full or cannot be delivered are counted in Dropped.
+func (s *SocketSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		s.dropped.Add(1)
+		return len(p), nil
+	}
+	select {
+	case s.queue <- append([]byte(nil), p...):
+	default:
+		s.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// writeLoop delivers queued events until Close, then closes the connection.
+func (s *SocketSink) writeLoop() {
+	defer close(s.done)
+	for p := range s.queue {
+		s.send(p)
+	}
+	if s.conn != nil {
+		s.closeErr = s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// send writes one event, dialing first if needed.
+func (s *SocketSink) send(p []byte) {
+	if s.conn == nil {
+		now := time.Now()
+		if now.Before(s.nextDial) {
+			s.dropped.Add(1)
+			return
+		}
+		conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+		if err != nil {
+			s.nextDial = now.Add(sinkRedialInterval)
+			s.dropped.Add(1)
+			return
+		}
+		s.conn = conn
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	if _, err := s.conn.Write(p); err != nil {
+		// A partial line is counted as malformed by ledgerd and skipped.
+		s.conn.Close()
+		s.conn = nil
+		s.nextDial = time.Now().Add(sinkRedialInterval)
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of events that could not be delivered.
+func (s *SocketSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close delivers the events still queued, then closes the connection.
+// A stalled daemon holds it up for at most one write timeout: the events
+// behind the failed write are dropped until the redial interval passes.
+// Later writes are dropped.
+func (s *SocketSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.done
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	<-s.done
+	return s.closeErr
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSocketSink_StalledDaemonDoesNotBlockWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledgerd.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	// Accept but never read, so the socket buffer fills and writes stall.
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	sink, err := NewSocketSink("unix://" + path)
+	if err != nil {
+		t.Fatalf("NewSocketSink: %v", err)
+	}
+	sink.timeout = 200 * time.Millisecond
+
+	line := append(bytes.Repeat([]byte("x"), 4096), '\n')
+	events := 4 * DefaultSinkQueueSize
+	start := time.Now()
+	for i := 0; i < events; i++ {
+		if n, err := sink.Write(line); n != len(line) || err != nil {
+			t.Fatalf("Write = %d, %v; want %d, nil", n, err, len(line))
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("writes took %v against a stalled daemon", elapsed)
+	}
+	if sink.Dropped() == 0 {
+		t.Fatal("expected events beyond the queue to be dropped")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sink.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return against a stalled daemon")
+	}
+
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	default:
+	}
+}
@@ -44,12 +44,18 @@ const (
 type EventType string
 
 const (
-	EventTypeRunStart         EventType = "run_start"
-	EventTypeToolCallStart    EventType = "tool_call_start"
-	EventTypeToolCallDecision EventType = "tool_call_decision"
-	EventTypeToolCallEnd      EventType = "tool_call_end"
-	EventTypeRunEnd           EventType = "run_end"
-	EventTypeSecretInjection  EventType = "secret_injection"
+	EventTypeRunStart          EventType = "run_start"
+	EventTypeToolCallStart     EventType = "tool_call_start"
+	EventTypeToolCallDecision  EventType = "tool_call_decision"
+	EventTypeToolCallEnd       EventType = "tool_call_end"
+	EventTypeRunEnd            EventType = "run_end"
+	EventTypeSecretInjection   EventType = "secret_injection"
+	EventTypePolicyLoaded      EventType = "policy_loaded"
+	EventTypePolicyVerified    EventType = "policy_verification"
+	EventTypeToolsListFiltered EventType = "tools_list_filtered"
+	EventTypeUpstreamLog       EventType = "upstream_log"
+	EventTypeUpstreamRestart   EventType = "upstream_restart"
+	EventTypeUpstreamLimit     EventType = "upstream_limit"
 )
 
 // Source identifies the producer instance.
@@ -142,6 +148,13 @@ type PolicyInfo struct {
 	PolicyHash    string `json:"policy_hash"`
 }
 
+// LayerInfo names the bundle layer that produced a decision when the
+// policy is a layer set.
+type LayerInfo struct {
+	Name string `json:"name"`
+	PolicyInfo
+}
+
 // RunInfo contains run metadata.
 // Per Interface-Pack §1.4
 type RunInfo struct {
@@ -198,8 +211,26 @@ const (
 // DecisionExplain contains human-readable explanation.
 // Per Interface-Pack §1.6
 type DecisionExplain struct {
-	Summary    string `json:"summary"`
-	ReasonCode string `json:"reason_code"`
+	Summary    string        `json:"summary"`
+	ReasonCode string        `json:"reason_code"`
+	Budgets    []BudgetUsage `json:"budgets,omitempty"` // Budgets the call was counted against
+}
+
+// Budget units.
+const (
+	BudgetUnitCalls        = "calls"
+	BudgetUnitCostUnits    = "cost_units"
+	BudgetUnitWriteActions = "write_actions"
+)
+
+// BudgetUsage reports one budget limit after the call was counted.
+type BudgetUsage struct {
+	RuleID    string `json:"rule_id"`
+	Layer     string `json:"layer,omitempty"` // Set for layer sets
+	Unit      string `json:"unit"`            // "calls" | "cost_units" | "write_actions"
+	Limit     int    `json:"limit"`
+	Used      int    `json:"used"`
+	Remaining int    `json:"remaining"`
 }
 
 // Hint contains structured recovery guidance for REJECT_WITH_HINT.
@@ -220,6 +251,13 @@ type CallRef struct {
 	ArgsHash   string `json:"args_hash"`
 }
 
+// Terminate describes why a run was ended by TERMINATE_RUN.
+// Per Interface-Pack §1.6
+type Terminate struct {
+	TerminateCode    string `json:"terminate_code"`
+	TerminateMessage string `json:"terminate_message"`
+}
+
 // Decision contains the enforcement decision.
 // Per Interface-Pack §1.6
 type Decision struct {
@@ -229,7 +267,9 @@ type Decision struct {
 	Explain   DecisionExplain `json:"explain"`
 	BackoffMS int             `json:"backoff_ms,omitempty"`
 	Hint      *Hint           `json:"hint,omitempty"`
+	Terminate *Terminate      `json:"terminate,omitempty"`
 	Policy    PolicyInfo      `json:"policy"`
+	Layer     *LayerInfo      `json:"layer,omitempty"` // Set for layer sets
 }
 
 // ToolCallDecisionEvent represents an enforcement decision.
@@ -312,9 +352,25 @@ type RunSummary struct {
 // RunEndInfo contains run completion metadata.
 // Per Interface-Pack §1.8
 type RunEndInfo struct {
-	EndedAt string     `json:"ended_at"` // RFC3339 timestamp
-	Status  RunStatus  `json:"status"`
-	Summary RunSummary `json:"summary"`
+	EndedAt   string          `json:"ended_at"` // RFC3339 timestamp
+	Status    RunStatus       `json:"status"`
+	Summary   RunSummary      `json:"summary"`
+	Terminate *RunTermination `json:"terminate,omitempty"` // Only if status == TERMINATED by policy
+	Upstream  *UpstreamExit   `json:"upstream,omitempty"`  // Only if the upstream process exited non-zero or was killed
+}
+
+// UpstreamExit describes how a stdio upstream process exited.
+type UpstreamExit struct {
+	ExitCode   int      `json:"exit_code"`             // -1 if killed by a signal
+	Signal     string   `json:"signal,omitempty"`      // e.g. "SIGKILL"; only if killed by a signal
+	StderrTail []string `json:"stderr_tail,omitempty"` // Last stderr lines, redacted
+}
+
+// RunTermination records the policy decision that ended a run.
+type RunTermination struct {
+	RuleID           *string `json:"rule_id"` // Nullable
+	TerminateCode    string  `json:"terminate_code"`
+	TerminateMessage string  `json:"terminate_message"`
 }
 
 // RunEndEvent represents the end of a run.
@@ -323,3 +379,176 @@ type RunEndEvent struct {
 	Envelope
 	Run RunEndInfo `json:"run"`
 }
+
+// =============================================================================
+// upstream_log event types (Interface-Pack §7.5)
+// =============================================================================
+
+// UpstreamLogInfo is one line the upstream process wrote to stderr.
+type UpstreamLogInfo struct {
+	Line      string `json:"line"`              // Redacted, without the newline
+	Truncated bool   `json:"truncated"`         // Line exceeded the length cap
+	Dropped   int    `json:"dropped,omitempty"` // Lines rate-limited away since the previous event
+}
+
+// UpstreamLogEvent records upstream stderr output.
+type UpstreamLogEvent struct {
+	Envelope
+	Log UpstreamLogInfo `json:"log"`
+}
+
+// =============================================================================
+// upstream_restart event types (Interface-Pack §7.6)
+// =============================================================================
+
+// Restart results.
+const (
+	RestartResultRestarted = "RESTARTED" // A new process is running
+	RestartResultGaveUp    = "GAVE_UP"   // Crash loop: the restart limit was reached
+	RestartResultFailed    = "FAILED"    // The new process could not be started
+)
+
+// UpstreamRestartInfo describes one supervisor restart of a crashed upstream.
+type UpstreamRestartInfo struct {
+	Result      string `json:"result"`           // RESTARTED | GAVE_UP | FAILED
+	Attempt     int    `json:"attempt"`          // Restarts within the window, this one included
+	MaxRestarts int    `json:"max_restarts"`     // Restarts allowed within the window
+	WindowMS    int    `json:"window_ms"`        // Crash-loop window
+	BackoffMS   int    `json:"backoff_ms"`       // Delay before the new process started
+	ExitCode    int    `json:"exit_code"`        // How the crashed process exited; -1 if killed by a signal
+	Signal      string `json:"signal,omitempty"` // e.g. "SIGKILL"; only if killed by a signal
+	CallsFailed int    `json:"calls_failed"`     // Calls in flight, failed as retryable
+	Error       string `json:"error,omitempty"`  // Why the restart failed
+}
+
+// UpstreamRestartEvent records a supervisor restart.
+type UpstreamRestartEvent struct {
+	Envelope
+	Restart UpstreamRestartInfo `json:"restart"`
+}
+
+// =============================================================================
+// upstream_limit event types (Interface-Pack §7.7)
+// =============================================================================
+
+// Limited resources.
+const (
+	LimitMemory    = "memory"    // Bytes
+	LimitCPU       = "cpu"       // CPU seconds
+	LimitFiles     = "files"     // Open file descriptors
+	LimitProcesses = "processes" // Processes
+)
+
+// How a breach was detected.
+const (
+	LimitSourceSignal = "signal" // The process was killed for it
+	LimitSourceCgroup = "cgroup" // A cgroup event counter went up
+	LimitSourceStderr = "stderr" // The process reported the error on stderr
+)
+
+// UpstreamLimitInfo describes a resource limit an upstream process hit.
+type UpstreamLimitInfo struct {
+	Resource string `json:"resource"`         // memory | cpu | files | processes
+	Limit    uint64 `json:"limit"`            // The limit, in the resource's unit
+	Source   string `json:"source"`           // signal | cgroup | stderr
+	Detail   string `json:"detail,omitempty"` // Signal, counter or redacted stderr line
+}
+
+// UpstreamLimitEvent records a limit breach.
+type UpstreamLimitEvent struct {
+	Envelope
+	Limit UpstreamLimitInfo `json:"limit"`
+}
+
+// =============================================================================
+// policy_loaded event types (Interface-Pack §1.2 optional, §2.6)
+// =============================================================================
+
+// PolicyLoadInfo describes a policy reload in a running shim, or a
+// configured policy that failed to load at startup.
+type PolicyLoadInfo struct {
+	Source       string     `json:"source"`                  // Where the bundle was loaded from (file path)
+	Success      bool       `json:"success"`                 // False if the new bundle failed to load
+	Error        string     `json:"error,omitempty"`         // Load error, safe for logs
+	Mode         RunMode    `json:"mode"`                    // Mode now in effect
+	Previous     PolicyInfo `json:"previous"`                // Policy before the reload
+	Current      PolicyInfo `json:"current"`                 // Policy now in effect
+	CarriedRules []string   `json:"carried_rules,omitempty"` // rule_ids whose state carried over
+	Severity     Severity   `json:"severity,omitempty"`      // warn when the policy failed to load
+}
+
+// PolicyLoadedEvent records a policy bundle swap (hot reload).
+type PolicyLoadedEvent struct {
+	Envelope
+	Policy PolicyLoadInfo `json:"policy"`
+}
+
+// =============================================================================
+// policy_verification event types (Interface-Pack §2.11)
+// =============================================================================
+
+// Policy signature verification results.
+const (
+	VerifyResultVerified     = "VERIFIED"      // Signed by a trusted key
+	VerifyResultUnsigned     = "UNSIGNED"      // No signature file
+	VerifyResultBadSignature = "BAD_SIGNATURE" // Signature does not match the content
+	VerifyResultUntrustedKey = "UNTRUSTED_KEY" // Signed by a key that is not trusted
+	VerifyResultError        = "ERROR"         // Policy or signature could not be read
+)
+
+// Fallbacks applied when verification fails.
+const (
+	VerifyFallbackClosed = "fail_closed"  // Every call is blocked
+	VerifyFallbackOpen   = "fail_open"    // Default observe policy
+	VerifyFallbackKeep   = "keep_current" // Reload refused; active policy stays
+)
+
+// PolicyVerificationInfo records the signature check of a policy load
+// when trusted keys are configured.
+type PolicyVerificationInfo struct {
+	Source   string     `json:"source"`             // Policy file loaded
+	Result   string     `json:"result"`             // VERIFIED | UNSIGNED | BAD_SIGNATURE | UNTRUSTED_KEY | ERROR
+	File     string     `json:"file,omitempty"`     // File that failed (a layer file for layer sets)
+	KeyID    string     `json:"key_id,omitempty"`   // Key that signed the file, if known
+	Error    string     `json:"error,omitempty"`    // Failure detail, safe for logs
+	Fallback string     `json:"fallback,omitempty"` // Set when verification failed
+	Policy   PolicyInfo `json:"policy"`             // Policy now in effect
+}
+
+// PolicyVerificationEvent records a policy signature check.
+type PolicyVerificationEvent struct {
+	Envelope
+	Verification PolicyVerificationInfo `json:"verification"`
+}
+
+// =============================================================================
+// tools_list_filtered event types (Interface-Pack §1.2 optional)
+// =============================================================================
+
+// Tools list rewrite modes.
+const (
+	ToolsListHide     = "hide"     // Restricted tools are removed from the list
+	ToolsListAnnotate = "annotate" // Restricted tools keep a description note
+)
+
+// FilteredTool is one tool affected by a tools/list rewrite.
+type FilteredTool struct {
+	ToolName   string         `json:"tool_name"`
+	RuleID     *string        `json:"rule_id"` // Nullable
+	Action     DecisionAction `json:"action"`
+	ReasonCode string         `json:"reason_code"`
+}
+
+// ToolsListFilterInfo describes a tools/list response rewritten by policy.
+type ToolsListFilterInfo struct {
+	ServerName string         `json:"server_name"`
+	Mode       string         `json:"mode"` // "hide" | "annotate"
+	Tools      []FilteredTool `json:"tools"`
+	Policy     PolicyInfo     `json:"policy"`
+}
+
+// ToolsListFilteredEvent records which tools a tools/list rewrite affected.
+type ToolsListFilteredEvent struct {
+	Envelope
+	Filter ToolsListFilterInfo `json:"filter"`
+}
@@ -0,0 +1,780 @@
+package expr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// node is a parsed expression. check infers its static type against an
+// Env; eval computes its value.
+type node interface {
+	check(env Env) (*Type, error)
+	eval(s *evalState) (any, error)
+}
+
+// errNoSuchKey marks a selection of a missing key, which has() tolerates.
+var errNoSuchKey = errors.New("no such key")
+
+type literalNode struct {
+	value any
+	typ   *Type
+}
+
+func (n *literalNode) check(Env) (*Type, error) { return n.typ, nil }
+
+func (n *literalNode) eval(s *evalState) (any, error) {
+	if err := s.charge(0); err != nil {
+		return nil, err
+	}
+	return n.value, nil
+}
+
+type listNode struct {
+	elems []node
+}
+
+func (n *listNode) check(env Env) (*Type, error) {
+	var elem *Type
+	for _, e := range n.elems {
+		t, err := e.check(env)
+		if err != nil {
+			return nil, err
+		}
+		if elem == nil {
+			elem = t
+		} else if elem.Kind != t.Kind {
+			elem = Dyn
+		}
+	}
+	if elem == nil {
+		elem = Dyn
+	}
+	return ListOf(elem), nil
+}
+
+func (n *listNode) eval(s *evalState) (any, error) {
+	if err := s.charge(0); err != nil {
+		return nil, err
+	}
+	list := make([]any, 0, len(n.elems))
+	for _, e := range n.elems {
+		v, err := e.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+type identNode struct {
+	name string
+	pos  int
+}
+
+func (n *identNode) check(env Env) (*Type, error) {
+	t, ok := env[n.name]
+	if !ok {
+		return nil, posError(n.pos, "undeclared reference to %q", n.name)
+	}
+	return t, nil
+}
+
+func (n *identNode) eval(s *evalState) (any, error) {
+	if err := s.charge(0); err != nil {
+		return nil, err
+	}
+	v, ok := s.vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not bound", n.name)
+	}
+	return v, nil
+}
+
+type selectNode struct {
+	operand node
+	field   string
+	pos     int
+}
+
+func (n *selectNode) check(env Env) (*Type, error) {
+	t, err := n.operand.check(env)
+	if err != nil {
+		return nil, err
+	}
+	return fieldType(t, n.field, true, n.pos)
+}
+
+func (n *selectNode) eval(s *evalState) (any, error) {
+	v, err := n.operand.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.charge(0); err != nil {
+		return nil, err
+	}
+	return selectKey(v, n.field)
+}
+
+type indexNode struct {
+	operand node
+	index   node
+	pos     int
+}
+
+func (n *indexNode) check(env Env) (*Type, error) {
+	t, err := n.operand.check(env)
+	if err != nil {
+		return nil, err
+	}
+	it, err := n.index.check(env)
+	if err != nil {
+		return nil, err
+	}
+	switch t.Kind {
+	case KindDyn:
+		return Dyn, nil
+	case KindList:
+		if !assignable(it, KindNumber) {
+			return nil, posError(n.pos, "list index must be a number, got %s", it)
+		}
+		return elemOrDyn(t), nil
+	case KindMap:
+		if !assignable(it, KindString) {
+			return nil, posError(n.pos, "map key must be a string, got %s", it)
+		}
+		if lit, ok := n.index.(*literalNode); ok {
+			return fieldType(t, lit.value.(string), false, n.pos)
+		}
+		if t.Fields != nil {
+			return Dyn, nil
+		}
+		return elemOrDyn(t), nil
+	default:
+		return nil, posError(n.pos, "cannot index %s", t)
+	}
+}
+
+func (n *indexNode) eval(s *evalState) (any, error) {
+	v, err := n.operand.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := n.index.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.charge(0); err != nil {
+		return nil, err
+	}
+	if list, ok := v.([]any); ok {
+		f, ok := toNumber(idx)
+		// Bounds are checked on the float: converting a huge or
+		// non-finite index to int first would wrap it into range.
+		if !ok || !(f >= 0 && f < float64(len(list))) || f != math.Trunc(f) {
+			return nil, fmt.Errorf("list index %v out of range", idx)
+		}
+		return list[int(f)], nil
+	}
+	key, ok := idx.(string)
+	if !ok {
+		return nil, fmt.Errorf("cannot index %s with %s", typeName(v), typeName(idx))
+	}
+	return selectKey(v, key)
+}
+
+// fieldType types the selection of key from t. Selection with '.' on a list
+// or scalar is an error; so is an undeclared key of an object.
+func fieldType(t *Type, key string, dotted bool, pos int) (*Type, error) {
+	switch t.Kind {
+	case KindDyn:
+		return Dyn, nil
+	case KindMap:
+		if t.Fields != nil {
+			f, ok := t.Fields[key]
+			if !ok {
+				return nil, posError(pos, "%s has no field %q", t, key)
+			}
+			return f, nil
+		}
+		return elemOrDyn(t), nil
+	}
+	if dotted {
+		return nil, posError(pos, "cannot select %q from %s", key, t)
+	}
+	return nil, posError(pos, "cannot index %s", t)
+}
+
+func selectKey(v any, key string) (any, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("cannot select %q from %s", key, typeName(v))
+	}
+	value, ok := m[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errNoSuchKey, key)
+	}
+	return value, nil
+}
+
+type hasNode struct {
+	operand node // *selectNode or *indexNode
+}
+
+func (n *hasNode) check(env Env) (*Type, error) {
+	var inner node
+	switch op := n.operand.(type) {
+	case *selectNode:
+		inner = op.operand
+	case *indexNode:
+		inner = op.operand
+		if _, err := op.index.check(env); err != nil {
+			return nil, err
+		}
+	}
+	t, err := inner.check(env)
+	if err != nil {
+		return nil, err
+	}
+	if !assignable(t, KindMap) {
+		return nil, fmt.Errorf("has() needs a map field, got %s", t)
+	}
+	return Bool, nil
+}
+
+func (n *hasNode) eval(s *evalState) (any, error) {
+	_, err := n.operand.eval(s)
+	if errors.Is(err, errNoSuchKey) {
+		return false, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+	pos     int
+}
+
+func (n *unaryNode) check(env Env) (*Type, error) {
+	t, err := n.operand.check(env)
+	if err != nil {
+		return nil, err
+	}
+	want, result := KindBool, Bool
+	if n.op == "-" {
+		want, result = KindNumber, Number
+	}
+	if !assignable(t, want) {
+		return nil, posError(n.pos, "operator %s does not apply to %s", n.op, t)
+	}
+	return result, nil
+}
+
+func (n *unaryNode) eval(s *evalState) (any, error) {
+	v, err := n.operand.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.charge(0); err != nil {
+		return nil, err
+	}
+	if n.op == "-" {
+		f, ok := toNumber(v)
+		if !ok {
+			return nil, fmt.Errorf("operator - does not apply to %s", typeName(v))
+		}
+		return -f, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operator ! does not apply to %s", typeName(v))
+	}
+	return !b, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+	pos         int
+}
+
+func (n *binaryNode) check(env Env) (*Type, error) {
+	lt, err := n.left.check(env)
+	if err != nil {
+		return nil, err
+	}
+	rt, err := n.right.check(env)
+	if err != nil {
+		return nil, err
+	}
+	mismatch := func() (*Type, error) {
+		return nil, posError(n.pos, "operator %s does not apply to %s and %s", n.op, lt, rt)
+	}
+
+	switch n.op {
+	case "&&", "||":
+		if !assignable(lt, KindBool) || !assignable(rt, KindBool) {
+			return mismatch()
+		}
+		return Bool, nil
+	case "==", "!=":
+		if lt.Kind != KindDyn && rt.Kind != KindDyn && lt.Kind != KindNull && rt.Kind != KindNull && lt.Kind != rt.Kind {
+			return mismatch()
+		}
+		return Bool, nil
+	case "<", "<=", ">", ">=":
+		for _, kind := range []Kind{KindNumber, KindString} {
+			if assignable(lt, kind) && assignable(rt, kind) {
+				return Bool, nil
+			}
+		}
+		return mismatch()
+	case "in":
+		if rt.Kind != KindDyn && rt.Kind != KindList && rt.Kind != KindMap {
+			return mismatch()
+		}
+		if rt.Kind == KindMap && !assignable(lt, KindString) {
+			return mismatch()
+		}
+		return Bool, nil
+	case "+":
+		for _, kind := range []Kind{KindNumber, KindString, KindList} {
+			if assignable(lt, kind) && assignable(rt, kind) {
+				if lt.Kind == KindDyn && rt.Kind == KindDyn {
+					return Dyn, nil
+				}
+				if kind == KindList {
+					return ListOf(Dyn), nil
+				}
+				return &Type{Kind: kind}, nil
+			}
+		}
+		return mismatch()
+	default: // - * / %
+		if !assignable(lt, KindNumber) || !assignable(rt, KindNumber) {
+			return mismatch()
+		}
+		return Number, nil
+	}
+}
+
+func (n *binaryNode) eval(s *evalState) (any, error) {
+	if n.op == "&&" || n.op == "||" {
+		return n.evalLogical(s)
+	}
+
+	l, err := n.left.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	mismatch := func() (any, error) {
+		return nil, fmt.Errorf("operator %s does not apply to %s and %s", n.op, typeName(l), typeName(r))
+	}
+
+	switch n.op {
+	case "==", "!=":
+		if err := s.charge(0); err != nil {
+			return nil, err
+		}
+		eq := equal(l, r)
+		return eq == (n.op == "=="), nil
+	case "<", "<=", ">", ">=":
+		if err := s.charge(0); err != nil {
+			return nil, err
+		}
+		var cmp int
+		if lf, ok := toNumber(l); ok {
+			rf, ok := toNumber(r)
+			if !ok {
+				return mismatch()
+			}
+			cmp = compareFloat(lf, rf)
+		} else if ls, ok := l.(string); ok {
+			rs, ok := r.(string)
+			if !ok {
+				return mismatch()
+			}
+			cmp = strings.Compare(ls, rs)
+		} else {
+			return mismatch()
+		}
+		switch n.op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		default:
+			return cmp >= 0, nil
+		}
+	case "in":
+		switch container := r.(type) {
+		case []any:
+			if err := s.chargeItems(len(container)); err != nil {
+				return nil, err
+			}
+			for _, item := range container {
+				if equal(l, item) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]any:
+			if err := s.charge(0); err != nil {
+				return nil, err
+			}
+			key, ok := l.(string)
+			if !ok {
+				return mismatch()
+			}
+			_, found := container[key]
+			return found, nil
+		}
+		return mismatch()
+	case "+":
+		if lf, ok := toNumber(l); ok {
+			rf, ok := toNumber(r)
+			if !ok {
+				return mismatch()
+			}
+			return lf + rf, s.charge(0)
+		}
+		switch lv := l.(type) {
+		case string:
+			rv, ok := r.(string)
+			if !ok {
+				return mismatch()
+			}
+			if err := s.charge(len(lv) + len(rv)); err != nil {
+				return nil, err
+			}
+			return lv + rv, nil
+		case []any:
+			rv, ok := r.([]any)
+			if !ok {
+				return mismatch()
+			}
+			if err := s.chargeItems(len(lv) + len(rv)); err != nil {
+				return nil, err
+			}
+			return append(append(make([]any, 0, len(lv)+len(rv)), lv...), rv...), nil
+		}
+		return mismatch()
+	default:
+		lf, lok := toNumber(l)
+		rf, rok := toNumber(r)
+		if !lok || !rok {
+			return mismatch()
+		}
+		if err := s.charge(0); err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "-":
+			return lf - rf, nil
+		case "*":
+			return lf * rf, nil
+		case "/":
+			if rf == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return lf / rf, nil
+		default:
+			if rf == 0 {
+				return nil, errors.New("modulus by zero")
+			}
+			return math.Mod(lf, rf), nil
+		}
+	}
+}
+
+// evalLogical evaluates && and || like CEL: a decisive operand wins even if
+// the other one fails, so `has(args.x) && args.x > 1` never errors.
+func (n *binaryNode) evalLogical(s *evalState) (any, error) {
+	decisive := n.op == "||"
+
+	l, lerr := evalBool(s, n.left)
+	if errors.Is(lerr, ErrCostLimit) {
+		return nil, lerr
+	}
+	if lerr == nil && l == decisive {
+		return decisive, nil
+	}
+	r, rerr := evalBool(s, n.right)
+	if errors.Is(rerr, ErrCostLimit) {
+		return nil, rerr
+	}
+	if rerr == nil && r == decisive {
+		return decisive, nil
+	}
+	if lerr != nil {
+		return nil, lerr
+	}
+	if rerr != nil {
+		return nil, rerr
+	}
+	return !decisive, nil
+}
+
+func evalBool(s *evalState, n node) (bool, error) {
+	v, err := n.eval(s)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected bool, got %s", typeName(v))
+	}
+	return b, nil
+}
+
+type condNode struct {
+	cond, then, otherwise node
+}
+
+func (n *condNode) check(env Env) (*Type, error) {
+	ct, err := n.cond.check(env)
+	if err != nil {
+		return nil, err
+	}
+	if !assignable(ct, KindBool) {
+		return nil, fmt.Errorf("condition of ?: must be bool, got %s", ct)
+	}
+	tt, err := n.then.check(env)
+	if err != nil {
+		return nil, err
+	}
+	ot, err := n.otherwise.check(env)
+	if err != nil {
+		return nil, err
+	}
+	if tt.Kind == ot.Kind && tt.Kind != KindList && tt.Kind != KindMap {
+		return tt, nil
+	}
+	return Dyn, nil
+}
+
+func (n *condNode) eval(s *evalState) (any, error) {
+	c, err := evalBool(s, n.cond)
+	if err != nil {
+		return nil, err
+	}
+	if c {
+		return n.then.eval(s)
+	}
+	return n.otherwise.eval(s)
+}
+
+type function struct {
+	method bool    // Only callable as receiver.name(...)
+	params []*Type // Receiver first
+	result *Type
+	impl   func(s *evalState, n *callNode, args []any) (any, error)
+}
+
+var functions = map[string]*function{
+	"has": {},
+	"size": {
+		params: []*Type{Dyn},
+		result: Number,
+		impl: func(s *evalState, _ *callNode, args []any) (any, error) {
+			switch v := args[0].(type) {
+			case string:
+				if err := s.charge(len(v)); err != nil {
+					return nil, err
+				}
+				return float64(utf8.RuneCountInString(v)), nil
+			case []any:
+				return float64(len(v)), s.charge(0)
+			case map[string]any:
+				return float64(len(v)), s.charge(0)
+			}
+			return nil, fmt.Errorf("size() does not apply to %s", typeName(args[0]))
+		},
+	},
+	"startsWith": stringMethod(strings.HasPrefix),
+	"endsWith":   stringMethod(strings.HasSuffix),
+	"contains":   stringMethod(strings.Contains),
+	"matches": {
+		method: true,
+		params: []*Type{String, String},
+		result: Bool,
+		impl: func(s *evalState, n *callNode, args []any) (any, error) {
+			text, ok1 := args[0].(string)
+			pattern, ok2 := args[1].(string)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("matches() does not apply to %s and %s", typeName(args[0]), typeName(args[1]))
+			}
+			if err := s.charge(len(text)); err != nil {
+				return nil, err
+			}
+			re := n.re
+			if re == nil {
+				var err error
+				if re, err = regexp.Compile(pattern); err != nil {
+					return nil, fmt.Errorf("invalid regex %q: %v", pattern, err)
+				}
+			}
+			return re.MatchString(text), nil
+		},
+	},
+}
+
+func stringMethod(fn func(s, arg string) bool) *function {
+	return &function{
+		method: true,
+		params: []*Type{String, String},
+		result: Bool,
+		impl: func(s *evalState, n *callNode, args []any) (any, error) {
+			text, ok1 := args[0].(string)
+			arg, ok2 := args[1].(string)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("%s() does not apply to %s and %s", n.name, typeName(args[0]), typeName(args[1]))
+			}
+			if err := s.charge(len(text)); err != nil {
+				return nil, err
+			}
+			return fn(text, arg), nil
+		},
+	}
+}
+
+type callNode struct {
+	name string
+	fn   *function
+	args []node // Receiver first for method calls
+	re   *regexp.Regexp
+	pos  int
+}
+
+func (n *callNode) check(env Env) (*Type, error) {
+	for i, arg := range n.args {
+		t, err := arg.check(env)
+		if err != nil {
+			return nil, err
+		}
+		param := n.fn.params[i]
+		if param.Kind == KindDyn {
+			if n.name == "size" && t.Kind != KindDyn && t.Kind != KindString && t.Kind != KindList && t.Kind != KindMap {
+				return nil, posError(n.pos, "size() does not apply to %s", t)
+			}
+			continue
+		}
+		if !assignable(t, param.Kind) {
+			return nil, posError(n.pos, "%s() needs %s, got %s", n.name, param, t)
+		}
+	}
+	return n.fn.result, nil
+}
+
+func (n *callNode) eval(s *evalState) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return n.fn.impl(s, n, args)
+}
+
+func assignable(t *Type, kind Kind) bool {
+	return t.Kind == KindDyn || t.Kind == kind
+}
+
+func equal(a, b any) bool {
+	if af, ok := toNumber(a); ok {
+		bf, ok := toNumber(b)
+		return ok && af == bf
+	}
+	switch av := a.(type) {
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equal(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			other, ok := bv[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case string:
+		return "string"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "map"
+	}
+	if _, ok := toNumber(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
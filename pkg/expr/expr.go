@@ -0,0 +1,194 @@
+// Package expr implements a small, CEL-like expression language for policy
+// rule conditions.
+//
+// An expression is parsed and type-checked once against an Env that declares
+// the variables it may reference, then evaluated per call:
+//
+//	tool == "delete_issue" && identity.agent_id.startsWith("triage-") && identity.env != "prod"
+//
+// Supported: literals (strings, numbers, true, false, null, lists), field
+// selection (a.b) and indexing (a["b"], a[0]), ! - * / % + - < <= > >= == !=
+// in && || and ?:, plus size(x), has(a.b), and the string methods
+// startsWith, endsWith, contains and matches (RE2).
+//
+// There are no loops or user functions, and compiled programs are capped in
+// size, so evaluation cost is bounded: every node evaluated, every KiB a
+// string operation touches and every 64 list items scanned cost one unit,
+// and evaluation fails once CostLimit units are spent.
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxLength is the longest expression source accepted, in bytes.
+	MaxLength = 4096
+	// MaxNodes caps the size of a parsed expression.
+	MaxNodes = 512
+	// MaxDepth caps nesting of parentheses and unary operators.
+	MaxDepth = 32
+	// CostLimit bounds the work of one evaluation.
+	CostLimit = 10000
+
+	costBytesPerUnit = 1024
+	costItemsPerUnit = 64
+)
+
+// ErrCostLimit is returned when an evaluation exceeds CostLimit.
+var ErrCostLimit = errors.New("expression exceeded its cost limit")
+
+// Kind is the kind of a Type.
+type Kind int
+
+const (
+	KindDyn Kind = iota // Unknown until evaluation
+	KindNull
+	KindBool
+	KindNumber
+	KindString
+	KindList
+	KindMap
+)
+
+// Type is the static type of a variable or expression.
+type Type struct {
+	Kind   Kind
+	Elem   *Type            // Element type of a list, value type of a map
+	Fields map[string]*Type // Known keys of an object; other keys are an error
+}
+
+var (
+	Dyn    = &Type{Kind: KindDyn}
+	Null   = &Type{Kind: KindNull}
+	Bool   = &Type{Kind: KindBool}
+	Number = &Type{Kind: KindNumber}
+	String = &Type{Kind: KindString}
+)
+
+// ListOf returns the type of a list of elem.
+func ListOf(elem *Type) *Type {
+	return &Type{Kind: KindList, Elem: elem}
+}
+
+// MapOf returns the type of a string-keyed map with elem values.
+func MapOf(elem *Type) *Type {
+	return &Type{Kind: KindMap, Elem: elem}
+}
+
+// ObjectOf returns the type of a map with exactly the given keys.
+func ObjectOf(fields map[string]*Type) *Type {
+	return &Type{Kind: KindMap, Fields: fields}
+}
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case KindNull:
+		return "null"
+	case KindBool:
+		return "bool"
+	case KindNumber:
+		return "number"
+	case KindString:
+		return "string"
+	case KindList:
+		return "list(" + elemOrDyn(t).String() + ")"
+	case KindMap:
+		if t.Fields != nil {
+			names := make([]string, 0, len(t.Fields))
+			for name := range t.Fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return "{" + strings.Join(names, ", ") + "}"
+		}
+		return "map(" + elemOrDyn(t).String() + ")"
+	default:
+		return "dyn"
+	}
+}
+
+func elemOrDyn(t *Type) *Type {
+	if t.Elem == nil {
+		return Dyn
+	}
+	return t.Elem
+}
+
+// Env declares the variables an expression may reference.
+type Env map[string]*Type
+
+// Program is a parsed and type-checked expression.
+type Program struct {
+	source string
+	root   node
+	typ    *Type
+}
+
+// Compile parses src and type-checks it against env.
+func Compile(src string, env Env) (*Program, error) {
+	if len(src) > MaxLength {
+		return nil, fmt.Errorf("expression longer than %d bytes", MaxLength)
+	}
+	root, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := root.check(env)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{source: src, root: root, typ: typ}, nil
+}
+
+// Source returns the expression text.
+func (p *Program) Source() string {
+	return p.source
+}
+
+// Type returns the static result type.
+func (p *Program) Type() *Type {
+	return p.typ
+}
+
+// Eval evaluates the program with vars bound to the Env's variables. Values
+// are JSON-shaped: nil, bool, numbers, string, []any and map[string]any.
+func (p *Program) Eval(vars map[string]any) (any, error) {
+	s := &evalState{vars: vars}
+	return p.root.eval(s)
+}
+
+// EvalBool evaluates a program whose result must be a bool.
+func (p *Program) EvalBool(vars map[string]any) (bool, error) {
+	value, err := p.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s, want bool", typeName(value))
+	}
+	return result, nil
+}
+
+type evalState struct {
+	vars map[string]any
+	cost int
+}
+
+// chargeItems spends one unit plus one per costItemsPerUnit list items.
+func (s *evalState) chargeItems(count int) error {
+	return s.charge(count * costBytesPerUnit / costItemsPerUnit)
+}
+
+// charge spends one unit plus one per KiB of size.
+func (s *evalState) charge(size int) error {
+	s.cost += 1 + size/costBytesPerUnit
+	if s.cost > CostLimit {
+		return ErrCostLimit
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package expr
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+var testEnv = Env{
+	"tool": String,
+	"args": MapOf(Dyn),
+	"identity": ObjectOf(map[string]*Type{
+		"env":      String,
+		"agent_id": String,
+	}),
+	"labels": MapOf(String),
+}
+
+func testVars() map[string]any {
+	return map[string]any{
+		"tool": "delete_issue",
+		"args": map[string]any{
+			"path":    "/repo/src",
+			"limit":   float64(25),
+			"options": map[string]any{"force": true},
+			"tags":    []any{"a", "b"},
+		},
+		"identity": map[string]any{"env": "staging", "agent_id": "triage-7"},
+		"labels":   map[string]any{"team": "infra"},
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{`tool == "delete_issue" && identity.agent_id.startsWith("triage-") && identity.env != "prod"`, true},
+		{`args.options.force == true`, true},
+		{`args["limit"] > 10 && args.limit <= 25`, true},
+		{`args.limit * 2 + 1`, float64(51)},
+		{`"b" in args.tags && !("c" in args.tags)`, true},
+		{`"team" in labels && labels.team == 'infra'`, true},
+		{`has(args.missing) || args.path.contains("src")`, true},
+		{`has(args.options.force) && !has(args.options.dry_run)`, true},
+		{`args.missing == 1 || true`, true},
+		{`false && args.missing == 1`, false},
+		{`size(args.tags) == 2 && args.path.size() == 9`, true},
+		{`args.path.matches("^/repo(/|$)")`, true},
+		{`identity.env == "prod" ? "deny" : "allow"`, "allow"},
+		{`args.tags[1] == "b"`, true},
+		{`[1, 2] + [3] == [1, 2, 3]`, true},
+		{`-args.limit < 0 && 7 % 4 == 3`, true},
+	}
+	for _, tt := range tests {
+		prog, err := Compile(tt.src, testEnv)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", tt.src, err)
+			continue
+		}
+		got, err := prog.Eval(testVars())
+		if err != nil {
+			t.Errorf("Eval(%s): %v", tt.src, err)
+			continue
+		}
+		if !equal(got, tt.want) {
+			t.Errorf("Eval(%s) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEval_Errors(t *testing.T) {
+	for _, src := range []string{
+		`args.missing == 1`,
+		`args.limit / 0 > 1`,
+		`args.path > 1`,
+		`args.tags[5] == "x"`,
+	} {
+		prog, err := Compile(src, testEnv)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", src, err)
+			continue
+		}
+		if _, err := prog.Eval(testVars()); err == nil {
+			t.Errorf("Eval(%s): expected an error", src)
+		}
+	}
+}
+
+func TestEval_ListIndexOutOfRange(t *testing.T) {
+	prog, err := Compile(`args.tags[args.i] == "a"`, testEnv)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	for _, index := range []float64{1e19, -1e19, math.MaxInt64, math.NaN(), math.Inf(1), math.Inf(-1), 2, 0.5} {
+		vars := testVars()
+		vars["args"].(map[string]any)["i"] = index
+		if _, err := prog.Eval(vars); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("index %v: expected an out of range error, got %v", index, err)
+		}
+	}
+}
+
+func TestCompile_TypeErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`tool > 3`, "does not apply to string and number"},
+		{`identity.team == "x"`, `has no field "team"`},
+		{`unknown == 1`, `undeclared reference to "unknown"`},
+		{`tool.startsWith(1)`, "needs string"},
+		{`size(true)`, "size() does not apply to bool"},
+		{`tool.nope()`, `unknown function "nope"`},
+		{`startsWith(tool, "x")`, "must be called as a method"},
+		{`tool.matches("(")`, "invalid regex"},
+		{`has(tool)`, "field selection"},
+		{`!tool`, "operator ! does not apply to string"},
+		{`tool == "a" &&`, "unexpected end of expression"},
+		{`"unterminated`, "unterminated string"},
+		{`tool # 1`, "unexpected character"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.src, testEnv)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%s) error = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestCompile_Limits(t *testing.T) {
+	if _, err := Compile(strings.Repeat("(", MaxDepth+1)+"true"+strings.Repeat(")", MaxDepth+1), testEnv); err == nil {
+		t.Error("expected nesting limit error")
+	}
+	if _, err := Compile(strings.Repeat("1 + ", MaxNodes)+"1 > 0", testEnv); err == nil {
+		t.Error("expected node limit error")
+	}
+	if _, err := Compile(strings.Repeat(" ", MaxLength+1), testEnv); err == nil {
+		t.Error("expected length limit error")
+	}
+}
+
+func TestEval_CostLimit(t *testing.T) {
+	prog, err := Compile(`(args.body + args.body + args.body + args.body).contains("x")`, testEnv)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	vars := testVars()
+	vars["args"].(map[string]any)["body"] = strings.Repeat("a", 4<<20)
+	if _, err := prog.Eval(vars); !errors.Is(err, ErrCostLimit) {
+		t.Fatalf("expected ErrCostLimit, got %v", err)
+	}
+
+	// A cost error is not absorbed by a decisive || operand.
+	prog, err = Compile(`(args.body + args.body + args.body).size() > 0 || true`, testEnv)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if _, err := prog.Eval(vars); !errors.Is(err, ErrCostLimit) {
+		t.Fatalf("expected ErrCostLimit through ||, got %v", err)
+	}
+}
@@ -0,0 +1,462 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string // Identifier, operator, or unquoted string
+	num  float64
+	pos  int
+}
+
+// operators lists multi-character operators before their prefixes.
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ".", ",", "?", ":"}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+		case isDigit(c):
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			if i+1 < len(src) && src[i] == '.' && isDigit(src[i+1]) {
+				i++
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				j := i + 1
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				if j < len(src) && isDigit(src[j]) {
+					for i = j; i < len(src) && isDigit(src[i]); i++ {
+					}
+				}
+			}
+			num, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, posError(start, "invalid number %q", src[start:i])
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], num: num, pos: start})
+		case c == '"' || c == '\'':
+			text, end, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: i})
+			i = end
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, posError(i, "unexpected character %q", c)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// lexString reads a quoted string starting at src[start].
+func lexString(src string, start int) (string, int, error) {
+	quote := src[start]
+	var b strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\':
+			i++
+			if i >= len(src) {
+				break
+			}
+			switch src[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '\\', '\'', '"':
+				b.WriteByte(src[i])
+			default:
+				return "", 0, posError(i-1, "unknown escape \\%c", src[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, posError(start, "unterminated string")
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func posError(pos int, format string, args ...any) error {
+	return fmt.Errorf("col %d: %s", pos+1, fmt.Sprintf(format, args...))
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	nodes  int
+	depth  int
+}
+
+func parse(src string) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, posError(tok.pos, "unexpected %q", tok.text)
+	}
+	return root, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if p.accept(op) {
+		return nil
+	}
+	tok := p.peek()
+	if tok.kind == tokEOF {
+		return posError(tok.pos, "expected %q, got end of expression", op)
+	}
+	return posError(tok.pos, "expected %q, got %q", op, tok.text)
+}
+
+// add counts n against MaxNodes.
+func (p *parser) add(n node) (node, error) {
+	p.nodes++
+	if p.nodes > MaxNodes {
+		return nil, fmt.Errorf("expression has more than %d nodes", MaxNodes)
+	}
+	return n, nil
+}
+
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return fmt.Errorf("expression nested deeper than %d", MaxDepth)
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) parseExpr() (node, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	then, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return p.add(&condNode{cond: cond, then: then, otherwise: otherwise})
+}
+
+// binaryLevels lists binary operators from lowest to highest precedence.
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		op := ""
+		for _, candidate := range binaryLevels[level] {
+			if (tok.kind == tokOp || tok.kind == tokIdent) && tok.text == candidate {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = p.add(&binaryNode{op: op, left: left, right: right, pos: tok.pos}); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok := p.peek()
+	if tok.kind == tokOp && (tok.text == "!" || tok.text == "-") {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return p.add(&unaryNode{op: tok.text, operand: operand, pos: tok.pos})
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		switch {
+		case p.accept("."):
+			name := p.next()
+			if name.kind != tokIdent {
+				return nil, posError(name.pos, "expected field name after '.'")
+			}
+			if p.accept("(") {
+				var args []node
+				if args, err = p.parseArgs(); err != nil {
+					return nil, err
+				}
+				n, err = p.call(name, n, args)
+			} else {
+				n, err = p.add(&selectNode{operand: n, field: name.text, pos: name.pos})
+			}
+			if err != nil {
+				return nil, err
+			}
+		case p.accept("["):
+			index, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if n, err = p.add(&indexNode{operand: n, index: index, pos: tok.pos}); err != nil {
+				return nil, err
+			}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		return p.add(&literalNode{value: tok.num, typ: Number})
+	case tokString:
+		return p.add(&literalNode{value: tok.text, typ: String})
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return p.add(&literalNode{value: tok.text == "true", typ: Bool})
+		case "null":
+			return p.add(&literalNode{value: nil, typ: Null})
+		case "in":
+			return nil, posError(tok.pos, "unexpected 'in'")
+		}
+		if p.accept("(") {
+			args, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			return p.call(tok, nil, args)
+		}
+		return p.add(&identNode{name: tok.text, pos: tok.pos})
+	case tokOp:
+		switch tok.text {
+		case "(":
+			n, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			var elems []node
+			if !p.accept("]") {
+				args, err := p.parseList("]")
+				if err != nil {
+					return nil, err
+				}
+				elems = args
+			}
+			return p.add(&listNode{elems: elems})
+		}
+	case tokEOF:
+		return nil, posError(tok.pos, "unexpected end of expression")
+	}
+	return nil, posError(tok.pos, "unexpected %q", tok.text)
+}
+
+// parseArgs parses call arguments after the opening parenthesis.
+func (p *parser) parseArgs() ([]node, error) {
+	if p.accept(")") {
+		return nil, nil
+	}
+	return p.parseList(")")
+}
+
+func (p *parser) parseList(closing string) ([]node, error) {
+	var elems []node
+	for {
+		elem, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+		if p.accept(closing) {
+			return elems, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// call builds a function or method call; receiver is nil for functions.
+func (p *parser) call(name token, receiver node, args []node) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, posError(name.pos, "unknown function %q", name.text)
+	}
+
+	if name.text == "has" {
+		if receiver != nil || len(args) != 1 {
+			return nil, posError(name.pos, "has() takes one field selection, e.g. has(args.path)")
+		}
+		switch args[0].(type) {
+		case *selectNode, *indexNode:
+		default:
+			return nil, posError(name.pos, "has() argument must be a field selection")
+		}
+		return p.add(&hasNode{operand: args[0]})
+	}
+
+	all := args
+	if receiver != nil {
+		all = append([]node{receiver}, args...)
+	} else if fn.method {
+		return nil, posError(name.pos, "%s must be called as a method, e.g. x.%s(...)", name.text, name.text)
+	}
+	if len(all) != len(fn.params) {
+		return nil, posError(name.pos, "%s takes %d argument(s)", name.text, len(fn.params)-btoi(fn.method))
+	}
+
+	n := &callNode{name: name.text, fn: fn, args: all, pos: name.pos}
+	if name.text == "matches" {
+		if lit, ok := all[1].(*literalNode); ok {
+			pattern, _ := lit.value.(string)
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, posError(name.pos, "invalid regex %q: %v", pattern, err)
+			}
+			n.re = re
+		}
+	}
+	return p.add(n)
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strings"
 )
 
 var serverKeys = []string{"mcpServers", "mcp_servers"}
 
-func rewriteConfig(raw []byte, shimPath string) ([]byte, []string, bool, error) {
+func rewriteConfig(raw []byte, shimPath string, shimArgs func(server string) []string) ([]byte, []string, bool, error) {
 	var root map[string]any
 	if err := json.Unmarshal(raw, &root); err != nil {
 		return nil, nil, false, fmt.Errorf("parse config JSON: %w", err)
@@ -41,14 +43,19 @@ func rewriteConfig(raw []byte, shimPath string) ([]byte, []string, bool, error)
 		if isShimWrapped(command, args, shimPath) {
 			if shouldUpdateShimPath(command, shimPath) {
 				server["command"] = shimPath
-				servers[name] = server
 				changed = true
 			}
+			if merged := mergeShimArgs(args, shimArgs(name)); !slices.Equal(merged, args) {
+				server["args"] = merged
+				changed = true
+			}
+			servers[name] = server
 			serverNames = append(serverNames, name)
 			continue
 		}
 
-		newArgs := []string{"--server-name=" + name, "--", command}
+		newArgs := append([]string{"--server-name=" + name}, shimArgs(name)...)
+		newArgs = append(newArgs, "--", command)
 		newArgs = append(newArgs, args...)
 		server["command"] = shimPath
 		server["args"] = newArgs
@@ -68,6 +75,39 @@ func rewriteConfig(raw []byte, shimPath string) ([]byte, []string, bool, error)
 	return updated, serverNames, changed, nil
 }
 
+// shimArgsFor returns the shim flags opts adds to a server.
+func shimArgsFor(opts Options) func(server string) []string {
+	return func(server string) []string {
+		if len(opts.ShimArgsServers) > 0 && !slices.Contains(opts.ShimArgsServers, server) {
+			return nil
+		}
+		return opts.ShimArgs
+	}
+}
+
+// mergeShimArgs sets shim flags in the args of a wrapped server: a flag
+// already before "--" is replaced, others are added just before it.
+func mergeShimArgs(args, shimArgs []string) []string {
+	if len(shimArgs) == 0 {
+		return args
+	}
+	sep := slices.Index(args, "--")
+	merged := append([]string{}, args[:sep]...)
+	for _, flag := range shimArgs {
+		name, _, _ := strings.Cut(flag, "=")
+		i := slices.IndexFunc(merged, func(arg string) bool {
+			argName, _, _ := strings.Cut(arg, "=")
+			return argName == name
+		})
+		if i >= 0 {
+			merged[i] = flag
+		} else {
+			merged = append(merged, flag)
+		}
+	}
+	return append(merged, args[sep:]...)
+}
+
 func extractServers(root map[string]any) (map[string]any, string, error) {
 	for _, key := range serverKeys {
 		if raw, ok := root[key]; ok {
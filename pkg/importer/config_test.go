@@ -21,7 +21,7 @@ func TestRewriteConfigUpdatesShimPath(t *testing.T) {
 		t.Fatalf("marshal: %v", err)
 	}
 
-	updated, _, changed, err := rewriteConfig(data, "/new/shim")
+	updated, _, changed, err := rewriteConfig(data, "/new/shim", shimArgsFor(Options{}))
 	if err != nil {
 		t.Fatalf("rewrite: %v", err)
 	}
@@ -67,3 +67,67 @@ func TestRewriteConfigUpdatesShimPath(t *testing.T) {
 		t.Fatalf("unexpected args after shim update: %v", args)
 	}
 }
+
+func TestRewriteConfigAddsShimArgs(t *testing.T) {
+	raw := map[string]any{
+		"mcpServers": map[string]any{
+			"alpha": map[string]any{
+				"command": "/usr/bin/alpha",
+				"args":    []any{"--flag"},
+			},
+			"beta": map[string]any{
+				"command": "/new/shim",
+				"args":    []any{"--server-name=beta", "--limit-memory=1G", "--", "/usr/bin/beta"},
+			},
+			"gamma": map[string]any{
+				"command": "/usr/bin/gamma",
+			},
+		},
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	opts := Options{
+		ShimArgs:        []string{"--limit-memory=512M", "--limit-cpu=30s"},
+		ShimArgsServers: []string{"alpha", "beta"},
+	}
+	updated, _, changed, err := rewriteConfig(data, "/new/shim", shimArgsFor(opts))
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if !changed {
+		t.Fatal("expected config to be marked as changed")
+	}
+
+	var out struct {
+		MCPServers map[string]struct {
+			Args []string `json:"args"`
+		} `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(updated, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	expected := map[string][]string{
+		"alpha": {"--server-name=alpha", "--limit-memory=512M", "--limit-cpu=30s", "--", "/usr/bin/alpha", "--flag"},
+		"beta":  {"--server-name=beta", "--limit-memory=512M", "--limit-cpu=30s", "--", "/usr/bin/beta"},
+		"gamma": {"--server-name=gamma", "--", "/usr/bin/gamma"},
+	}
+	for name, want := range expected {
+		if got := out.MCPServers[name].Args; !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s args = %v, want %v", name, got, want)
+		}
+	}
+
+	// Importing again with the same flags changes nothing
+	_, _, changed, err = rewriteConfig(updated, "/new/shim", shimArgsFor(opts))
+	if err != nil {
+		t.Fatalf("second rewrite: %v", err)
+	}
+	if changed {
+		t.Fatal("expected second import to be a no-op")
+	}
+}
@@ -25,7 +25,7 @@ func Import(opts Options) (ImportResult, error) {
 		return ImportResult{}, fmt.Errorf("read config: %w", err)
 	}
 
-	updated, serverNames, changed, err := rewriteConfig(data, shimPath)
+	updated, serverNames, changed, err := rewriteConfig(data, shimPath, shimArgsFor(opts))
 	if err != nil {
 		return ImportResult{}, err
 	}
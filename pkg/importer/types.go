@@ -18,6 +18,12 @@ type Options struct {
 	Client     Client
 	ConfigPath string
 	ShimPath   string
+
+	// ShimArgs are shim flags (--name=value) written before "--" for
+	// ShimArgsServers, or every server when that is empty. They replace
+	// same-named flags of servers that are already imported.
+	ShimArgs        []string
+	ShimArgsServers []string
 }
 
 // ImportResult describes the outcome of an import operation.
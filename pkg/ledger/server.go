@@ -0,0 +1,396 @@
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+// Server defaults.
+const (
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 200 * time.Millisecond
+	DefaultQueueSize     = 10000
+)
+
+// ServerOptions configures batching and backpressure.
+type ServerOptions struct {
+	// BatchSize is the max events committed per transaction.
+	BatchSize int
+	// FlushInterval bounds how long a partial batch waits before commit.
+	FlushInterval time.Duration
+	// QueueSize is the max events buffered between readers and the writer.
+	QueueSize int
+	// PreviewDropThreshold is the queue length above which previews are
+	// stripped from incoming events. Defaults to 3/4 of QueueSize.
+	PreviewDropThreshold int
+	// NoDrop blocks producers instead of shedding previews. For replaying
+	// a file, where the producer can simply wait.
+	NoDrop bool
+	// ErrorLog receives commit failures; defaults to os.Stderr.
+	ErrorLog io.Writer
+}
+
+// ServerStats counts what the server has done since it started.
+type ServerStats struct {
+	Received        uint64 // Well-formed lines read
+	Malformed       uint64 // Lines skipped because they did not decode
+	PreviewsDropped uint64 // Events whose previews were stripped under load
+	EventsDropped   uint64 // Preview-bearing events dropped with a full queue
+	Committed       uint64 // Events written in committed batches
+	Failed          uint64 // Events lost to failed batches
+	Batches         uint64 // Committed transactions
+}
+
+// Server is the single writer for a ledger store. Any number of producers
+// (shim sockets, stdin) feed it JSONL; it commits in batched transactions.
+//
+// Backpressure mirrors the emitter: above the threshold previews are
+// stripped; with a full queue tool_call_start/end events are dropped while
+// decisions evict them or block their producer. Run boundaries also block.
+type Server struct {
+	store Store
+	opts  ServerOptions
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	queue    []queuedEvent
+	stopping bool // no new connections
+	closed   bool // queue closed; writer drains and exits
+
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	readers   sync.WaitGroup
+	writer    sync.WaitGroup
+
+	received        atomic.Uint64
+	malformed       atomic.Uint64
+	previewsDropped atomic.Uint64
+	eventsDropped   atomic.Uint64
+	committed       atomic.Uint64
+	failed          atomic.Uint64
+	batches         atomic.Uint64
+}
+
+type queuedEvent struct {
+	evt      any
+	decision bool
+	preview  bool
+}
+
+// NewServer creates a server writing to store and starts its writer.
+func NewServer(store Store, opts ServerOptions) *Server {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.PreviewDropThreshold <= 0 || opts.PreviewDropThreshold > opts.QueueSize {
+		opts.PreviewDropThreshold = (opts.QueueSize * 3) / 4
+		if opts.PreviewDropThreshold < 1 {
+			opts.PreviewDropThreshold = 1
+		}
+	}
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = os.Stderr
+	}
+
+	s := &Server{
+		store:     store,
+		opts:      opts,
+		queue:     make([]queuedEvent, 0, opts.QueueSize),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	s.notEmpty = sync.NewCond(&s.mu)
+	s.notFull = sync.NewCond(&s.mu)
+
+	s.writer.Add(1)
+	go s.writeLoop()
+	return s
+}
+
+// Serve accepts connections on ln until Close is called, reading JSONL
+// from each concurrently. Returns nil after Close.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			stopping := s.stopping
+			delete(s.listeners, ln)
+			s.mu.Unlock()
+			if stopping || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.stopping {
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.readers.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.readers.Done()
+			s.ServeReader(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// ServeReader ingests JSONL from r until EOF. Malformed lines are counted and
+// skipped. Blocks while the queue is full of events that must not drop.
+func (s *Server) ServeReader(r io.Reader) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := readLine(reader)
+		if len(line) > 0 {
+			s.ingestLine(line)
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// readLine returns the next line without its terminator. Lines longer than
+// maxLineBytes are consumed and returned as a marker that fails to decode.
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	var line []byte
+	oversized := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !oversized {
+			if len(line)+len(chunk) > maxLineBytes {
+				oversized = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if oversized {
+			line = []byte("{oversized")
+		}
+		return bytes.TrimSpace(line), err
+	}
+}
+
+func (s *Server) ingestLine(line []byte) {
+	evt, err := DecodeEvent(line)
+	if err != nil {
+		s.malformed.Add(1)
+		return
+	}
+	s.received.Add(1)
+	if evt == nil {
+		return
+	}
+	s.enqueue(evt)
+}
+
+func (s *Server) enqueue(evt any) {
+	item := queuedEvent{evt: evt}
+	switch evt.(type) {
+	case event.ToolCallDecisionEvent:
+		item.decision = true
+	case event.ToolCallStartEvent, event.ToolCallEndEvent:
+		item.preview = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item.preview && !s.opts.NoDrop && len(s.queue) >= s.opts.PreviewDropThreshold {
+		item.evt = stripPreview(item.evt)
+		s.previewsDropped.Add(1)
+	}
+
+	for {
+		if s.closed {
+			s.eventsDropped.Add(1)
+			return
+		}
+		if len(s.queue) < s.opts.QueueSize {
+			s.queue = append(s.queue, item)
+			s.notEmpty.Signal()
+			return
+		}
+		if item.preview && !s.opts.NoDrop {
+			s.eventsDropped.Add(1)
+			return
+		}
+		if item.decision && !s.opts.NoDrop && s.evictPreviewLocked() {
+			continue
+		}
+		s.notFull.Wait()
+	}
+}
+
+func (s *Server) evictPreviewLocked() bool {
+	for i, queued := range s.queue {
+		if !queued.preview {
+			continue
+		}
+		copy(s.queue[i:], s.queue[i+1:])
+		s.queue[len(s.queue)-1] = queuedEvent{}
+		s.queue = s.queue[:len(s.queue)-1]
+		s.eventsDropped.Add(1)
+		return true
+	}
+	return false
+}
+
+// writeLoop commits queued events in batches until Close drains the queue.
+func (s *Server) writeLoop() {
+	defer s.writer.Done()
+
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.notEmpty.Wait()
+		}
+		if len(s.queue) == 0 && s.closed {
+			s.mu.Unlock()
+			return
+		}
+
+		// Give a partial batch a moment to fill, unless shutting down.
+		if len(s.queue) < s.opts.BatchSize && !s.closed {
+			s.mu.Unlock()
+			time.Sleep(s.opts.FlushInterval)
+			s.mu.Lock()
+		}
+
+		n := len(s.queue)
+		if n > s.opts.BatchSize {
+			n = s.opts.BatchSize
+		}
+		batch := make([]any, n)
+		for i := 0; i < n; i++ {
+			batch[i] = s.queue[i].evt
+		}
+		remaining := copy(s.queue, s.queue[n:])
+		for i := remaining; i < len(s.queue); i++ {
+			s.queue[i] = queuedEvent{}
+		}
+		s.queue = s.queue[:remaining]
+		s.notFull.Broadcast()
+		s.mu.Unlock()
+
+		s.commit(batch)
+	}
+}
+
+func (s *Server) commit(events []any) {
+	if err := s.writeBatch(events); err != nil {
+		s.failed.Add(uint64(len(events)))
+		fmt.Fprintf(s.opts.ErrorLog, "ledgerd: batch of %d events failed: %v\n", len(events), err)
+		return
+	}
+	s.committed.Add(uint64(len(events)))
+	s.batches.Add(1)
+}
+
+func (s *Server) writeBatch(events []any) error {
+	batch, err := s.store.Begin()
+	if err != nil {
+		return err
+	}
+	for _, evt := range events {
+		if err := batch.Write(evt); err != nil {
+			batch.Rollback()
+			return err
+		}
+	}
+	return batch.Commit()
+}
+
+// Close stops accepting connections, closes open ones, and waits until
+// every queued event is committed.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.stopping = true
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	// Readers finish their current line before the queue closes.
+	s.readers.Wait()
+
+	s.mu.Lock()
+	s.closed = true
+	s.notEmpty.Broadcast()
+	s.notFull.Broadcast()
+	s.mu.Unlock()
+	s.writer.Wait()
+}
+
+// Stats returns a snapshot of the server counters.
+func (s *Server) Stats() ServerStats {
+	return ServerStats{
+		Received:        s.received.Load(),
+		Malformed:       s.malformed.Load(),
+		PreviewsDropped: s.previewsDropped.Load(),
+		EventsDropped:   s.eventsDropped.Load(),
+		Committed:       s.committed.Load(),
+		Failed:          s.failed.Load(),
+		Batches:         s.batches.Load(),
+	}
+}
+
+func stripPreview(evt any) any {
+	switch e := evt.(type) {
+	case event.ToolCallStartEvent:
+		e.Call.Preview.Truncated = true
+		e.Call.Preview.ArgsPreview = ""
+		return e
+	case event.ToolCallEndEvent:
+		e.Preview.Truncated = true
+		e.Preview.ResultPreview = ""
+		return e
+	default:
+		return evt
+	}
+}
@@ -0,0 +1,177 @@
+package ledger
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/core"
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServer_ConcurrentSocketsSkipMalformed(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(filepath.Join(dir, "ledger.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+
+	sockPath := filepath.Join(dir, "ledgerd.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := NewServer(store, ServerOptions{FlushInterval: time.Millisecond, ErrorLog: io.Discard})
+	go server.Serve(ln)
+
+	lines := strings.Split(strings.TrimSpace(ingestFixture), "\n")
+	var wg sync.WaitGroup
+	for i, chunk := range [][]string{lines[:3], lines[3:]} {
+		sink, err := core.NewSocketSink("unix://" + sockPath)
+		if err != nil {
+			t.Fatalf("sink: %v", err)
+		}
+		wg.Add(1)
+		go func(i int, chunk []string) {
+			defer wg.Done()
+			defer sink.Close()
+			for _, line := range chunk {
+				sink.Write([]byte(line + "\n"))
+			}
+			if i == 0 {
+				sink.Write([]byte("{not json\n"))
+			}
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	waitFor(t, "all lines", func() bool {
+		stats := server.Stats()
+		return stats.Received == uint64(len(lines)) && stats.Malformed == 1
+	})
+	server.Close()
+
+	stats := server.Stats()
+	if stats.Committed != uint64(len(lines)) || stats.Failed != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	calls, err := store.ToolCalls(ToolCallQuery{})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+}
+
+// blockingStore holds the writer in Begin until released.
+type blockingStore struct {
+	entered chan struct{}
+	release chan struct{}
+
+	mu     sync.Mutex
+	events []any
+}
+
+func (s *blockingStore) Begin() (Batch, error) {
+	select {
+	case s.entered <- struct{}{}:
+	default:
+	}
+	<-s.release
+	return &recordingBatch{store: s}, nil
+}
+
+func (s *blockingStore) ToolCalls(ToolCallQuery) ([]ToolCall, error)     { return nil, nil }
+func (s *blockingStore) Call(string) (CallDetail, error)                 { return CallDetail{}, ErrNotFound }
+func (s *blockingStore) CallDetails(ToolCallQuery) ([]CallDetail, error) { return nil, nil }
+func (s *blockingStore) Run(string) (Run, error)                         { return Run{}, ErrNotFound }
+func (s *blockingStore) Close() error                                    { return nil }
+
+type recordingBatch struct {
+	store  *blockingStore
+	events []any
+}
+
+func (b *recordingBatch) Write(evt any) error { b.events = append(b.events, evt); return nil }
+func (b *recordingBatch) Rollback() error     { return nil }
+func (b *recordingBatch) Commit() error {
+	b.store.mu.Lock()
+	defer b.store.mu.Unlock()
+	b.store.events = append(b.store.events, b.events...)
+	return nil
+}
+
+func TestServer_BackpressureDropsPreviewsNotDecisions(t *testing.T) {
+	store := &blockingStore{entered: make(chan struct{}, 1), release: make(chan struct{})}
+	server := NewServer(store, ServerOptions{
+		QueueSize:     4,
+		FlushInterval: time.Millisecond,
+		ErrorLog:      io.Discard,
+	})
+
+	lines := strings.Split(strings.TrimSpace(ingestFixture), "\n")
+	runStart, callStart, decision := lines[0], lines[1], lines[2]
+
+	// Park the writer so the queue can only fill.
+	server.ServeReader(strings.NewReader(runStart + "\n"))
+	<-store.entered
+
+	// Three previews fit; the 4th is stripped (threshold 3) and fills the
+	// queue; the 5th is stripped and dropped; the decision evicts a queued
+	// preview instead of waiting.
+	var input strings.Builder
+	for i := 0; i < 5; i++ {
+		input.WriteString(callStart + "\n")
+	}
+	input.WriteString(decision + "\n")
+	server.ServeReader(strings.NewReader(input.String()))
+
+	close(store.release)
+	server.Close()
+
+	stats := server.Stats()
+	if stats.EventsDropped != 2 {
+		t.Errorf("expected 2 dropped events, got %d", stats.EventsDropped)
+	}
+	if stats.PreviewsDropped != 2 {
+		t.Errorf("expected 2 stripped previews, got %d", stats.PreviewsDropped)
+	}
+
+	decisions, stripped := 0, 0
+	for _, evt := range store.events {
+		switch evt := evt.(type) {
+		case event.ToolCallDecisionEvent:
+			decisions++
+		case event.ToolCallStartEvent:
+			if evt.Call.Preview.Truncated && evt.Call.Preview.ArgsPreview == "" {
+				stripped++
+			}
+		}
+	}
+	if decisions != 1 {
+		t.Fatalf("decision must never drop, got %d", decisions)
+	}
+	if len(store.events) != 5 {
+		t.Fatalf("expected run_start + 3 previews + decision, got %d events", len(store.events))
+	}
+	if stripped == 0 {
+		t.Error("expected stripped previews in committed events")
+	}
+}
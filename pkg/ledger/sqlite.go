@@ -0,0 +1,522 @@
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+
+	_ "github.com/mattn/go-sqlite3" // registers the "sqlite3" driver
+)
+
+const sqliteDriver = "sqlite3"
+
+// busyTimeoutMS lets readers (sub tail) and the writer share the file.
+const busyTimeoutMS = 5000
+
+var schemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS runs (
+		run_id TEXT PRIMARY KEY,
+		agent_id TEXT,
+		client TEXT,
+		env TEXT,
+		started_at TEXT,
+		ended_at TEXT,
+		status TEXT,
+		metadata_json TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS tool_calls (
+		call_id TEXT PRIMARY KEY,
+		run_id TEXT,
+		server_name TEXT,
+		tool_name TEXT,
+		args_hash TEXT,
+		decision TEXT,
+		rule_id TEXT,
+		status TEXT,
+		latency_ms INTEGER,
+		bytes_in INTEGER,
+		bytes_out INTEGER,
+		preview_truncated INTEGER,
+		created_at TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS previews (
+		call_id TEXT PRIMARY KEY,
+		args_preview TEXT,
+		result_preview TEXT,
+		redaction_flags TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS hints (
+		call_id TEXT PRIMARY KEY,
+		hint_text TEXT,
+		suggested_args_json TEXT,
+		created_at TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS policy_versions (
+		policy_id TEXT,
+		version TEXT,
+		mode TEXT,
+		rules_hash TEXT,
+		rules_json TEXT,
+		created_at TEXT,
+		PRIMARY KEY (policy_id, version)
+	)`,
+	"CREATE INDEX IF NOT EXISTS idx_tool_calls_run_created ON tool_calls(run_id, created_at)",
+	"CREATE INDEX IF NOT EXISTS idx_tool_calls_tool ON tool_calls(server_name, tool_name)",
+	"CREATE INDEX IF NOT EXISTS idx_tool_calls_decision_status ON tool_calls(decision, status)",
+	"CREATE INDEX IF NOT EXISTS idx_tool_calls_args_hash ON tool_calls(args_hash)",
+}
+
+const (
+	upsertRunStart = "INSERT INTO runs (run_id, agent_id, client, env, started_at, metadata_json) VALUES (?, ?, ?, ?, ?, ?) " +
+		"ON CONFLICT(run_id) DO UPDATE SET agent_id=excluded.agent_id, client=excluded.client, env=excluded.env, started_at=excluded.started_at, metadata_json=excluded.metadata_json"
+
+	upsertRunEnd = "INSERT INTO runs (run_id, ended_at, status) VALUES (?, ?, ?) " +
+		"ON CONFLICT(run_id) DO UPDATE SET ended_at=excluded.ended_at, status=excluded.status"
+
+	upsertToolCallStart = "INSERT INTO tool_calls (call_id, run_id, server_name, tool_name, args_hash, bytes_in, preview_truncated, created_at) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?) " +
+		"ON CONFLICT(call_id) DO UPDATE SET run_id=excluded.run_id, server_name=excluded.server_name, tool_name=excluded.tool_name, args_hash=excluded.args_hash, bytes_in=excluded.bytes_in, preview_truncated=CASE WHEN excluded.preview_truncated=1 OR tool_calls.preview_truncated=1 THEN 1 ELSE 0 END, created_at=excluded.created_at"
+
+	upsertToolCallDecision = "INSERT INTO tool_calls (call_id, run_id, decision, rule_id, created_at) VALUES (?, ?, ?, ?, ?) " +
+		"ON CONFLICT(call_id) DO UPDATE SET decision=excluded.decision, rule_id=excluded.rule_id"
+
+	upsertToolCallEnd = "INSERT INTO tool_calls (call_id, run_id, status, latency_ms, bytes_out, preview_truncated, created_at) VALUES (?, ?, ?, ?, ?, ?, ?) " +
+		"ON CONFLICT(call_id) DO UPDATE SET status=excluded.status, latency_ms=excluded.latency_ms, bytes_out=excluded.bytes_out, preview_truncated=CASE WHEN excluded.preview_truncated=1 OR tool_calls.preview_truncated=1 THEN 1 ELSE 0 END"
+
+	upsertPreviewArgs = "INSERT INTO previews (call_id, args_preview, redaction_flags) VALUES (?, ?, ?) " +
+		"ON CONFLICT(call_id) DO UPDATE SET args_preview=excluded.args_preview"
+
+	upsertPreviewResult = "INSERT INTO previews (call_id, result_preview) VALUES (?, ?) " +
+		"ON CONFLICT(call_id) DO UPDATE SET result_preview=excluded.result_preview"
+
+	upsertHint = "INSERT INTO hints (call_id, hint_text, suggested_args_json, created_at) VALUES (?, ?, ?, ?) " +
+		"ON CONFLICT(call_id) DO UPDATE SET hint_text=excluded.hint_text, suggested_args_json=excluded.suggested_args_json, created_at=excluded.created_at"
+
+	upsertPolicyVersion = "INSERT INTO policy_versions (policy_id, version, mode, rules_hash, rules_json, created_at) VALUES (?, ?, ?, ?, ?, ?) " +
+		"ON CONFLICT(policy_id, version) DO UPDATE SET " +
+		"mode=COALESCE(excluded.mode, policy_versions.mode), " +
+		"rules_hash=COALESCE(excluded.rules_hash, policy_versions.rules_hash), " +
+		"rules_json=COALESCE(excluded.rules_json, policy_versions.rules_json), " +
+		"created_at=COALESCE(policy_versions.created_at, excluded.created_at)"
+)
+
+// sqliteStore is the SQLite-backed Store.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// Open opens (creating if needed) the SQLite ledger at dbPath in WAL mode
+// and ensures the schema exists.
+func Open(dbPath string) (Store, error) {
+	if strings.TrimSpace(dbPath) == "" {
+		return nil, fmt.Errorf("db path is required")
+	}
+	if err := ensureDir(dbPath); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(sqliteDriver, sqliteDSN(dbPath, fmt.Sprintf("_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=%d", busyTimeoutMS)))
+	if err != nil {
+		return nil, fmt.Errorf("open ledger: %w", err)
+	}
+	for _, stmt := range schemaStatements {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("create schema: %w", err)
+		}
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// OpenReadOnly opens an existing SQLite ledger for queries.
+func OpenReadOnly(dbPath string) (Store, error) {
+	if strings.TrimSpace(dbPath) == "" {
+		return nil, fmt.Errorf("db path is required")
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("ledger db not found at %s", dbPath)
+		}
+		return nil, fmt.Errorf("ledger db error: %w", err)
+	}
+
+	db, err := sql.Open(sqliteDriver, sqliteDSN(dbPath, fmt.Sprintf("mode=ro&_busy_timeout=%d", busyTimeoutMS)))
+	if err != nil {
+		return nil, fmt.Errorf("open ledger: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open ledger: %w", err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// sqliteDSN builds a file: URI so paths containing '?' or '#' stay intact.
+func sqliteDSN(dbPath, params string) string {
+	escaped := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(dbPath)
+	return "file:" + escaped + "?" + params
+}
+
+func ensureDir(dbPath string) error {
+	dir := filepath.Dir(dbPath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create db dir: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteStore) Begin() (Batch, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	return &sqliteBatch{tx: tx, stmts: make(map[string]*sql.Stmt)}, nil
+}
+
+func (s *sqliteStore) ToolCalls(q ToolCallQuery) ([]ToolCall, error) {
+	query, args := buildToolCallQuery(q)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query tool_calls: %w", err)
+	}
+	defer rows.Close()
+
+	var out []ToolCall
+	for rows.Next() {
+		var (
+			row                                                      ToolCall
+			createdAt, runID, serverName, toolName, decision, status sql.NullString
+		)
+		if err := rows.Scan(&row.CallID, &createdAt, &runID, &serverName, &toolName, &decision, &status,
+			&row.LatencyMS, &row.BytesIn, &row.BytesOut); err != nil {
+			return nil, fmt.Errorf("scan tool_calls: %w", err)
+		}
+		row.CreatedAt = createdAt.String
+		row.RunID = runID.String
+		row.ServerName = serverName.String
+		row.ToolName = toolName.String
+		row.Decision = decision.String
+		row.Status = status.String
+		out = append(out, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query tool_calls: %w", err)
+	}
+	return out, nil
+}
+
+func (s *sqliteStore) Call(callID string) (CallDetail, error) {
+	rows, err := s.CallDetails(ToolCallQuery{CallID: callID})
+	if err != nil {
+		return CallDetail{}, err
+	}
+	if len(rows) == 0 {
+		return CallDetail{}, fmt.Errorf("tool call %s: %w", callID, ErrNotFound)
+	}
+	return rows[0], nil
+}
+
+func (s *sqliteStore) CallDetails(q ToolCallQuery) ([]CallDetail, error) {
+	query, args := buildCallDetailQuery(q)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query tool_calls: %w", err)
+	}
+	defer rows.Close()
+
+	var out []CallDetail
+	for rows.Next() {
+		var (
+			row                                                      CallDetail
+			createdAt, runID, serverName, toolName, decision, status sql.NullString
+			argsHash, ruleID, argsPreview, hintText, suggested       sql.NullString
+			truncated                                                sql.NullBool
+		)
+		if err := rows.Scan(&row.CallID, &createdAt, &runID, &serverName, &toolName, &decision, &status,
+			&row.LatencyMS, &row.BytesIn, &row.BytesOut, &argsHash, &ruleID, &truncated, &argsPreview, &hintText, &suggested); err != nil {
+			return nil, fmt.Errorf("scan tool_calls: %w", err)
+		}
+		row.CreatedAt = createdAt.String
+		row.RunID = runID.String
+		row.ServerName = serverName.String
+		row.ToolName = toolName.String
+		row.Decision = decision.String
+		row.Status = status.String
+		row.ArgsHash = argsHash.String
+		row.RuleID = ruleID.String
+		row.PreviewTruncated = truncated.Bool
+		row.ArgsPreview = argsPreview.String
+		row.HintText = hintText.String
+		row.SuggestedArgsJSON = suggested.String
+		out = append(out, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query tool_calls: %w", err)
+	}
+	return out, nil
+}
+
+func (s *sqliteStore) Run(runID string) (Run, error) {
+	var (
+		row                                              Run
+		agentID, client, env, startedAt, endedAt, status sql.NullString
+	)
+	err := s.db.QueryRow("SELECT run_id, agent_id, client, env, started_at, ended_at, status FROM runs WHERE run_id = ?", runID).
+		Scan(&row.RunID, &agentID, &client, &env, &startedAt, &endedAt, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Run{}, fmt.Errorf("run %s: %w", runID, ErrNotFound)
+	}
+	if err != nil {
+		return Run{}, fmt.Errorf("query runs: %w", err)
+	}
+	row.AgentID = agentID.String
+	row.Client = client.String
+	row.Env = env.String
+	row.StartedAt = startedAt.String
+	row.EndedAt = endedAt.String
+	row.Status = status.String
+	return row, nil
+}
+
+// buildToolCallQuery returns the SELECT for q and its bound arguments.
+func buildToolCallQuery(q ToolCallQuery) (string, []any) {
+	return buildQuery("SELECT call_id, created_at, run_id, server_name, tool_name, decision, status, latency_ms, bytes_in, bytes_out FROM tool_calls", "", q)
+}
+
+// buildCallDetailQuery is buildToolCallQuery joined with previews and hints.
+func buildCallDetailQuery(q ToolCallQuery) (string, []any) {
+	return buildQuery("SELECT t.call_id, t.created_at, t.run_id, t.server_name, t.tool_name, t.decision, t.status, "+
+		"t.latency_ms, t.bytes_in, t.bytes_out, t.args_hash, t.rule_id, t.preview_truncated, p.args_preview, h.hint_text, h.suggested_args_json "+
+		"FROM tool_calls t LEFT JOIN previews p ON p.call_id = t.call_id LEFT JOIN hints h ON h.call_id = t.call_id", "t.", q)
+}
+
+// buildQuery appends q's filters, order and limit to selectFrom. prefix
+// qualifies tool_calls columns when selectFrom joins other tables.
+func buildQuery(selectFrom, prefix string, q ToolCallQuery) (string, []any) {
+	query := selectFrom
+
+	clauses := []string{}
+	args := []any{}
+	for _, filter := range []struct {
+		column string
+		value  string
+	}{
+		{"call_id", q.CallID},
+		{"run_id", q.RunID},
+		{"server_name", q.Server},
+		{"tool_name", q.Tool},
+		{"decision", q.Decision},
+		{"status", q.Status},
+	} {
+		if filter.value != "" {
+			clauses = append(clauses, prefix+filter.column+" = ?")
+			args = append(args, filter.value)
+		}
+	}
+	if q.Since != "" {
+		clauses = append(clauses, prefix+"created_at >= ?")
+		args = append(args, q.Since)
+	}
+	if q.AfterCreatedAt != "" {
+		if q.AfterCallID != "" {
+			clauses = append(clauses, fmt.Sprintf("(%[1]screated_at > ? OR (%[1]screated_at = ? AND %[1]scall_id > ?))", prefix))
+			args = append(args, q.AfterCreatedAt, q.AfterCreatedAt, q.AfterCallID)
+		} else {
+			clauses = append(clauses, prefix+"created_at > ?")
+			args = append(args, q.AfterCreatedAt)
+		}
+	}
+
+	if len(clauses) > 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	if q.Desc {
+		query += fmt.Sprintf(" ORDER BY %[1]screated_at DESC, %[1]scall_id DESC", prefix)
+	} else {
+		query += fmt.Sprintf(" ORDER BY %[1]screated_at ASC, %[1]scall_id ASC", prefix)
+	}
+
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	return query, args
+}
+
+// sqliteBatch writes events inside one transaction, reusing prepared
+// statements across events.
+type sqliteBatch struct {
+	tx    *sql.Tx
+	stmts map[string]*sql.Stmt
+}
+
+func (b *sqliteBatch) Commit() error {
+	if err := b.tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (b *sqliteBatch) Rollback() error {
+	return b.tx.Rollback()
+}
+
+func (b *sqliteBatch) exec(query string, args ...any) error {
+	stmt, ok := b.stmts[query]
+	if !ok {
+		var err error
+		stmt, err = b.tx.Prepare(query)
+		if err != nil {
+			return fmt.Errorf("prepare: %w", err)
+		}
+		b.stmts[query] = stmt
+	}
+	if _, err := stmt.Exec(args...); err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
+
+func (b *sqliteBatch) Write(evt any) error {
+	switch evt := evt.(type) {
+	case event.RunStartEvent:
+		return b.writeRunStart(evt)
+	case event.RunEndEvent:
+		return b.writeRunEnd(evt)
+	case event.ToolCallStartEvent:
+		return b.writeToolCallStart(evt)
+	case event.ToolCallDecisionEvent:
+		return b.writeToolCallDecision(evt)
+	case event.ToolCallEndEvent:
+		return b.writeToolCallEnd(evt)
+	default:
+		return nil
+	}
+}
+
+func (b *sqliteBatch) writeRunStart(evt event.RunStartEvent) error {
+	metadata, err := marshalJSON(evt.Run)
+	if err != nil {
+		return err
+	}
+	if err := b.exec(upsertRunStart,
+		nullText(evt.RunID),
+		nullText(evt.AgentID),
+		nullText(string(evt.Client)),
+		nullText(string(evt.Env)),
+		nullText(evt.Run.StartedAt),
+		nullText(metadata),
+	); err != nil {
+		return err
+	}
+	return b.writePolicyVersion(evt.Run.Policy, string(evt.Run.Mode), evt.Run.StartedAt)
+}
+
+func (b *sqliteBatch) writeRunEnd(evt event.RunEndEvent) error {
+	return b.exec(upsertRunEnd,
+		nullText(evt.RunID),
+		nullText(evt.Run.EndedAt),
+		nullText(string(evt.Run.Status)),
+	)
+}
+
+func (b *sqliteBatch) writeToolCallStart(evt event.ToolCallStartEvent) error {
+	if err := b.exec(upsertToolCallStart,
+		nullText(evt.Call.CallID),
+		nullText(evt.RunID),
+		nullText(evt.Call.ServerName),
+		nullText(evt.Call.ToolName),
+		nullText(evt.Call.ArgsHash),
+		evt.Call.BytesIn,
+		evt.Call.Preview.Truncated,
+		nullText(evt.TS),
+	); err != nil {
+		return err
+	}
+	return b.exec(upsertPreviewArgs, nullText(evt.Call.CallID), nullText(evt.Call.Preview.ArgsPreview), nil)
+}
+
+func (b *sqliteBatch) writeToolCallDecision(evt event.ToolCallDecisionEvent) error {
+	ruleID := ""
+	if evt.Decision.RuleID != nil {
+		ruleID = *evt.Decision.RuleID
+	}
+	if err := b.exec(upsertToolCallDecision,
+		nullText(evt.Call.CallID),
+		nullText(evt.RunID),
+		nullText(string(evt.Decision.Action)),
+		nullText(ruleID),
+		nullText(evt.TS),
+	); err != nil {
+		return err
+	}
+	if err := b.writePolicyVersion(evt.Decision.Policy, "", evt.TS); err != nil {
+		return err
+	}
+	if evt.Decision.Hint == nil {
+		return nil
+	}
+	return b.writeHint(evt.Call.CallID, *evt.Decision.Hint, evt.TS)
+}
+
+func (b *sqliteBatch) writeToolCallEnd(evt event.ToolCallEndEvent) error {
+	if err := b.exec(upsertToolCallEnd,
+		nullText(evt.Call.CallID),
+		nullText(evt.RunID),
+		nullText(string(evt.Status)),
+		evt.LatencyMS,
+		evt.BytesOut,
+		evt.Preview.Truncated,
+		nullText(evt.TS),
+	); err != nil {
+		return err
+	}
+	return b.exec(upsertPreviewResult, nullText(evt.Call.CallID), nullText(evt.Preview.ResultPreview))
+}
+
+func (b *sqliteBatch) writeHint(callID string, hint event.Hint, createdAt string) error {
+	suggested := ""
+	if len(hint.SuggestedArgs) > 0 {
+		var err error
+		suggested, err = marshalJSON(hint.SuggestedArgs)
+		if err != nil {
+			return err
+		}
+	}
+	return b.exec(upsertHint, nullText(callID), nullText(hint.HintText), nullText(suggested), nullText(createdAt))
+}
+
+func (b *sqliteBatch) writePolicyVersion(policy event.PolicyInfo, mode string, createdAt string) error {
+	policyID := strings.TrimSpace(policy.PolicyID)
+	version := strings.TrimSpace(policy.PolicyVersion)
+	if policyID == "" || version == "" {
+		return nil
+	}
+	return b.exec(upsertPolicyVersion,
+		policyID,
+		version,
+		nullText(strings.TrimSpace(mode)),
+		nullText(policy.PolicyHash),
+		nil,
+		nullText(createdAt),
+	)
+}
+
+// nullText stores empty strings as NULL.
+func nullText(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
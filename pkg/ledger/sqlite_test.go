@@ -0,0 +1,164 @@
+package ledger
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildToolCallQuery(t *testing.T) {
+	query, args := buildToolCallQuery(ToolCallQuery{
+		RunID:    "run-1",
+		Server:   "server-A",
+		Tool:     "tool-B",
+		Decision: "ALLOW",
+		Status:   "OK",
+		Desc:     true,
+		Limit:    25,
+	})
+	expected := "SELECT call_id, created_at, run_id, server_name, tool_name, decision, status, latency_ms, bytes_in, bytes_out FROM tool_calls WHERE run_id = ? AND server_name = ? AND tool_name = ? AND decision = ? AND status = ? ORDER BY created_at DESC, call_id DESC LIMIT ?"
+	if query != expected {
+		t.Fatalf("unexpected query:\nexpected: %s\nactual:   %s", expected, query)
+	}
+	if want := []any{"run-1", "server-A", "tool-B", "ALLOW", "OK", 25}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
+
+func TestBuildToolCallQueryAfterCursor(t *testing.T) {
+	query, args := buildToolCallQuery(ToolCallQuery{
+		RunID:          "run-2",
+		AfterCreatedAt: "2024-01-01T00:00:05Z",
+		AfterCallID:    "call-9",
+		Limit:          10,
+	})
+	if !strings.HasSuffix(query, "WHERE run_id = ? AND (created_at > ? OR (created_at = ? AND call_id > ?)) ORDER BY created_at ASC, call_id ASC LIMIT ?") {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	want := []any{"run-2", "2024-01-01T00:00:05Z", "2024-01-01T00:00:05Z", "call-9", 10}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
+
+const ingestFixture = `{"v":"0.1.0","type":"run_start","ts":"2024-01-01T00:00:00Z","run_id":"run-1","agent_id":"a","client":"headless","env":"ci","source":{},"run":{"started_at":"2024-01-01T00:00:00Z","mode":"guardrails","policy":{"policy_id":"p","policy_version":"1","policy_hash":"h"}}}
+{"v":"0.1.0","type":"tool_call_start","ts":"2024-01-01T00:00:01Z","run_id":"run-1","agent_id":"a","client":"headless","env":"ci","source":{},"call":{"call_id":"c-1","server_name":"git","tool_name":"o'brien","transport":"mcp_stdio","args_hash":"x","bytes_in":12,"preview":{"truncated":false,"args_preview":"{}"}}}
+{"v":"0.1.0","type":"tool_call_decision","ts":"2024-01-01T00:00:01Z","run_id":"run-1","agent_id":"a","client":"headless","env":"ci","source":{},"call":{"call_id":"c-1","server_name":"git","tool_name":"o'brien","args_hash":"x"},"decision":{"action":"ALLOW","rule_id":null,"severity":"info","explain":{"summary":"ok","reason_code":"POLICY_ALLOW"},"policy":{"policy_id":"p","policy_version":"1","policy_hash":"h"}}}
+{"v":"0.1.0","type":"tool_call_start","ts":"2024-01-01T00:00:02Z","run_id":"run-1","agent_id":"a","client":"headless","env":"ci","source":{},"call":{"call_id":"c-2","server_name":"git","tool_name":"status","transport":"mcp_stdio","args_hash":"y","bytes_in":3,"preview":{"truncated":false,"args_preview":"{}"}}}
+{"v":"0.1.0","type":"tool_call_end","ts":"2024-01-01T00:00:03Z","run_id":"run-1","agent_id":"a","client":"headless","env":"ci","source":{},"call":{"call_id":"c-1","server_name":"git","tool_name":"o'brien","args_hash":"x"},"status":"OK","latency_ms":7,"bytes_out":40,"preview":{"truncated":false,"result_preview":"{}"}}
+`
+
+func TestIngestAndQueryToolCalls(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "nested", "ledger.db")
+	if err := IngestJSONL(strings.NewReader(ingestFixture), dbPath); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+
+	store, err := OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+
+	calls, err := store.ToolCalls(ToolCallQuery{RunID: "run-1", Desc: true})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+
+	// Newest first; c-2 has no decision or end yet.
+	if calls[0].CallID != "c-2" || calls[0].Decision != "" || calls[0].LatencyMS.Valid {
+		t.Fatalf("unexpected pending call: %+v", calls[0])
+	}
+	first := calls[1]
+	if first.ToolName != "o'brien" || first.Decision != "ALLOW" || first.Status != "OK" {
+		t.Fatalf("unexpected completed call: %+v", first)
+	}
+	if first.LatencyMS.Int64 != 7 || first.BytesIn.Int64 != 12 || first.BytesOut.Int64 != 40 {
+		t.Fatalf("unexpected counters: %+v", first)
+	}
+
+	// Quotes are bound as parameters, not spliced into SQL.
+	calls, err = store.ToolCalls(ToolCallQuery{Tool: "o'brien"})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(calls) != 1 || calls[0].CallID != "c-1" {
+		t.Fatalf("expected c-1 by tool name, got %+v", calls)
+	}
+}
+
+func TestIngestRollsBackOnMalformedLine(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "ledger.db")
+	lines := strings.SplitN(ingestFixture, "\n", 3)
+	input := lines[0] + "\n" + lines[1] + "\n{not json\n"
+	if err := IngestJSONL(strings.NewReader(input), dbPath); err == nil {
+		t.Fatal("expected error for malformed line")
+	}
+
+	store, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	calls, err := store.ToolCalls(ToolCallQuery{})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("expected nothing committed, got %d calls", len(calls))
+	}
+}
+
+func TestCallJoinsPreviewAndHint(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "ledger.db")
+	rejected := `{"v":"0.1.0","type":"tool_call_start","ts":"2024-01-01T00:00:04Z","run_id":"run-1","agent_id":"a","client":"headless","env":"ci","source":{},"call":{"call_id":"c-3","server_name":"git","tool_name":"push","transport":"mcp_stdio","args_hash":"z","bytes_in":20,"preview":{"truncated":false,"args_preview":"{\"branch\":\"main\"}"}}}
+{"v":"0.1.0","type":"tool_call_decision","ts":"2024-01-01T00:00:04Z","run_id":"run-1","agent_id":"a","client":"headless","env":"ci","source":{},"call":{"call_id":"c-3","server_name":"git","tool_name":"push","args_hash":"z"},"decision":{"action":"REJECT_WITH_HINT","rule_id":"no-main","severity":"warn","explain":{"summary":"blocked","reason_code":"POLICY_BLOCK"},"policy":{"policy_id":"p","policy_version":"1","policy_hash":"h"},"hint":{"hint_text":"Push to a feature branch","suggested_args":{"branch":"fix"},"hint_kind":"ARG_FIX"}}}
+`
+	if err := IngestJSONL(strings.NewReader(ingestFixture+rejected), dbPath); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+
+	store, err := OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+
+	call, err := store.Call("c-3")
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if call.Decision != "REJECT_WITH_HINT" || call.RuleID != "no-main" || call.ArgsHash != "z" || call.RunID != "run-1" {
+		t.Fatalf("unexpected call: %+v", call)
+	}
+	if call.ArgsPreview != `{"branch":"main"}` || call.PreviewTruncated {
+		t.Fatalf("unexpected preview: %q truncated=%v", call.ArgsPreview, call.PreviewTruncated)
+	}
+	if call.HintText != "Push to a feature branch" || call.SuggestedArgsJSON != `{"branch":"fix"}` {
+		t.Fatalf("unexpected hint: %q %q", call.HintText, call.SuggestedArgsJSON)
+	}
+
+	// A call without a hint has empty hint fields.
+	if call, err := store.Call("c-1"); err != nil || call.HintText != "" {
+		t.Fatalf("unexpected c-1: %+v, %v", call, err)
+	}
+	if _, err := store.Call("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	details, err := store.CallDetails(ToolCallQuery{RunID: "run-1", Since: "2024-01-01T00:00:02Z"})
+	if err != nil {
+		t.Fatalf("call details: %v", err)
+	}
+	if len(details) != 2 || details[0].CallID != "c-2" || details[1].CallID != "c-3" || details[1].HintText == "" {
+		t.Fatalf("expected c-2 then c-3 since 00:00:02, got %+v", details)
+	}
+	if run, err := store.Run("run-1"); err != nil || run.AgentID != "a" || run.Env != "ci" {
+		t.Fatalf("unexpected run: %+v, %v", run, err)
+	}
+}
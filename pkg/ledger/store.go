@@ -0,0 +1,102 @@
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrNotFound is returned by lookups of a row that does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Store persists ledger events and answers queries over them.
+type Store interface {
+	// Begin starts a write batch. Events written to it become visible
+	// together on Commit.
+	Begin() (Batch, error)
+
+	// ToolCalls returns tool_calls rows matching q.
+	ToolCalls(q ToolCallQuery) ([]ToolCall, error)
+
+	// Call returns one tool call with its args preview and hint, or
+	// ErrNotFound.
+	Call(callID string) (CallDetail, error)
+
+	// CallDetails returns tool calls matching q with their args previews
+	// and hints.
+	CallDetails(q ToolCallQuery) ([]CallDetail, error)
+
+	// Run returns one runs row, or ErrNotFound.
+	Run(runID string) (Run, error)
+
+	// Close releases the underlying database.
+	Close() error
+}
+
+// Batch is a set of event writes applied atomically.
+type Batch interface {
+	// Write records one decoded event (see DecodeEvent). Event types the
+	// ledger does not store are ignored.
+	Write(evt any) error
+	Commit() error
+	Rollback() error
+}
+
+// ToolCallQuery scopes a ToolCalls lookup. Empty fields do not filter.
+type ToolCallQuery struct {
+	CallID   string
+	RunID    string
+	Server   string
+	Tool     string
+	Decision string
+	Status   string
+
+	// Only rows created at or after Since (RFC 3339)
+	Since string
+
+	// Keyset cursor: only rows strictly after (AfterCreatedAt, AfterCallID)
+	AfterCreatedAt string
+	AfterCallID    string
+
+	// Newest first when true; oldest first otherwise
+	Desc bool
+
+	// Max rows to return; 0 means no limit
+	Limit int
+}
+
+// ToolCall is one row of the tool_calls table.
+// Columns filled by events that have not arrived yet are NULL.
+type ToolCall struct {
+	CallID     string
+	CreatedAt  string
+	RunID      string
+	ServerName string
+	ToolName   string
+	Decision   string
+	Status     string
+	LatencyMS  sql.NullInt64
+	BytesIn    sql.NullInt64
+	BytesOut   sql.NullInt64
+}
+
+// CallDetail is a tool_calls row joined with its preview and hint.
+type CallDetail struct {
+	ToolCall
+	ArgsHash          string
+	RuleID            string
+	ArgsPreview       string
+	PreviewTruncated  bool
+	HintText          string
+	SuggestedArgsJSON string
+}
+
+// Run is one row of the runs table.
+type Run struct {
+	RunID     string
+	AgentID   string
+	Client    string
+	Env       string
+	StartedAt string
+	EndedAt   string
+	Status    string
+}
@@ -2,38 +2,192 @@ package policy
 
 import (
 	"encoding/json"
+	"errors"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
-func matchArgs(match *ArgsMatch, args map[string]any) bool {
+func (b *Bundle) matchArgs(match *ArgsMatch, args map[string]any) bool {
 	if match == nil || match.IsZero() {
 		return true
 	}
 	if args == nil {
-		return false
+		args = map[string]any{}
 	}
 	for _, key := range match.HasKeys {
-		if _, ok := args[key]; !ok {
+		if _, ok := lookupArg(args, key); !ok {
 			return false
 		}
 	}
 	for key, expected := range match.KeyEquals {
-		if !valuesEqual(args[key], expected) {
+		actual, _ := lookupArg(args, key)
+		if !valuesEqual(actual, expected) {
 			return false
 		}
 	}
 	for key, allowed := range match.KeyIn {
-		if !valueIn(args[key], allowed) {
+		actual, _ := lookupArg(args, key)
+		if !valueIn(actual, allowed) {
 			return false
 		}
 	}
 	for key, numeric := range match.NumericRange {
-		if !valueInRange(args[key], numeric) {
+		actual, _ := lookupArg(args, key)
+		if !valueInRange(actual, numeric) {
+			return false
+		}
+	}
+	for key, patterns := range match.KeyRegex {
+		actual, _ := lookupArg(args, key)
+		value, ok := actual.(string)
+		if !ok || !anyPattern(patterns, value, b.regexMatch) {
+			return false
+		}
+	}
+	for key, patterns := range match.KeyGlob {
+		actual, _ := lookupArg(args, key)
+		value, ok := actual.(string)
+		if !ok || !anyPattern(patterns, value, globMatch) {
+			return false
+		}
+	}
+	for key, prefixes := range match.PathPrefix {
+		actual, _ := lookupArg(args, key)
+		value, ok := actual.(string)
+		if !ok || !anyPattern(prefixes, value, pathWithin) {
+			return false
+		}
+	}
+	for key, length := range match.Length {
+		actual, _ := lookupArg(args, key)
+		if !lengthInRange(actual, length) {
+			return false
+		}
+	}
+	if match.Not != nil && b.matchArgs(match.Not, args) {
+		return false
+	}
+	for i := range match.AllOf {
+		if !b.matchArgs(&match.AllOf[i], args) {
+			return false
+		}
+	}
+	if len(match.AnyOf) > 0 {
+		matched := false
+		for i := range match.AnyOf {
+			if b.matchArgs(&match.AnyOf[i], args) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
 			return false
 		}
 	}
 	return true
 }
 
+// lookupArg resolves key against args. Keys starting with "/" are JSON
+// pointers into nested objects and arrays; any other key is a top-level name.
+func lookupArg(args map[string]any, key string) (any, bool) {
+	if !strings.HasPrefix(key, "/") {
+		value, ok := args[key]
+		return value, ok
+	}
+	tokens, err := parsePointer(key)
+	if err != nil {
+		return nil, false
+	}
+	var current any = args
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]any:
+			next, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []any:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) || (len(token) > 1 && token[0] == '0') {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// parsePointer splits a JSON pointer into unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("JSON pointer must start with /")
+	}
+	parts := strings.Split(pointer[1:], "/")
+	for i, part := range parts {
+		for j := 0; j < len(part); j++ {
+			if part[j] == '~' && (j+1 >= len(part) || (part[j+1] != '0' && part[j+1] != '1')) {
+				return nil, errors.New("invalid ~ escape in JSON pointer (use ~0 or ~1)")
+			}
+		}
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+	}
+	return parts, nil
+}
+
+func anyPattern(patterns []string, value string, match func(pattern, value string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathWithin reports whether value, once "." and ".." segments are
+// resolved, is prefix or lies beneath it. A relative prefix of "." admits
+// any relative path that does not climb out of it.
+func pathWithin(prefix, value string) bool {
+	if value == "" || prefix == "" {
+		return false
+	}
+	cleaned := path.Clean(value)
+	root := path.Clean(prefix)
+	switch root {
+	case ".":
+		return !path.IsAbs(cleaned) && cleaned != ".." && !strings.HasPrefix(cleaned, "../")
+	case "/":
+		return path.IsAbs(cleaned)
+	}
+	return cleaned == root || strings.HasPrefix(cleaned, root+"/")
+}
+
+func lengthInRange(actual any, length LengthRange) bool {
+	var size int
+	switch v := actual.(type) {
+	case string:
+		size = utf8.RuneCountInString(v)
+	case []any:
+		size = len(v)
+	case map[string]any:
+		size = len(v)
+	default:
+		return false
+	}
+	if length.Min != nil && size < *length.Min {
+		return false
+	}
+	if length.Max != nil && size > *length.Max {
+		return false
+	}
+	return true
+}
+
 func valuesEqual(actual, expected any) bool {
 	if actual == nil || expected == nil {
 		return actual == expected
@@ -51,7 +205,7 @@ func valuesEqual(actual, expected any) bool {
 		act, ok := actual.(bool)
 		return ok && act == exp
 	default:
-		return actual == expected
+		return reflect.DeepEqual(actual, expected)
 	}
 }
 
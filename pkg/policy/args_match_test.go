@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+func parseArgsMatch(t *testing.T, raw string) *ArgsMatch {
+	t.Helper()
+	var match ArgsMatch
+	if err := json.Unmarshal([]byte(raw), &match); err != nil {
+		t.Fatalf("parse args match: %v", err)
+	}
+	return &match
+}
+
+func parseArgs(t *testing.T, raw string) map[string]any {
+	t.Helper()
+	var args map[string]any
+	if err := json.Unmarshal([]byte(raw), &args); err != nil {
+		t.Fatalf("parse args: %v", err)
+	}
+	return args
+}
+
+func TestMatchArgs_Predicates(t *testing.T) {
+	tests := []struct {
+		name  string
+		match string
+		args  string
+		want  bool
+	}{
+		{"pointer equals nested bool", `{"key_equals": {"/options/force": true}}`, `{"options": {"force": true}}`, true},
+		{"pointer missing key", `{"key_equals": {"/options/force": true}}`, `{"options": {}}`, false},
+		{"pointer into array", `{"key_equals": {"/files/1/path": "b"}}`, `{"files": [{"path": "a"}, {"path": "b"}]}`, true},
+		{"pointer escapes", `{"has_keys": ["/a~1b/c~0d"]}`, `{"a/b": {"c~d": 1}}`, true},
+		{"plain key stays top-level", `{"has_keys": ["options.force"]}`, `{"options": {"force": true}}`, false},
+		{"glob matches release branch", `{"key_glob": {"branch": ["main", "release/*"]}}`, `{"branch": "release/1.2"}`, true},
+		{"glob misses feature branch", `{"key_glob": {"branch": ["main", "release/*"]}}`, `{"branch": "feature/x"}`, false},
+		{"regex", `{"key_regex": {"branch": ["^(main|release/.*)$"]}}`, `{"branch": "main"}`, true},
+		{"regex needs string", `{"key_regex": {"count": ["1"]}}`, `{"count": 1}`, false},
+		{"path inside root", `{"path_prefix": {"path": ["/repo"]}}`, `{"path": "/repo/src/main.go"}`, true},
+		{"path is root", `{"path_prefix": {"path": ["/repo/"]}}`, `{"path": "/repo"}`, true},
+		{"path escapes via dotdot", `{"path_prefix": {"path": ["/repo"]}}`, `{"path": "/repo/src/../../etc/passwd"}`, false},
+		{"path sibling with shared prefix", `{"path_prefix": {"path": ["/repo"]}}`, `{"path": "/repo-other/x"}`, false},
+		{"relative path within dot", `{"path_prefix": {"path": ["."]}}`, `{"path": "src/./main.go"}`, true},
+		{"relative path climbs out", `{"path_prefix": {"path": ["."]}}`, `{"path": "src/../../x"}`, false},
+		{"string length", `{"length": {"query": {"max": 5}}}`, `{"query": "héllo"}`, true},
+		{"array length", `{"length": {"ids": {"min": 3}}}`, `{"ids": [1, 2]}`, false},
+		{"not", `{"not": {"path_prefix": {"path": ["/repo"]}}}`, `{"path": "/etc/passwd"}`, true},
+		{"not with missing args", `{"not": {"has_keys": ["path"]}}`, `{}`, true},
+		{"any_of", `{"any_of": [{"key_equals": {"mode": "a"}}, {"key_equals": {"mode": "b"}}]}`, `{"mode": "b"}`, true},
+		{"any_of none", `{"any_of": [{"key_equals": {"mode": "a"}}, {"key_equals": {"mode": "b"}}]}`, `{"mode": "c"}`, false},
+		{"all_of", `{"all_of": [{"has_keys": ["a"]}, {"has_keys": ["b"]}]}`, `{"a": 1}`, false},
+		{"equals object", `{"key_equals": {"opts": {"x": 1}}}`, `{"opts": {"x": 1}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&Bundle{}).matchArgs(parseArgsMatch(t, tt.match), parseArgs(t, tt.args)); got != tt.want {
+				t.Errorf("matchArgs(%s, %s) = %v, want %v", tt.match, tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintBundle_ArgsPredicates(t *testing.T) {
+	spec := BundleSpec{
+		PolicyID: "p",
+		Version:  "1",
+		Mode:     "guardrails",
+		Rules: []Rule{
+			{
+				RuleID: "r",
+				Kind:   "deny",
+				Match: Match{Args: parseArgsMatch(t, `{
+					"key_regex": {"branch": ["("]},
+					"key_glob": {"branch": ["[a-"]},
+					"has_keys": ["/bad~2escape"],
+					"length": {"q": {"min": 5, "max": 1}},
+					"any_of": [{"path_prefix": {"path": [""]}}],
+					"not": {}
+				}`)},
+			},
+		},
+	}
+
+	var fields []string
+	for _, issue := range LintBundle(spec) {
+		fields = append(fields, issue.Level+" "+issue.Field)
+	}
+	got := strings.Join(fields, "\n")
+	for _, want := range []string{
+		"error rules[0].match.args",
+		"error rules[0].match.args.key_regex.branch",
+		"error rules[0].match.args.key_glob.branch",
+		"error rules[0].match.args.length.q",
+		"error rules[0].match.args.any_of[0].path_prefix.path",
+		"warn rules[0].match.args.not",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected lint issue %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestCompileBundle_PrecompilesKeyRegex(t *testing.T) {
+	rule := Rule{
+		RuleID: "r",
+		Kind:   "deny",
+		Match:  Match{Args: parseArgsMatch(t, `{"any_of": [{"key_regex": {"branch": ["^precompiled/[0-9]+$"]}}]}`)},
+	}
+	compiled, err := CompileBundle(BundleSpec{Mode: "guardrails", Rules: []Rule{rule}})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if _, ok := compiled.Bundle.patterns.Load("^precompiled/[0-9]+$"); !ok {
+		t.Fatal("expected key_regex pattern compiled at load")
+	}
+
+	// Patterns belong to the bundle, so a reload releases the old ones
+	other := Rule{RuleID: "r", Kind: "deny", Match: Match{ToolName: &NameMatch{Regex: []string{"^other$"}}}}
+	reloaded, err := CompileBundle(BundleSpec{Mode: "guardrails", Rules: []Rule{other}})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if _, ok := reloaded.Bundle.patterns.Load("^precompiled/[0-9]+$"); ok {
+		t.Fatal("expected a new bundle not to hold the previous bundle's patterns")
+	}
+	if _, ok := reloaded.Bundle.patterns.Load("^other$"); !ok {
+		t.Fatal("expected tool_name regex compiled at load")
+	}
+
+	rule.Match.Args = parseArgsMatch(t, `{"all_of": [{"key_regex": {"branch": ["("]}}]}`)
+	_, err = CompileBundle(BundleSpec{Mode: "guardrails", Rules: []Rule{rule}})
+	if err == nil || !strings.Contains(err.Error(), "rules[0].match.args.all_of[0].key_regex.branch") {
+		t.Fatalf("expected invalid key_regex rejected at load, got %v", err)
+	}
+}
+
+func TestLoadFromEnv_InvalidKeyRegexFailsClosed(t *testing.T) {
+	t.Setenv("SUB_POLICY_FILE", "")
+	t.Setenv("SUB_POLICY_JSON", `{"mode":"guardrails","rules":[{"rule_id":"r","kind":"deny","match":{"args":{"key_regex":{"branch":["("]}}}}]}`)
+
+	bundle := LoadFromEnv()
+	if bundle.LoadFailure == nil {
+		t.Fatal("expected a load failure for an invalid key_regex")
+	}
+	if d := bundle.Decide("s", "tool", "h"); d.Action != event.DecisionBlock {
+		t.Fatalf("expected BLOCK, got %s", d.Action)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package policy
+
+import "os"
+
+// Without flock, the state file is only safe for one shim at a time.
+
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
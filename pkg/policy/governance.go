@@ -2,6 +2,7 @@ package policy
 
 import (
 	"fmt"
+	"path"
 	"reflect"
 	"regexp"
 	"sort"
@@ -45,6 +46,29 @@ func LintBundle(spec BundleSpec) []LintIssue {
 		}
 	}
 
+	costPatterns := make([]string, 0, len(spec.Defaults.ToolCosts))
+	for pattern := range spec.Defaults.ToolCosts {
+		costPatterns = append(costPatterns, pattern)
+	}
+	sort.Strings(costPatterns)
+	for _, pattern := range costPatterns {
+		if spec.Defaults.ToolCosts[pattern] < 0 {
+			issues = append(issues, LintIssue{Level: "error", Field: "defaults.tool_costs." + pattern, Message: "cost units cannot be negative"})
+		}
+	}
+
+	tagsWriteLike := false
+	for _, rule := range spec.Rules {
+		if rule.Effect.Tag == nil {
+			continue
+		}
+		for _, class := range rule.Effect.Tag.AddRiskClass {
+			if normalizeRiskClass(class) == "write_like" {
+				tagsWriteLike = true
+			}
+		}
+	}
+
 	if len(spec.Rules) == 0 {
 		issues = append(issues, LintIssue{Level: "error", Field: "rules", Message: "at least one rule is required"})
 	}
@@ -77,28 +101,82 @@ func LintBundle(spec BundleSpec) []LintIssue {
 			}
 		}
 
-		for _, pattern := range rule.Match.ServerName.Regex {
-			if _, err := regexp.Compile(pattern); err != nil {
-				issues = append(issues, LintIssue{Level: "error", Field: ruleField + ".match.server_name.regex", Message: err.Error()})
+		if rule.Match.ServerName != nil {
+			for _, pattern := range rule.Match.ServerName.Regex {
+				if _, err := regexp.Compile(pattern); err != nil {
+					issues = append(issues, LintIssue{Level: "error", Field: ruleField + ".match.server_name.regex", Message: err.Error()})
+				}
 			}
 		}
-		for _, pattern := range rule.Match.ToolName.Regex {
-			if _, err := regexp.Compile(pattern); err != nil {
-				issues = append(issues, LintIssue{Level: "error", Field: ruleField + ".match.tool_name.regex", Message: err.Error()})
+		if rule.Match.ToolName != nil {
+			for _, pattern := range rule.Match.ToolName.Regex {
+				if _, err := regexp.Compile(pattern); err != nil {
+					issues = append(issues, LintIssue{Level: "error", Field: ruleField + ".match.tool_name.regex", Message: err.Error()})
+				}
 			}
 		}
 
-		if rule.Match.Args != nil {
-			for key, numeric := range rule.Match.Args.NumericRange {
-				if numeric.Min != nil && numeric.Max != nil && *numeric.Min > *numeric.Max {
-					issues = append(issues, LintIssue{Level: "error", Field: ruleField + ".match.args.numeric_range." + key, Message: "min cannot exceed max"})
+		if rule.Effect.TimeoutMS < 0 {
+			issues = append(issues, LintIssue{Level: "error", Field: ruleField + ".effect.timeout_ms", Message: "timeout_ms cannot be negative"})
+		}
+
+		if budget := rule.Effect.Budget; budget != nil {
+			budgetField := ruleField + ".effect.budget"
+			for _, field := range []struct {
+				name  string
+				value *int
+			}{
+				{"limit_calls", budget.LimitCalls},
+				{"limit_cost_units", budget.LimitCostUnits},
+				{"cost_units_per_call", budget.CostUnitsPerCall},
+				{"limit_write_actions", budget.LimitWriteActions},
+			} {
+				if field.value != nil && *field.value < 0 {
+					issues = append(issues, LintIssue{Level: "error", Field: budgetField + "." + field.name, Message: field.name + " cannot be negative"})
 				}
 			}
-			for key, values := range rule.Match.Args.KeyIn {
-				if len(values) == 0 {
-					issues = append(issues, LintIssue{Level: "warn", Field: ruleField + ".match.args.key_in." + key, Message: "key_in list is empty"})
+			if budget.LimitCalls == nil && budget.LimitCostUnits == nil && budget.LimitWriteActions == nil {
+				issues = append(issues, LintIssue{Level: "warn", Field: budgetField, Message: "budget sets no limit; it never triggers"})
+			}
+			if budget.CostArg != "" && budget.LimitCostUnits == nil {
+				issues = append(issues, LintIssue{Level: "warn", Field: budgetField + ".cost_arg", Message: "cost_arg has no effect without limit_cost_units"})
+			}
+			if budget.LimitWriteActions != nil && !tagsWriteLike {
+				issues = append(issues, LintIssue{Level: "warn", Field: budgetField + ".limit_write_actions", Message: "no tag rule adds write_like; write actions are never counted"})
+			}
+		}
+
+		if breaker := rule.Effect.Breaker; breaker != nil {
+			breakerField := ruleField + ".effect.breaker"
+			for _, field := range []struct {
+				name  string
+				value int
+			}{
+				{"error_threshold", breaker.ErrorThreshold},
+				{"window_ms", breaker.WindowMS},
+				{"latency_threshold_ms", breaker.LatencyThresholdMS},
+				{"slow_call_threshold", breaker.SlowCallThreshold},
+				{"cooldown_ms", breaker.CooldownMS},
+			} {
+				if field.value < 0 {
+					issues = append(issues, LintIssue{Level: "error", Field: breakerField + "." + field.name, Message: field.name + " cannot be negative"})
 				}
 			}
+			if (breaker.ErrorThreshold > 0 || breaker.SlowCallThreshold > 0) && breaker.WindowMS <= 0 {
+				issues = append(issues, LintIssue{Level: "error", Field: breakerField + ".window_ms", Message: "window_ms is required with error_threshold or slow_call_threshold"})
+			}
+			if (breaker.LatencyThresholdMS > 0) != (breaker.SlowCallThreshold > 0) {
+				issues = append(issues, LintIssue{Level: "warn", Field: breakerField + ".slow_call_threshold", Message: "latency_threshold_ms and slow_call_threshold only take effect together"})
+			}
+		}
+
+		if rule.Match.Args != nil {
+			issues = append(issues, lintArgsMatch(ruleField+".match.args", rule.Match.Args)...)
+		}
+		if strings.TrimSpace(rule.When) != "" {
+			if _, err := compileWhenExpr(rule.When); err != nil {
+				issues = append(issues, LintIssue{Level: "error", Field: ruleField + ".when", Message: err.Error()})
+			}
 		}
 	}
 
@@ -113,6 +191,117 @@ func LintBundle(spec BundleSpec) []LintIssue {
 	return issues
 }
 
+// lintArgsMatch validates argument predicates, recursing into combinators.
+func lintArgsMatch(field string, match *ArgsMatch) []LintIssue {
+	var issues []LintIssue
+
+	keys := map[string]struct{}{}
+	for _, key := range match.HasKeys {
+		keys[key] = struct{}{}
+	}
+	for _, set := range []map[string]struct{}{
+		mapKeys(match.KeyEquals), mapKeys(match.KeyIn), mapKeys(match.NumericRange),
+		mapKeys(match.KeyRegex), mapKeys(match.KeyGlob), mapKeys(match.PathPrefix), mapKeys(match.Length),
+	} {
+		for key := range set {
+			keys[key] = struct{}{}
+		}
+	}
+	for _, key := range sortedSet(keys) {
+		if !strings.HasPrefix(key, "/") {
+			continue
+		}
+		if _, err := parsePointer(key); err != nil {
+			issues = append(issues, LintIssue{Level: "error", Field: field, Message: fmt.Sprintf("key %q: %v", key, err)})
+		}
+	}
+
+	for _, key := range sortedSet(mapKeys(match.NumericRange)) {
+		numeric := match.NumericRange[key]
+		if numeric.Min != nil && numeric.Max != nil && *numeric.Min > *numeric.Max {
+			issues = append(issues, LintIssue{Level: "error", Field: field + ".numeric_range." + key, Message: "min cannot exceed max"})
+		}
+	}
+	for _, key := range sortedSet(mapKeys(match.KeyIn)) {
+		if len(match.KeyIn[key]) == 0 {
+			issues = append(issues, LintIssue{Level: "warn", Field: field + ".key_in." + key, Message: "key_in list is empty"})
+		}
+	}
+	for _, key := range sortedSet(mapKeys(match.KeyRegex)) {
+		patterns := match.KeyRegex[key]
+		if len(patterns) == 0 {
+			issues = append(issues, LintIssue{Level: "warn", Field: field + ".key_regex." + key, Message: "key_regex list is empty; never matches"})
+		}
+		for _, pattern := range patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				issues = append(issues, LintIssue{Level: "error", Field: field + ".key_regex." + key, Message: err.Error()})
+			}
+		}
+	}
+	for _, key := range sortedSet(mapKeys(match.KeyGlob)) {
+		patterns := match.KeyGlob[key]
+		if len(patterns) == 0 {
+			issues = append(issues, LintIssue{Level: "warn", Field: field + ".key_glob." + key, Message: "key_glob list is empty; never matches"})
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				issues = append(issues, LintIssue{Level: "error", Field: field + ".key_glob." + key, Message: fmt.Sprintf("invalid glob %q", pattern)})
+			}
+		}
+	}
+	for _, key := range sortedSet(mapKeys(match.PathPrefix)) {
+		prefixes := match.PathPrefix[key]
+		if len(prefixes) == 0 {
+			issues = append(issues, LintIssue{Level: "warn", Field: field + ".path_prefix." + key, Message: "path_prefix list is empty; never matches"})
+		}
+		for _, prefix := range prefixes {
+			if strings.TrimSpace(prefix) == "" {
+				issues = append(issues, LintIssue{Level: "error", Field: field + ".path_prefix." + key, Message: "path prefix cannot be empty"})
+			}
+		}
+	}
+	for _, key := range sortedSet(mapKeys(match.Length)) {
+		length := match.Length[key]
+		if (length.Min != nil && *length.Min < 0) || (length.Max != nil && *length.Max < 0) {
+			issues = append(issues, LintIssue{Level: "error", Field: field + ".length." + key, Message: "length bounds cannot be negative"})
+		}
+		if length.Min != nil && length.Max != nil && *length.Min > *length.Max {
+			issues = append(issues, LintIssue{Level: "error", Field: field + ".length." + key, Message: "min cannot exceed max"})
+		}
+	}
+
+	if match.Not != nil {
+		if match.Not.IsZero() {
+			issues = append(issues, LintIssue{Level: "warn", Field: field + ".not", Message: "empty not never matches"})
+		}
+		issues = append(issues, lintArgsMatch(field+".not", match.Not)...)
+	}
+	for i := range match.AnyOf {
+		issues = append(issues, lintArgsMatch(fmt.Sprintf("%s.any_of[%d]", field, i), &match.AnyOf[i])...)
+	}
+	for i := range match.AllOf {
+		issues = append(issues, lintArgsMatch(fmt.Sprintf("%s.all_of[%d]", field, i), &match.AllOf[i])...)
+	}
+	return issues
+}
+
+func mapKeys[V any](m map[string]V) map[string]struct{} {
+	keys := make(map[string]struct{}, len(m))
+	for key := range m {
+		keys[key] = struct{}{}
+	}
+	return keys
+}
+
+func sortedSet(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // DiffChange describes a policy change.
 type DiffChange struct {
 	Kind     string `json:"kind"`
@@ -0,0 +1,446 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+// LayerSetSpec is a policy file that stacks bundles, lowest precedence
+// first (for example global, team, repo, kill-switch).
+type LayerSetSpec struct {
+	PolicyID string      `json:"policy_id"`
+	Version  string      `json:"version,omitempty"`
+	Layers   []LayerSpec `json:"layers"`
+}
+
+// LayerSpec is one layer: a bundle file, relative to the layer set file,
+// or an inline bundle. The bundle's own selectors decide where it applies.
+type LayerSpec struct {
+	Name   string      `json:"name"`
+	File   string      `json:"file,omitempty"`
+	Bundle *BundleSpec `json:"bundle,omitempty"`
+}
+
+// Layer statuses in LayerResult.
+const (
+	LayerSelected      = "selected"       // Produced the decision
+	LayerOverridden    = "overridden"     // Decided, but a stricter or higher layer won
+	LayerNotApplicable = "not_applicable" // Selectors did not match
+	LayerObserveOnly   = "observe_only"   // Observe-mode layer in an enforcing set
+)
+
+// LayerResult is how one layer of a layer set decided a call.
+type LayerResult struct {
+	Layer    event.LayerInfo
+	Mode     event.RunMode
+	Status   string
+	Decision Decision
+}
+
+type layer struct {
+	name   string
+	bundle *Bundle
+}
+
+func (l layer) info() event.LayerInfo {
+	return event.LayerInfo{Name: l.name, PolicyInfo: l.bundle.Info}
+}
+
+// CompileLayerSet compiles every layer of set into one bundle. Layer files
+// are resolved against baseDir.
+func CompileLayerSet(set LayerSetSpec, baseDir string) (*Bundle, error) {
+	return compileLayerSet(set, baseDir, os.ReadFile)
+}
+
+func compileLayerSet(set LayerSetSpec, baseDir string, read func(string) ([]byte, error)) (*Bundle, error) {
+	if len(set.Layers) == 0 {
+		return nil, fmt.Errorf("layer set has no layers")
+	}
+
+	mode := event.RunModeObserve
+	layers := make([]layer, 0, len(set.Layers))
+	hashes := make([]layerHash, 0, len(set.Layers))
+	seen := map[string]struct{}{}
+	for i, spec := range set.Layers {
+		name := strings.TrimSpace(spec.Name)
+		if name == "" {
+			return nil, fmt.Errorf("layers[%d]: name is required", i)
+		}
+		if _, dup := seen[name]; dup {
+			return nil, fmt.Errorf("layers[%d]: duplicate layer %q", i, name)
+		}
+		seen[name] = struct{}{}
+
+		bundleSpec, err := layerBundleSpec(spec, baseDir, read)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %w", name, err)
+		}
+		compiled, err := CompileBundle(bundleSpec)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %w", name, err)
+		}
+
+		layers = append(layers, layer{name: name, bundle: compiled.Bundle})
+		hashes = append(hashes, layerHash{Name: name, PolicyHash: compiled.Hash})
+		if modeRank(compiled.Bundle.Mode) > modeRank(mode) {
+			mode = compiled.Bundle.Mode
+		}
+	}
+
+	policyID := defaultString(set.PolicyID, "layered")
+	version := defaultString(set.Version, "0.1.0")
+	hash, _, err := hashSnapshot(layerSetSnapshot{PolicyID: policyID, PolicyVersion: version, Layers: hashes})
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &Bundle{
+		Mode: mode,
+		Info: event.PolicyInfo{
+			PolicyID:      policyID,
+			PolicyVersion: version,
+			PolicyHash:    hash,
+		},
+		layers: layers,
+	}
+	bundle.ensureState()
+	return bundle, nil
+}
+
+// layerSetSnapshot is what a layer set's policy_hash covers: its identity
+// and the name and policy_hash of every layer, in order.
+type layerSetSnapshot struct {
+	PolicyID      string      `json:"policy_id"`
+	PolicyVersion string      `json:"policy_version"`
+	Layers        []layerHash `json:"layers"`
+}
+
+type layerHash struct {
+	Name       string `json:"name"`
+	PolicyHash string `json:"policy_hash"`
+}
+
+func layerBundleSpec(spec LayerSpec, baseDir string, read func(string) ([]byte, error)) (BundleSpec, error) {
+	switch {
+	case spec.Bundle != nil && spec.File != "":
+		return BundleSpec{}, fmt.Errorf("set file or bundle, not both")
+	case spec.Bundle != nil:
+		return *spec.Bundle, nil
+	case spec.File == "":
+		return BundleSpec{}, fmt.Errorf("file or bundle is required")
+	}
+	data, err := read(layerPath(baseDir, spec.File))
+	if err != nil {
+		return BundleSpec{}, err
+	}
+	return ParseBundle(data)
+}
+
+// layerPath resolves a layer file against the layer set's directory.
+func layerPath(baseDir, file string) string {
+	if filepath.IsAbs(file) || baseDir == "" {
+		return file
+	}
+	return filepath.Join(baseDir, file)
+}
+
+// isLayerSet reports whether a parsed policy file is a layer set.
+func isLayerSet(raw any) bool {
+	object, ok := raw.(map[string]any)
+	if !ok {
+		return false
+	}
+	_, ok = object["layers"]
+	return ok
+}
+
+func decodeLayerSet(raw any) (LayerSetSpec, error) {
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return LayerSetSpec{}, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	dec.UseNumber()
+	var set LayerSetSpec
+	if err := dec.Decode(&set); err != nil {
+		return LayerSetSpec{}, err
+	}
+	return set, nil
+}
+
+// loadPolicy loads the bundle or layer set at path, reading every file
+// through read.
+func loadPolicy(path string, read func(string) ([]byte, error)) (*Bundle, error) {
+	data, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := parsePolicyData(data)
+	if err != nil {
+		return nil, err
+	}
+	if isLayerSet(raw) {
+		set, err := decodeLayerSet(raw)
+		if err != nil {
+			return nil, err
+		}
+		return compileLayerSet(set, filepath.Dir(path), read)
+	}
+	spec, err := decodeBundle(raw)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := CompileBundle(spec)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.Bundle, nil
+}
+
+// readPolicyFiles reads path and, for a layer set, every layer file it
+// names, each with its detached signature if present. A missing layer file
+// maps to nil so the load reports it.
+func readPolicyFiles(path string) (map[string][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{path}
+	files := map[string][]byte{path: data}
+
+	if raw, err := parsePolicyData(data); err == nil && isLayerSet(raw) {
+		if set, err := decodeLayerSet(raw); err == nil {
+			for _, spec := range set.Layers {
+				if spec.File == "" {
+					continue
+				}
+				name := layerPath(filepath.Dir(path), spec.File)
+				layerData, err := os.ReadFile(name)
+				if err != nil {
+					debugLog("readPolicyFiles: read %s: %v", name, err)
+					layerData = nil
+				}
+				names = append(names, name)
+				files[name] = layerData
+			}
+		}
+	}
+
+	for _, name := range names {
+		if sig, err := os.ReadFile(SignaturePath(name)); err == nil {
+			files[SignaturePath(name)] = sig
+		}
+	}
+	return files, nil
+}
+
+// Layered evaluation
+
+// decideLayers decides ctx in every layer and combines the results. The
+// most restrictive action of any layer wins, so any layer can deny; among
+// equal actions the higher layer wins, and a rule's ALLOW beats a default
+// one. Budgets of every layer are counted and reported. Observe-mode layers
+// only take part when the whole set observes.
+func (b *Bundle) decideLayers(ctx DecisionContext) Decision {
+	results := make([]LayerResult, len(b.layers))
+	winner := -1
+	var budgets []event.BudgetUsage
+	timeoutMS := 0
+
+	for i, l := range b.layers {
+		result := LayerResult{Layer: l.info(), Mode: l.bundle.Mode, Status: LayerOverridden}
+		if !selectorsMatch(l.bundle.Selectors, ctx.Target) {
+			result.Status = LayerNotApplicable
+			result.Decision = notApplicableDecision()
+			results[i] = result
+			continue
+		}
+
+		result.Decision = l.bundle.DecideWithContext(ctx)
+		results[i] = result
+		if l.bundle.Mode == event.RunModeObserve && b.Mode != event.RunModeObserve {
+			results[i].Status = LayerObserveOnly
+			continue
+		}
+
+		for _, usage := range result.Decision.Budgets {
+			usage.Layer = l.name
+			budgets = append(budgets, usage)
+		}
+		if ms := result.Decision.TimeoutMS; ms > 0 && (timeoutMS == 0 || ms < timeoutMS) {
+			timeoutMS = ms
+		}
+		if winner < 0 || outranks(result.Decision, results[winner].Decision) {
+			winner = i
+		}
+	}
+
+	if winner < 0 {
+		decision := notApplicableDecision()
+		decision.Summary = "No enforcing policy layer applies"
+		decision.Layers = results
+		return decision
+	}
+
+	results[winner].Status = LayerSelected
+	decision := results[winner].Decision
+	info := results[winner].Layer
+	decision.Layer = &info
+	decision.Budgets = budgets
+	decision.TimeoutMS = timeoutMS
+	decision.Layers = results
+	return decision
+}
+
+// outranks reports whether d, from a higher layer, replaces current.
+func outranks(d, current Decision) bool {
+	if rank, currentRank := actionRank(d.Action), actionRank(current.Action); rank != currentRank {
+		return rank > currentRank
+	}
+	return d.RuleID != nil || current.RuleID == nil
+}
+
+func actionRank(action event.DecisionAction) int {
+	switch action {
+	case event.DecisionTerminateRun:
+		return 4
+	case event.DecisionBlock:
+		return 3
+	case event.DecisionRejectWithHint:
+		return 2
+	case event.DecisionThrottle:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func modeRank(mode event.RunMode) int {
+	switch mode {
+	case event.RunModeControl:
+		return 2
+	case event.RunModeGuardrails:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// layerRestriction returns the restriction of the highest layer that
+// denies the tool outright.
+func (b *Bundle) layerRestriction(serverName, toolName string, target SelectorTarget) *Restriction {
+	if b.Mode == event.RunModeObserve {
+		return nil
+	}
+	for i := len(b.layers) - 1; i >= 0; i-- {
+		if restriction := b.layers[i].bundle.ToolRestriction(serverName, toolName, target); restriction != nil {
+			return restriction
+		}
+	}
+	return nil
+}
+
+// inheritLayers carries state between layers of the same name. Returns the
+// carried rule_ids as layer/rule_id.
+func (b *Bundle) inheritLayers(prev *Bundle) []string {
+	prevLayers := map[string]*Bundle{}
+	for _, l := range prev.layers {
+		prevLayers[l.name] = l.bundle
+	}
+	var carried []string
+	for _, l := range b.layers {
+		old, ok := prevLayers[l.name]
+		if !ok {
+			continue
+		}
+		for _, id := range l.bundle.InheritState(old) {
+			carried = append(carried, l.name+"/"+id)
+		}
+	}
+	return carried
+}
+
+// layerStateStore scopes a layer's state to keys prefixed with its name in
+// the run's snapshot, so rule_ids may repeat across layers. Promotions are
+// shared by every layer.
+type layerStateStore struct {
+	store  StateStore
+	prefix string
+}
+
+func newLayerStateStore(store StateStore, name string) StateStore {
+	if store == nil {
+		return nil
+	}
+	return layerStateStore{store: store, prefix: "@" + name + "/"}
+}
+
+// Update implements StateStore.
+func (s layerStateStore) Update(fn func(state *StateSnapshot) error) error {
+	return s.store.Update(func(state *StateSnapshot) error {
+		scoped := StateSnapshot{
+			Budgets:    takeScope(state.Budgets, s.prefix),
+			RateLimits: takeScope(state.RateLimits, s.prefix),
+			Breakers:   takeScope(state.Breakers, s.prefix),
+			Dedupe:     takeScope(state.Dedupe, s.prefix),
+			Circuits:   takeScope(state.Circuits, s.prefix),
+			Promotions: state.Promotions,
+		}
+		if err := fn(&scoped); err != nil {
+			return err
+		}
+		state.Budgets = putScope(state.Budgets, s.prefix, scoped.Budgets)
+		state.RateLimits = putScope(state.RateLimits, s.prefix, scoped.RateLimits)
+		state.Breakers = putScope(state.Breakers, s.prefix, scoped.Breakers)
+		state.Dedupe = putScope(state.Dedupe, s.prefix, scoped.Dedupe)
+		state.Circuits = putScope(state.Circuits, s.prefix, scoped.Circuits)
+		state.Promotions = scoped.Promotions
+		return nil
+	})
+}
+
+// takeScope returns the entries of m under prefix, with the prefix removed.
+func takeScope[V any](m map[string]V, prefix string) map[string]V {
+	scoped := map[string]V{}
+	for key, value := range m {
+		if strings.HasPrefix(key, prefix) {
+			scoped[strings.TrimPrefix(key, prefix)] = value
+		}
+	}
+	return scoped
+}
+
+// putScope replaces the entries of m under prefix with scoped.
+func putScope[V any](m map[string]V, prefix string, scoped map[string]V) map[string]V {
+	for key := range m {
+		if strings.HasPrefix(key, prefix) {
+			delete(m, key)
+		}
+	}
+	if len(scoped) == 0 {
+		return m
+	}
+	if m == nil {
+		m = make(map[string]V, len(scoped))
+	}
+	for key, value := range scoped {
+		m[prefix+key] = value
+	}
+	return m
+}
+
+// loadLayerSetJSON compiles a layer set from SUB_POLICY_JSON; layer files
+// resolve against the working directory.
+func loadLayerSetJSON(raw any) (*Bundle, error) {
+	set, err := decodeLayerSet(raw)
+	if err != nil {
+		return nil, err
+	}
+	return CompileLayerSet(set, "")
+}
@@ -0,0 +1,264 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+func budgetRule(id string, limit int) Rule {
+	return Rule{
+		RuleID: id,
+		Kind:   "budget",
+		Match:  Match{ToolName: &NameMatch{Glob: []string{"*"}}},
+		Effect: Effect{Budget: &BudgetEffect{Scope: "run", LimitCalls: &limit, OnExceed: "BLOCK"}},
+	}
+}
+
+func testLayerSet(t *testing.T) *Bundle {
+	t.Helper()
+	set := LayerSetSpec{
+		PolicyID: "acme",
+		Layers: []LayerSpec{
+			{Name: "global", Bundle: &BundleSpec{
+				PolicyID: "global",
+				Mode:     "control",
+				Rules: []Rule{
+					{RuleID: "allow-push", Kind: "allow", Match: Match{ToolName: &NameMatch{Glob: []string{"push"}}}},
+					budgetRule("calls", 3),
+				},
+			}},
+			{Name: "repo", Bundle: &BundleSpec{
+				PolicyID: "repo",
+				Mode:     "control",
+				Rules: []Rule{
+					{RuleID: "no-push", Kind: "deny", Match: Match{ToolName: &NameMatch{Glob: []string{"push"}}}},
+					{RuleID: "allow-read", Kind: "allow", Match: Match{ToolName: &NameMatch{Glob: []string{"read"}}}},
+					budgetRule("calls", 10),
+				},
+			}},
+			{Name: "kill-switch", Bundle: &BundleSpec{
+				PolicyID:  "kill",
+				Mode:      "control",
+				Selectors: PolicySelectors{Env: []string{"prod"}},
+				Rules: []Rule{
+					{RuleID: "stop", Kind: "deny", Match: Match{ToolName: &NameMatch{Glob: []string{"*"}}}},
+				},
+			}},
+		},
+	}
+	bundle, err := CompileLayerSet(set, "")
+	if err != nil {
+		t.Fatalf("CompileLayerSet: %v", err)
+	}
+	return bundle
+}
+
+func TestLayerSet_AnyLayerDeniesAndHigherAllowWins(t *testing.T) {
+	bundle := testLayerSet(t)
+	if bundle.Mode != event.RunModeControl || bundle.Info.PolicyID != "acme" || bundle.Info.PolicyHash == "" {
+		t.Fatalf("unexpected layer set info: mode=%s %+v", bundle.Mode, bundle.Info)
+	}
+
+	// global allows push, repo denies it: the deny wins.
+	d := bundle.DecideWithContext(DecisionContext{ServerName: "git", ToolName: "push"})
+	if d.Action != event.DecisionRejectWithHint || d.Layer == nil || d.Layer.Name != "repo" || *d.RuleID != "no-push" {
+		t.Fatalf("expected repo's no-push, got %s from %+v", d.Action, d.Layer)
+	}
+	if d.Layer.PolicyID != "repo" || d.Layer.PolicyHash == "" || d.Layer.PolicyHash == bundle.Info.PolicyHash {
+		t.Fatalf("expected the repo layer's own policy info, got %+v", d.Layer)
+	}
+	statuses := map[string]string{}
+	for _, result := range d.Layers {
+		statuses[result.Layer.Name] = result.Status
+	}
+	if statuses["global"] != LayerOverridden || statuses["repo"] != LayerSelected || statuses["kill-switch"] != LayerNotApplicable {
+		t.Fatalf("unexpected layer statuses: %v", statuses)
+	}
+
+	// A rule's ALLOW in a higher layer is reported over a default ALLOW.
+	d = bundle.DecideWithContext(DecisionContext{ServerName: "fs", ToolName: "read"})
+	if d.Action != event.DecisionAllow || d.RuleID == nil || *d.RuleID != "allow-read" {
+		t.Fatalf("expected repo's allow-read, got %+v", d)
+	}
+
+	// Budgets of every layer are counted; the tighter one trips first.
+	if len(d.Budgets) != 2 || d.Budgets[0].Layer != "global" || d.Budgets[1].Layer != "repo" {
+		t.Fatalf("expected a budget per layer, got %+v", d.Budgets)
+	}
+	bundle.DecideWithContext(DecisionContext{ServerName: "fs", ToolName: "read"})
+	d = bundle.DecideWithContext(DecisionContext{ServerName: "fs", ToolName: "read"})
+	if d.Action == event.DecisionAllow || d.Layer.Name != "global" || d.ReasonCode != "BUDGET_EXCEEDED" {
+		t.Fatalf("expected global's budget to deny the 4th call, got %s %s from %+v", d.Action, d.ReasonCode, d.Layer)
+	}
+
+	// The kill switch applies to prod only.
+	d = bundle.DecideWithContext(DecisionContext{ServerName: "fs", ToolName: "list", Target: SelectorTarget{Env: "prod"}})
+	if d.Action == event.DecisionAllow || d.Layer.Name != "kill-switch" {
+		t.Fatalf("expected the kill switch to block in prod, got %s from %+v", d.Action, d.Layer)
+	}
+	if r := bundle.ToolRestriction("fs", "list", SelectorTarget{Env: "prod"}); r == nil || *r.RuleID != "stop" {
+		t.Fatalf("expected the kill switch to restrict tools in prod, got %+v", r)
+	}
+}
+
+func TestLayerSet_ObserveLayerDoesNotEnforce(t *testing.T) {
+	bundle, err := CompileLayerSet(LayerSetSpec{Layers: []LayerSpec{
+		{Name: "trial", Bundle: &BundleSpec{
+			Mode:  "observe",
+			Rules: []Rule{{RuleID: "no-write", Kind: "deny", Match: Match{ToolName: &NameMatch{Glob: []string{"write"}}}}},
+		}},
+		{Name: "repo", Bundle: &BundleSpec{Mode: "guardrails"}},
+	}}, "")
+	if err != nil {
+		t.Fatalf("CompileLayerSet: %v", err)
+	}
+
+	d := bundle.DecideWithContext(DecisionContext{ServerName: "fs", ToolName: "write"})
+	if d.Action != event.DecisionAllow || d.Layer.Name != "repo" || d.Layers[0].Status != LayerObserveOnly {
+		t.Fatalf("expected the observe layer not to enforce, got %s from %+v (%+v)", d.Action, d.Layer, d.Layers)
+	}
+}
+
+func TestLayerSet_DurableStatePerLayer(t *testing.T) {
+	store, err := NewFileStateStore(t.TempDir(), "run-1")
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	bundle := testLayerSet(t)
+	bundle.SetStateStore(store)
+	for i := 0; i < 3; i++ {
+		bundle.DecideWithContext(DecisionContext{ServerName: "fs", ToolName: "read"})
+	}
+
+	// Both layers use rule_id "calls"; each counts under its own name.
+	var state StateSnapshot
+	store.Update(func(s *StateSnapshot) error {
+		state = *s
+		return nil
+	})
+	if state.Budgets["@global/calls|run"] != 3 || state.Budgets["@repo/calls|run"] != 3 {
+		t.Fatalf("expected per-layer budget keys, got %v", state.Budgets)
+	}
+
+	// A restarted shim resumes every layer's count.
+	restarted := testLayerSet(t)
+	restarted.SetStateStore(store)
+	if d := restarted.DecideWithContext(DecisionContext{ServerName: "fs", ToolName: "read"}); d.ReasonCode != "BUDGET_EXCEEDED" {
+		t.Fatalf("expected the restored global budget to deny, got %s %s", d.Action, d.ReasonCode)
+	}
+
+	// A promotion unblocks the call in every layer.
+	rule := PromoteRule(PromotedRuleID("call-1"), "git", "push", nil)
+	if err := AddPromotion(store, Promotion{CallID: "call-1", Rule: rule}); err != nil {
+		t.Fatalf("AddPromotion: %v", err)
+	}
+	other := testLayerSet(t)
+	other.SetStateStore(store)
+	if d := other.DecideWithContext(DecisionContext{ServerName: "git", ToolName: "push"}); d.ReasonCode != "PROMOTED_ALLOW" {
+		t.Fatalf("expected the promotion to override repo's deny, got %s %s", d.Action, d.ReasonCode)
+	}
+}
+
+func TestLayerSet_InheritStateByLayerName(t *testing.T) {
+	prev := testLayerSet(t)
+	for i := 0; i < 3; i++ {
+		prev.DecideWithContext(DecisionContext{ServerName: "fs", ToolName: "read"})
+	}
+	next := testLayerSet(t)
+	carried := map[string]bool{}
+	for _, id := range next.InheritState(prev) {
+		carried[id] = true
+	}
+	if !carried["global/calls"] || !carried["repo/calls"] {
+		t.Fatalf("expected both budgets carried by layer, got %v", carried)
+	}
+	if d := next.DecideWithContext(DecisionContext{ServerName: "fs", ToolName: "read"}); d.ReasonCode != "BUDGET_EXCEEDED" {
+		t.Fatalf("expected the carried budget to deny, got %s %s", d.Action, d.ReasonCode)
+	}
+}
+
+func TestLoadFile_LayerSetFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	write("global.yaml", "policy_id: global\nmode: control\nrules: []\n")
+	write("repo.yaml", `policy_id: repo
+mode: control
+rules:
+  - rule_id: no-drop
+    kind: deny
+    match:
+      tool_name:
+        glob: ["drop"]
+`)
+	setPath := write("layers.yaml", `policy_id: acme
+version: "2"
+layers:
+  - name: global
+    file: global.yaml
+  - name: repo
+    file: repo.yaml
+`)
+
+	bundle, err := LoadFile(setPath)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if d := bundle.DecideWithContext(DecisionContext{ServerName: "db", ToolName: "drop"}); d.Layer == nil || d.Layer.Name != "repo" {
+		t.Fatalf("expected repo's deny, got %+v", d)
+	}
+
+	if _, err := LoadBundleFile(setPath); err == nil {
+		t.Fatal("expected LoadBundleFile to reject a layer set")
+	}
+
+	// Editing a layer file changes what the watcher sees and the set's hash.
+	files, err := readPolicyFiles(setPath)
+	if err != nil {
+		t.Fatalf("readPolicyFiles: %v", err)
+	}
+	before := policyFilesSum(files)
+	write("repo.yaml", "policy_id: repo\nmode: control\nrules: []\n")
+	files, err = readPolicyFiles(setPath)
+	if err != nil {
+		t.Fatalf("readPolicyFiles: %v", err)
+	}
+	if string(policyFilesSum(files)) == string(before) {
+		t.Fatal("expected a layer edit to change the watched sum")
+	}
+	reloaded, err := LoadFile(setPath)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if reloaded.Info.PolicyHash == bundle.Info.PolicyHash {
+		t.Fatal("expected a layer edit to change the layer set's policy_hash")
+	}
+
+	os.Remove(filepath.Join(dir, "repo.yaml"))
+	if _, err := LoadFile(setPath); err == nil {
+		t.Fatal("expected an error for a missing layer file")
+	}
+}
+
+func TestCompileLayerSet_Validation(t *testing.T) {
+	for name, set := range map[string]LayerSetSpec{
+		"no layers": {},
+		"no name":   {Layers: []LayerSpec{{Bundle: &BundleSpec{}}}},
+		"duplicate": {Layers: []LayerSpec{{Name: "a", Bundle: &BundleSpec{}}, {Name: "a", Bundle: &BundleSpec{}}}},
+		"no source": {Layers: []LayerSpec{{Name: "a"}}},
+		"both":      {Layers: []LayerSpec{{Name: "a", File: "a.yaml", Bundle: &BundleSpec{}}}},
+	} {
+		if _, err := CompileLayerSet(set, ""); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -25,26 +25,28 @@ func LoadBundleFile(path string) (BundleSpec, error) {
 
 // ParseBundle parses a JSON or YAML policy bundle payload.
 func ParseBundle(data []byte) (BundleSpec, error) {
-	trimmed := bytes.TrimSpace(data)
-	if len(trimmed) == 0 {
-		return BundleSpec{}, fmt.Errorf("empty policy bundle")
-	}
-
-	var raw any
-	var err error
-	switch trimmed[0] {
-	case '{':
-		raw, err = parseJSONBundle(trimmed)
-	default:
-		raw, err = parseYAMLBundle(string(data))
-	}
+	raw, err := parsePolicyData(data)
 	if err != nil {
 		return BundleSpec{}, err
 	}
-
+	if isLayerSet(raw) {
+		return BundleSpec{}, fmt.Errorf("policy file is a layer set; pass one of its layer bundles")
+	}
 	return decodeBundle(raw)
 }
 
+// parsePolicyData parses a JSON or YAML policy payload into generic values.
+func parsePolicyData(data []byte) (any, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("empty policy bundle")
+	}
+	if trimmed[0] == '{' {
+		return parseJSONBundle(trimmed)
+	}
+	return parseYAMLBundle(string(data))
+}
+
 func parseJSONBundle(data []byte) (any, error) {
 	dec := json.NewDecoder(bytes.NewReader(data))
 	dec.UseNumber()
@@ -96,7 +98,7 @@ func CompileBundle(spec BundleSpec) (CompiledBundle, error) {
 		return CompiledBundle{}, err
 	}
 
-	bundle := Bundle{
+	bundle := &Bundle{
 		Mode: parseMode(mode),
 		Info: event.PolicyInfo{
 			PolicyID:      policyID,
@@ -108,6 +110,12 @@ func CompileBundle(spec BundleSpec) (CompiledBundle, error) {
 		Rules:     spec.Rules,
 	}
 	bundle.ensureState()
+	if err := bundle.compileWhen(); err != nil {
+		return CompiledBundle{}, err
+	}
+	if err := bundle.compilePatterns(); err != nil {
+		return CompiledBundle{}, err
+	}
 
 	return CompiledBundle{
 		Bundle:   bundle,
@@ -116,6 +124,74 @@ func CompileBundle(spec BundleSpec) (CompiledBundle, error) {
 	}, nil
 }
 
+// ExpandDefaults returns spec with every default the decision engine would
+// apply written out: policy_id, version and mode, enabled and severity on
+// each rule, the action of allow/deny rules, and the scopes and actions of
+// budget, rate-limit, dedupe and breaker effects. The expanded bundle
+// decides exactly like spec, and expanding it again changes nothing.
+func ExpandDefaults(spec BundleSpec) BundleSpec {
+	spec.PolicyID = defaultString(spec.PolicyID, "default")
+	spec.PolicyVersion = defaultString(spec.EffectiveVersion(), "0.1.0")
+	spec.Version = ""
+	spec.Mode = normalizeModeString(spec.Mode)
+
+	rules := make([]Rule, len(spec.Rules))
+	for i, rule := range spec.Rules {
+		enabled := ruleEnabled(rule.Enabled)
+		rule.Enabled = &enabled
+		rule.Severity = normalizeSeverity(rule.Severity)
+		rule.Effect = expandEffect(rule, rule.Effect)
+		rules[i] = rule
+	}
+	spec.Rules = rules
+	return spec
+}
+
+// expandEffect mirrors the defaults applied in DecideWithContext and its
+// helpers. Effects are copied, never modified in place.
+func expandEffect(rule Rule, effect Effect) Effect {
+	if budget := effect.Budget; budget != nil {
+		expanded := *budget
+		expanded.Scope = defaultString(expanded.Scope, "run")
+		if expanded.OnExceed == "" {
+			expanded.OnExceed = event.DecisionBlock
+		}
+		effect.Budget = &expanded
+	}
+	if limit := effect.RateLimit; limit != nil {
+		expanded := *limit
+		config := normalizeRateLimit(limit)
+		expanded.Scope = config.Scope
+		expanded.CostTokensPerCall = config.CostTokensPerCall
+		expanded.OnLimit = config.OnLimit
+		expanded.BackoffMS = config.BackoffMS
+		effect.RateLimit = &expanded
+	}
+	if dedupe := effect.Dedupe; dedupe != nil {
+		expanded := *dedupe
+		expanded.Scope = defaultString(expanded.Scope, "tool")
+		expanded.OnDuplicate = normalizeOnDuplicateAction(expanded.OnDuplicate)
+		if expanded.OnDuplicate == "" {
+			expanded.OnDuplicate = event.DecisionBlock
+		}
+		effect.Dedupe = &expanded
+	}
+	if breaker := effect.Breaker; breaker != nil {
+		expanded := *breaker
+		expanded.Scope = defaultString(expanded.Scope, "server_tool")
+		expanded.OnTrip = string(breakerAction(expanded.OnTrip))
+		if expanded.CooldownMS <= 0 && expanded.WindowMS > 0 {
+			expanded.CooldownMS = expanded.WindowMS
+		}
+		effect.Breaker = &expanded
+	}
+	if effect.Action == "" && effect.Budget == nil && effect.RateLimit == nil &&
+		effect.Dedupe == nil && effect.Breaker == nil && effect.Tag == nil {
+		effect.Action = actionFromKind(strings.TrimSpace(rule.Kind))
+	}
+	return effect
+}
+
 func buildSnapshot(policyID, version, mode string, defaults PolicyDefaults, selectors PolicySelectors, rules []Rule) policySnapshot {
 	return policySnapshot{
 		PolicyID:      policyID,
@@ -138,7 +214,7 @@ func normalizeModeString(mode string) string {
 	}
 }
 
-func hashSnapshot(snapshot policySnapshot) (string, []byte, error) {
+func hashSnapshot(snapshot any) (string, []byte, error) {
 	encoded, err := json.Marshal(snapshot)
 	if err != nil {
 		return "", nil, err
@@ -0,0 +1,63 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+func TestExpandDefaults_DecidesLikeSource(t *testing.T) {
+	limit := 2
+	spec := BundleSpec{
+		PolicyID: "expand",
+		Version:  "3",
+		Mode:     "Guardrails",
+		Rules: []Rule{
+			{RuleID: "no-drop", Kind: "deny", Match: Match{ToolName: &NameMatch{Glob: []string{"drop"}}}},
+			{RuleID: "calls", Kind: "budget", Match: Match{ToolName: &NameMatch{Glob: []string{"query"}}},
+				Effect: Effect{Budget: &BudgetEffect{LimitCalls: &limit}}},
+			{RuleID: "burst", Kind: "rate_limit", Match: Match{ToolName: &NameMatch{Glob: []string{"list"}}},
+				Effect: Effect{RateLimit: &RateLimitEffect{Capacity: 1, RefillTokens: 1, RefillPeriodMS: 60000}}},
+			{RuleID: "once", Kind: "dedupe", Match: Match{ToolName: &NameMatch{Glob: []string{"write"}}},
+				Effect: Effect{Dedupe: &DedupeEffect{WindowMS: 60000, Key: "args_hash"}}},
+		},
+	}
+
+	expanded := ExpandDefaults(spec)
+	if expanded.PolicyVersion != "3" || expanded.Mode != "guardrails" {
+		t.Fatalf("expected version and mode expanded, got %q %q", expanded.PolicyVersion, expanded.Mode)
+	}
+	if r := expanded.Rules[0]; r.Enabled == nil || !*r.Enabled || r.Severity != event.SeverityInfo || r.Effect.Action != event.DecisionBlock {
+		t.Fatalf("expected the deny rule's defaults written out, got %+v", r)
+	}
+	if b := expanded.Rules[1].Effect.Budget; b.Scope != "run" || b.OnExceed != event.DecisionBlock {
+		t.Fatalf("expected budget defaults, got %+v", b)
+	}
+	if rl := expanded.Rules[2].Effect.RateLimit; rl.Scope != "run" || rl.OnLimit != event.DecisionThrottle || rl.BackoffMS != 1000 || rl.CostTokensPerCall != 1 {
+		t.Fatalf("expected rate-limit defaults, got %+v", rl)
+	}
+	if spec.Rules[1].Effect.Budget.OnExceed != "" || spec.Rules[0].Enabled != nil {
+		t.Fatal("expected the source spec to be left as is")
+	}
+	if again := ExpandDefaults(expanded); !reflect.DeepEqual(again, expanded) {
+		t.Fatalf("expected expansion to be idempotent:\n%+v\n%+v", again, expanded)
+	}
+
+	source, err := CompileBundle(spec)
+	if err != nil {
+		t.Fatalf("CompileBundle: %v", err)
+	}
+	compiled, err := CompileBundle(expanded)
+	if err != nil {
+		t.Fatalf("CompileBundle: %v", err)
+	}
+	for i, tool := range []string{"drop", "query", "query", "query", "list", "list", "write", "write", "read"} {
+		ctx := DecisionContext{ServerName: "db", ToolName: tool, ArgsHash: "h"}
+		want := source.Bundle.DecideWithContext(ctx)
+		got := compiled.Bundle.DecideWithContext(ctx)
+		if got.Action != want.Action || got.ReasonCode != want.ReasonCode || got.BackoffMS != want.BackoffMS {
+			t.Fatalf("call %d (%s): expanded decided %s %s, source %s %s", i+1, tool, got.Action, got.ReasonCode, want.Action, want.ReasonCode)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+// Outcome is how an allowed call ended upstream.
+type Outcome struct {
+	Status  event.CallStatus
+	Latency time.Duration
+}
+
+// circuitState is an open outcome breaker. A set probeAt means a half-open
+// probe call was admitted and its outcome decides whether the circuit closes.
+type circuitState struct {
+	openedAt time.Time
+	probeAt  time.Time
+}
+
+// RecordOutcome feeds a finished call back into the breaker rules matching
+// ctx. Errors and calls slower than latency_threshold_ms are counted within
+// window_ms; reaching error_threshold or slow_call_threshold opens the
+// circuit. After cooldown_ms one probe is admitted: success closes the
+// circuit, failure re-opens it.
+func (b *Bundle) RecordOutcome(ctx DecisionContext, outcome Outcome) {
+	if len(b.layers) > 0 {
+		for _, l := range b.layers {
+			l.bundle.RecordOutcome(ctx, outcome)
+		}
+		return
+	}
+	if b.stateStore != nil && b.hasStatefulRules() {
+		applied := false
+		err := b.withDurableState(func() {
+			b.recordOutcome(ctx, outcome, ctx.now())
+			applied = true
+		})
+		if err != nil {
+			debugLog("RecordOutcome: state store error: %v", err)
+			if !applied {
+				b.recordOutcome(ctx, outcome, ctx.now())
+			}
+		}
+		return
+	}
+	b.recordOutcome(ctx, outcome, ctx.now())
+}
+
+func (b *Bundle) recordOutcome(ctx DecisionContext, outcome Outcome, now time.Time) {
+	b.ensureState()
+	if !selectorsMatch(b.Selectors, ctx.Target) {
+		return
+	}
+
+	riskClasses := b.riskClasses(ctx)
+	for idx, rule := range b.Rules {
+		breaker := rule.Effect.Breaker
+		if !ruleEnabled(rule.Enabled) || breaker == nil || !outcomeBreaker(breaker) {
+			continue
+		}
+		if !strings.EqualFold(strings.TrimSpace(rule.Kind), "breaker") {
+			continue
+		}
+		if !b.matchName(rule.Match.ServerName, ctx.ServerName) ||
+			!b.matchName(rule.Match.ToolName, ctx.ToolName) ||
+			!matchRiskClass(rule.Match.RiskClass, riskClasses) ||
+			!b.matchArgs(rule.Match.Args, ctx.Args) ||
+			!b.matchWhen(idx, rule, ctx) {
+			continue
+		}
+
+		failed := outcome.Status != event.CallStatusOK
+		slow := breaker.LatencyThresholdMS > 0 && outcome.Latency > time.Duration(breaker.LatencyThresholdMS)*time.Millisecond
+		ruleKey := ruleStateKey(rule, idx)
+		key := circuitKey(ruleKey, breaker.Scope, ctx.ServerName, ctx.ToolName)
+		errorKey := outcomeWindowKey(ruleKey, "errors", breaker.Scope, ctx.ServerName, ctx.ToolName)
+		slowKey := outcomeWindowKey(ruleKey, "slow", breaker.Scope, ctx.ServerName, ctx.ToolName)
+
+		b.breakerMu.Lock()
+		circuit := b.circuits[key]
+		if circuit != nil {
+			// Outcomes of calls admitted before the trip are ignored; only
+			// the half-open probe decides.
+			if !circuit.probeAt.IsZero() {
+				if failed || slow {
+					debugLog("RecordOutcome: probe failed, re-opening %s", key)
+					circuit.openedAt = now
+					circuit.probeAt = time.Time{}
+				} else {
+					debugLog("RecordOutcome: probe succeeded, closing %s", key)
+					delete(b.circuits, key)
+					delete(b.breakerState, errorKey)
+					delete(b.breakerState, slowKey)
+				}
+			}
+			b.breakerMu.Unlock()
+			continue
+		}
+		b.breakerMu.Unlock()
+
+		window := time.Duration(breaker.WindowMS) * time.Millisecond
+		trip := false
+		if failed && breaker.ErrorThreshold > 0 {
+			count := b.recordRepeat(errorKey, now, window)
+			debugLog("RecordOutcome: key=%s, errors=%d, threshold=%d", errorKey, count, breaker.ErrorThreshold)
+			trip = trip || count >= breaker.ErrorThreshold
+		}
+		if slow && breaker.SlowCallThreshold > 0 {
+			count := b.recordRepeat(slowKey, now, window)
+			debugLog("RecordOutcome: key=%s, slow=%d, threshold=%d", slowKey, count, breaker.SlowCallThreshold)
+			trip = trip || count >= breaker.SlowCallThreshold
+		}
+		if !trip {
+			continue
+		}
+
+		debugLog("RecordOutcome: opening %s", key)
+		b.breakerMu.Lock()
+		b.circuits[key] = &circuitState{openedAt: now}
+		delete(b.breakerState, errorKey)
+		delete(b.breakerState, slowKey)
+		b.breakerMu.Unlock()
+	}
+}
+
+// circuitOpen reports whether the circuit at key rejects a call now, and
+// for how long. Past the cooldown it admits one probe at a time; a probe
+// whose outcome never arrives is replaced after another cooldown. probe
+// reports that an admitted call would be that probe; the caller reserves
+// it with reserveProbes once the call is allowed.
+func (b *Bundle) circuitOpen(key string, cooldown time.Duration, now time.Time) (retryAfter time.Duration, open, probe bool) {
+	b.breakerMu.Lock()
+	defer b.breakerMu.Unlock()
+
+	circuit := b.circuits[key]
+	if circuit == nil {
+		return 0, false, false
+	}
+	if elapsed := now.Sub(circuit.openedAt); elapsed < cooldown {
+		return cooldown - elapsed, true, false
+	}
+	if !circuit.probeAt.IsZero() {
+		if elapsed := now.Sub(circuit.probeAt); elapsed < cooldown {
+			return cooldown - elapsed, true, false
+		}
+	}
+	return 0, false, true
+}
+
+// reserveProbes marks the half-open circuits at keys as probing, so the
+// allowed call's outcome decides whether they close.
+func (b *Bundle) reserveProbes(keys []string, now time.Time) {
+	if len(keys) == 0 {
+		return
+	}
+	b.breakerMu.Lock()
+	defer b.breakerMu.Unlock()
+	for _, key := range keys {
+		if circuit := b.circuits[key]; circuit != nil {
+			debugLog("    Breaker probe admitted: key=%s", key)
+			circuit.probeAt = now
+		}
+	}
+}
+
+// outcomeBreaker reports whether a breaker is fed by call outcomes.
+func outcomeBreaker(breaker *BreakerEffect) bool {
+	if breaker.WindowMS <= 0 {
+		return false
+	}
+	return breaker.ErrorThreshold > 0 || (breaker.LatencyThresholdMS > 0 && breaker.SlowCallThreshold > 0)
+}
+
+func breakerCooldown(breaker *BreakerEffect) time.Duration {
+	if breaker.CooldownMS > 0 {
+		return time.Duration(breaker.CooldownMS) * time.Millisecond
+	}
+	return time.Duration(breaker.WindowMS) * time.Millisecond
+}
+
+// circuitKey scopes an outcome breaker. Unlike repeat breakers, args_hash
+// is not part of the key: failures of any call to the tool count.
+func circuitKey(ruleKey, scope, serverName, toolName string) string {
+	return outcomeWindowKey(ruleKey, "circuit", scope, serverName, toolName)
+}
+
+func outcomeWindowKey(ruleKey, kind, scope, serverName, toolName string) string {
+	switch strings.ToLower(strings.TrimSpace(scope)) {
+	case "run":
+		return strings.Join([]string{ruleKey, kind, "run"}, "|")
+	case "tool":
+		return strings.Join([]string{ruleKey, kind, "tool", toolName}, "|")
+	default:
+		return strings.Join([]string{ruleKey, kind, "server_tool", serverName, toolName}, "|")
+	}
+}
+
+// attachRetryAdvice tells a hinted agent when the breaker will admit a probe.
+func attachRetryAdvice(decision *Decision, retryAfter time.Duration) {
+	if decision == nil || decision.Hint == nil || retryAfter <= 0 {
+		return
+	}
+	advice := fmt.Sprintf("retry after %dms", retryAfter.Milliseconds())
+	decision.Hint.RetryAdvice = &advice
+}
+
+// riskClasses returns the risk classes the tag rules matching ctx add.
+func (b *Bundle) riskClasses(ctx DecisionContext) map[string]struct{} {
+	classes := make(map[string]struct{})
+	for idx, rule := range b.Rules {
+		if !ruleEnabled(rule.Enabled) || rule.Effect.Tag == nil {
+			continue
+		}
+		if !b.matchName(rule.Match.ServerName, ctx.ServerName) ||
+			!b.matchName(rule.Match.ToolName, ctx.ToolName) ||
+			!matchRiskClass(rule.Match.RiskClass, classes) ||
+			!b.matchArgs(rule.Match.Args, ctx.Args) ||
+			!b.matchWhen(idx, rule, ctx) {
+			continue
+		}
+		applyTag(rule.Effect.Tag, classes)
+	}
+	return classes
+}
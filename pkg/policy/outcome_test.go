@@ -0,0 +1,181 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+func outcomeBreakerBundle(breaker BreakerEffect) *Bundle {
+	return &Bundle{
+		Mode: event.RunModeGuardrails,
+		Rules: []Rule{
+			{
+				RuleID: "flaky-upstream",
+				Kind:   "breaker",
+				Match: Match{
+					ToolName: &NameMatch{Glob: []string{"flaky_*"}},
+				},
+				Effect: Effect{Breaker: &breaker},
+			},
+		},
+	}
+}
+
+func TestOutcomeBreaker_ErrorsOpenCircuit(t *testing.T) {
+	bundle := outcomeBreakerBundle(BreakerEffect{
+		Scope:          "tool",
+		ErrorThreshold: 2,
+		WindowMS:       60000,
+		OnTrip:         "BLOCK",
+	})
+	ctx := DecisionContext{ServerName: "s", ToolName: "flaky_fetch"}
+	now := time.Now()
+
+	bundle.recordOutcome(ctx, Outcome{Status: event.CallStatusOK}, now)
+	bundle.recordOutcome(ctx, Outcome{Status: event.CallStatusError}, now)
+	if d := bundle.DecideWithContext(ctx); d.Action != event.DecisionAllow {
+		t.Fatalf("one error should not open the circuit, got %s", d.Action)
+	}
+
+	bundle.recordOutcome(ctx, Outcome{Status: event.CallStatusTimeout}, now)
+	d := bundle.DecideWithContext(ctx)
+	if d.Action != event.DecisionBlock {
+		t.Fatalf("expected BLOCK once error_threshold is reached, got %s", d.Action)
+	}
+	if d.ReasonCode != "BREAKER_OPEN" {
+		t.Errorf("expected BREAKER_OPEN, got %q", d.ReasonCode)
+	}
+
+	other := DecisionContext{ServerName: "s", ToolName: "flaky_write"}
+	if d := bundle.DecideWithContext(other); d.Action != event.DecisionAllow {
+		t.Errorf("tool-scoped circuit should not block another tool, got %s", d.Action)
+	}
+}
+
+func TestOutcomeBreaker_SlowCallsOpenCircuit(t *testing.T) {
+	bundle := outcomeBreakerBundle(BreakerEffect{
+		Scope:              "run",
+		WindowMS:           60000,
+		LatencyThresholdMS: 500,
+		SlowCallThreshold:  2,
+		OnTrip:             "REJECT_WITH_HINT",
+	})
+	ctx := DecisionContext{ServerName: "s", ToolName: "flaky_fetch"}
+	now := time.Now()
+
+	bundle.recordOutcome(ctx, Outcome{Status: event.CallStatusOK, Latency: 200 * time.Millisecond}, now)
+	bundle.recordOutcome(ctx, Outcome{Status: event.CallStatusOK, Latency: 900 * time.Millisecond}, now)
+	if d := bundle.DecideWithContext(ctx); d.Action != event.DecisionAllow {
+		t.Fatalf("one slow call should not open the circuit, got %s", d.Action)
+	}
+	bundle.recordOutcome(ctx, Outcome{Status: event.CallStatusOK, Latency: 700 * time.Millisecond}, now)
+
+	d := bundle.DecideWithContext(ctx)
+	if d.Action != event.DecisionRejectWithHint {
+		t.Fatalf("expected REJECT_WITH_HINT, got %s", d.Action)
+	}
+	if d.Hint == nil || d.Hint.RetryAdvice == nil {
+		t.Fatalf("expected retry advice on the hint, got %+v", d.Hint)
+	}
+}
+
+func TestOutcomeBreaker_HalfOpenProbe(t *testing.T) {
+	bundle := outcomeBreakerBundle(BreakerEffect{
+		Scope:          "server_tool",
+		ErrorThreshold: 1,
+		WindowMS:       60000,
+		CooldownMS:     1000,
+		OnTrip:         "BLOCK",
+	})
+	ctx := DecisionContext{ServerName: "s", ToolName: "flaky_fetch"}
+	failed := Outcome{Status: event.CallStatusError}
+
+	// Opened long enough ago that the cooldown has passed.
+	bundle.recordOutcome(ctx, failed, time.Now().Add(-2*time.Second))
+
+	if d := bundle.DecideWithContext(ctx); d.Action != event.DecisionAllow {
+		t.Fatalf("expected the half-open probe to be admitted, got %s", d.Action)
+	}
+	if d := bundle.DecideWithContext(ctx); d.Action != event.DecisionBlock {
+		t.Fatalf("expected calls behind the probe to be blocked, got %s", d.Action)
+	}
+
+	// A failed probe re-opens the circuit for another cooldown.
+	bundle.recordOutcome(ctx, failed, time.Now())
+	if d := bundle.DecideWithContext(ctx); d.Action != event.DecisionBlock {
+		t.Fatalf("expected BLOCK after a failed probe, got %s", d.Action)
+	}
+
+	// Next cooldown over: the probe succeeds and the circuit closes.
+	bundle.breakerMu.Lock()
+	for _, circuit := range bundle.circuits {
+		circuit.openedAt = time.Now().Add(-2 * time.Second)
+	}
+	bundle.breakerMu.Unlock()
+	if d := bundle.DecideWithContext(ctx); d.Action != event.DecisionAllow {
+		t.Fatalf("expected a second probe to be admitted, got %s", d.Action)
+	}
+	bundle.recordOutcome(ctx, Outcome{Status: event.CallStatusOK}, time.Now())
+	for i := 0; i < 3; i++ {
+		if d := bundle.DecideWithContext(ctx); d.Action != event.DecisionAllow {
+			t.Fatalf("call %d: expected ALLOW after a successful probe, got %s", i+1, d.Action)
+		}
+	}
+}
+
+func TestOutcomeBreaker_DeniedCallDoesNotTakeProbe(t *testing.T) {
+	bundle := outcomeBreakerBundle(BreakerEffect{
+		Scope:          "tool",
+		ErrorThreshold: 1,
+		WindowMS:       60000,
+		CooldownMS:     1000,
+		OnTrip:         "BLOCK",
+	})
+	bundle.Rules = append(bundle.Rules, Rule{
+		RuleID: "deny-secrets",
+		Kind:   "deny",
+		Match: Match{
+			ToolName: &NameMatch{Glob: []string{"flaky_*"}},
+			Args:     &ArgsMatch{KeyEquals: map[string]any{"path": "/etc/shadow"}},
+		},
+		Effect: Effect{Action: event.DecisionBlock},
+	})
+	denied := DecisionContext{ServerName: "s", ToolName: "flaky_fetch", Args: map[string]any{"path": "/etc/shadow"}}
+	allowed := DecisionContext{ServerName: "s", ToolName: "flaky_fetch", Args: map[string]any{"path": "README.md"}}
+
+	bundle.recordOutcome(allowed, Outcome{Status: event.CallStatusError}, time.Now().Add(-2*time.Second))
+
+	// The deny rule refuses the call, so it must not use up the probe.
+	if d := bundle.DecideWithContext(denied); d.Action != event.DecisionBlock || d.ReasonCode == "BREAKER_OPEN" {
+		t.Fatalf("expected the deny rule to block, got %s %s", d.Action, d.ReasonCode)
+	}
+	if d := bundle.DecideWithContext(allowed); d.Action != event.DecisionAllow {
+		t.Fatalf("expected the probe to be admitted after a denied call, got %s %s", d.Action, d.ReasonCode)
+	}
+	if d := bundle.DecideWithContext(allowed); d.ReasonCode != "BREAKER_OPEN" {
+		t.Fatalf("expected calls behind the probe to be blocked, got %s %s", d.Action, d.ReasonCode)
+	}
+}
+
+func TestOutcomeBreaker_StateSurvivesStore(t *testing.T) {
+	breaker := BreakerEffect{
+		Scope:          "tool",
+		ErrorThreshold: 1,
+		WindowMS:       60000,
+		OnTrip:         "BLOCK",
+	}
+	store := &MemoryStateStore{}
+	ctx := DecisionContext{ServerName: "s", ToolName: "flaky_fetch"}
+
+	first := outcomeBreakerBundle(breaker)
+	first.SetStateStore(store)
+	first.RecordOutcome(ctx, Outcome{Status: event.CallStatusError})
+
+	second := outcomeBreakerBundle(breaker)
+	second.SetStateStore(store)
+	if d := second.DecideWithContext(ctx); d.Action != event.DecisionBlock {
+		t.Fatalf("expected the open circuit to be shared through the store, got %s", d.Action)
+	}
+}
@@ -3,6 +3,7 @@ package policy
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path"
 	"regexp"
@@ -12,9 +13,13 @@ import (
 	"time"
 
 	"github.com/peakyragnar/subluminal/pkg/event"
+	"github.com/peakyragnar/subluminal/pkg/expr"
 )
 
-const policyEnvJSON = "SUB_POLICY_JSON"
+const (
+	policyEnvJSON = "SUB_POLICY_JSON"
+	policyEnvFile = "SUB_POLICY_FILE"
+)
 
 // debugPolicy enables verbose logging for policy debugging.
 // Set SUB_POLICY_DEBUG=1 to enable.
@@ -33,11 +38,35 @@ type Bundle struct {
 	Selectors PolicySelectors
 	Rules     []Rule
 
+	// Verification records the signature check when trusted keys are
+	// configured; nil otherwise.
+	Verification *event.PolicyVerificationInfo
+
+	// LoadFailure records a configured policy that failed to load at
+	// startup and that this bundle replaced; nil otherwise.
+	LoadFailure *event.PolicyLoadInfo
+
 	breakerMu    sync.Mutex
 	breakerState map[string][]time.Time
+	circuits     map[string]*circuitState // guarded by breakerMu
 	budgets      *budgetState
 	rateLimit    *rateLimitState
 	dedupe       *dedupeCache
+
+	stateStore StateStore
+	stateMu    sync.Mutex // serializes durable decisions
+
+	whenOnce sync.Once
+	when     []*expr.Program // Per rule; nil when the rule has no when
+	whenErr  error
+
+	patterns sync.Map // Compiled regex and key_regex patterns: string -> *regexp.Regexp
+
+	promoMu    sync.Mutex
+	promotions []Promotion     // Run-scoped rules from `sub policy promote`
+	promoWhen  []*expr.Program // Per promotion
+
+	layers []layer // Set for layer sets, lowest precedence first
 }
 
 type Rule struct {
@@ -46,6 +75,7 @@ type Rule struct {
 	Enabled  *bool          `json:"enabled"`
 	Severity event.Severity `json:"severity"`
 	Match    Match          `json:"match"`
+	When     string         `json:"when,omitempty"` // Expression over server, tool, args, identity, workload
 	Effect   Effect         `json:"effect"`
 }
 
@@ -70,17 +100,21 @@ type Effect struct {
 	RateLimit  *RateLimitEffect     `json:"rate_limit,omitempty"`
 	Dedupe     *DedupeEffect        `json:"dedupe,omitempty"`
 	Tag        *TagEffect           `json:"tag,omitempty"`
+	TimeoutMS  int                  `json:"timeout_ms,omitempty"` // Per-call upstream deadline
 }
 
 type BreakerEffect struct {
-	Scope           string `json:"scope"`
-	ErrorThreshold  int    `json:"error_threshold"`
-	WindowMS        int    `json:"window_ms"`
-	RepeatThreshold int    `json:"repeat_threshold"`
-	RepeatWindowMS  int    `json:"repeat_window_ms"`
-	OnTrip          string `json:"on_trip"`
-	TerminateCode   string `json:"terminate_code"`
-	HintText        string `json:"hint_text"`
+	Scope              string `json:"scope"`
+	ErrorThreshold     int    `json:"error_threshold"`
+	WindowMS           int    `json:"window_ms"`
+	LatencyThresholdMS int    `json:"latency_threshold_ms,omitempty"` // Calls slower than this are slow calls
+	SlowCallThreshold  int    `json:"slow_call_threshold,omitempty"`  // Slow calls within window_ms that trip
+	CooldownMS         int    `json:"cooldown_ms,omitempty"`          // Open time before a half-open probe; defaults to window_ms
+	RepeatThreshold    int    `json:"repeat_threshold"`
+	RepeatWindowMS     int    `json:"repeat_window_ms"`
+	OnTrip             string `json:"on_trip"`
+	TerminateCode      string `json:"terminate_code"`
+	HintText           string `json:"hint_text"`
 }
 
 type RateLimitEffect struct {
@@ -95,12 +129,14 @@ type RateLimitEffect struct {
 }
 
 type BudgetEffect struct {
-	Scope            string               `json:"scope"`
-	LimitCalls       *int                 `json:"limit_calls,omitempty"`
-	LimitCostUnits   *int                 `json:"limit_cost_units,omitempty"`
-	CostUnitsPerCall *int                 `json:"cost_units_per_call,omitempty"`
-	OnExceed         event.DecisionAction `json:"on_exceed"`
-	HintText         string               `json:"hint_text,omitempty"`
+	Scope             string               `json:"scope"`
+	LimitCalls        *int                 `json:"limit_calls,omitempty"`
+	LimitCostUnits    *int                 `json:"limit_cost_units,omitempty"`
+	CostUnitsPerCall  *int                 `json:"cost_units_per_call,omitempty"`
+	CostArg           string               `json:"cost_arg,omitempty"`            // Numeric argument scaling the call cost, e.g. "limit"
+	LimitWriteActions *int                 `json:"limit_write_actions,omitempty"` // Counts only write_like calls
+	OnExceed          event.DecisionAction `json:"on_exceed"`
+	HintText          string               `json:"hint_text,omitempty"`
 }
 
 type DedupeEffect struct {
@@ -122,6 +158,15 @@ type DecisionContext struct {
 	ArgsHash   string
 	Args       map[string]any
 	Target     SelectorTarget
+	Now        time.Time // Decision time for replays and tests; zero means the wall clock
+}
+
+// now returns ctx.Now, or time.Now() when it is unset.
+func (ctx DecisionContext) now() time.Time {
+	if ctx.Now.IsZero() {
+		return time.Now()
+	}
+	return ctx.Now
 }
 
 type Decision struct {
@@ -132,6 +177,11 @@ type Decision struct {
 	Severity   event.Severity
 	BackoffMS  int
 	Hint       *event.Hint
+	Terminate  *event.Terminate
+	TimeoutMS  int                 // Upstream deadline from the first matching rule; 0 = shim default
+	Budgets    []event.BudgetUsage // Budgets the call was counted against
+	Layer      *event.LayerInfo    // Layer that produced the decision; set for layer sets
+	Layers     []LayerResult       // How every layer decided; set for layer sets
 }
 
 type rateLimitConfig struct {
@@ -172,6 +222,25 @@ func (bs *budgetState) incrementCalls(key string, delta int) int {
 	return bs.calls[key]
 }
 
+// charge adds delta to key unless that would exceed limit. Returns the
+// total after the charge, or the unchanged total when refused. A negative
+// delta is refused so no call can credit the budget.
+func (bs *budgetState) charge(key string, delta, limit int) (int, bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if delta < 0 || delta > limit-bs.calls[key] {
+		return bs.calls[key], false
+	}
+	bs.calls[key] += delta
+	return bs.calls[key], true
+}
+
+func (bs *budgetState) used(key string) int {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return bs.calls[key]
+}
+
 type dedupeCache struct {
 	mu      sync.Mutex
 	entries map[string]time.Time
@@ -196,6 +265,42 @@ func (d *dedupeCache) IsDuplicate(key string, window time.Duration, now time.Tim
 	return false
 }
 
+// loadFailed returns the bundle that replaces a configured policy that
+// failed to load at startup. A policy that declares observe mode, which
+// never blocks, gets the default observe bundle; any other, or one too
+// broken to tell, blocks every call until a reload fixes it.
+func loadFailed(source string, data []byte, err error) *Bundle {
+	bundle := failClosedBundle("load-failed", "POLICY_LOAD_FAILED", "Policy failed to load")
+	if declaresObserve(data) {
+		bundle = DefaultBundle()
+	}
+	bundle.LoadFailure = &event.PolicyLoadInfo{
+		Source:   source,
+		Success:  false,
+		Error:    err.Error(),
+		Severity: event.SeverityWarn,
+		Mode:     bundle.Mode,
+		Current:  bundle.Info,
+	}
+	debugLog("LoadFromEnv: %s failed to load (mode=%s): %v", source, bundle.Mode, err)
+	return bundle
+}
+
+// declaresObserve reports whether a policy that failed to load still
+// parses as a single bundle in observe mode.
+func declaresObserve(data []byte) bool {
+	raw, err := parsePolicyData(data)
+	if err != nil || isLayerSet(raw) {
+		return false
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return false
+	}
+	mode, _ := fields["mode"].(string)
+	return parseMode(mode) == event.RunModeObserve
+}
+
 type rawBundle struct {
 	Mode          string          `json:"mode"`
 	PolicyID      string          `json:"policy_id"`
@@ -207,7 +312,25 @@ type rawBundle struct {
 	Rules         []Rule          `json:"rules"`
 }
 
-func LoadFromEnv() Bundle {
+// LoadFromEnv loads the policy bundle for a shim.
+// SUB_POLICY_FILE takes precedence over SUB_POLICY_JSON; a policy that
+// fails to load is replaced as described at loadFailed.
+// With SUB_POLICY_TRUSTED_KEYS set, only a signed SUB_POLICY_FILE loads;
+// see loadTrustedFromEnv.
+func LoadFromEnv() *Bundle {
+	if t, err := trustFromEnv(); t != nil {
+		return loadTrustedFromEnv(t, err)
+	}
+	if path := FilePathFromEnv(); path != "" {
+		bundle, err := LoadFile(path)
+		if err != nil {
+			data, _ := os.ReadFile(path)
+			return loadFailed(path, data, err)
+		}
+		debugLog("LoadFromEnv: loaded %s (mode=%s, rules=%d)", path, bundle.Mode, len(bundle.Rules))
+		return bundle
+	}
+
 	raw := strings.TrimSpace(os.Getenv(policyEnvJSON))
 	if raw == "" {
 		debugLog("LoadFromEnv: SUB_POLICY_JSON is empty, using default bundle")
@@ -216,10 +339,18 @@ func LoadFromEnv() Bundle {
 
 	debugLog("LoadFromEnv: parsing policy JSON (len=%d)", len(raw))
 
+	if generic, err := parsePolicyData([]byte(raw)); err == nil && isLayerSet(generic) {
+		bundle, err := loadLayerSetJSON(generic)
+		if err != nil {
+			return loadFailed(policyEnvJSON, []byte(raw), err)
+		}
+		debugLog("LoadFromEnv: loaded layer set (mode=%s, layers=%d)", bundle.Mode, len(bundle.layers))
+		return bundle
+	}
+
 	var parsed rawBundle
 	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
-		debugLog("LoadFromEnv: JSON parse error: %v", err)
-		return DefaultBundle()
+		return loadFailed(policyEnvJSON, []byte(raw), err)
 	}
 
 	version := defaultString(parsed.PolicyVersion, parsed.Version)
@@ -235,7 +366,7 @@ func LoadFromEnv() Bundle {
 		}
 	}
 
-	bundle := Bundle{
+	bundle := &Bundle{
 		Mode: parseMode(parsed.Mode),
 		Info: event.PolicyInfo{
 			PolicyID:      policyID,
@@ -254,6 +385,12 @@ func LoadFromEnv() Bundle {
 	if bundle.Mode == "" {
 		bundle.Mode = event.RunModeObserve
 	}
+	if err := bundle.compileWhen(); err != nil {
+		return loadFailed(policyEnvJSON, []byte(raw), err)
+	}
+	if err := bundle.compilePatterns(); err != nil {
+		return loadFailed(policyEnvJSON, []byte(raw), err)
+	}
 
 	debugLog("LoadFromEnv: mode=%s, rules=%d, budgets=%v, rateLimit=%v, dedupe=%v",
 		bundle.Mode, len(bundle.Rules), bundle.budgets != nil, bundle.rateLimit != nil, bundle.dedupe != nil)
@@ -268,8 +405,8 @@ func LoadFromEnv() Bundle {
 	return bundle
 }
 
-func DefaultBundle() Bundle {
-	return Bundle{
+func DefaultBundle() *Bundle {
+	return &Bundle{
 		Mode: event.RunModeObserve,
 		Info: event.PolicyInfo{
 			PolicyID:      "default",
@@ -291,46 +428,77 @@ func (b *Bundle) Decide(serverName, toolName, argsHash string) Decision {
 	})
 }
 
+// DecideWithContext evaluates the bundle for one call. With a state store
+// attached, stateful rules see and update the run's durable state.
 func (b *Bundle) DecideWithContext(ctx DecisionContext) Decision {
+	if len(b.layers) > 0 {
+		return b.decideLayers(ctx)
+	}
+	if b.stateStore != nil && b.hasStatefulRules() {
+		return b.decideDurable(ctx)
+	}
+	if b.stateStore != nil {
+		b.refreshPromotions()
+	}
+	return b.decide(ctx)
+}
+
+func (b *Bundle) decide(ctx DecisionContext) Decision {
 	b.ensureState()
-	now := time.Now()
-	riskClasses := make(map[string]struct{})
+	now := ctx.now()
 
 	debugLog("Decide: server=%s, tool=%s, hash=%s", ctx.ServerName, ctx.ToolName, ctx.ArgsHash)
 
 	if !selectorsMatch(b.Selectors, ctx.Target) {
-		return Decision{
-			Action:     event.DecisionAllow,
-			RuleID:     nil,
-			ReasonCode: "POLICY_NOT_APPLICABLE",
-			Summary:    "Policy selectors did not match",
-			Severity:   event.SeverityInfo,
-		}
+		return notApplicableDecision()
 	}
 
+	// Tags apply wherever their rule sits, so budgets and risk_class
+	// matches see tag rules listed after them
+	riskClasses := b.riskClasses(ctx)
+
 	var orderedDecision *Decision
 	var breakerDecision *Decision
+	var budgets []event.BudgetUsage
+	var probes []string // Half-open circuits this call would probe
+	timeoutMS := 0
+
+	// Promoted rules come first; breakers and rate limits still apply.
+	orderedDecision = b.promotedDecision(ctx)
 
 	for idx, rule := range b.Rules {
 		if !ruleEnabled(rule.Enabled) {
 			continue
 		}
 
-		if !matchName(rule.Match.ServerName, ctx.ServerName) {
+		if !b.matchName(rule.Match.ServerName, ctx.ServerName) {
 			continue
 		}
-		if !matchName(rule.Match.ToolName, ctx.ToolName) {
+		if !b.matchName(rule.Match.ToolName, ctx.ToolName) {
 			continue
 		}
 		if !matchRiskClass(rule.Match.RiskClass, riskClasses) {
 			continue
 		}
-		if !matchArgs(rule.Match.Args, ctx.Args) {
+		if !b.matchArgs(rule.Match.Args, ctx.Args) {
+			continue
+		}
+		if matched, err := b.evalWhen(idx, rule, ctx); err != nil {
+			// Rules that restrict calls fail closed
+			if !allowsCalls(rule) && orderedDecision == nil {
+				orderedDecision = b.whenErrorDecision(rule, err)
+			}
+			continue
+		} else if !matched {
 			continue
 		}
 
 		debugLog("  Matched Rule[%d] id=%s kind=%s", idx, rule.RuleID, rule.Kind)
 
+		if timeoutMS == 0 && rule.Effect.TimeoutMS > 0 {
+			timeoutMS = rule.Effect.TimeoutMS
+		}
+
 		kind := strings.ToLower(strings.TrimSpace(rule.Kind))
 
 		// Check breaker rules (POL-005)
@@ -339,26 +507,44 @@ func (b *Bundle) DecideWithContext(ctx DecisionContext) Decision {
 			if breaker == nil {
 				continue
 			}
-			if breaker.RepeatThreshold <= 0 || breaker.RepeatWindowMS <= 0 {
-				continue
-			}
 
-			key := breakerKey(breakerRuleKey(rule, idx), breaker.Scope, ctx.ServerName, ctx.ToolName, ctx.ArgsHash)
-			count := b.recordRepeat(key, now, time.Duration(breaker.RepeatWindowMS)*time.Millisecond)
-			debugLog("    Breaker: key=%s, count=%d, threshold=%d", key, count, breaker.RepeatThreshold)
+			if breaker.RepeatThreshold > 0 && breaker.RepeatWindowMS > 0 {
+				key := breakerKey(ruleStateKey(rule, idx), breaker.Scope, ctx.ServerName, ctx.ToolName, ctx.ArgsHash)
+				count := b.recordRepeat(key, now, time.Duration(breaker.RepeatWindowMS)*time.Millisecond)
+				debugLog("    Breaker: key=%s, count=%d, threshold=%d", key, count, breaker.RepeatThreshold)
+
+				if count >= breaker.RepeatThreshold && breakerDecision == nil {
+					debugLog("    Breaker TRIPPED")
+					action := b.controlAction(breakerAction(breaker.OnTrip))
+					breakerDecision = buildDecision(rule, action, "BREAKER_TRIPPED", "Breaker tripped")
+					attachHint(breakerDecision, breaker.HintText, event.HintKindSafety)
+					attachTerminate(breakerDecision, breaker.TerminateCode)
+				}
+			}
 
-			if count >= breaker.RepeatThreshold && breakerDecision == nil {
-				debugLog("    Breaker TRIPPED")
-				action := b.controlAction(breakerAction(breaker.OnTrip))
-				breakerDecision = buildDecision(rule, action, "BREAKER_TRIPPED", "Breaker tripped")
-				attachHint(breakerDecision, breaker.HintText, event.HintKindSafety)
+			// Outcome breakers (error count / latency) trip in RecordOutcome
+			if outcomeBreaker(breaker) && breakerDecision == nil {
+				key := circuitKey(ruleStateKey(rule, idx), breaker.Scope, ctx.ServerName, ctx.ToolName)
+				retryAfter, open, probe := b.circuitOpen(key, breakerCooldown(breaker), now)
+				if probe {
+					probes = append(probes, key)
+				}
+				if open {
+					debugLog("    Breaker OPEN: key=%s, retry_after=%s", key, retryAfter)
+					action := b.controlAction(breakerAction(breaker.OnTrip))
+					breakerDecision = buildDecision(rule, action, "BREAKER_OPEN", "Breaker open after failed or slow calls")
+					attachHint(breakerDecision, breaker.HintText, event.HintKindSafety)
+					attachRetryAdvice(breakerDecision, retryAfter)
+					attachTerminate(breakerDecision, breaker.TerminateCode)
+				}
 			}
 			continue
 		}
 
 		// Check budget rules (POL-003)
 		if isBudgetRule(rule) {
-			budgetDec := b.applyBudgetDecision(rule, idx, ctx.ServerName, ctx.ToolName)
+			budgetDec, usage := b.applyBudgetDecision(rule, idx, ctx, riskClasses)
+			budgets = append(budgets, usage...)
 			if budgetDec != nil {
 				debugLog("    Budget EXCEEDED: action=%s", budgetDec.Action)
 				if orderedDecision == nil {
@@ -372,7 +558,7 @@ func (b *Bundle) DecideWithContext(ctx DecisionContext) Decision {
 
 		// Check rate limit rules (POL-004)
 		if rule.Effect.RateLimit != nil {
-			rateLimitDec, limited := b.rateLimitDecision(idx, rule, ctx.ServerName, ctx.ToolName)
+			rateLimitDec, limited := b.rateLimitDecision(ruleStateKey(rule, idx), rule, ctx.ServerName, ctx.ToolName, now)
 			if limited {
 				debugLog("    RateLimit LIMITED: action=%s, backoff=%d", rateLimitDec.Action, rateLimitDec.BackoffMS)
 				return rateLimitDec
@@ -392,9 +578,8 @@ func (b *Bundle) DecideWithContext(ctx DecisionContext) Decision {
 			continue
 		}
 
-		// Check tag rules (POL-007)
+		// Tag rules (POL-007) were applied up front
 		if kind == "tag" || rule.Effect.Tag != nil {
-			applyTag(rule.Effect.Tag, riskClasses)
 			continue
 		}
 
@@ -417,20 +602,40 @@ func (b *Bundle) DecideWithContext(ctx DecisionContext) Decision {
 
 	if breakerDecision != nil {
 		debugLog("Decide: Returning Breaker Decision %s", breakerDecision.Action)
+		breakerDecision.TimeoutMS = timeoutMS
+		breakerDecision.Budgets = budgets
 		return *breakerDecision
 	}
 	if orderedDecision != nil {
 		debugLog("Decide: Returning Ordered Decision %s", orderedDecision.Action)
+		if orderedDecision.Action == event.DecisionAllow {
+			b.reserveProbes(probes, now)
+		}
+		orderedDecision.TimeoutMS = timeoutMS
+		orderedDecision.Budgets = budgets
 		return *orderedDecision
 	}
 
 	debugLog("Decide: Default Allow")
+	b.reserveProbes(probes, now)
 	return Decision{
 		Action:     event.DecisionAllow,
 		RuleID:     nil,
 		ReasonCode: "DEFAULT_ALLOW",
 		Summary:    "Allowed by default policy",
 		Severity:   event.SeverityInfo,
+		TimeoutMS:  timeoutMS,
+		Budgets:    budgets,
+	}
+}
+
+func notApplicableDecision() Decision {
+	return Decision{
+		Action:     event.DecisionAllow,
+		RuleID:     nil,
+		ReasonCode: "POLICY_NOT_APPLICABLE",
+		Summary:    "Policy selectors did not match",
+		Severity:   event.SeverityInfo,
 	}
 }
 
@@ -439,6 +644,9 @@ func (b *Bundle) ensureState() {
 	if b.breakerState == nil {
 		b.breakerState = make(map[string][]time.Time)
 	}
+	if b.circuits == nil {
+		b.circuits = make(map[string]*circuitState)
+	}
 	b.breakerMu.Unlock()
 	if b.budgets == nil {
 		b.budgets = newBudgetState()
@@ -475,7 +683,7 @@ func (b *Bundle) recordRepeat(key string, now time.Time, window time.Duration) i
 	return len(kept)
 }
 
-func breakerRuleKey(rule Rule, index int) string {
+func ruleStateKey(rule Rule, index int) string {
 	if strings.TrimSpace(rule.RuleID) != "" {
 		return rule.RuleID
 	}
@@ -543,6 +751,18 @@ func buildDecision(rule Rule, action event.DecisionAction, fallbackReason, fallb
 	}
 }
 
+// attachTerminate fills decision.Terminate for TERMINATE_RUN decisions.
+// terminateCode falls back to the decision's reason code.
+func attachTerminate(decision *Decision, terminateCode string) {
+	if decision == nil || decision.Action != event.DecisionTerminateRun {
+		return
+	}
+	decision.Terminate = &event.Terminate{
+		TerminateCode:    defaultString(terminateCode, decision.ReasonCode),
+		TerminateMessage: defaultString(decision.Summary, defaultSummary(event.DecisionTerminateRun)),
+	}
+}
+
 func attachHint(decision *Decision, hintText string, kind event.HintKind) {
 	if decision == nil || decision.Action != event.DecisionRejectWithHint {
 		return
@@ -579,14 +799,14 @@ func isBudgetRule(rule Rule) bool {
 	return strings.EqualFold(rule.Kind, "budget")
 }
 
-func (b *Bundle) applyBudgetDecision(rule Rule, ruleIndex int, serverName, toolName string) *Decision {
-	if rule.Effect.Budget == nil {
-		return nil
-	}
-
-	limit := rule.Effect.Budget.LimitCalls
-	if limit == nil {
-		return nil
+// applyBudgetDecision counts the call against each limit of a budget rule.
+// Calls always count; cost units and write actions are charged only while
+// the call fits, so a refused call does not use up budget. Returns the
+// exceed decision, if any, and the usage of every limit.
+func (b *Bundle) applyBudgetDecision(rule Rule, ruleIndex int, ctx DecisionContext, riskClasses map[string]struct{}) (*Decision, []event.BudgetUsage) {
+	budget := rule.Effect.Budget
+	if budget == nil {
+		return nil, nil
 	}
 
 	bs := b.budgets
@@ -597,17 +817,57 @@ func (b *Bundle) applyBudgetDecision(rule Rule, ruleIndex int, serverName, toolN
 		b.budgets = bs
 	}
 
-	scope := strings.TrimSpace(strings.ToLower(rule.Effect.Budget.Scope))
-	key := budgetKey(rule.RuleID, ruleIndex, scope, serverName, toolName)
-	count := bs.incrementCalls(key, 1)
+	scope := strings.TrimSpace(strings.ToLower(budget.Scope))
+	key := budgetKey(rule.RuleID, ruleIndex, scope, ctx.ServerName, ctx.ToolName)
 
-	debugLog("    applyBudgetDecision: key=%s, count=%d, limit=%d", key, count, *limit)
+	var usage []event.BudgetUsage
+	var exceeded *event.BudgetUsage
+	cost := 0
 
-	if count <= *limit {
-		return nil
+	if limit := budget.LimitCalls; limit != nil {
+		count := bs.incrementCalls(key, 1)
+		debugLog("    applyBudgetDecision: key=%s, count=%d, limit=%d", key, count, *limit)
+		usage = append(usage, budgetUsage(rule, event.BudgetUnitCalls, *limit, count))
+		if count > *limit {
+			exceeded = &usage[len(usage)-1]
+		}
+	}
+
+	if limit := budget.LimitCostUnits; limit != nil {
+		cost = b.callCost(budget, ctx)
+		costKey := key + "|" + event.BudgetUnitCostUnits
+		used, ok := bs.used(costKey), false
+		if exceeded == nil {
+			used, ok = bs.charge(costKey, cost, *limit)
+		}
+		debugLog("    applyBudgetDecision: key=%s, cost=%d, used=%d, limit=%d", costKey, cost, used, *limit)
+		usage = append(usage, budgetUsage(rule, event.BudgetUnitCostUnits, *limit, used))
+		if !ok && exceeded == nil {
+			exceeded = &usage[len(usage)-1]
+		}
+	}
+
+	if limit := budget.LimitWriteActions; limit != nil {
+		writeKey := key + "|" + event.BudgetUnitWriteActions
+		used := bs.used(writeKey)
+		if _, write := riskClasses["write_like"]; write && exceeded == nil {
+			var ok bool
+			used, ok = bs.charge(writeKey, 1, *limit)
+			debugLog("    applyBudgetDecision: key=%s, used=%d, limit=%d", writeKey, used, *limit)
+			usage = append(usage, budgetUsage(rule, event.BudgetUnitWriteActions, *limit, used))
+			if !ok {
+				exceeded = &usage[len(usage)-1]
+			}
+		} else {
+			usage = append(usage, budgetUsage(rule, event.BudgetUnitWriteActions, *limit, used))
+		}
+	}
+
+	if exceeded == nil {
+		return nil, usage
 	}
 
-	action := rule.Effect.Budget.OnExceed
+	action := budget.OnExceed
 	if action == "" {
 		action = event.DecisionBlock
 	}
@@ -616,8 +876,94 @@ func (b *Bundle) applyBudgetDecision(rule Rule, ruleIndex int, serverName, toolN
 	summary := defaultString(rule.Effect.Message, "Budget exceeded")
 
 	decision := buildDecision(rule, action, reason, summary)
-	attachHint(decision, rule.Effect.Budget.HintText, event.HintKindBudget)
-	return decision
+	attachHint(decision, budgetHintText(budget.HintText, *exceeded, cost), event.HintKindBudget)
+	attachTerminate(decision, "")
+	return decision, usage
+}
+
+func budgetUsage(rule Rule, unit string, limit, used int) event.BudgetUsage {
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return event.BudgetUsage{
+		RuleID:    rule.RuleID,
+		Unit:      unit,
+		Limit:     limit,
+		Used:      used,
+		Remaining: remaining,
+	}
+}
+
+// budgetHintText appends the remaining budget to the rule's hint so the
+// agent can tell a smaller call from no call at all.
+func budgetHintText(hintText string, exceeded event.BudgetUsage, cost int) string {
+	unit := strings.ReplaceAll(exceeded.Unit, "_", " ")
+	note := fmt.Sprintf("%d of %d %s remaining", exceeded.Remaining, exceeded.Limit, unit)
+	if exceeded.Unit == event.BudgetUnitCostUnits {
+		note += fmt.Sprintf("; this call costs %d", cost)
+	}
+	text := strings.TrimSpace(hintText)
+	if text == "" {
+		return "Budget exceeded: " + note
+	}
+	return text + " (" + note + ")"
+}
+
+// callCost returns the cost units of one call: cost_arg's numeric value
+// times cost_units_per_call when the argument is present, otherwise the
+// defaults.tool_costs entry, otherwise cost_units_per_call (default 1).
+// Costs too large for an int, or not a number at all, saturate at
+// math.MaxInt so they exceed any limit.
+func (b *Bundle) callCost(budget *BudgetEffect, ctx DecisionContext) int {
+	perCall := 1
+	if budget.CostUnitsPerCall != nil {
+		perCall = *budget.CostUnitsPerCall
+	}
+
+	if name := strings.TrimSpace(budget.CostArg); name != "" {
+		if value, ok := toFloat(ctx.Args[name]); ok {
+			switch {
+			case math.IsNaN(value) || value >= math.MaxInt:
+				return math.MaxInt
+			case value < 0:
+				value = 0
+			}
+			units := int(math.Ceil(value))
+			if perCall > 0 && units > math.MaxInt/perCall {
+				return math.MaxInt
+			}
+			return units * perCall
+		}
+	}
+
+	if cost, ok := toolCost(b.Defaults.ToolCosts, ctx.ToolName); ok {
+		return cost
+	}
+	return perCall
+}
+
+// toolCost looks up toolName in a glob-keyed cost table. An exact key wins,
+// then the longest matching glob; ties break lexically for determinism.
+func toolCost(costs map[string]int, toolName string) (int, bool) {
+	if cost, ok := costs[toolName]; ok {
+		return cost, true
+	}
+	best := ""
+	found := false
+	for pattern := range costs {
+		if !globMatch(pattern, toolName) {
+			continue
+		}
+		if !found || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best = pattern
+			found = true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	return costs[best], true
 }
 
 func budgetKey(ruleID string, ruleIndex int, scope, serverName, toolName string) string {
@@ -638,14 +984,14 @@ func budgetKey(ruleID string, ruleIndex int, scope, serverName, toolName string)
 	}
 }
 
-func (b *Bundle) rateLimitDecision(ruleIndex int, rule Rule, serverName, toolName string) (Decision, bool) {
+func (b *Bundle) rateLimitDecision(ruleKey string, rule Rule, serverName, toolName string, now time.Time) (Decision, bool) {
 	if b.rateLimit == nil {
 		debugLog("    rateLimitDecision: rateLimit state is NIL! recreating")
 		b.rateLimit = newRateLimitState()
 	}
 
 	config := normalizeRateLimit(rule.Effect.RateLimit)
-	if b.rateLimit.allow(ruleIndex, config, serverName, toolName) {
+	if b.rateLimit.allow(ruleKey, config, serverName, toolName, now) {
 		return Decision{}, false
 	}
 
@@ -665,6 +1011,7 @@ func (b *Bundle) rateLimitDecision(ruleIndex int, rule Rule, serverName, toolNam
 		decision.BackoffMS = config.BackoffMS
 	}
 	attachHint(&decision, rule.Effect.RateLimit.HintText, event.HintKindRate)
+	attachTerminate(&decision, "")
 
 	if rule.RuleID == "" {
 		return decision, true
@@ -731,6 +1078,7 @@ func (b *Bundle) evaluateDedupe(rule Rule, serverName, toolName, argsHash string
 		decision.RuleID = &ruleID
 	}
 	attachHint(&decision, effect.HintText, event.HintKindSafety)
+	attachTerminate(&decision, "")
 	return decision, true
 }
 
@@ -765,7 +1113,7 @@ func ruleEnabled(enabled *bool) bool {
 	return *enabled
 }
 
-func matchName(match *NameMatch, value string) bool {
+func (b *Bundle) matchName(match *NameMatch, value string) bool {
 	if match == nil {
 		return true
 	}
@@ -780,7 +1128,7 @@ func matchName(match *NameMatch, value string) bool {
 	}
 
 	for _, pattern := range match.Regex {
-		if regexMatch(pattern, value) {
+		if b.regexMatch(pattern, value) {
 			return true
 		}
 	}
@@ -837,14 +1185,88 @@ func globMatch(pattern, value string) bool {
 	return matched
 }
 
-func regexMatch(pattern, value string) bool {
-	re, err := regexp.Compile(pattern)
+func (b *Bundle) regexMatch(pattern, value string) bool {
+	re, err := b.compilePattern(pattern)
 	if err != nil {
 		return false
 	}
 	return re.MatchString(value)
 }
 
+// compilePattern returns pattern compiled, caching it on the bundle so the
+// cache is released with the bundle when a reload replaces it.
+// compilePatterns fills it at load, so decisions never compile; patterns
+// of promoted rules are compiled on first use.
+func (b *Bundle) compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := b.patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	b.patterns.Store(pattern, re)
+	return re, nil
+}
+
+// compilePatterns compiles every regex the rules match with. An invalid
+// pattern fails the load instead of silently never matching.
+func (b *Bundle) compilePatterns() error {
+	for i, rule := range b.Rules {
+		field := fmt.Sprintf("rules[%d].match", i)
+		names := []struct {
+			field string
+			match *NameMatch
+		}{
+			{field + ".server_name", rule.Match.ServerName},
+			{field + ".tool_name", rule.Match.ToolName},
+		}
+		for _, name := range names {
+			if name.match == nil {
+				continue
+			}
+			for _, pattern := range name.match.Regex {
+				if _, err := b.compilePattern(pattern); err != nil {
+					return fmt.Errorf("%s.regex: %w", name.field, err)
+				}
+			}
+		}
+		if err := b.compileArgsPatterns(field+".args", rule.Match.Args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileArgsPatterns compiles key_regex patterns, recursing into
+// combinators.
+func (b *Bundle) compileArgsPatterns(field string, match *ArgsMatch) error {
+	if match == nil {
+		return nil
+	}
+	for _, key := range sortedSet(mapKeys(match.KeyRegex)) {
+		for _, pattern := range match.KeyRegex[key] {
+			if _, err := b.compilePattern(pattern); err != nil {
+				return fmt.Errorf("%s.key_regex.%s: %w", field, key, err)
+			}
+		}
+	}
+	if err := b.compileArgsPatterns(field+".not", match.Not); err != nil {
+		return err
+	}
+	for i := range match.AnyOf {
+		if err := b.compileArgsPatterns(fmt.Sprintf("%s.any_of[%d]", field, i), &match.AnyOf[i]); err != nil {
+			return err
+		}
+	}
+	for i := range match.AllOf {
+		if err := b.compileArgsPatterns(fmt.Sprintf("%s.all_of[%d]", field, i), &match.AllOf[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func actionFromKind(kind string) event.DecisionAction {
 	switch strings.ToLower(kind) {
 	case "allow":
@@ -984,9 +1406,8 @@ func newRateLimitState() *rateLimitState {
 	}
 }
 
-func (state *rateLimitState) allow(ruleIndex int, config rateLimitConfig, serverName, toolName string) bool {
-	key := rateLimitKey(ruleIndex, config.Scope, serverName, toolName)
-	now := time.Now()
+func (state *rateLimitState) allow(ruleKey string, config rateLimitConfig, serverName, toolName string, now time.Time) bool {
+	key := rateLimitKey(ruleKey, config.Scope, serverName, toolName)
 
 	state.mu.Lock()
 	bucket := state.buckets[key]
@@ -1000,14 +1421,14 @@ func (state *rateLimitState) allow(ruleIndex int, config rateLimitConfig, server
 	return allowed
 }
 
-func rateLimitKey(ruleIndex int, scope, serverName, toolName string) string {
+func rateLimitKey(ruleKey, scope, serverName, toolName string) string {
 	switch strings.ToLower(scope) {
 	case "server_tool":
-		return fmt.Sprintf("rate_limit:%d:server_tool:%s:%s", ruleIndex, serverName, toolName)
+		return fmt.Sprintf("%s|server_tool:%s:%s", ruleKey, serverName, toolName)
 	case "tool":
-		return fmt.Sprintf("rate_limit:%d:tool:%s", ruleIndex, toolName)
+		return fmt.Sprintf("%s|tool:%s", ruleKey, toolName)
 	default:
-		return fmt.Sprintf("rate_limit:%d:run", ruleIndex)
+		return fmt.Sprintf("%s|run", ruleKey)
 	}
 }
 
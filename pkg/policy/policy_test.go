@@ -6,7 +6,9 @@ package policy
 
 import (
 	"encoding/json"
+	"math"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -175,6 +177,179 @@ func TestBudget_LoadFromEnvPreservesState(t *testing.T) {
 	}
 }
 
+func TestBudget_CostUnitsFromArgToolTableAndFixed(t *testing.T) {
+	bundle := &Bundle{
+		Mode:     event.RunModeControl,
+		Defaults: PolicyDefaults{ToolCosts: map[string]int{"search_*": 3, "search_web": 5}},
+		Rules: []Rule{
+			{
+				RuleID: "cost-budget",
+				Kind:   "budget",
+				Effect: Effect{
+					Budget: &BudgetEffect{
+						Scope:          "run",
+						LimitCostUnits: intPtr(20),
+						CostArg:        "limit",
+						OnExceed:       event.DecisionRejectWithHint,
+					},
+				},
+			},
+		},
+	}
+
+	decide := func(tool string, args map[string]any) Decision {
+		return bundle.DecideWithContext(DecisionContext{ServerName: "s", ToolName: tool, ArgsHash: "h", Args: args})
+	}
+
+	// search_web: exact table entry (5) beats the glob (3).
+	if d := decide("search_web", nil); d.Action != event.DecisionAllow || d.Budgets[0].Used != 5 {
+		t.Fatalf("expected 5 units used, got %s %+v", d.Action, d.Budgets)
+	}
+	// search_code: glob entry.
+	if d := decide("search_code", nil); d.Budgets[0].Used != 8 {
+		t.Fatalf("expected 8 units used, got %+v", d.Budgets)
+	}
+	// Unlisted tool: fixed default of 1.
+	if d := decide("read", nil); d.Budgets[0].Used != 9 {
+		t.Fatalf("expected 9 units used, got %+v", d.Budgets)
+	}
+	// cost_arg overrides the table; 12.5 rounds up to 13 > 11 remaining.
+	d := decide("search_web", map[string]any{"limit": 12.5})
+	if d.Action != event.DecisionRejectWithHint {
+		t.Fatalf("expected REJECT_WITH_HINT, got %s", d.Action)
+	}
+	if d.Hint == nil || !strings.Contains(d.Hint.HintText, "11 of 20 cost units remaining; this call costs 13") {
+		t.Fatalf("expected remaining budget in hint, got %+v", d.Hint)
+	}
+	// The refused call was not charged, so a smaller one still fits.
+	if d := decide("search_web", map[string]any{"limit": 11}); d.Action != event.DecisionAllow || d.Budgets[0].Remaining != 0 {
+		t.Fatalf("expected smaller call to fit exactly, got %s %+v", d.Action, d.Budgets)
+	}
+}
+
+func TestBudget_HugeCostArgIsDenied(t *testing.T) {
+	bundle := &Bundle{
+		Mode: event.RunModeGuardrails,
+		Rules: []Rule{
+			{
+				RuleID: "cost-budget",
+				Kind:   "budget",
+				Effect: Effect{
+					Budget: &BudgetEffect{
+						Scope:            "run",
+						LimitCostUnits:   intPtr(10),
+						CostUnitsPerCall: intPtr(2),
+						CostArg:          "limit",
+						OnExceed:         event.DecisionBlock,
+					},
+				},
+			},
+		},
+	}
+
+	decide := func(limit any) Decision {
+		return bundle.DecideWithContext(DecisionContext{ServerName: "s", ToolName: "search", ArgsHash: "h", Args: map[string]any{"limit": limit}})
+	}
+
+	// Values that overflow int, or the multiplication, must not wrap
+	// into a negative cost that credits the budget.
+	for _, limit := range []any{1e300, math.Inf(1), math.NaN(), float64(math.MaxInt64 / 2)} {
+		if d := decide(limit); d.Action != event.DecisionBlock || d.Budgets[0].Used != 0 {
+			t.Fatalf("limit=%v: expected BLOCK with nothing charged, got %s %+v", limit, d.Action, d.Budgets)
+		}
+	}
+
+	// Later calls are still held to the limit.
+	if d := decide(4); d.Action != event.DecisionAllow || d.Budgets[0].Used != 8 {
+		t.Fatalf("expected 8 units used, got %s %+v", d.Action, d.Budgets)
+	}
+	if d := decide(2); d.Action != event.DecisionBlock || d.Budgets[0].Used != 8 {
+		t.Fatalf("expected BLOCK over the limit, got %s %+v", d.Action, d.Budgets)
+	}
+}
+
+func TestBudgetState_ChargeRefusesNegativeDelta(t *testing.T) {
+	bs := newBudgetState()
+	if used, ok := bs.charge("k", 3, 5); !ok || used != 3 {
+		t.Fatalf("expected charge of 3 to fit, got %d %v", used, ok)
+	}
+	if used, ok := bs.charge("k", -3, 5); ok || used != 3 {
+		t.Fatalf("expected negative charge refused, got %d %v", used, ok)
+	}
+	if _, ok := bs.charge("k", math.MaxInt, 5); ok {
+		t.Fatal("expected saturated charge refused")
+	}
+}
+
+func TestBudget_WriteActionsCountOnlyWriteLike(t *testing.T) {
+	bundle := &Bundle{
+		Mode: event.RunModeGuardrails,
+		Rules: []Rule{
+			{
+				RuleID: "tag-writes",
+				Kind:   "tag",
+				Match:  Match{ToolName: &NameMatch{Glob: []string{"write_*"}}},
+				Effect: Effect{Tag: &TagEffect{AddRiskClass: []string{"write_like"}}},
+			},
+			{
+				RuleID: "write-budget",
+				Kind:   "budget",
+				Effect: Effect{Budget: &BudgetEffect{Scope: "run", LimitWriteActions: intPtr(2)}},
+			},
+		},
+	}
+
+	for i := 0; i < 5; i++ {
+		if d := bundle.Decide("s", "read_file", "h"); d.Action != event.DecisionAllow {
+			t.Fatalf("read %d: expected ALLOW, got %s", i+1, d.Action)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		d := bundle.Decide("s", "write_file", "h")
+		if d.Action != event.DecisionAllow {
+			t.Fatalf("write %d: expected ALLOW, got %s", i+1, d.Action)
+		}
+		if got := d.Budgets[0]; got.Unit != event.BudgetUnitWriteActions || got.Remaining != 1-i {
+			t.Fatalf("write %d: unexpected usage %+v", i+1, got)
+		}
+	}
+	if d := bundle.Decide("s", "write_file", "h"); d.Action != event.DecisionBlock {
+		t.Fatalf("expected third write blocked, got %s", d.Action)
+	}
+	if d := bundle.Decide("s", "read_file", "h"); d.Action != event.DecisionAllow {
+		t.Fatalf("expected reads to stay allowed, got %s", d.Action)
+	}
+}
+
+func TestBudget_WriteActionsSeeLaterTagRules(t *testing.T) {
+	bundle := &Bundle{
+		Mode: event.RunModeGuardrails,
+		Rules: []Rule{
+			{
+				RuleID: "write-budget",
+				Kind:   "budget",
+				Effect: Effect{Budget: &BudgetEffect{Scope: "run", LimitWriteActions: intPtr(1)}},
+			},
+			{
+				RuleID: "tag-writes",
+				Kind:   "tag",
+				Match:  Match{ToolName: &NameMatch{Glob: []string{"write_*"}}},
+				Effect: Effect{Tag: &TagEffect{AddRiskClass: []string{"write_like"}}},
+			},
+		},
+	}
+
+	if d := bundle.Decide("s", "write_file", "h"); d.Action != event.DecisionAllow {
+		t.Fatalf("first write: expected ALLOW, got %s", d.Action)
+	}
+	if d := bundle.Decide("s", "write_file", "h"); d.Action != event.DecisionBlock {
+		t.Fatalf("expected the second write blocked by a budget listed before its tag rule, got %s", d.Action)
+	}
+	if d := bundle.Decide("s", "read_file", "h"); d.Action != event.DecisionAllow {
+		t.Fatalf("expected reads to stay allowed, got %s", d.Action)
+	}
+}
+
 // =============================================================================
 // Rate Limiting Tests (POL-004)
 // =============================================================================
@@ -334,6 +509,44 @@ func TestBreaker_TripsOnRepeatThreshold(t *testing.T) {
 	}
 }
 
+func TestBreaker_TerminateRunCarriesTerminateCode(t *testing.T) {
+	bundle := &Bundle{
+		Mode: event.RunModeGuardrails,
+		Rules: []Rule{
+			{
+				RuleID: "breaker-terminate",
+				Kind:   "breaker",
+				Match: Match{
+					ToolName: &NameMatch{Glob: []string{"loop_tool"}},
+				},
+				Effect: Effect{
+					Breaker: &BreakerEffect{
+						Scope:           "tool",
+						RepeatThreshold: 1,
+						RepeatWindowMS:  10000,
+						OnTrip:          "TERMINATE_RUN",
+						TerminateCode:   "RUNAWAY_LOOP",
+					},
+				},
+			},
+		},
+	}
+
+	d := bundle.Decide("s", "loop_tool", "h")
+	if d.Action != event.DecisionTerminateRun {
+		t.Fatalf("expected TERMINATE_RUN, got %s", d.Action)
+	}
+	if d.Terminate == nil {
+		t.Fatal("expected terminate detail on TERMINATE_RUN decision")
+	}
+	if d.Terminate.TerminateCode != "RUNAWAY_LOOP" {
+		t.Errorf("expected terminate_code RUNAWAY_LOOP, got %q", d.Terminate.TerminateCode)
+	}
+	if d.Terminate.TerminateMessage == "" {
+		t.Error("expected non-empty terminate_message")
+	}
+}
+
 func TestBreaker_StatePersistedAcrossCalls(t *testing.T) {
 	bundle := Bundle{
 		Mode: event.RunModeGuardrails,
@@ -614,3 +827,29 @@ func TestJSONParsing_RateLimitEffect(t *testing.T) {
 func intPtr(i int) *int {
 	return &i
 }
+
+func TestDecide_TimeoutFromFirstMatchingRule(t *testing.T) {
+	bundle := &Bundle{
+		Mode: event.RunModeGuardrails,
+		Rules: []Rule{
+			{
+				RuleID: "tag-slow",
+				Kind:   "tag",
+				Match:  Match{ToolName: &NameMatch{Glob: []string{"slow_*"}}},
+				Effect: Effect{Tag: &TagEffect{AddRiskClass: []string{"slow"}}, TimeoutMS: 250},
+			},
+			{
+				RuleID: "allow-all",
+				Kind:   "allow",
+				Effect: Effect{Action: event.DecisionAllow, TimeoutMS: 5000},
+			},
+		},
+	}
+
+	if d := bundle.Decide("s", "slow_query", "h"); d.TimeoutMS != 250 {
+		t.Errorf("expected timeout 250ms from first matching rule, got %d", d.TimeoutMS)
+	}
+	if d := bundle.Decide("s", "other", "h"); d.TimeoutMS != 5000 {
+		t.Errorf("expected timeout 5000ms from allow rule, got %d", d.TimeoutMS)
+	}
+}
@@ -0,0 +1,251 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/canonical"
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+// DefaultTestStart is the virtual clock's start for cases without a start.
+var DefaultTestStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// TestFile is a set of policy test cases (`sub policy test`).
+type TestFile struct {
+	Cases []TestCase `json:"cases"`
+}
+
+// TestCase is a sequence of calls decided by one fresh bundle, so budgets,
+// rate limits, dedupe and breakers carry from call to call.
+type TestCase struct {
+	Name     string        `json:"name"`
+	Start    string        `json:"start,omitempty"`    // RFC 3339; defaults to DefaultTestStart
+	Identity *TestIdentity `json:"identity,omitempty"` // Default for every call
+	Calls    []TestCall    `json:"calls"`
+}
+
+// TestIdentity is the identity and workload a call is decided for.
+type TestIdentity struct {
+	Env      string           `json:"env,omitempty"`
+	AgentID  string           `json:"agent_id,omitempty"`
+	Client   string           `json:"client,omitempty"`
+	Workload *WorkloadContext `json:"workload,omitempty"`
+}
+
+// TestCall is one call and what the bundle must decide for it.
+type TestCall struct {
+	Server   string         `json:"server"`
+	Tool     string         `json:"tool"`
+	Args     map[string]any `json:"args,omitempty"`
+	Identity *TestIdentity  `json:"identity,omitempty"` // Overrides the case identity
+	// At is the virtual time of the call: an offset from the case start
+	// ("1500ms", "2m") or an RFC 3339 time. Omitted, the clock stays where
+	// the previous call left it.
+	At      string       `json:"at,omitempty"`
+	Outcome *TestOutcome `json:"outcome,omitempty"`
+	Expect  TestExpect   `json:"expect"`
+}
+
+// TestOutcome is how an allowed call ends; it feeds outcome breakers.
+type TestOutcome struct {
+	Status    event.CallStatus `json:"status"`
+	LatencyMS int              `json:"latency_ms,omitempty"`
+}
+
+// TestExpect lists the checked parts of a decision; empty fields are not
+// checked. RuleID "" expects no rule.
+type TestExpect struct {
+	Decision   event.DecisionAction `json:"decision,omitempty"`
+	RuleID     *string              `json:"rule_id,omitempty"`
+	ReasonCode string               `json:"reason_code,omitempty"`
+	Hint       string               `json:"hint,omitempty"` // Substring of hint_text
+	HintKind   event.HintKind       `json:"hint_kind,omitempty"`
+}
+
+// TestReport is the result of RunTests.
+type TestReport struct {
+	Passed  int          `json:"passed"`
+	Failed  int          `json:"failed"`
+	Results []TestResult `json:"results"`
+}
+
+// TestResult is the result of one case.
+type TestResult struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Failures []TestFailure `json:"failures,omitempty"`
+}
+
+// TestFailure is one mismatch; Call is the 1-based call index, 0 for
+// problems with the case itself.
+type TestFailure struct {
+	Call  int    `json:"call"`
+	Field string `json:"field"`
+	Want  string `json:"want,omitempty"`
+	Got   string `json:"got"`
+}
+
+// ParseTestFile parses a JSON or YAML test case file.
+func ParseTestFile(data []byte) (TestFile, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return TestFile{}, fmt.Errorf("empty test file")
+	}
+	raw, err := parsePolicyData(data)
+	if err != nil {
+		return TestFile{}, err
+	}
+
+	// Args decode as a shim decodes them: numbers become float64.
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return TestFile{}, err
+	}
+	var file TestFile
+	if err := json.Unmarshal(encoded, &file); err != nil {
+		return TestFile{}, err
+	}
+	if len(file.Cases) == 0 {
+		return TestFile{}, fmt.Errorf("test file has no cases")
+	}
+	return file, nil
+}
+
+// RunTests runs every case against its own compiled copy of spec.
+func RunTests(spec BundleSpec, file TestFile) (TestReport, error) {
+	report := TestReport{Results: []TestResult{}}
+	for i, tc := range file.Cases {
+		compiled, err := CompileBundle(spec)
+		if err != nil {
+			return report, err
+		}
+		result := runTestCase(compiled.Bundle, tc)
+		if result.Name == "" {
+			result.Name = fmt.Sprintf("case_%d", i+1)
+		}
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+func runTestCase(bundle *Bundle, tc TestCase) TestResult {
+	result := TestResult{Name: tc.Name}
+	fail := func(call int, field, want, got string) {
+		result.Failures = append(result.Failures, TestFailure{Call: call, Field: field, Want: want, Got: got})
+	}
+
+	start := DefaultTestStart
+	if tc.Start != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, tc.Start)
+		if err != nil {
+			fail(0, "start", "RFC 3339 time", tc.Start)
+			return result
+		}
+		start = parsed
+	}
+
+	now := start
+	for i, call := range tc.Calls {
+		n := i + 1
+		if call.At != "" {
+			at, err := testCallTime(start, call.At)
+			if err != nil {
+				fail(n, "at", "offset or RFC 3339 time", call.At)
+				continue
+			}
+			now = at
+		}
+
+		ctx := DecisionContext{
+			ServerName: call.Server,
+			ToolName:   call.Tool,
+			Args:       call.Args,
+			Target:     testTarget(tc.Identity, call.Identity),
+			Now:        now,
+		}
+		if call.Args != nil {
+			if hash, err := canonical.ArgsHash(call.Args); err == nil {
+				ctx.ArgsHash = hash
+			}
+		}
+
+		decision := bundle.DecideWithContext(ctx)
+		checkDecision(n, call.Expect, decision, fail)
+
+		if call.Outcome != nil && (decision.Action == event.DecisionAllow || bundle.Mode == event.RunModeObserve) {
+			latency := time.Duration(call.Outcome.LatencyMS) * time.Millisecond
+			ctx.Now = now.Add(latency)
+			bundle.RecordOutcome(ctx, Outcome{Status: call.Outcome.Status, Latency: latency})
+		}
+	}
+
+	result.Passed = len(result.Failures) == 0
+	return result
+}
+
+func checkDecision(call int, expect TestExpect, decision Decision, fail func(call int, field, want, got string)) {
+	if expect.Decision != "" && !strings.EqualFold(string(expect.Decision), string(decision.Action)) {
+		fail(call, "decision", string(expect.Decision), string(decision.Action))
+	}
+	if expect.RuleID != nil {
+		got := ""
+		if decision.RuleID != nil {
+			got = *decision.RuleID
+		}
+		if got != *expect.RuleID {
+			fail(call, "rule_id", *expect.RuleID, got)
+		}
+	}
+	if expect.ReasonCode != "" && expect.ReasonCode != decision.ReasonCode {
+		fail(call, "reason_code", expect.ReasonCode, decision.ReasonCode)
+	}
+	hintText, hintKind := "", event.HintKind("")
+	if decision.Hint != nil {
+		hintText, hintKind = decision.Hint.HintText, decision.Hint.HintKind
+	}
+	if expect.Hint != "" && !strings.Contains(hintText, expect.Hint) {
+		fail(call, "hint", expect.Hint, hintText)
+	}
+	if expect.HintKind != "" && expect.HintKind != hintKind {
+		fail(call, "hint_kind", string(expect.HintKind), string(hintKind))
+	}
+}
+
+// testCallTime resolves a call's at: an offset from start or an RFC 3339 time.
+func testCallTime(start time.Time, at string) (time.Time, error) {
+	if offset, err := time.ParseDuration(at); err == nil {
+		return start.Add(offset), nil
+	}
+	return time.Parse(time.RFC3339Nano, at)
+}
+
+// testTarget applies a call's identity over the case's.
+func testTarget(base, override *TestIdentity) SelectorTarget {
+	var target SelectorTarget
+	for _, identity := range []*TestIdentity{base, override} {
+		if identity == nil {
+			continue
+		}
+		if identity.Env != "" {
+			target.Env = identity.Env
+		}
+		if identity.AgentID != "" {
+			target.AgentID = identity.AgentID
+		}
+		if identity.Client != "" {
+			target.Client = identity.Client
+		}
+		if identity.Workload != nil {
+			target.Workload = *identity.Workload
+		}
+	}
+	return target
+}
@@ -0,0 +1,144 @@
+package policy
+
+import (
+	"testing"
+)
+
+const testBundleYAML = `policy_id: tests
+version: "1"
+mode: control
+rules:
+  - rule_id: no-drop
+    kind: deny
+    match:
+      tool_name:
+        glob: ["drop_*"]
+    effect:
+      message: Dropping tables is not allowed
+  - rule_id: query-rate
+    kind: rate_limit
+    match:
+      tool_name:
+        glob: ["query"]
+    effect:
+      rate_limit:
+        scope: tool
+        capacity: 1
+        refill_tokens: 1
+        refill_period_ms: 1000
+        on_limit: THROTTLE
+  - rule_id: prod-only-read
+    kind: deny
+    match:
+      tool_name:
+        glob: ["write"]
+    when: identity.env == "prod"
+`
+
+func TestRunTests_VirtualClockAndExpectations(t *testing.T) {
+	spec, err := ParseBundle([]byte(testBundleYAML))
+	if err != nil {
+		t.Fatalf("ParseBundle: %v", err)
+	}
+	file, err := ParseTestFile([]byte(`cases:
+  - name: rate limit refills on the virtual clock
+    calls:
+      - server: db
+        tool: query
+        expect:
+          decision: ALLOW
+          rule_id: ""
+      - server: db
+        tool: query
+        at: 500ms
+        expect:
+          decision: THROTTLE
+          rule_id: query-rate
+      - server: db
+        tool: query
+        at: 1500ms
+        expect:
+          decision: ALLOW
+  - name: deny carries its hint
+    calls:
+      - server: db
+        tool: drop_table
+        args: {table: users, cascade: 1}
+        expect:
+          decision: REJECT_WITH_HINT
+          rule_id: no-drop
+          hint: not allowed
+  - name: identity selects rules
+    identity:
+      env: dev
+    calls:
+      - server: db
+        tool: write
+        expect:
+          decision: ALLOW
+      - server: db
+        tool: write
+        identity:
+          env: prod
+        expect:
+          decision: ALLOW
+          rule_id: prod-only-read
+`))
+	if err != nil {
+		t.Fatalf("ParseTestFile: %v", err)
+	}
+	if got := file.Cases[1].Calls[0].Args["cascade"]; got != float64(1) {
+		t.Fatalf("expected args numbers to decode as float64, got %T", got)
+	}
+
+	report, err := RunTests(spec, file)
+	if err != nil {
+		t.Fatalf("RunTests: %v", err)
+	}
+	if report.Passed != 2 || report.Failed != 1 {
+		t.Fatalf("expected 2 passed and 1 failed, got %+v", report)
+	}
+
+	failed := report.Results[2]
+	if failed.Passed || len(failed.Failures) != 1 {
+		t.Fatalf("expected one failure in %q, got %+v", failed.Name, failed.Failures)
+	}
+	failure := failed.Failures[0]
+	if failure.Call != 2 || failure.Field != "decision" || failure.Want != "ALLOW" || failure.Got != "REJECT_WITH_HINT" {
+		t.Fatalf("unexpected failure: %+v", failure)
+	}
+}
+
+func TestRunTests_FreshStatePerCase(t *testing.T) {
+	spec, err := ParseBundle([]byte(testBundleYAML))
+	if err != nil {
+		t.Fatalf("ParseBundle: %v", err)
+	}
+	call := TestCall{Server: "db", Tool: "query", Expect: TestExpect{Decision: "ALLOW"}}
+	file := TestFile{Cases: []TestCase{
+		{Name: "first", Calls: []TestCall{call}},
+		{Name: "second", Calls: []TestCall{call}},
+		{Calls: []TestCall{{Server: "db", Tool: "query", At: "soon"}}},
+	}}
+
+	report, err := RunTests(spec, file)
+	if err != nil {
+		t.Fatalf("RunTests: %v", err)
+	}
+	if !report.Results[0].Passed || !report.Results[1].Passed {
+		t.Fatalf("expected each case to start with a full bucket, got %+v", report.Results)
+	}
+	last := report.Results[2]
+	if last.Name != "case_3" || last.Passed || last.Failures[0].Field != "at" {
+		t.Fatalf("expected an unnamed case to fail on its at, got %+v", last)
+	}
+}
+
+func TestParseTestFile_RequiresCases(t *testing.T) {
+	if _, err := ParseTestFile([]byte(`{"cases": []}`)); err == nil {
+		t.Fatal("expected an error for a file without cases")
+	}
+	if _, err := ParseTestFile([]byte("  \n")); err == nil {
+		t.Fatal("expected an error for an empty file")
+	}
+}
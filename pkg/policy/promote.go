@@ -0,0 +1,172 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+	"github.com/peakyragnar/subluminal/pkg/expr"
+)
+
+// Promotion is a rule added to one run by `sub policy promote`. Promotions
+// are kept in the run's durable state, so every shim of the run sees them,
+// and are evaluated ahead of the bundle's rules.
+type Promotion struct {
+	CallID    string    `json:"call_id,omitempty"` // The blocked call the rule unblocks
+	Rule      Rule      `json:"rule"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PromotedRuleID returns the rule_id of the rule promoted from callID.
+func PromotedRuleID(callID string) string {
+	return "promoted-" + callID
+}
+
+// PromoteRule returns an allow rule for serverName/toolName. With non-nil
+// args the rule only matches calls with exactly those arguments; otherwise
+// it matches any arguments.
+func PromoteRule(ruleID, serverName, toolName string, args map[string]any) Rule {
+	rule := Rule{
+		RuleID:   ruleID,
+		Kind:     "allow",
+		Severity: event.SeverityInfo,
+		Match: Match{
+			ServerName: &NameMatch{Glob: []string{escapeGlob(serverName)}},
+			ToolName:   &NameMatch{Glob: []string{escapeGlob(toolName)}},
+		},
+		Effect: Effect{
+			Action:     event.DecisionAllow,
+			ReasonCode: "PROMOTED_ALLOW",
+			Message:    "Allowed by a promoted rule",
+		},
+	}
+	if args != nil {
+		if len(args) > 0 {
+			rule.Match.Args = &ArgsMatch{KeyEquals: args}
+		}
+		rule.When = fmt.Sprintf("size(args) == %d", len(args))
+	}
+	return rule
+}
+
+// escapeGlob quotes the path.Match metacharacters in name.
+func escapeGlob(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// AddPromotion stores p in the run's state, replacing any promotion with the
+// same rule_id.
+func AddPromotion(store StateStore, p Promotion) error {
+	if strings.TrimSpace(p.Rule.RuleID) == "" {
+		return errors.New("promoted rule needs a rule_id")
+	}
+	if actionFromKind(p.Rule.Kind) != event.DecisionAllow {
+		return fmt.Errorf("promoted rule %s must be an allow rule", p.Rule.RuleID)
+	}
+	if _, err := compilePromotion(p); err != nil {
+		return err
+	}
+	return store.Update(func(state *StateSnapshot) error {
+		for i, existing := range state.Promotions {
+			if existing.Rule.RuleID == p.Rule.RuleID {
+				state.Promotions[i] = p
+				return nil
+			}
+		}
+		state.Promotions = append(state.Promotions, p)
+		return nil
+	})
+}
+
+// compilePromotion compiles the promoted rule's when expression, if any.
+func compilePromotion(p Promotion) (*expr.Program, error) {
+	if strings.TrimSpace(p.Rule.When) == "" {
+		return nil, nil
+	}
+	prog, err := compileWhenExpr(p.Rule.When)
+	if err != nil {
+		return nil, fmt.Errorf("promoted rule %s: when: %w", p.Rule.RuleID, err)
+	}
+	return prog, nil
+}
+
+// setPromotions replaces the in-memory promotions. A promotion whose when
+// expression does not compile is dropped.
+func (b *Bundle) setPromotions(promotions []Promotion) {
+	kept := make([]Promotion, 0, len(promotions))
+	programs := make([]*expr.Program, 0, len(promotions))
+	for _, p := range promotions {
+		prog, err := compilePromotion(p)
+		if err != nil {
+			debugLog("setPromotions: %v", err)
+			continue
+		}
+		kept = append(kept, p)
+		programs = append(programs, prog)
+	}
+
+	b.promoMu.Lock()
+	b.promotions = kept
+	b.promoWhen = programs
+	b.promoMu.Unlock()
+}
+
+// currentPromotions returns a copy of the in-memory promotions.
+func (b *Bundle) currentPromotions() []Promotion {
+	b.promoMu.Lock()
+	defer b.promoMu.Unlock()
+	return append([]Promotion(nil), b.promotions...)
+}
+
+// errReadOnly aborts a state store update that only reads.
+var errReadOnly = errors.New("read only")
+
+// refreshPromotions loads the run's promotions for a bundle without stateful
+// rules; decideDurable loads them along with the rest of the state. On a
+// store error the last promotions seen stay in effect.
+func (b *Bundle) refreshPromotions() {
+	err := b.stateStore.Update(func(state *StateSnapshot) error {
+		b.setPromotions(state.Promotions)
+		return errReadOnly
+	})
+	if err != nil && !errors.Is(err, errReadOnly) {
+		debugLog("refreshPromotions: state store error: %v", err)
+	}
+}
+
+// promotedDecision returns ALLOW if an enabled promoted rule matches ctx,
+// or nil.
+func (b *Bundle) promotedDecision(ctx DecisionContext) *Decision {
+	b.promoMu.Lock()
+	defer b.promoMu.Unlock()
+
+	for i, p := range b.promotions {
+		rule := p.Rule
+		if !ruleEnabled(rule.Enabled) ||
+			!b.matchName(rule.Match.ServerName, ctx.ServerName) ||
+			!b.matchName(rule.Match.ToolName, ctx.ToolName) ||
+			!b.matchArgs(rule.Match.Args, ctx.Args) {
+			continue
+		}
+		if prog := b.promoWhen[i]; prog != nil {
+			matched, err := prog.EvalBool(whenVars(ctx))
+			if err != nil || !matched {
+				continue
+			}
+		}
+
+		debugLog("  Matched promoted rule id=%s", rule.RuleID)
+		return buildDecision(rule, event.DecisionAllow, "PROMOTED_ALLOW", "Allowed by a promoted rule")
+	}
+	return nil
+}
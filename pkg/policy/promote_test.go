@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+func denyPushBundle() *Bundle {
+	return &Bundle{
+		Mode: event.RunModeControl,
+		Rules: []Rule{
+			{
+				RuleID: "no-push",
+				Kind:   "deny",
+				Match:  Match{ToolName: &NameMatch{Glob: []string{"push"}}},
+			},
+		},
+	}
+}
+
+func TestPromotion_AllowsExactCallForRun(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStateStore(dir, "run-1")
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	bundle := denyPushBundle()
+	bundle.SetStateStore(store)
+
+	blocked := DecisionContext{ServerName: "git", ToolName: "push", Args: map[string]any{"branch": "main"}}
+	if d := bundle.DecideWithContext(blocked); d.Action != event.DecisionRejectWithHint {
+		t.Fatalf("expected REJECT_WITH_HINT before promotion, got %s", d.Action)
+	}
+
+	rule := PromoteRule(PromotedRuleID("call-1"), "git", "push", map[string]any{"branch": "main"})
+	if err := AddPromotion(store, Promotion{CallID: "call-1", Rule: rule}); err != nil {
+		t.Fatalf("AddPromotion: %v", err)
+	}
+
+	d := bundle.DecideWithContext(blocked)
+	if d.Action != event.DecisionAllow || d.ReasonCode != "PROMOTED_ALLOW" || d.RuleID == nil || *d.RuleID != "promoted-call-1" {
+		t.Fatalf("expected promoted ALLOW, got %+v", d)
+	}
+
+	// Other args, extra args and other tools stay blocked.
+	for _, ctx := range []DecisionContext{
+		{ServerName: "git", ToolName: "push", Args: map[string]any{"branch": "release"}},
+		{ServerName: "git", ToolName: "push", Args: map[string]any{"branch": "main", "force": true}},
+		{ServerName: "other", ToolName: "push", Args: map[string]any{"branch": "main"}},
+	} {
+		if d := bundle.DecideWithContext(ctx); d.Action != event.DecisionRejectWithHint {
+			t.Errorf("%s/%s %v: expected REJECT_WITH_HINT, got %s", ctx.ServerName, ctx.ToolName, ctx.Args, d.Action)
+		}
+	}
+
+	// Another run's shim does not see the promotion.
+	otherStore, err := NewFileStateStore(dir, "run-2")
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	other := denyPushBundle()
+	other.SetStateStore(otherStore)
+	if d := other.DecideWithContext(blocked); d.Action != event.DecisionRejectWithHint {
+		t.Fatalf("expected run-2 to stay blocked, got %s", d.Action)
+	}
+}
+
+func TestPromotion_SurvivesDurableDecisions(t *testing.T) {
+	store := &MemoryStateStore{}
+	bundle := denyPushBundle()
+	limit := 10
+	bundle.Rules = append(bundle.Rules, Rule{
+		RuleID: "run-budget",
+		Kind:   "budget",
+		Effect: Effect{Budget: &BudgetEffect{Scope: "run", LimitCalls: &limit, OnExceed: event.DecisionBlock}},
+	})
+	bundle.SetStateStore(store)
+
+	rule := PromoteRule(PromotedRuleID("call-2"), "git", "push", nil)
+	if err := AddPromotion(store, Promotion{CallID: "call-2", Rule: rule}); err != nil {
+		t.Fatalf("AddPromotion: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		d := bundle.DecideWithContext(DecisionContext{ServerName: "git", ToolName: "push", Args: map[string]any{"force": true}})
+		if d.Action != event.DecisionAllow {
+			t.Fatalf("call %d: expected promoted ALLOW, got %s", i, d.Action)
+		}
+	}
+
+	var state StateSnapshot
+	store.Update(func(s *StateSnapshot) error {
+		state = *s
+		return nil
+	})
+	if len(state.Promotions) != 1 || state.Budgets["run-budget|run"] != 2 {
+		t.Fatalf("expected the promotion kept and 2 calls counted, got %+v", state)
+	}
+}
+
+func TestPromotion_RejectsNonAllowRules(t *testing.T) {
+	rule := PromoteRule("p", "git", "push", nil)
+	rule.Kind = "deny"
+	if err := AddPromotion(&MemoryStateStore{}, Promotion{Rule: rule}); err == nil {
+		t.Fatal("expected an error for a deny rule")
+	}
+}
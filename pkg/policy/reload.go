@@ -0,0 +1,206 @@
+package policy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+// DefaultReloadInterval is how often WatchFile polls the policy file.
+const DefaultReloadInterval = time.Second
+
+// FilePathFromEnv returns the SUB_POLICY_FILE path, or "" if unset.
+func FilePathFromEnv() string {
+	return strings.TrimSpace(os.Getenv(policyEnvFile))
+}
+
+// LoadFile parses and compiles a YAML or JSON policy bundle or layer set
+// from disk.
+func LoadFile(path string) (*Bundle, error) {
+	return loadPolicy(path, os.ReadFile)
+}
+
+// InheritState copies budget, rate-limit, breaker and dedupe state from prev
+// for every rule whose rule_id exists in both bundles. Rules without a
+// rule_id, or whose rule_id is new, start from empty state.
+// Rules promoted into the run carry over as they are. Layer sets carry
+// state between layers of the same name.
+// Returns the rule_ids whose state was carried over.
+func (b *Bundle) InheritState(prev *Bundle) []string {
+	if prev == nil {
+		return nil
+	}
+	if len(b.layers) > 0 || len(prev.layers) > 0 {
+		return b.inheritLayers(prev)
+	}
+	b.ensureState()
+	b.setPromotions(prev.currentPromotions())
+
+	prevIDs := map[string]struct{}{}
+	for _, rule := range prev.Rules {
+		if id := strings.TrimSpace(rule.RuleID); id != "" {
+			prevIDs[id] = struct{}{}
+		}
+	}
+
+	var carried []string
+	for _, rule := range b.Rules {
+		id := strings.TrimSpace(rule.RuleID)
+		if id == "" {
+			continue
+		}
+		if _, ok := prevIDs[id]; !ok {
+			continue
+		}
+		carried = append(carried, id)
+	}
+	if len(carried) == 0 {
+		return nil
+	}
+
+	keep := func(key string) bool {
+		for _, id := range carried {
+			if strings.HasPrefix(key, id+"|") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if prev.budgets != nil {
+		prev.budgets.mu.Lock()
+		b.budgets.mu.Lock()
+		for key, count := range prev.budgets.calls {
+			if keep(key) {
+				b.budgets.calls[key] = count
+			}
+		}
+		b.budgets.mu.Unlock()
+		prev.budgets.mu.Unlock()
+	}
+
+	if prev.rateLimit != nil {
+		prev.rateLimit.mu.Lock()
+		b.rateLimit.mu.Lock()
+		for key, bucket := range prev.rateLimit.buckets {
+			if keep(key) && bucket != nil {
+				copied := *bucket
+				b.rateLimit.buckets[key] = &copied
+			}
+		}
+		b.rateLimit.mu.Unlock()
+		prev.rateLimit.mu.Unlock()
+	}
+
+	if prev.dedupe != nil {
+		prev.dedupe.mu.Lock()
+		b.dedupe.mu.Lock()
+		for key, seen := range prev.dedupe.entries {
+			if keep(key) {
+				b.dedupe.entries[key] = seen
+			}
+		}
+		b.dedupe.mu.Unlock()
+		prev.dedupe.mu.Unlock()
+	}
+
+	prev.breakerMu.Lock()
+	b.breakerMu.Lock()
+	for key, hits := range prev.breakerState {
+		if keep(key) {
+			b.breakerState[key] = append([]time.Time(nil), hits...)
+		}
+	}
+	for key, circuit := range prev.circuits {
+		if keep(key) && circuit != nil {
+			copied := *circuit
+			b.circuits[key] = &copied
+		}
+	}
+	b.breakerMu.Unlock()
+	prev.breakerMu.Unlock()
+
+	return carried
+}
+
+// WatchFile polls path every interval and calls onChange whenever the file
+// content changes; for a layer set, whenever any layer file changes too,
+// and whenever a signature changes.
+// onChange receives the compiled bundle, or the load error if the new
+// content does not parse. With SUB_POLICY_TRUSTED_KEYS set, content that
+// fails signature verification is reported as a *VerifyError.
+// Returns when done is closed.
+func WatchFile(path string, interval time.Duration, done <-chan struct{}, onChange func(*Bundle, error)) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	t, trustErr := trustFromEnv()
+
+	// The first successful read is always reported; callers compare
+	// policy_hash to skip content they already loaded.
+	var lastSum []byte
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		files, err := readPolicyFiles(path)
+		if err != nil {
+			// Editors often replace files via rename; retry on the next tick.
+			debugLog("WatchFile: read %s: %v", path, err)
+			continue
+		}
+		sum := policyFilesSum(files)
+		if bytes.Equal(sum, lastSum) {
+			continue
+		}
+		lastSum = sum
+
+		if trustErr != nil {
+			onChange(nil, &VerifyError{File: path, Result: event.VerifyResultError, Err: trustErr})
+			continue
+		}
+		bundle, err := loadVerified(path, t, func(name string) ([]byte, error) {
+			if data := files[name]; data != nil {
+				return data, nil
+			}
+			return nil, fmt.Errorf("read %s: %w", name, os.ErrNotExist)
+		})
+		if err != nil {
+			onChange(nil, err)
+			continue
+		}
+		onChange(bundle, nil)
+	}
+}
+
+// policyFilesSum hashes the names and contents of files.
+func policyFilesSum(files map[string][]byte) []byte {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(files[name]))
+		if files[name] == nil {
+			h.Write([]byte("missing"))
+		}
+		h.Write(files[name])
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,220 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+const reloadBundleYAML = `policy_id: reload-test
+version: 1.0.0
+mode: guardrails
+rules:
+  - rule_id: tool-budget
+    kind: budget
+    match:
+      tool_name:
+        glob: ["budget_tool"]
+    effect:
+      budget:
+        scope: tool
+        limit_calls: 2
+        on_exceed: BLOCK
+`
+
+func TestLoadFromEnv_PolicyFileTakesPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(reloadBundleYAML), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+
+	t.Setenv("SUB_POLICY_FILE", path)
+	t.Setenv("SUB_POLICY_JSON", `{"mode":"observe","policy_id":"inline"}`)
+
+	bundle := LoadFromEnv()
+	if bundle.Info.PolicyID != "reload-test" {
+		t.Fatalf("expected policy from file, got %q", bundle.Info.PolicyID)
+	}
+	if bundle.Mode != event.RunModeGuardrails {
+		t.Fatalf("expected guardrails mode, got %s", bundle.Mode)
+	}
+	if bundle.Info.PolicyHash == "" || bundle.Info.PolicyHash == "none" {
+		t.Fatalf("expected computed policy hash, got %q", bundle.Info.PolicyHash)
+	}
+}
+
+func TestLoadFromEnv_BrokenPolicyFileFailsClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("policy_id: broken\nmode: guardrails\nrules: oops\n"), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	t.Setenv("SUB_POLICY_FILE", path)
+
+	bundle := LoadFromEnv()
+	failure := bundle.LoadFailure
+	if failure == nil || failure.Success || failure.Source != path || failure.Error == "" {
+		t.Fatalf("expected a load failure for %s, got %+v", path, failure)
+	}
+	if failure.Severity != event.SeverityWarn {
+		t.Fatalf("expected warn severity, got %q", failure.Severity)
+	}
+	decision := bundle.Decide("server", "any_tool", "hash")
+	if decision.Action != event.DecisionBlock || decision.ReasonCode != "POLICY_LOAD_FAILED" {
+		t.Fatalf("expected BLOCK with POLICY_LOAD_FAILED, got %s %s", decision.Action, decision.ReasonCode)
+	}
+}
+
+func TestLoadFromEnv_BrokenObservePolicyStaysObserve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("policy_id: broken\nmode: observe\nrules: oops\n"), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	t.Setenv("SUB_POLICY_FILE", path)
+
+	bundle := LoadFromEnv()
+	if bundle.LoadFailure == nil {
+		t.Fatal("expected a load failure")
+	}
+	if bundle.Mode != event.RunModeObserve {
+		t.Fatalf("expected observe mode, got %s", bundle.Mode)
+	}
+	if decision := bundle.Decide("server", "any_tool", "hash"); decision.Action != event.DecisionAllow {
+		t.Fatalf("expected ALLOW, got %s", decision.Action)
+	}
+}
+
+func TestLoadFromEnv_InvalidPolicyJSONFailsClosed(t *testing.T) {
+	t.Setenv("SUB_POLICY_JSON", `{"mode":"control","rules":[`)
+
+	bundle := LoadFromEnv()
+	if bundle.LoadFailure == nil || bundle.LoadFailure.Source != policyEnvJSON {
+		t.Fatalf("expected a load failure for %s, got %+v", policyEnvJSON, bundle.LoadFailure)
+	}
+	if decision := bundle.Decide("server", "any_tool", "hash"); decision.Action != event.DecisionBlock {
+		t.Fatalf("expected BLOCK, got %s", decision.Action)
+	}
+}
+
+func TestInheritState_CarriesStateForUnchangedRuleIDs(t *testing.T) {
+	spec, err := ParseBundle([]byte(reloadBundleYAML))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	oldCompiled, err := CompileBundle(spec)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	old := oldCompiled.Bundle
+
+	// Spend the whole budget on the old bundle.
+	for i := 0; i < 2; i++ {
+		if d := old.Decide("s", "budget_tool", "h"); d.Action != event.DecisionAllow {
+			t.Fatalf("call %d: expected ALLOW, got %s", i+1, d.Action)
+		}
+	}
+
+	// Same rule_id, new version: state carries over.
+	spec.Version = "1.0.1"
+	nextCompiled, err := CompileBundle(spec)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	next := nextCompiled.Bundle
+	carried := next.InheritState(old)
+	if len(carried) != 1 || carried[0] != "tool-budget" {
+		t.Fatalf("expected tool-budget carried, got %v", carried)
+	}
+	if d := next.Decide("s", "budget_tool", "h"); d.Action != event.DecisionBlock {
+		t.Fatalf("expected BLOCK after reload, got %s", d.Action)
+	}
+
+	// Renamed rule: state resets.
+	spec.Rules = append([]Rule(nil), spec.Rules...)
+	spec.Rules[0].RuleID = "tool-budget-v2"
+	renamedCompiled, err := CompileBundle(spec)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	renamed := renamedCompiled.Bundle
+	if carried := renamed.InheritState(next); len(carried) != 0 {
+		t.Fatalf("expected no carried rules, got %v", carried)
+	}
+	if d := renamed.Decide("s", "budget_tool", "h"); d.Action != event.DecisionAllow {
+		t.Fatalf("expected ALLOW with fresh budget, got %s", d.Action)
+	}
+}
+
+func TestInheritState_CarriesRateLimitAndDedupe(t *testing.T) {
+	rules := []Rule{
+		{
+			RuleID: "rate",
+			Kind:   "rate_limit",
+			Match:  Match{ToolName: &NameMatch{Glob: []string{"rate_tool"}}},
+			Effect: Effect{RateLimit: &RateLimitEffect{
+				Scope:          "tool",
+				Capacity:       1,
+				RefillTokens:   1,
+				RefillPeriodMS: 60000,
+				OnLimit:        event.DecisionThrottle,
+			}},
+		},
+		{
+			RuleID: "dedupe",
+			Kind:   "dedupe",
+			Match:  Match{ToolName: &NameMatch{Glob: []string{"write_tool"}}},
+			Effect: Effect{Dedupe: &DedupeEffect{WindowMS: 60000, OnDuplicate: event.DecisionBlock}},
+		},
+	}
+	old := &Bundle{Mode: event.RunModeGuardrails, Rules: rules}
+	old.Decide("s", "rate_tool", "h1")
+	old.Decide("s", "write_tool", "h2")
+
+	// Reordering rules must not break carry-over.
+	next := &Bundle{Mode: event.RunModeGuardrails, Rules: []Rule{rules[1], rules[0]}}
+	next.InheritState(old)
+
+	if d := next.Decide("s", "rate_tool", "h1"); d.Action != event.DecisionThrottle {
+		t.Fatalf("expected THROTTLE after reload, got %s", d.Action)
+	}
+	if d := next.Decide("s", "write_tool", "h2"); d.Action != event.DecisionBlock {
+		t.Fatalf("expected dedupe BLOCK after reload, got %s", d.Action)
+	}
+}
+
+func TestWatchFile_ReportsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(reloadBundleYAML), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+
+	type result struct {
+		bundle *Bundle
+		err    error
+	}
+	results := make(chan result, 4)
+	done := make(chan struct{})
+	defer close(done)
+	go WatchFile(path, 10*time.Millisecond, done, func(b *Bundle, err error) {
+		results <- result{bundle: b, err: err}
+	})
+
+	first := <-results
+	if first.err != nil || first.bundle.Info.PolicyID != "reload-test" {
+		t.Fatalf("unexpected first load: %+v", first)
+	}
+
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	select {
+	case got := <-results:
+		if got.err == nil {
+			t.Fatal("expected parse error for invalid bundle")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for reload error")
+	}
+}
@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"strings"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+// Restriction describes why a tool is denied regardless of arguments.
+type Restriction struct {
+	RuleID     *string
+	Action     event.DecisionAction
+	ReasonCode string
+	Summary    string
+}
+
+// ToolRestriction reports whether every call to toolName on serverName
+// would be denied for target, independent of arguments and run state.
+// Returns nil if some call could be allowed (or the bundle never enforces).
+//
+// Only allow/deny rules are considered: budgets, rate limits, breakers and
+// dedupe depend on call history. A conditional (args, risk_class or when) ALLOW
+// ahead of the first unconditional deny means the tool stays usable.
+func (b *Bundle) ToolRestriction(serverName, toolName string, target SelectorTarget) *Restriction {
+	if b == nil || b.Mode == event.RunModeObserve {
+		return nil
+	}
+	if len(b.layers) > 0 {
+		return b.layerRestriction(serverName, toolName, target)
+	}
+	if !selectorsMatch(b.Selectors, target) {
+		return nil
+	}
+
+	for _, rule := range b.Rules {
+		if !ruleEnabled(rule.Enabled) {
+			continue
+		}
+		if !b.matchName(rule.Match.ServerName, serverName) || !b.matchName(rule.Match.ToolName, toolName) {
+			continue
+		}
+
+		kind := strings.ToLower(strings.TrimSpace(rule.Kind))
+		if kind == "tag" || kind == "breaker" || isBudgetRule(rule) ||
+			rule.Effect.RateLimit != nil || rule.Effect.Dedupe != nil || rule.Effect.Tag != nil {
+			continue
+		}
+
+		action := rule.Effect.Action
+		if action == "" {
+			action = actionFromKind(kind)
+		}
+		action = b.controlAction(action)
+		if action != event.DecisionAllow && action != event.DecisionBlock && action != event.DecisionRejectWithHint {
+			continue
+		}
+
+		conditional := (rule.Match.Args != nil && !rule.Match.Args.IsZero()) || len(rule.Match.RiskClass) > 0 ||
+			strings.TrimSpace(rule.When) != ""
+		if action == event.DecisionAllow {
+			// Some (or every) call is allowed before any deny applies
+			return nil
+		}
+		if conditional {
+			continue
+		}
+
+		decision := buildDecision(rule, action, defaultReason(action), defaultSummary(action))
+		return &Restriction{
+			RuleID:     decision.RuleID,
+			Action:     decision.Action,
+			ReasonCode: decision.ReasonCode,
+			Summary:    decision.Summary,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+func TestToolRestriction_UnconditionalDenyOnly(t *testing.T) {
+	bundle := &Bundle{
+		Mode: event.RunModeGuardrails,
+		Rules: []Rule{
+			{
+				RuleID: "deny-write-prod",
+				Kind:   "deny",
+				Match: Match{
+					ToolName: &NameMatch{Glob: []string{"write_file"}},
+					Args:     &ArgsMatch{HasKeys: []string{"prod"}},
+				},
+			},
+			{
+				RuleID: "allow-read",
+				Kind:   "allow",
+				Match:  Match{ToolName: &NameMatch{Glob: []string{"read_*"}}},
+			},
+			{
+				RuleID: "deny-rest",
+				Kind:   "deny",
+				Match:  Match{ToolName: &NameMatch{Glob: []string{"*"}}},
+				Effect: Effect{Message: "Only reads are allowed"},
+			},
+		},
+	}
+
+	if r := bundle.ToolRestriction("s", "read_file", SelectorTarget{}); r != nil {
+		t.Fatalf("read_file: expected no restriction, got %+v", r)
+	}
+
+	r := bundle.ToolRestriction("s", "delete_repo", SelectorTarget{})
+	if r == nil {
+		t.Fatal("delete_repo: expected restriction")
+	}
+	if r.RuleID == nil || *r.RuleID != "deny-rest" || r.Action != event.DecisionBlock {
+		t.Fatalf("delete_repo: unexpected restriction %+v", r)
+	}
+
+	// The conditional deny does not apply to every call, but the catch-all does
+	r = bundle.ToolRestriction("s", "write_file", SelectorTarget{})
+	if r == nil || r.RuleID == nil || *r.RuleID != "deny-rest" {
+		t.Fatalf("write_file: expected deny-rest restriction, got %+v", r)
+	}
+
+	bundle.Mode = event.RunModeObserve
+	if r := bundle.ToolRestriction("s", "delete_repo", SelectorTarget{}); r != nil {
+		t.Fatalf("observe mode: expected no restriction, got %+v", r)
+	}
+}
+
+func TestToolRestriction_ConditionalAllowKeepsTool(t *testing.T) {
+	bundle := &Bundle{
+		Mode: event.RunModeGuardrails,
+		Rules: []Rule{
+			{
+				RuleID: "allow-safe-path",
+				Kind:   "allow",
+				Match: Match{
+					ToolName: &NameMatch{Glob: []string{"write_file"}},
+					Args:     &ArgsMatch{HasKeys: []string{"path"}},
+				},
+			},
+			{
+				RuleID: "deny-write",
+				Kind:   "deny",
+				Match:  Match{ToolName: &NameMatch{Glob: []string{"write_file"}}},
+			},
+		},
+	}
+
+	if r := bundle.ToolRestriction("s", "write_file", SelectorTarget{}); r != nil {
+		t.Fatalf("expected no restriction when some calls are allowed, got %+v", r)
+	}
+}
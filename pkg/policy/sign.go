@@ -0,0 +1,401 @@
+package policy
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+const (
+	policyEnvTrustedKeys = "SUB_POLICY_TRUSTED_KEYS"
+	policyEnvUnverified  = "SUB_POLICY_ON_UNVERIFIED"
+)
+
+const signatureAlgorithm = "ed25519"
+
+// DefaultKeyDir returns the default signing key directory.
+func DefaultKeyDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".subluminal", "keys"), nil
+}
+
+// KeyFile is a signing key (<name>.key) or a public key (<name>.pub).
+type KeyFile struct {
+	KeyID      string `json:"key_id"`
+	Algorithm  string `json:"algorithm"`
+	PublicKey  string `json:"public_key"`            // base64
+	PrivateKey string `json:"private_key,omitempty"` // base64 seed; .key files only
+}
+
+// Signature is a detached policy signature, stored as <file>.sig.
+type Signature struct {
+	KeyID     string `json:"key_id"`
+	Algorithm string `json:"algorithm"`
+	Signature string `json:"signature"` // base64 ed25519 signature over the file's bytes
+}
+
+// SignaturePath returns where the detached signature of path lives.
+func SignaturePath(path string) string {
+	return path + ".sig"
+}
+
+// KeyID identifies a public key: the first 8 bytes of its SHA-256, in hex.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// GenerateKey writes a new key pair to <dir>/<name>.key (0600) and
+// <dir>/<name>.pub. Existing keys are never overwritten.
+func GenerateKey(dir, name string) (KeyFile, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return KeyFile{}, fmt.Errorf("invalid key name %q", name)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return KeyFile{}, fmt.Errorf("create key dir: %w", err)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return KeyFile{}, err
+	}
+	public := KeyFile{
+		KeyID:     KeyID(pub),
+		Algorithm: signatureAlgorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+	}
+	private := public
+	private.PrivateKey = base64.StdEncoding.EncodeToString(priv.Seed())
+
+	if err := writeKeyFile(filepath.Join(dir, name+".key"), private, 0o600); err != nil {
+		return KeyFile{}, err
+	}
+	if err := writeKeyFile(filepath.Join(dir, name+".pub"), public, 0o644); err != nil {
+		return KeyFile{}, err
+	}
+	return public, nil
+}
+
+func writeKeyFile(path string, key KeyFile, perm os.FileMode) error {
+	data, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("write key: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write key: %w", err)
+	}
+	return nil
+}
+
+func readKeyFile(path string) (KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return KeyFile{}, err
+	}
+	var key KeyFile
+	if err := json.Unmarshal(data, &key); err != nil {
+		return KeyFile{}, fmt.Errorf("parse key %s: %w", path, err)
+	}
+	if key.Algorithm != signatureAlgorithm {
+		return KeyFile{}, fmt.Errorf("key %s: unsupported algorithm %q", path, key.Algorithm)
+	}
+	return key, nil
+}
+
+// LoadSigningKey reads a .key file.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	key, err := readKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := base64.StdEncoding.DecodeString(key.PrivateKey)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("key %s: no valid private key", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// Sign returns the detached signature of data.
+func Sign(data []byte, key ed25519.PrivateKey) Signature {
+	return Signature{
+		KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+		Algorithm: signatureAlgorithm,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+	}
+}
+
+// SignFile writes the detached signature of path to SignaturePath(path).
+func SignFile(path string, key ed25519.PrivateKey) (Signature, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Signature{}, err
+	}
+	sig := Sign(data, key)
+	encoded, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return Signature{}, err
+	}
+	if err := os.WriteFile(SignaturePath(path), append(encoded, '\n'), 0o644); err != nil {
+		return Signature{}, fmt.Errorf("write signature: %w", err)
+	}
+	return sig, nil
+}
+
+// TrustedKeys are the public keys policy signatures are accepted from,
+// by key_id.
+type TrustedKeys map[string]ed25519.PublicKey
+
+// LoadTrustedKeys reads public keys from .pub files; a directory adds every
+// .pub file in it.
+func LoadTrustedKeys(paths []string) (TrustedKeys, error) {
+	keys := TrustedKeys{}
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		files := []string{path}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			files, err = filepath.Glob(filepath.Join(path, "*.pub"))
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, file := range files {
+			key, err := readKeyFile(file)
+			if err != nil {
+				return nil, err
+			}
+			pub, err := base64.StdEncoding.DecodeString(key.PublicKey)
+			if err != nil || len(pub) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("key %s: no valid public key", file)
+			}
+			keys[KeyID(pub)] = ed25519.PublicKey(pub)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no trusted keys found")
+	}
+	return keys, nil
+}
+
+// VerifyError is a policy file that failed signature verification.
+type VerifyError struct {
+	File   string
+	Result string // One of the event.VerifyResult* failures
+	KeyID  string
+	Err    error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("verify %s: %s: %v", e.File, e.Result, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// Info describes the failure for a policy_verification event.
+func (e *VerifyError) Info(source, fallback string, policy event.PolicyInfo) event.PolicyVerificationInfo {
+	return event.PolicyVerificationInfo{
+		Source:   source,
+		Result:   e.Result,
+		File:     e.File,
+		KeyID:    e.KeyID,
+		Error:    e.Err.Error(),
+		Fallback: fallback,
+		Policy:   policy,
+	}
+}
+
+// Verify checks that sigData is a signature of data by a trusted key and
+// returns that key's id.
+func (k TrustedKeys) Verify(file string, data, sigData []byte) (string, error) {
+	var sig Signature
+	if err := json.Unmarshal(sigData, &sig); err != nil {
+		return "", &VerifyError{File: file, Result: event.VerifyResultBadSignature, Err: fmt.Errorf("parse signature: %w", err)}
+	}
+	if sig.Algorithm != signatureAlgorithm {
+		return "", &VerifyError{File: file, Result: event.VerifyResultBadSignature, KeyID: sig.KeyID,
+			Err: fmt.Errorf("unsupported algorithm %q", sig.Algorithm)}
+	}
+	pub, ok := k[sig.KeyID]
+	if !ok {
+		return "", &VerifyError{File: file, Result: event.VerifyResultUntrustedKey, KeyID: sig.KeyID,
+			Err: errors.New("signing key is not trusted")}
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil || !ed25519.Verify(pub, data, raw) {
+		return "", &VerifyError{File: file, Result: event.VerifyResultBadSignature, KeyID: sig.KeyID,
+			Err: errors.New("signature does not match content")}
+	}
+	return sig.KeyID, nil
+}
+
+// trust is a shim's signature requirement, from SUB_POLICY_TRUSTED_KEYS
+// and SUB_POLICY_ON_UNVERIFIED.
+type trust struct {
+	keys     TrustedKeys
+	failOpen bool
+}
+
+// trustFromEnv returns nil when no trusted keys are configured. If they
+// are configured but cannot be loaded, it returns the trust (so its
+// fallback applies) and the error.
+func trustFromEnv() (*trust, error) {
+	paths := strings.TrimSpace(os.Getenv(policyEnvTrustedKeys))
+	if paths == "" {
+		return nil, nil
+	}
+	t := &trust{
+		failOpen: strings.EqualFold(strings.TrimSpace(os.Getenv(policyEnvUnverified)), event.VerifyFallbackOpen),
+	}
+	keys, err := LoadTrustedKeys(filepath.SplitList(paths))
+	if err != nil {
+		return t, fmt.Errorf("%s: %w", policyEnvTrustedKeys, err)
+	}
+	t.keys = keys
+	return t, nil
+}
+
+// verifiedRead wraps read so that every file must carry a valid signature.
+// The key of the first file read, the policy file itself, goes to keyID.
+func (t *trust) verifiedRead(read func(string) ([]byte, error), keyID *string) func(string) ([]byte, error) {
+	return func(name string) ([]byte, error) {
+		data, err := read(name)
+		if err != nil {
+			return nil, &VerifyError{File: name, Result: event.VerifyResultError, Err: err}
+		}
+		sigData, err := read(SignaturePath(name))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &VerifyError{File: name, Result: event.VerifyResultUnsigned, Err: errors.New("no signature")}
+		}
+		if err != nil {
+			return nil, &VerifyError{File: name, Result: event.VerifyResultError, Err: err}
+		}
+		id, err := t.keys.Verify(name, data, sigData)
+		if err != nil {
+			return nil, err
+		}
+		if *keyID == "" {
+			*keyID = id
+		}
+		return data, nil
+	}
+}
+
+// loadVerified loads path like loadPolicy. With t set, every file must be
+// signed by a trusted key; the bundle records the check, and any failure is
+// a *VerifyError.
+func loadVerified(path string, t *trust, read func(string) ([]byte, error)) (*Bundle, error) {
+	if t == nil {
+		return loadPolicy(path, read)
+	}
+	keyID := ""
+	bundle, err := loadPolicy(path, t.verifiedRead(read, &keyID))
+	if err != nil {
+		var verr *VerifyError
+		if !errors.As(err, &verr) {
+			verr = &VerifyError{File: path, Result: event.VerifyResultError, Err: err}
+		}
+		return nil, verr
+	}
+	bundle.Verification = &event.PolicyVerificationInfo{
+		Source: path,
+		Result: event.VerifyResultVerified,
+		KeyID:  keyID,
+		Policy: bundle.Info,
+	}
+	return bundle, nil
+}
+
+// fallback returns the bundle that replaces a policy failing verification
+// at startup: every call blocked, or with SUB_POLICY_ON_UNVERIFIED=fail_open
+// the default observe bundle.
+func (t *trust) fallback(source string, verr *VerifyError) *Bundle {
+	bundle, fallback := failClosedBundle("unverified", "POLICY_UNVERIFIED", "Policy failed signature verification"), event.VerifyFallbackClosed
+	if t != nil && t.failOpen {
+		bundle, fallback = DefaultBundle(), event.VerifyFallbackOpen
+	}
+	info := verr.Info(source, fallback, bundle.Info)
+	bundle.Verification = &info
+	debugLog("policy verification failed (%s): %v", fallback, verr)
+	return bundle
+}
+
+// failClosedBundle blocks every call with reasonCode. Its policy_id is id
+// and its single rule is policy-<id>.
+func failClosedBundle(id, reasonCode, message string) *Bundle {
+	rules := []Rule{
+		{
+			RuleID:   "policy-" + id,
+			Kind:     "deny",
+			Severity: event.SeverityCritical,
+			Match:    Match{ToolName: &NameMatch{Glob: []string{"*"}}},
+			Effect: Effect{
+				Action:     event.DecisionBlock,
+				ReasonCode: reasonCode,
+				Message:    message,
+			},
+		},
+	}
+	hash, _, err := hashSnapshot(buildSnapshot(id, "0.1.0", string(event.RunModeGuardrails), PolicyDefaults{}, PolicySelectors{}, rules))
+	if err != nil {
+		hash = "none"
+	}
+	bundle := &Bundle{
+		Mode: event.RunModeGuardrails,
+		Info: event.PolicyInfo{
+			PolicyID:      id,
+			PolicyVersion: "0.1.0",
+			PolicyHash:    hash,
+		},
+		Rules: rules,
+	}
+	bundle.ensureState()
+	return bundle
+}
+
+// loadTrustedFromEnv is LoadFromEnv with trusted keys configured. Only a
+// SUB_POLICY_FILE signed by a trusted key loads; anything else, including
+// an inline SUB_POLICY_JSON, gets t's fallback.
+func loadTrustedFromEnv(t *trust, trustErr error) *Bundle {
+	path := FilePathFromEnv()
+	if trustErr != nil {
+		return t.fallback(path, &VerifyError{File: path, Result: event.VerifyResultError, Err: trustErr})
+	}
+	if path == "" {
+		source := ""
+		if strings.TrimSpace(os.Getenv(policyEnvJSON)) != "" {
+			source = policyEnvJSON
+		}
+		return t.fallback(source, &VerifyError{File: source, Result: event.VerifyResultUnsigned,
+			Err: fmt.Errorf("trusted keys require a signed %s", policyEnvFile)})
+	}
+
+	bundle, err := loadVerified(path, t, os.ReadFile)
+	if err != nil {
+		return t.fallback(path, err.(*VerifyError))
+	}
+	debugLog("LoadFromEnv: verified %s (key=%s)", path, bundle.Verification.KeyID)
+	return bundle
+}
@@ -0,0 +1,193 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+func writeSnapshot(t *testing.T, dir string) string {
+	t.Helper()
+	compiled, err := CompileBundle(BundleSpec{
+		PolicyID: "signed",
+		Mode:     "guardrails",
+		Rules: []Rule{
+			{RuleID: "no-drop", Kind: "deny", Match: Match{ToolName: &NameMatch{Glob: []string{"drop"}}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CompileBundle: %v", err)
+	}
+	path := filepath.Join(dir, "snapshot.json")
+	if err := os.WriteFile(path, compiled.Snapshot, 0o644); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	return path
+}
+
+func signWith(t *testing.T, keyDir, name, path string) string {
+	t.Helper()
+	key, err := LoadSigningKey(filepath.Join(keyDir, name+".key"))
+	if err != nil {
+		t.Fatalf("LoadSigningKey: %v", err)
+	}
+	sig, err := SignFile(path, key)
+	if err != nil {
+		t.Fatalf("SignFile: %v", err)
+	}
+	return sig.KeyID
+}
+
+func TestSnapshot_LoadsWithSameHash(t *testing.T) {
+	path := writeSnapshot(t, t.TempDir())
+	spec, err := LoadBundleFile(path)
+	if err != nil {
+		t.Fatalf("LoadBundleFile: %v", err)
+	}
+	compiled, err := CompileBundle(spec)
+	if err != nil {
+		t.Fatalf("CompileBundle: %v", err)
+	}
+	bundle, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if bundle.Info.PolicyHash != compiled.Hash || bundle.Info.PolicyID != "signed" {
+		t.Fatalf("expected the snapshot to keep its hash, got %+v want %s", bundle.Info, compiled.Hash)
+	}
+}
+
+func TestLoadVerified_Results(t *testing.T) {
+	dir := t.TempDir()
+	keyDir := filepath.Join(dir, "keys")
+	trusted, err := GenerateKey(keyDir, "ci")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if _, err := GenerateKey(keyDir, "ci"); err == nil {
+		t.Fatal("expected GenerateKey not to overwrite an existing key")
+	}
+	otherDir := filepath.Join(dir, "other")
+	if _, err := GenerateKey(otherDir, "rogue"); err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(keyDir, "ci.key")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected a private key file with mode 0600, got %v %v", info, err)
+	}
+
+	keys, err := LoadTrustedKeys([]string{keyDir})
+	if err != nil {
+		t.Fatalf("LoadTrustedKeys: %v", err)
+	}
+	tr := &trust{keys: keys}
+	path := writeSnapshot(t, dir)
+
+	expectResult := func(label, want string) {
+		t.Helper()
+		_, err := loadVerified(path, tr, os.ReadFile)
+		var verr *VerifyError
+		if !errors.As(err, &verr) || verr.Result != want {
+			t.Fatalf("%s: expected %s, got %v", label, want, err)
+		}
+	}
+
+	expectResult("unsigned", event.VerifyResultUnsigned)
+
+	if id := signWith(t, keyDir, "ci", path); id != trusted.KeyID {
+		t.Fatalf("expected key %s, got %s", trusted.KeyID, id)
+	}
+	bundle, err := loadVerified(path, tr, os.ReadFile)
+	if err != nil {
+		t.Fatalf("loadVerified: %v", err)
+	}
+	if v := bundle.Verification; v == nil || v.Result != event.VerifyResultVerified || v.KeyID != trusted.KeyID || v.Policy.PolicyID != "signed" {
+		t.Fatalf("expected a verified bundle, got %+v", v)
+	}
+
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, append(data, ' '), 0o644)
+	expectResult("tampered", event.VerifyResultBadSignature)
+
+	os.WriteFile(path, data, 0o644)
+	signWith(t, otherDir, "rogue", path)
+	expectResult("untrusted", event.VerifyResultUntrustedKey)
+}
+
+func TestLoadVerified_LayerFilesNeedSignatures(t *testing.T) {
+	dir := t.TempDir()
+	keyDir := filepath.Join(dir, "keys")
+	if _, err := GenerateKey(keyDir, "ci"); err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	keys, err := LoadTrustedKeys([]string{filepath.Join(keyDir, "ci.pub")})
+	if err != nil {
+		t.Fatalf("LoadTrustedKeys: %v", err)
+	}
+	layerPath := filepath.Join(dir, "repo.yaml")
+	os.WriteFile(layerPath, []byte("policy_id: repo\nmode: control\nrules: []\n"), 0o644)
+	setPath := filepath.Join(dir, "layers.yaml")
+	os.WriteFile(setPath, []byte("layers:\n  - name: repo\n    file: repo.yaml\n"), 0o644)
+	signWith(t, keyDir, "ci", setPath)
+
+	_, err = loadVerified(setPath, &trust{keys: keys}, os.ReadFile)
+	var verr *VerifyError
+	if !errors.As(err, &verr) || verr.Result != event.VerifyResultUnsigned || verr.File != layerPath {
+		t.Fatalf("expected the unsigned layer file to fail, got %v", err)
+	}
+
+	signWith(t, keyDir, "ci", layerPath)
+	if _, err := loadVerified(setPath, &trust{keys: keys}, os.ReadFile); err != nil {
+		t.Fatalf("expected the signed layer set to load, got %v", err)
+	}
+
+	// Re-signing changes what the watcher sees.
+	files, err := readPolicyFiles(setPath)
+	if err != nil {
+		t.Fatalf("readPolicyFiles: %v", err)
+	}
+	if files[SignaturePath(layerPath)] == nil {
+		t.Fatal("expected readPolicyFiles to read layer signatures")
+	}
+}
+
+func TestLoadFromEnv_UnverifiedFallback(t *testing.T) {
+	dir := t.TempDir()
+	keyDir := filepath.Join(dir, "keys")
+	if _, err := GenerateKey(keyDir, "ci"); err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	path := writeSnapshot(t, dir)
+	t.Setenv(policyEnvTrustedKeys, keyDir)
+	t.Setenv(policyEnvFile, path)
+
+	bundle := LoadFromEnv()
+	d := bundle.DecideWithContext(DecisionContext{ServerName: "fs", ToolName: "read"})
+	if d.Action != event.DecisionBlock || d.ReasonCode != "POLICY_UNVERIFIED" {
+		t.Fatalf("expected fail-closed to block, got %s %s", d.Action, d.ReasonCode)
+	}
+	if v := bundle.Verification; v == nil || v.Result != event.VerifyResultUnsigned || v.Fallback != event.VerifyFallbackClosed {
+		t.Fatalf("expected an unsigned fail_closed record, got %+v", v)
+	}
+
+	t.Setenv(policyEnvUnverified, "fail_open")
+	bundle = LoadFromEnv()
+	if bundle.Info.PolicyID != "default" || bundle.Verification.Fallback != event.VerifyFallbackOpen {
+		t.Fatalf("expected fail_open to use the default bundle, got %+v %+v", bundle.Info, bundle.Verification)
+	}
+
+	// Inline policies cannot carry a signature.
+	t.Setenv(policyEnvFile, "")
+	t.Setenv(policyEnvJSON, `{"mode":"observe","rules":[]}`)
+	if v := LoadFromEnv().Verification; v == nil || v.Result != event.VerifyResultUnsigned || v.Source != policyEnvJSON {
+		t.Fatalf("expected SUB_POLICY_JSON to count as unsigned, got %+v", v)
+	}
+
+	signWith(t, keyDir, "ci", path)
+	t.Setenv(policyEnvFile, path)
+	if v := LoadFromEnv().Verification; v == nil || v.Result != event.VerifyResultVerified {
+		t.Fatalf("expected the signed snapshot to verify, got %+v", v)
+	}
+}
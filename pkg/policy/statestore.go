@@ -0,0 +1,349 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+// StateEnvDir names the directory for durable per-run enforcement state.
+const StateEnvDir = "SUB_STATE_DIR"
+
+// StateSnapshot is the budget, rate-limit, breaker and dedupe state of a run,
+// plus the rules promoted into it. Keys are the same rule-scoped keys the
+// bundle uses in memory.
+type StateSnapshot struct {
+	Budgets    map[string]int          `json:"budgets,omitempty"`
+	RateLimits map[string]BucketState  `json:"rate_limits,omitempty"`
+	Breakers   map[string][]time.Time  `json:"breakers,omitempty"`
+	Dedupe     map[string]time.Time    `json:"dedupe,omitempty"`
+	Circuits   map[string]CircuitState `json:"circuits,omitempty"`
+	Promotions []Promotion             `json:"promotions,omitempty"`
+}
+
+// CircuitState is a persisted open outcome breaker.
+type CircuitState struct {
+	OpenedAt time.Time `json:"opened_at"`
+	ProbeAt  time.Time `json:"probe_at"` // Zero unless a half-open probe is in flight
+}
+
+// BucketState is a persisted token bucket.
+type BucketState struct {
+	Tokens     int       `json:"tokens"`
+	LastRefill time.Time `json:"last_refill"`
+}
+
+// StateStore persists enforcement state for one run so that limits hold
+// across shim restarts and are shared by every shim in the run.
+type StateStore interface {
+	// Update loads the run's state, lets fn modify it, and saves it,
+	// holding an exclusive lock across all three steps.
+	Update(fn func(state *StateSnapshot) error) error
+}
+
+// MemoryStateStore keeps state in process memory. The ledgerd coordinator
+// uses one per run when it has no state dir.
+type MemoryStateStore struct {
+	mu    sync.Mutex
+	state StateSnapshot
+}
+
+// Update implements StateStore.
+func (s *MemoryStateStore) Update(fn func(state *StateSnapshot) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// fn gets a deep copy so an aborted update leaves no trace.
+	var next StateSnapshot
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+	if err := json.Unmarshal(data, &next); err != nil {
+		return fmt.Errorf("decode state: %w", err)
+	}
+	if err := fn(&next); err != nil {
+		return err
+	}
+	s.state = next
+	return nil
+}
+
+// FileStateStore keeps a run's state in <dir>/<run_id>.json, guarded by an
+// advisory lock on <dir>/<run_id>.lock.
+type FileStateStore struct {
+	path     string
+	lockPath string
+}
+
+// NewFileStateStore creates the state directory if needed and returns the
+// store for runID.
+func NewFileStateStore(dir, runID string) (*FileStateStore, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return nil, errors.New("state dir is required")
+	}
+	name := stateFileName(runID)
+	if name == "" {
+		return nil, errors.New("run id is required")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+	return &FileStateStore{
+		path:     filepath.Join(dir, name+".json"),
+		lockPath: filepath.Join(dir, name+".lock"),
+	}, nil
+}
+
+// Path returns the state file path.
+func (s *FileStateStore) Path() string {
+	return s.path
+}
+
+// Update implements StateStore.
+func (s *FileStateStore) Update(fn func(state *StateSnapshot) error) error {
+	lock, err := os.OpenFile(s.lockPath, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("open state lock: %w", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("lock state: %w", err)
+	}
+	defer unlockFile(lock)
+
+	state, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := fn(&state); err != nil {
+		return err
+	}
+	return s.save(state)
+}
+
+func (s *FileStateStore) load() (StateSnapshot, error) {
+	var state StateSnapshot
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("read state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("parse state %s: %w", s.path, err)
+	}
+	return state, nil
+}
+
+// save writes through a temp file so a crash never leaves a torn file.
+func (s *FileStateStore) save(state StateSnapshot) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("replace state: %w", err)
+	}
+	return nil
+}
+
+// stateFileName maps a run ID onto a safe file name.
+func stateFileName(runID string) string {
+	runID = strings.TrimSpace(runID)
+	var b strings.Builder
+	for _, r := range runID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name := b.String()
+	if strings.Trim(name, ".") == "" {
+		return ""
+	}
+	return name
+}
+
+// SetStateStore attaches durable state. Every decision then reloads the
+// run's state before evaluating and saves it afterwards, so limits count
+// calls made by earlier or concurrent shims of the same run.
+// Each layer of a layer set keeps its state under its own name.
+func (b *Bundle) SetStateStore(store StateStore) {
+	b.stateStore = store
+	for _, l := range b.layers {
+		l.bundle.SetStateStore(newLayerStateStore(store, l.name))
+	}
+}
+
+// hasStatefulRules reports whether any enabled rule reads or writes state;
+// bundles without one skip the store entirely.
+func (b *Bundle) hasStatefulRules() bool {
+	for _, rule := range b.Rules {
+		if !ruleEnabled(rule.Enabled) {
+			continue
+		}
+		effect := rule.Effect
+		if effect.Breaker != nil || effect.RateLimit != nil || effect.Dedupe != nil || isBudgetRule(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// decideDurable runs decide between a restore and a capture of the run's
+// state. If the store fails, defaults.decision_on_error applies.
+func (b *Bundle) decideDurable(ctx DecisionContext) Decision {
+	var decision Decision
+	decided := false
+	err := b.withDurableState(func() {
+		decision = b.decide(ctx)
+		decided = true
+	})
+	if err != nil {
+		debugLog("decideDurable: state store error: %v", err)
+		if !decided {
+			return b.stateErrorDecision(ctx)
+		}
+	}
+	return decision
+}
+
+// withDurableState runs fn against the run's stored state and saves the
+// result. fn does not run if the state cannot be loaded.
+func (b *Bundle) withDurableState(fn func()) error {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	return b.stateStore.Update(func(state *StateSnapshot) error {
+		b.restoreState(state)
+		fn()
+		*state = b.captureState()
+		return nil
+	})
+}
+
+// stateErrorDecision decides a call whose shared state is unavailable.
+// decision_on_error ALLOW (the default) evaluates against this shim's
+// in-memory state; BLOCK blocks the call, unless fail_open_read_tools is
+// set and a tag rule marks the tool read_like.
+func (b *Bundle) stateErrorDecision(ctx DecisionContext) Decision {
+	if !strings.EqualFold(strings.TrimSpace(b.Defaults.DecisionOnError), "BLOCK") ||
+		!selectorsMatch(b.Selectors, ctx.Target) ||
+		(b.Defaults.FailOpenReadTools != nil && *b.Defaults.FailOpenReadTools && b.isReadLike(ctx)) {
+		return b.decide(ctx)
+	}
+
+	decision := Decision{
+		Action:     b.controlAction(event.DecisionBlock),
+		ReasonCode: "POLICY_STATE_UNAVAILABLE",
+		Summary:    "Shared policy state unavailable",
+		Severity:   event.SeverityWarn,
+	}
+	attachHint(&decision, "", event.HintKindOther)
+	return decision
+}
+
+// isReadLike reports whether the tag rules matching ctx add read_like.
+func (b *Bundle) isReadLike(ctx DecisionContext) bool {
+	_, ok := b.riskClasses(ctx)["read_like"]
+	return ok
+}
+
+// restoreState replaces the in-memory state with state.
+func (b *Bundle) restoreState(state *StateSnapshot) {
+	b.ensureState()
+
+	b.budgets.mu.Lock()
+	b.budgets.calls = make(map[string]int, len(state.Budgets))
+	for key, count := range state.Budgets {
+		b.budgets.calls[key] = count
+	}
+	b.budgets.mu.Unlock()
+
+	b.rateLimit.mu.Lock()
+	b.rateLimit.buckets = make(map[string]*tokenBucket, len(state.RateLimits))
+	for key, bucket := range state.RateLimits {
+		b.rateLimit.buckets[key] = &tokenBucket{tokens: bucket.Tokens, lastRefill: bucket.LastRefill}
+	}
+	b.rateLimit.mu.Unlock()
+
+	b.dedupe.mu.Lock()
+	b.dedupe.entries = make(map[string]time.Time, len(state.Dedupe))
+	for key, seen := range state.Dedupe {
+		b.dedupe.entries[key] = seen
+	}
+	b.dedupe.mu.Unlock()
+
+	b.breakerMu.Lock()
+	b.breakerState = make(map[string][]time.Time, len(state.Breakers))
+	for key, hits := range state.Breakers {
+		b.breakerState[key] = append([]time.Time(nil), hits...)
+	}
+	b.circuits = make(map[string]*circuitState, len(state.Circuits))
+	for key, circuit := range state.Circuits {
+		b.circuits[key] = &circuitState{openedAt: circuit.OpenedAt, probeAt: circuit.ProbeAt}
+	}
+	b.breakerMu.Unlock()
+
+	b.setPromotions(state.Promotions)
+}
+
+// captureState returns a copy of the in-memory state.
+func (b *Bundle) captureState() StateSnapshot {
+	b.ensureState()
+	state := StateSnapshot{
+		Budgets:    make(map[string]int),
+		RateLimits: make(map[string]BucketState),
+		Breakers:   make(map[string][]time.Time),
+		Dedupe:     make(map[string]time.Time),
+		Circuits:   make(map[string]CircuitState),
+	}
+
+	b.budgets.mu.Lock()
+	for key, count := range b.budgets.calls {
+		state.Budgets[key] = count
+	}
+	b.budgets.mu.Unlock()
+
+	b.rateLimit.mu.Lock()
+	for key, bucket := range b.rateLimit.buckets {
+		if bucket != nil {
+			state.RateLimits[key] = BucketState{Tokens: bucket.tokens, LastRefill: bucket.lastRefill}
+		}
+	}
+	b.rateLimit.mu.Unlock()
+
+	b.dedupe.mu.Lock()
+	for key, seen := range b.dedupe.entries {
+		state.Dedupe[key] = seen
+	}
+	b.dedupe.mu.Unlock()
+
+	b.breakerMu.Lock()
+	for key, hits := range b.breakerState {
+		if len(hits) > 0 {
+			state.Breakers[key] = append([]time.Time(nil), hits...)
+		}
+	}
+	for key, circuit := range b.circuits {
+		state.Circuits[key] = CircuitState{OpenedAt: circuit.openedAt, ProbeAt: circuit.probeAt}
+	}
+	b.breakerMu.Unlock()
+
+	state.Promotions = b.currentPromotions()
+	return state
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+const durableBundleJSON = `{
+	"mode": "guardrails",
+	"policy_id": "durable-test",
+	"rules": [
+		{
+			"rule_id": "run-budget",
+			"kind": "budget",
+			"match": {"tool_name": {"glob": ["*"]}},
+			"effect": {"budget": {"scope": "run", "limit_calls": 4, "on_exceed": "BLOCK"}}
+		}
+	]
+}`
+
+func durableBundle(t *testing.T, store StateStore) *Bundle {
+	t.Helper()
+	t.Setenv("SUB_POLICY_FILE", "")
+	t.Setenv("SUB_POLICY_JSON", durableBundleJSON)
+	bundle := LoadFromEnv()
+	bundle.SetStateStore(store)
+	return bundle
+}
+
+func TestFileStateStore_BudgetSharedAcrossBundles(t *testing.T) {
+	dir := t.TempDir()
+	storeA, err := NewFileStateStore(dir, "run/1")
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	storeB, err := NewFileStateStore(dir, "run/1")
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	a := durableBundle(t, storeA)
+	b := durableBundle(t, storeB)
+
+	// Two "shims" of the same run spend one budget concurrently.
+	var wg sync.WaitGroup
+	results := make(chan event.DecisionAction, 6)
+	for i := 0; i < 3; i++ {
+		for _, bundle := range []*Bundle{a, b} {
+			wg.Add(1)
+			go func(bundle *Bundle) {
+				defer wg.Done()
+				results <- bundle.Decide("s", "tool", "h").Action
+			}(bundle)
+		}
+	}
+	wg.Wait()
+	close(results)
+
+	allowed := 0
+	for action := range results {
+		if action == event.DecisionAllow {
+			allowed++
+		}
+	}
+	if allowed != 4 {
+		t.Fatalf("expected 4 allowed calls across both bundles, got %d", allowed)
+	}
+
+	// A restarted shim starts from the persisted count.
+	restarted := durableBundle(t, storeA)
+	if d := restarted.Decide("s", "tool", "h"); d.Action != event.DecisionBlock {
+		t.Fatalf("expected BLOCK after restart, got %s", d.Action)
+	}
+
+	if _, err := os.Stat(storeA.Path()); err != nil {
+		t.Fatalf("expected state file: %v", err)
+	}
+}
+
+func TestFileStateStore_IsolatedByRunID(t *testing.T) {
+	dir := t.TempDir()
+	storeA, _ := NewFileStateStore(dir, "run-a")
+	storeB, _ := NewFileStateStore(dir, "run-b")
+	a := durableBundle(t, storeA)
+	for i := 0; i < 4; i++ {
+		a.Decide("s", "tool", "h")
+	}
+
+	b := durableBundle(t, storeB)
+	if d := b.Decide("s", "tool", "h"); d.Action != event.DecisionAllow {
+		t.Fatalf("expected a different run to start fresh, got %s", d.Action)
+	}
+}
+
+func TestFileStateStore_CorruptFileFallsBackToMemory(t *testing.T) {
+	store, err := NewFileStateStore(t.TempDir(), "run-corrupt")
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if err := os.WriteFile(store.Path(), []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	bundle := durableBundle(t, store)
+	for i := 0; i < 4; i++ {
+		if d := bundle.Decide("s", "tool", "h"); d.Action != event.DecisionAllow {
+			t.Fatalf("call %d: expected ALLOW, got %s", i+1, d.Action)
+		}
+	}
+	if d := bundle.Decide("s", "tool", "h"); d.Action != event.DecisionBlock {
+		t.Fatalf("expected in-memory budget to still enforce, got %s", d.Action)
+	}
+}
+
+func TestNewFileStateStore_RequiresRunID(t *testing.T) {
+	if _, err := NewFileStateStore(t.TempDir(), " .. "); err == nil {
+		t.Fatal("expected error for unusable run id")
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Update(func(*StateSnapshot) error) error {
+	return errors.New("unreachable")
+}
+
+func TestStateError_DecisionOnError(t *testing.T) {
+	t.Setenv("SUB_POLICY_FILE", "")
+	t.Setenv("SUB_POLICY_JSON", `{
+		"mode": "guardrails",
+		"defaults": {"decision_on_error": "BLOCK", "fail_open_read_tools": true},
+		"rules": [
+			{"rule_id": "tag-reads", "kind": "tag", "match": {"tool_name": {"glob": ["read_*"]}}, "effect": {"tag": {"add_risk_class": ["read_like"]}}},
+			{"rule_id": "run-budget", "kind": "budget", "effect": {"budget": {"scope": "run", "limit_calls": 10}}}
+		]
+	}`)
+	bundle := LoadFromEnv()
+	bundle.SetStateStore(failingStore{})
+
+	if d := bundle.Decide("s", "write_file", "h"); d.Action != event.DecisionBlock || d.ReasonCode != "POLICY_STATE_UNAVAILABLE" {
+		t.Fatalf("expected BLOCK POLICY_STATE_UNAVAILABLE, got %s %s", d.Action, d.ReasonCode)
+	}
+	if d := bundle.Decide("s", "read_file", "h"); d.Action != event.DecisionAllow {
+		t.Fatalf("expected read_like tool to fail open, got %s", d.Action)
+	}
+
+	bundle.Defaults.DecisionOnError = "ALLOW"
+	if d := bundle.Decide("s", "write_file", "h"); d.Action != event.DecisionAllow {
+		t.Fatalf("expected ALLOW with in-memory state, got %s", d.Action)
+	}
+}
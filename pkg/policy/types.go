@@ -1,9 +1,14 @@
 package policy
 
+import "github.com/peakyragnar/subluminal/pkg/event"
+
 // PolicyDefaults defines top-level bundle defaults.
 type PolicyDefaults struct {
 	DecisionOnError   string `json:"decision_on_error,omitempty"`
 	FailOpenReadTools *bool  `json:"fail_open_read_tools,omitempty"`
+	// ToolCosts maps tool name globs to per-call cost units for budgets
+	// with limit_cost_units. The most specific (longest) matching glob wins.
+	ToolCosts map[string]int `json:"tool_costs,omitempty"`
 }
 
 // WorkloadSelector matches workload context fields.
@@ -54,12 +59,45 @@ type WorkloadContext struct {
 	Branch         string            `json:"branch"`
 }
 
-// ArgsMatch defines argument predicates for rule matching.
+// WorkloadFromEvent reads the workload context of a run (SUB_WORKLOAD).
+// Fields and labels that are not strings are ignored.
+func WorkloadFromEvent(workload event.Workload) WorkloadContext {
+	field := func(key string) string {
+		value, _ := workload[key].(string)
+		return value
+	}
+	ctx := WorkloadContext{
+		Namespace:      field("namespace"),
+		ServiceAccount: field("service_account"),
+		Repo:           field("repo"),
+		Branch:         field("branch"),
+	}
+	if labels, ok := workload["labels"].(map[string]any); ok {
+		ctx.Labels = make(map[string]string, len(labels))
+		for key, value := range labels {
+			if text, ok := value.(string); ok {
+				ctx.Labels[key] = text
+			}
+		}
+	}
+	return ctx
+}
+
+// ArgsMatch defines argument predicates for rule matching. All predicates
+// present must hold. Keys name a top-level argument, or a nested value when
+// written as a JSON pointer (RFC 6901) such as "/options/force".
 type ArgsMatch struct {
 	HasKeys      []string                `json:"has_keys,omitempty"`
 	KeyEquals    map[string]any          `json:"key_equals,omitempty"`
 	KeyIn        map[string][]any        `json:"key_in,omitempty"`
 	NumericRange map[string]NumericRange `json:"numeric_range,omitempty"`
+	KeyRegex     map[string][]string     `json:"key_regex,omitempty"`   // String value matches any pattern
+	KeyGlob      map[string][]string     `json:"key_glob,omitempty"`    // String value matches any glob
+	PathPrefix   map[string][]string     `json:"path_prefix,omitempty"` // Cleaned path lies within any prefix
+	Length       map[string]LengthRange  `json:"length,omitempty"`      // String, array or object size
+	Not          *ArgsMatch              `json:"not,omitempty"`
+	AnyOf        []ArgsMatch             `json:"any_of,omitempty"`
+	AllOf        []ArgsMatch             `json:"all_of,omitempty"`
 }
 
 // IsZero reports whether no argument predicates are specified.
@@ -70,7 +108,10 @@ func (m *ArgsMatch) IsZero() bool {
 	if len(m.HasKeys) > 0 || len(m.KeyEquals) > 0 || len(m.KeyIn) > 0 || len(m.NumericRange) > 0 {
 		return false
 	}
-	return true
+	if len(m.KeyRegex) > 0 || len(m.KeyGlob) > 0 || len(m.PathPrefix) > 0 || len(m.Length) > 0 {
+		return false
+	}
+	return m.Not == nil && len(m.AnyOf) == 0 && len(m.AllOf) == 0
 }
 
 // NumericRange specifies an inclusive numeric range.
@@ -79,6 +120,13 @@ type NumericRange struct {
 	Max *float64 `json:"max,omitempty"`
 }
 
+// LengthRange specifies an inclusive size range. Strings are measured in
+// characters, arrays in elements and objects in keys.
+type LengthRange struct {
+	Min *int `json:"min,omitempty"`
+	Max *int `json:"max,omitempty"`
+}
+
 // BundleSpec is the authoring/parsed policy bundle.
 type BundleSpec struct {
 	PolicyID      string          `json:"policy_id"`
@@ -104,7 +152,7 @@ func (s BundleSpec) EffectiveVersion() string {
 
 // CompiledBundle is the compiled snapshot and runtime bundle.
 type CompiledBundle struct {
-	Bundle   Bundle
+	Bundle   *Bundle
 	Snapshot []byte
 	Hash     string
 }
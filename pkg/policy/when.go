@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+	"github.com/peakyragnar/subluminal/pkg/expr"
+)
+
+// whenEnv declares what a rule's when expression can see.
+var whenEnv = expr.Env{
+	"server": expr.String,
+	"tool":   expr.String,
+	"args":   expr.MapOf(expr.Dyn),
+	"identity": expr.ObjectOf(map[string]*expr.Type{
+		"env":      expr.String,
+		"agent_id": expr.String,
+		"client":   expr.String,
+	}),
+	"workload": expr.ObjectOf(map[string]*expr.Type{
+		"namespace":       expr.String,
+		"service_account": expr.String,
+		"repo":            expr.String,
+		"branch":          expr.String,
+		"labels":          expr.MapOf(expr.String),
+	}),
+}
+
+// compileWhenExpr compiles and type-checks one when expression.
+func compileWhenExpr(src string) (*expr.Program, error) {
+	prog, err := expr.Compile(src, whenEnv)
+	if err != nil {
+		return nil, err
+	}
+	if kind := prog.Type().Kind; kind != expr.KindBool && kind != expr.KindDyn {
+		return nil, fmt.Errorf("when must be a bool expression, got %s", prog.Type())
+	}
+	return prog, nil
+}
+
+// compileWhen compiles every rule's when expression, once per bundle.
+// A rule whose expression does not compile never matches.
+func (b *Bundle) compileWhen() error {
+	b.whenOnce.Do(func() {
+		b.when = make([]*expr.Program, len(b.Rules))
+		for i, rule := range b.Rules {
+			if strings.TrimSpace(rule.When) == "" {
+				continue
+			}
+			prog, err := compileWhenExpr(rule.When)
+			if err != nil {
+				if b.whenErr == nil {
+					b.whenErr = fmt.Errorf("rules[%d].when: %w", i, err)
+				}
+				continue
+			}
+			b.when[i] = prog
+		}
+	})
+	return b.whenErr
+}
+
+// matchWhen evaluates the when expression of rule idx. Evaluation errors
+// (a missing argument, a type mismatch, the cost limit) mean no match.
+func (b *Bundle) matchWhen(idx int, rule Rule, ctx DecisionContext) bool {
+	matched, _ := b.evalWhen(idx, rule, ctx)
+	return matched
+}
+
+// evalWhen evaluates the when expression of rule idx, reporting an
+// evaluation error alongside no match.
+func (b *Bundle) evalWhen(idx int, rule Rule, ctx DecisionContext) (bool, error) {
+	if strings.TrimSpace(rule.When) == "" {
+		return true, nil
+	}
+	b.compileWhen()
+	if idx >= len(b.when) || b.when[idx] == nil {
+		return false, nil
+	}
+	matched, err := b.when[idx].EvalBool(whenVars(ctx))
+	if err != nil {
+		debugLog("  Rule[%d] when error: %v", idx, err)
+		return false, err
+	}
+	return matched, nil
+}
+
+// whenErrorDecision blocks a call whose when expression failed on a rule
+// that restricts calls. Arguments are the caller's to shape, so an error
+// such as the cost limit on an oversized argument must not let the call
+// slip past a deny.
+func (b *Bundle) whenErrorDecision(rule Rule, err error) *Decision {
+	decision := buildDecision(rule, b.controlAction(event.DecisionBlock), "WHEN_EVAL_ERROR", "")
+	decision.ReasonCode = "WHEN_EVAL_ERROR"
+	decision.Summary = "Rule condition could not be evaluated: " + err.Error()
+	decision.Severity = event.SeverityWarn
+	attachHint(decision, "", event.HintKindOther)
+	return decision
+}
+
+// allowsCalls reports whether rule only ever allows calls.
+func allowsCalls(rule Rule) bool {
+	action := rule.Effect.Action
+	if action == "" {
+		action = actionFromKind(strings.TrimSpace(rule.Kind))
+	}
+	return action == event.DecisionAllow
+}
+
+func whenVars(ctx DecisionContext) map[string]any {
+	args := ctx.Args
+	if args == nil {
+		args = map[string]any{}
+	}
+	labels := make(map[string]any, len(ctx.Target.Workload.Labels))
+	for key, value := range ctx.Target.Workload.Labels {
+		labels[key] = value
+	}
+	return map[string]any{
+		"server": ctx.ServerName,
+		"tool":   ctx.ToolName,
+		"args":   args,
+		"identity": map[string]any{
+			"env":      ctx.Target.Env,
+			"agent_id": ctx.Target.AgentID,
+			"client":   ctx.Target.Client,
+		},
+		"workload": map[string]any{
+			"namespace":       ctx.Target.Workload.Namespace,
+			"service_account": ctx.Target.Workload.ServiceAccount,
+			"repo":            ctx.Target.Workload.Repo,
+			"branch":          ctx.Target.Workload.Branch,
+			"labels":          labels,
+		},
+	}
+}
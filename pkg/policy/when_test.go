@@ -0,0 +1,144 @@
+package policy
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/peakyragnar/subluminal/pkg/event"
+)
+
+func TestWhen_GatesRuleOnIdentity(t *testing.T) {
+	compiled, err := CompileBundle(BundleSpec{
+		PolicyID: "when",
+		Version:  "1",
+		Mode:     "guardrails",
+		Rules: []Rule{
+			{
+				RuleID: "triage-may-delete",
+				Kind:   "allow",
+				Match:  Match{ToolName: &NameMatch{Glob: []string{"delete_issue"}}},
+				When:   `identity.agent_id.startsWith("triage-") && identity.env != "prod"`,
+			},
+			{
+				RuleID: "no-delete",
+				Kind:   "deny",
+				Match:  Match{ToolName: &NameMatch{Glob: []string{"delete_issue"}}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CompileBundle: %v", err)
+	}
+	bundle := compiled.Bundle
+
+	tests := []struct {
+		agentID string
+		env     string
+		want    event.DecisionAction
+	}{
+		{"triage-bot", "dev", event.DecisionAllow},
+		{"triage-bot", "prod", event.DecisionBlock},
+		{"coder", "dev", event.DecisionBlock},
+	}
+	for _, tt := range tests {
+		d := bundle.DecideWithContext(DecisionContext{
+			ServerName: "linear",
+			ToolName:   "delete_issue",
+			Target:     SelectorTarget{AgentID: tt.agentID, Env: tt.env},
+		})
+		if d.Action != tt.want {
+			t.Errorf("agent=%s env=%s: got %s, want %s", tt.agentID, tt.env, d.Action, tt.want)
+		}
+	}
+}
+
+func TestWhen_EvaluationErrorFailsClosed(t *testing.T) {
+	bundle := &Bundle{
+		Mode: event.RunModeGuardrails,
+		Rules: []Rule{
+			{
+				RuleID: "big-limit",
+				Kind:   "deny",
+				When:   `args.limit > 100`,
+			},
+		},
+	}
+
+	if d := bundle.DecideWithContext(DecisionContext{ToolName: "query", Args: map[string]any{"limit": float64(500)}}); d.ReasonCode != "POLICY_BLOCK" {
+		t.Errorf("expected POLICY_BLOCK for limit=500, got %s %s", d.Action, d.ReasonCode)
+	}
+	for name, args := range map[string]map[string]any{
+		"missing argument": {},
+		"type mismatch":    {"limit": "lots"},
+	} {
+		d := bundle.DecideWithContext(DecisionContext{ToolName: "query", Args: args})
+		if d.Action != event.DecisionBlock || d.ReasonCode != "WHEN_EVAL_ERROR" {
+			t.Errorf("%s: expected BLOCK with WHEN_EVAL_ERROR, got %s %s", name, d.Action, d.ReasonCode)
+		}
+	}
+
+	// Guarded with has(), a missing argument is no match
+	bundle.Rules[0].When = `has(args.limit) && args.limit > 100`
+	bundle.when, bundle.whenOnce = nil, sync.Once{}
+	if d := bundle.DecideWithContext(DecisionContext{ToolName: "query", Args: map[string]any{}}); d.Action != event.DecisionAllow {
+		t.Errorf("expected the guarded rule to skip a missing argument, got %s %s", d.Action, d.ReasonCode)
+	}
+}
+
+func TestWhen_CostLimitFailsClosed(t *testing.T) {
+	bundle := &Bundle{
+		Mode: event.RunModeGuardrails,
+		Rules: []Rule{
+			{
+				RuleID: "trusted-reads",
+				Kind:   "allow",
+				When:   `args.sql.startsWith("SELECT") && !args.sql.contains(";")`,
+			},
+			{
+				RuleID: "no-drop",
+				Kind:   "deny",
+				When:   `args.sql.contains("DROP") || args.sql.contains("drop")`,
+			},
+		},
+	}
+	huge := strings.Repeat("x", 6<<20) + "drop table users"
+
+	d := bundle.DecideWithContext(DecisionContext{ToolName: "query", Args: map[string]any{"sql": huge}})
+	if d.Action != event.DecisionBlock || d.ReasonCode != "WHEN_EVAL_ERROR" {
+		t.Fatalf("expected BLOCK with WHEN_EVAL_ERROR, got %s %s", d.Action, d.ReasonCode)
+	}
+	if d.RuleID == nil || *d.RuleID != "no-drop" {
+		t.Errorf("expected the deny rule to be blamed, got %v", d.RuleID)
+	}
+	if d := bundle.DecideWithContext(DecisionContext{ToolName: "query", Args: map[string]any{"sql": "drop table users"}}); d.ReasonCode != "POLICY_BLOCK" {
+		t.Errorf("expected POLICY_BLOCK for a small argument, got %s %s", d.Action, d.ReasonCode)
+	}
+}
+
+func TestWhen_CompileAndLintErrors(t *testing.T) {
+	spec := BundleSpec{
+		PolicyID: "when",
+		Version:  "1",
+		Mode:     "guardrails",
+		Rules: []Rule{
+			{RuleID: "ok", Kind: "deny", When: `tool == "x"`},
+			{RuleID: "typo", Kind: "deny", When: `identity.agent == "x"`},
+			{RuleID: "not-bool", Kind: "deny", When: `size(tool)`},
+		},
+	}
+
+	if _, err := CompileBundle(spec); err == nil || !strings.Contains(err.Error(), "rules[1].when") {
+		t.Errorf("expected CompileBundle to reject rules[1].when, got %v", err)
+	}
+
+	var fields []string
+	for _, issue := range LintBundle(spec) {
+		if issue.Level == "error" {
+			fields = append(fields, issue.Field)
+		}
+	}
+	if got := strings.Join(fields, ","); got != "rules[1].when,rules[2].when" {
+		t.Errorf("expected lint errors on rules[1].when and rules[2].when, got %q", got)
+	}
+}
@@ -37,7 +37,7 @@ func parseYAMLBundle(input string) (any, error) {
 
 		trimmed := strings.TrimSpace(stripped)
 
-		for len(stack) > 1 && indent <= stack[len(stack)-1].indent {
+		for len(stack) > 1 && closesFrame(stack[len(stack)-1], indent, trimmed) {
 			stack = stack[:len(stack)-1]
 		}
 
@@ -136,6 +136,26 @@ func parseYAMLBundle(input string) (any, error) {
 	return root, nil
 }
 
+// closesFrame reports whether a line at indent ends the given frame.
+// Lines at the same indent as a map frame are sibling keys and stay in it;
+// list-item maps close on the next "-" at their indent, and lists close on
+// a non-item line at their indent.
+func closesFrame(frame yamlFrame, indent int, trimmed string) bool {
+	if indent < frame.indent {
+		return true
+	}
+	if indent > frame.indent {
+		return false
+	}
+	if frame.inlineListKV {
+		return true
+	}
+	if _, ok := frame.container.([]any); ok {
+		return !strings.HasPrefix(trimmed, "-")
+	}
+	return false
+}
+
 func updateListFrame(frame *yamlFrame, list []any) {
 	frame.container = list
 	if frame.parentMap != nil {
@@ -31,3 +31,73 @@ rules:
 		t.Fatalf("expected rule_id allow-all, got %q", spec.Rules[0].RuleID)
 	}
 }
+
+func TestParseYAMLBundleNestedSiblingKeys(t *testing.T) {
+	yaml := `
+policy_id: nested
+rules:
+  - rule_id: deny-push
+    kind: deny
+    match:
+      tool_name:
+        glob: ["git_push"]
+      server_name:
+        glob: ["git"]
+    effect:
+      action: BLOCK
+      reason_code: NO_PUSH
+      message: pushes are blocked
+  - rule_id: allow-all
+    kind: allow
+mode: guardrails
+`
+
+	raw, err := parseYAMLBundle(yaml)
+	if err != nil {
+		t.Fatalf("parseYAMLBundle error: %v", err)
+	}
+	spec, err := decodeBundle(raw)
+	if err != nil {
+		t.Fatalf("decodeBundle error: %v", err)
+	}
+	if spec.Mode != "guardrails" {
+		t.Fatalf("expected mode guardrails, got %q", spec.Mode)
+	}
+	if len(spec.Rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(spec.Rules))
+	}
+	rule := spec.Rules[0]
+	if rule.Effect.ReasonCode != "NO_PUSH" || rule.Effect.Message != "pushes are blocked" {
+		t.Fatalf("effect keys not nested: %+v", rule.Effect)
+	}
+	if rule.Match.ServerName == nil || len(rule.Match.ServerName.Glob) != 1 {
+		t.Fatalf("match.server_name not nested: %+v", rule.Match)
+	}
+}
+
+func TestParseYAMLBundleCompactList(t *testing.T) {
+	yaml := `
+policy_id: compact
+rules:
+- rule_id: a
+  kind: allow
+- rule_id: b
+  kind: deny
+mode: control
+`
+
+	raw, err := parseYAMLBundle(yaml)
+	if err != nil {
+		t.Fatalf("parseYAMLBundle error: %v", err)
+	}
+	spec, err := decodeBundle(raw)
+	if err != nil {
+		t.Fatalf("decodeBundle error: %v", err)
+	}
+	if len(spec.Rules) != 2 || spec.Rules[1].Kind != "deny" {
+		t.Fatalf("unexpected rules: %+v", spec.Rules)
+	}
+	if spec.Mode != "control" {
+		t.Fatalf("expected mode control, got %q", spec.Mode)
+	}
+}
@@ -0,0 +1,133 @@
+// Package testharness provides test infrastructure for contract testing.
+//
+// This file implements a fake MCP server speaking the Streamable HTTP
+// transport: JSON-RPC messages are POSTed to a single endpoint and answered
+// with either application/json or a text/event-stream (SSE) body.
+//
+// WHY THIS EXISTS:
+// The mcp_http adapter proxies remote MCP servers. Tests need a local,
+// predictable server that exercises both response styles, including SSE
+// streams that carry notifications before the final response.
+package testharness
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+// FakeHTTPSessionID is the Mcp-Session-Id the fake server assigns.
+const FakeHTTPSessionID = "fake-session-1"
+
+// FakeHTTPMCPServer serves a FakeMCPServer's tools over Streamable HTTP.
+type FakeHTTPMCPServer struct {
+	*FakeMCPServer
+
+	// SSE makes POST responses use text/event-stream. Each SSE response
+	// sends a notifications/progress event before the JSON-RPC response.
+	SSE bool
+
+	server *httptest.Server
+}
+
+// NewFakeHTTPMCPServer creates a fake HTTP server with no tools.
+// Add tools with AddTool(), then call Start().
+func NewFakeHTTPMCPServer() *FakeHTTPMCPServer {
+	return &FakeHTTPMCPServer{FakeMCPServer: NewFakeMCPServer()}
+}
+
+// Start begins listening on a local port and returns the endpoint URL.
+func (s *FakeHTTPMCPServer) Start() string {
+	s.server = httptest.NewServer(s)
+	return s.URL()
+}
+
+// URL returns the MCP endpoint URL, or "" if not started.
+func (s *FakeHTTPMCPServer) URL() string {
+	if s.server == nil {
+		return ""
+	}
+	return s.server.URL + "/mcp"
+}
+
+// Close stops the server.
+func (s *FakeHTTPMCPServer) Close() {
+	if s.server != nil {
+		s.server.Close()
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *FakeHTTPMCPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		// No server-initiated stream
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var req JSONRPCRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeHTTPJSON(w, &JSONRPCResponse{
+			JSONRPC: "2.0",
+			Error:   &JSONRPCError{Code: -32700, Message: "Parse error", Data: err.Error()},
+		})
+		return
+	}
+
+	// Notifications and responses are accepted without a body
+	if req.ID == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if req.Method == "initialize" {
+		w.Header().Set("Mcp-Session-Id", FakeHTTPSessionID)
+	}
+	resp := s.handleRequest(&req)
+
+	if !s.SSE {
+		writeHTTPJSON(w, resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	progress, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "notifications/progress",
+		"params":  map[string]any{"progressToken": req.ID, "progress": 1},
+	})
+	fmt.Fprintf(w, "event: message\ndata: %s\n\n", progress)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	respBytes, _ := json.Marshal(resp)
+	fmt.Fprintf(w, "event: message\ndata: %s\n\n", respBytes)
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+func writeHTTPJSON(w http.ResponseWriter, resp *JSONRPCResponse) {
+	respBytes, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+}
@@ -74,15 +74,31 @@ type HarnessConfig struct {
 	// CrashOn makes fakemcp exit(1) when this tool is called (simulates crash).
 	CrashOn string
 
+	// SpinOn makes fakemcp burn CPU without responding when this tool is called.
+	SpinOn string
+
+	// StderrLines makes fakemcp write this many log lines to stderr at startup.
+	StderrLines int
+
 	// ErrorOn makes fakemcp return an error when these tools are called (comma-separated).
 	ErrorOn string
 
+	// Echo makes fakemcp return the call arguments as the tool result.
+	Echo bool
+
 	// MeasureSize makes fakemcp return {"bytes_received": N} for each tool call,
 	// where N is the JSON byte size of the args. Used by BUF-003 test.
 	MeasureSize bool
 
 	// RequireEnv makes fakemcp require these env vars for tool calls.
 	RequireEnv []string
+
+	// SlowOn makes fakemcp delay responses for these tools (comma-separated).
+	SlowOn string
+
+	// SlowDelay is how long SlowOn tools wait before responding.
+	// If zero, fakemcp uses its default.
+	SlowDelay time.Duration
 }
 
 // directPipes connects driver directly to fake server (no shim).
@@ -182,12 +198,27 @@ func (h *TestHarness) startWithShim() error {
 	if h.config.ErrorOn != "" {
 		args = append(args, "--error-on="+h.config.ErrorOn)
 	}
+	if h.config.SpinOn != "" {
+		args = append(args, "--spin-on="+h.config.SpinOn)
+	}
+	if h.config.StderrLines > 0 {
+		args = append(args, fmt.Sprintf("--stderr-lines=%d", h.config.StderrLines))
+	}
 	if h.config.MeasureSize {
 		args = append(args, "--measure-size")
 	}
+	if h.config.Echo {
+		args = append(args, "--echo")
+	}
 	if len(h.config.RequireEnv) > 0 {
 		args = append(args, "--require-env="+strings.Join(h.config.RequireEnv, ","))
 	}
+	if h.config.SlowOn != "" {
+		args = append(args, "--slow-on="+h.config.SlowOn)
+		if h.config.SlowDelay > 0 {
+			args = append(args, "--slow-delay="+h.config.SlowDelay.String())
+		}
+	}
 
 	// Start shim process
 	h.shimCmd = exec.Command(h.config.ShimPath, args...)
@@ -302,6 +333,8 @@ func (h *TestHarness) Stop() error {
 		h.shimCmd.Process.Signal(os.Interrupt)
 		done := make(chan error, 1)
 		go func() {
+			// Wait closes the stderr pipe, so finish capturing events first
+			h.captureWg.Wait()
 			done <- h.shimCmd.Wait()
 		}()
 
@@ -310,10 +343,8 @@ func (h *TestHarness) Stop() error {
 			// Clean exit
 		case <-time.After(h.config.Timeout):
 			h.shimCmd.Process.Kill()
+			<-done
 		}
-
-		// Wait for event capture goroutine to finish reading stderr
-		h.captureWg.Wait()
 	}
 
 	// Close direct mode pipes
@@ -361,6 +392,16 @@ func (h *TestHarness) Events() []CapturedEvent {
 	return h.EventSink.All()
 }
 
+// ShimPID returns the shim's process ID, or 0 in direct mode or before Start.
+func (h *TestHarness) ShimPID() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.shimCmd == nil || h.shimCmd.Process == nil {
+		return 0
+	}
+	return h.shimCmd.Process.Pid
+}
+
 // =============================================================================
 // Test assertion helpers
 // =============================================================================
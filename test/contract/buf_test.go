@@ -10,6 +10,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/peakyragnar/subluminal/pkg/testharness"
 )
@@ -251,3 +252,53 @@ func TestBUF004_RollingHashForTruncatedPayload(t *testing.T) {
 	// Note: To fully verify, we'd need the golden hash of the raw bytes
 	// This test just verifies the field exists and is non-empty
 }
+
+// =============================================================================
+// BUF-005: Result Preview in tool_call_end
+// Contract: tool_call_end carries a result_preview built from the upstream
+//           response, truncated with "..." past 1 KiB like args previews.
+// Reference: Interface-Pack.md §1.7, §1.10
+// =============================================================================
+
+func TestBUF005_ResultPreviewInToolCallEnd(t *testing.T) {
+	skipIfNoShim(t)
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		Echo:     true,
+	})
+	h.AddTool("echo_tool", "Echo arguments", nil)
+
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+
+	h.Initialize()
+
+	// Execute: one small result, one result larger than the preview limit
+	h.CallTool("echo_tool", map[string]any{"marker": "small-result"})
+	h.CallTool("echo_tool", map[string]any{"marker": strings.Repeat("r", 4096)})
+
+	if !h.EventSink.WaitForTypeCount("tool_call_end", 2, 2*time.Second) {
+		t.Fatal("BUF-005 FAILED: expected 2 tool_call_end events")
+	}
+	ends := h.EventSink.ByType("tool_call_end")
+
+	small := ends[0]
+	if preview := testharness.GetString(small, "preview.result_preview"); !strings.Contains(preview, "small-result") {
+		t.Errorf("BUF-005 FAILED: result_preview should contain the tool result, got %q", preview)
+	}
+	if testharness.GetBool(small, "preview.truncated") {
+		t.Error("BUF-005 FAILED: small result should not be truncated")
+	}
+
+	large := ends[1]
+	preview := testharness.GetString(large, "preview.result_preview")
+	if !testharness.GetBool(large, "preview.truncated") {
+		t.Error("BUF-005 FAILED: large result should set preview.truncated=true")
+	}
+	if !strings.HasSuffix(preview, "...") || len(preview) > 1024+len("...") {
+		t.Errorf("BUF-005 FAILED: large result_preview should be cut to 1024 bytes + \"...\", got %d bytes", len(preview))
+	}
+}
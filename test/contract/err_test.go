@@ -7,6 +7,7 @@ package contract
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/peakyragnar/subluminal/pkg/testharness"
 )
@@ -421,3 +422,100 @@ func stringify(v any) string {
 		return ""
 	}
 }
+
+// =============================================================================
+// ERR-005: Upstream Timeout Synthesizes Error + TIMEOUT Status
+// Contract: When upstream misses the per-call deadline, the agent receives a
+//           JSON-RPC error, tool_call_end reports status TIMEOUT with error
+//           class "timeout" after the call's tool_call_start, and the late
+//           upstream response is dropped.
+// Reference: Interface-Pack.md §1.7
+// =============================================================================
+
+func TestERR005_UpstreamTimeoutSynthesizesError(t *testing.T) {
+	skipIfNoShim(t)
+
+	// The deadline comes from the rule so fast_tool, which queues behind the
+	// hung call upstream, is not itself timed out.
+	policyJSON := `{
+		"mode": "guardrails",
+		"policy_id": "test-err-005",
+		"policy_version": "1.0.0",
+		"rules": [
+			{
+				"rule_id": "slow-deadline",
+				"kind": "allow",
+				"match": {"tool_name": {"glob": ["slow_tool"]}},
+				"effect": {"action": "ALLOW", "timeout_ms": 100}
+			}
+		]
+	}`
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath:  shimPath,
+		ShimEnv:   []string{"SUB_POLICY_JSON=" + policyJSON},
+		SlowOn:    "slow_tool",
+		SlowDelay: 400 * time.Millisecond,
+	})
+	h.AddTool("slow_tool", "A tool that hangs", nil)
+	h.AddTool("fast_tool", "A tool that answers", nil)
+
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+
+	h.Initialize()
+
+	started := time.Now()
+	resp, err := h.CallTool("slow_tool", nil)
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed >= 400*time.Millisecond {
+		t.Errorf("ERR-005 FAILED: timeout error arrived after %s, expected ~100ms", elapsed)
+	}
+	wrapped := testharness.WrapResponse(resp)
+	if !wrapped.IsError() {
+		t.Fatal("ERR-005 FAILED: expected JSON-RPC error for timed-out call")
+	}
+
+	// The fast call queues behind the slow one upstream; its success proves
+	// the late slow_tool response was not delivered in its place.
+	resp, err = h.CallTool("fast_tool", nil)
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if !testharness.WrapResponse(resp).IsSuccess() {
+		t.Error("ERR-005 FAILED: call after timeout should succeed")
+	}
+
+	if !h.EventSink.WaitForTypeCount("tool_call_end", 2, 2*time.Second) {
+		t.Fatal("ERR-005 FAILED: expected 2 tool_call_end events")
+	}
+	ends := h.EventSink.ByType("tool_call_end")
+	if len(ends) != 2 {
+		t.Fatalf("ERR-005 FAILED: late response produced extra tool_call_end, got %d", len(ends))
+	}
+	timedOut := ends[0]
+	if got := testharness.GetString(timedOut, "call.tool_name"); got != "slow_tool" {
+		t.Fatalf("ERR-005 FAILED: first tool_call_end is for %q, expected slow_tool", got)
+	}
+	if got := testharness.GetString(timedOut, "status"); got != "TIMEOUT" {
+		t.Errorf("ERR-005 FAILED: status %q, expected TIMEOUT", got)
+	}
+	if got := testharness.GetString(timedOut, "error.class"); got != "timeout" {
+		t.Errorf("ERR-005 FAILED: error.class %q, expected timeout", got)
+	}
+
+	var slowTypes []string
+	for _, e := range h.EventSink.All() {
+		if testharness.GetString(e, "call.tool_name") == "slow_tool" {
+			slowTypes = append(slowTypes, e.Type)
+		}
+	}
+	want := []string{"tool_call_start", "tool_call_decision", "tool_call_end"}
+	if strings.Join(slowTypes, ",") != strings.Join(want, ",") {
+		t.Errorf("ERR-005 FAILED: slow_tool events %v, expected %v", slowTypes, want)
+	}
+}
@@ -5,9 +5,16 @@
 package contract
 
 import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/peakyragnar/subluminal/pkg/coord"
+	"github.com/peakyragnar/subluminal/pkg/policy"
 	"github.com/peakyragnar/subluminal/pkg/testharness"
 )
 
@@ -856,3 +863,1168 @@ func TestPOL010_ArgumentPredicatesMatch(t *testing.T) {
 		t.Error("POL-010 FAILED: Call should be blocked when args predicates match")
 	}
 }
+
+// =============================================================================
+// POL-011: Policy File Hot Reload
+// Contract: A SUB_POLICY_FILE change is swapped into the running shim, a
+//           policy_loaded event records old/new policy_hash, and budget state
+//           carries over for unchanged rule_ids.
+// Reference: Interface-Pack.md §2.6
+// =============================================================================
+
+func TestPOL011_PolicyFileHotReload(t *testing.T) {
+	skipIfNoShim(t)
+
+	const budgetPolicy = `policy_id: test-pol-011
+version: 1.0.0
+mode: guardrails
+rules:
+  - rule_id: reload-budget
+    kind: budget
+    match:
+      tool_name:
+        glob: ["reload_tool"]
+    effect:
+      budget:
+        scope: tool
+        limit_calls: 2
+        on_exceed: BLOCK
+`
+	const reloadedPolicy = budgetPolicy + `  - rule_id: deny-other
+    kind: deny
+    match:
+      tool_name:
+        glob: ["other_tool"]
+    effect:
+      action: BLOCK
+      reason_code: RELOADED_DENY
+      message: Denied after reload
+`
+
+	policyPath := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(policyPath, []byte(budgetPolicy), 0o600); err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimArgs: []string{"--policy-reload-interval=50ms"},
+		ShimEnv:  []string{"SUB_POLICY_FILE=" + policyPath},
+	})
+	h.AddTool("reload_tool", "A budgeted tool", nil)
+	h.AddTool("other_tool", "A tool denied after reload", nil)
+
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+
+	h.Initialize()
+
+	// Spend one unit of budget before the reload.
+	resp, err := h.CallTool("reload_tool", nil)
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if !testharness.WrapResponse(resp).IsSuccess() {
+		t.Fatal("POL-011 FAILED: first call should be allowed")
+	}
+	resp, err = h.CallTool("other_tool", nil)
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if !testharness.WrapResponse(resp).IsSuccess() {
+		t.Fatal("POL-011 FAILED: other_tool should be allowed before reload")
+	}
+
+	if err := os.WriteFile(policyPath, []byte(reloadedPolicy), 0o600); err != nil {
+		t.Fatalf("Failed to rewrite policy file: %v", err)
+	}
+	if !h.EventSink.WaitForTypeCount("policy_loaded", 1, 3*time.Second) {
+		t.Fatal("POL-011 FAILED: no policy_loaded event after policy file change")
+	}
+
+	loaded := h.EventSink.ByType("policy_loaded")[0]
+	if !testharness.GetBool(loaded, "policy.success") {
+		t.Fatalf("POL-011 FAILED: reload reported failure: %s", testharness.GetString(loaded, "policy.error"))
+	}
+	oldHash := testharness.GetString(loaded, "policy.previous.policy_hash")
+	newHash := testharness.GetString(loaded, "policy.current.policy_hash")
+	if oldHash == "" || newHash == "" || oldHash == newHash {
+		t.Errorf("POL-011 FAILED: expected distinct old/new policy_hash, got %q -> %q", oldHash, newHash)
+	}
+
+	resp, err = h.CallTool("other_tool", nil)
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if testharness.WrapResponse(resp).IsSuccess() {
+		t.Error("POL-011 FAILED: other_tool should be blocked by the reloaded policy")
+	}
+
+	// Budget state carries over: one call left, then BLOCK.
+	resp, err = h.CallTool("reload_tool", nil)
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if !testharness.WrapResponse(resp).IsSuccess() {
+		t.Error("POL-011 FAILED: second budgeted call should be allowed")
+	}
+	resp, err = h.CallTool("reload_tool", nil)
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if testharness.WrapResponse(resp).IsSuccess() {
+		t.Error("POL-011 FAILED: budget should carry over the reload and block the third call")
+	}
+
+	waitForDecisionCount(t, h.EventSink, 5, 2*time.Second)
+	decisions := h.EventSink.ByType("tool_call_decision")
+	last := decisions[len(decisions)-1]
+	if got := testharness.GetString(last, "decision.policy.policy_hash"); got != newHash {
+		t.Errorf("POL-011 FAILED: decision policy_hash %q, expected reloaded hash %q", got, newHash)
+	}
+}
+
+// =============================================================================
+// POL-012: TERMINATE_RUN Ends the Run
+// Contract: A breaker with on_trip TERMINATE_RUN rejects the tripping call
+//           and every later tools/call with -32084, stops the upstream, and
+//           emits run_end with status TERMINATED citing the rule_id.
+// Reference: Interface-Pack.md §1.6, §1.8, §3.2.1
+// =============================================================================
+
+func TestPOL012_TerminateRunEndsRun(t *testing.T) {
+	skipIfNoShim(t)
+
+	policyJSON := `{
+		"mode": "guardrails",
+		"policy_id": "test-pol-012",
+		"policy_version": "1.0.0",
+		"rules": [
+			{
+				"rule_id": "breaker-terminate",
+				"kind": "breaker",
+				"match": {
+					"tool_name": {"glob": ["looping_tool"]}
+				},
+				"effect": {
+					"breaker": {
+						"scope": "tool",
+						"repeat_threshold": 2,
+						"repeat_window_ms": 10000,
+						"on_trip": "TERMINATE_RUN",
+						"terminate_code": "RUNAWAY_LOOP"
+					}
+				}
+			}
+		]
+	}`
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimEnv:  []string{"SUB_POLICY_JSON=" + policyJSON},
+	})
+	h.AddTool("looping_tool", "A tool called in a loop", nil)
+
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+
+	h.Initialize()
+
+	sameArgs := map[string]any{"always": "same"}
+	resp, err := h.CallTool("looping_tool", sameArgs)
+	if err != nil {
+		t.Fatalf("Call 1 failed: %v", err)
+	}
+	if !testharness.WrapResponse(resp).IsSuccess() {
+		t.Fatal("POL-012 FAILED: first call should be allowed")
+	}
+
+	resp, err = h.CallTool("looping_tool", sameArgs)
+	if err != nil {
+		t.Fatalf("Call 2 failed: %v", err)
+	}
+	if code := testharness.WrapResponse(resp).ErrorCode(); code != -32084 {
+		t.Fatalf("POL-012 FAILED: tripping call should return -32084, got %d", code)
+	}
+
+	// Later calls are rejected until the shim exits; a closed pipe is
+	// also acceptable since the run is over.
+	if resp, err := h.CallTool("looping_tool", map[string]any{"other": "args"}); err == nil && resp != nil {
+		if code := testharness.WrapResponse(resp).ErrorCode(); code != -32084 {
+			t.Errorf("POL-012 FAILED: call after termination should return -32084, got %d", code)
+		}
+	}
+
+	if !h.EventSink.WaitForTypeCount("run_end", 1, 3*time.Second) {
+		t.Fatal("POL-012 FAILED: no run_end after TERMINATE_RUN")
+	}
+	runEnd := h.EventSink.ByType("run_end")[0]
+	if status := testharness.GetString(runEnd, "run.status"); status != "TERMINATED" {
+		t.Errorf("POL-012 FAILED: run_end status %q, expected TERMINATED", status)
+	}
+	if ruleID := testharness.GetString(runEnd, "run.terminate.rule_id"); ruleID != "breaker-terminate" {
+		t.Errorf("POL-012 FAILED: run_end rule_id %q, expected breaker-terminate", ruleID)
+	}
+	if code := testharness.GetString(runEnd, "run.terminate.terminate_code"); code != "RUNAWAY_LOOP" {
+		t.Errorf("POL-012 FAILED: run_end terminate_code %q, expected RUNAWAY_LOOP", code)
+	}
+
+	decisions := h.EventSink.ByType("tool_call_decision")
+	if len(decisions) != 2 {
+		t.Fatalf("POL-012 FAILED: expected 2 decisions, got %d", len(decisions))
+	}
+	if got := testharness.GetString(decisions[1], "decision.terminate.terminate_code"); got != "RUNAWAY_LOOP" {
+		t.Errorf("POL-012 FAILED: decision.terminate.terminate_code %q, expected RUNAWAY_LOOP", got)
+	}
+}
+
+// =============================================================================
+// POL-013: tools/list Rewrite Hides or Annotates Denied Tools
+// Contract: With --tools-list=hide, tools that every call would deny are
+//           removed from tools/list; with --tools-list=annotate they stay
+//           with the restriction in their description. Each rewrite emits
+//           tools_list_filtered naming the tools and rule_ids.
+// Reference: Interface-Pack.md §1.2
+// =============================================================================
+
+func TestPOL013_ToolsListRewrite(t *testing.T) {
+	skipIfNoShim(t)
+
+	policyJSON := `{
+		"mode": "guardrails",
+		"policy_id": "test-pol-013",
+		"policy_version": "1.0.0",
+		"rules": [
+			{
+				"rule_id": "deny-delete",
+				"kind": "deny",
+				"match": {"tool_name": {"glob": ["delete_repo"]}},
+				"effect": {"action": "BLOCK", "message": "Repository deletion is disabled"}
+			},
+			{
+				"rule_id": "deny-prod-write",
+				"kind": "deny",
+				"match": {
+					"tool_name": {"glob": ["write_file"]},
+					"args": {"key_equals": {"env": "prod"}}
+				},
+				"effect": {"action": "BLOCK"}
+			}
+		]
+	}`
+
+	listTools := func(t *testing.T, mode string) (map[string]string, *testharness.TestHarness) {
+		t.Helper()
+		h := testharness.NewTestHarness(testharness.HarnessConfig{
+			ShimPath: shimPath,
+			ShimArgs: []string{"--tools-list=" + mode},
+			ShimEnv:  []string{"SUB_POLICY_JSON=" + policyJSON},
+		})
+		h.AddTool("read_file", "Read a file", nil)
+		h.AddTool("write_file", "Write a file", nil)
+		h.AddTool("delete_repo", "Delete a repository", nil)
+
+		if err := h.Start(); err != nil {
+			t.Fatalf("Failed to start harness: %v", err)
+		}
+		t.Cleanup(func() { h.Stop() })
+		h.Initialize()
+
+		resp, err := h.Driver.ListTools()
+		if err != nil {
+			t.Fatalf("tools/list failed: %v", err)
+		}
+		raw, _ := json.Marshal(resp.Result)
+		var result struct {
+			Tools []struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+			} `json:"tools"`
+		}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			t.Fatalf("invalid tools/list result %s: %v", raw, err)
+		}
+		tools := make(map[string]string)
+		for _, tool := range result.Tools {
+			tools[tool.Name] = tool.Description
+		}
+		return tools, h
+	}
+
+	checkEvent := func(t *testing.T, h *testharness.TestHarness, mode string) {
+		t.Helper()
+		if !h.EventSink.WaitForTypeCount("tools_list_filtered", 1, 2*time.Second) {
+			t.Fatal("POL-013 FAILED: no tools_list_filtered event")
+		}
+		evt := h.EventSink.ByType("tools_list_filtered")[0]
+		if got := testharness.GetString(evt, "filter.mode"); got != mode {
+			t.Errorf("POL-013 FAILED: filter.mode %q, expected %q", got, mode)
+		}
+		tools, _ := testharness.GetField(evt, "filter.tools").([]any)
+		if len(tools) != 1 {
+			t.Fatalf("POL-013 FAILED: expected 1 filtered tool, got %v", tools)
+		}
+		tool, _ := tools[0].(map[string]any)
+		if tool["tool_name"] != "delete_repo" || tool["rule_id"] != "deny-delete" {
+			t.Errorf("POL-013 FAILED: unexpected filtered tool %v", tool)
+		}
+	}
+
+	t.Run("hide", func(t *testing.T) {
+		tools, h := listTools(t, "hide")
+		if _, ok := tools["delete_repo"]; ok {
+			t.Error("POL-013 FAILED: delete_repo should be hidden")
+		}
+		for _, name := range []string{"read_file", "write_file"} {
+			if _, ok := tools[name]; !ok {
+				t.Errorf("POL-013 FAILED: %s should remain listed", name)
+			}
+		}
+		checkEvent(t, h, "hide")
+	})
+
+	t.Run("annotate", func(t *testing.T) {
+		tools, h := listTools(t, "annotate")
+		desc, ok := tools["delete_repo"]
+		if !ok {
+			t.Fatal("POL-013 FAILED: delete_repo should remain listed")
+		}
+		if !strings.Contains(desc, "Repository deletion is disabled") || !strings.Contains(desc, "deny-delete") {
+			t.Errorf("POL-013 FAILED: description not annotated: %q", desc)
+		}
+		if strings.Contains(tools["write_file"], "Subluminal") {
+			t.Errorf("POL-013 FAILED: write_file description changed: %q", tools["write_file"])
+		}
+		checkEvent(t, h, "annotate")
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		tools, h := listTools(t, "passthrough")
+		if len(tools) != 3 || strings.Contains(tools["delete_repo"], "Subluminal") {
+			t.Errorf("POL-013 FAILED: passthrough should not rewrite, got %v", tools)
+		}
+		if n := len(h.EventSink.ByType("tools_list_filtered")); n != 0 {
+			t.Errorf("POL-013 FAILED: passthrough emitted %d tools_list_filtered events", n)
+		}
+	})
+}
+
+// =============================================================================
+// POL-014: Durable State Survives Shim Restarts
+// Contract: With SUB_STATE_DIR set, a run-scoped budget counts calls made by
+// every shim process of the same run_id; restarting the shim does not reset it.
+// =============================================================================
+
+func TestPOL014_DurableStateSurvivesRestart(t *testing.T) {
+	skipIfNoShim(t)
+
+	policyJSON := `{
+		"mode": "guardrails",
+		"policy_id": "test-pol-014",
+		"policy_version": "1.0.0",
+		"rules": [
+			{
+				"rule_id": "run-budget",
+				"kind": "budget",
+				"match": {"tool_name": {"glob": ["*"]}},
+				"effect": {"budget": {"scope": "run", "limit_calls": 3, "on_exceed": "BLOCK"}}
+			}
+		]
+	}`
+	shimEnv := []string{
+		"SUB_POLICY_JSON=" + policyJSON,
+		"SUB_RUN_ID=pol-014-run",
+		"SUB_STATE_DIR=" + t.TempDir(),
+	}
+
+	callTwice := func(label string) []*testharness.ToolCallResponse {
+		h := testharness.NewTestHarness(testharness.HarnessConfig{
+			ShimPath: shimPath,
+			ShimEnv:  shimEnv,
+		})
+		h.AddTool("test_tool", "A test tool", nil)
+		if err := h.Start(); err != nil {
+			t.Fatalf("%s: failed to start harness: %v", label, err)
+		}
+		defer h.Stop()
+		h.Initialize()
+
+		var results []*testharness.ToolCallResponse
+		for i := 0; i < 2; i++ {
+			resp, err := h.CallTool("test_tool", nil)
+			if err != nil {
+				t.Fatalf("%s: call %d failed: %v", label, i+1, err)
+			}
+			results = append(results, testharness.WrapResponse(resp))
+		}
+		return results
+	}
+
+	first := callTwice("first shim")
+	for i, result := range first {
+		if !result.IsSuccess() {
+			t.Errorf("POL-014 FAILED: first shim call %d should be within budget: %s", i+1, result.ErrorMessage())
+		}
+	}
+
+	second := callTwice("restarted shim")
+	if !second[0].IsSuccess() {
+		t.Errorf("POL-014 FAILED: call 3 of the run should be within budget: %s", second[0].ErrorMessage())
+	}
+	if second[1].IsSuccess() {
+		t.Error("POL-014 FAILED: call 4 of the run should be blocked after the shim restarted")
+	}
+}
+
+// =============================================================================
+// POL-015: Coordinator Shares Run Budgets Across Servers
+// Contract: Shims for different servers in one run_id draw from one
+// run-scoped budget held by the coordinator. With the coordinator
+// unreachable, defaults.decision_on_error decides, and fail_open_read_tools
+// exempts read_like tools from a BLOCK.
+// =============================================================================
+
+func TestPOL015_CoordinatorSharesRunBudget(t *testing.T) {
+	skipIfNoShim(t)
+
+	// Unix socket paths are length-limited; keep it short.
+	dir, err := os.MkdirTemp("", "pol015")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	sockPath := filepath.Join(dir, "coord.sock")
+
+	policyJSON := `{
+		"mode": "guardrails",
+		"policy_id": "test-pol-015",
+		"policy_version": "1.0.0",
+		"defaults": {"decision_on_error": "BLOCK", "fail_open_read_tools": true},
+		"rules": [
+			{
+				"rule_id": "tag-reads",
+				"kind": "tag",
+				"match": {"tool_name": {"glob": ["read_*"]}},
+				"effect": {"tag": {"add_risk_class": ["read_like"]}}
+			},
+			{
+				"rule_id": "run-budget",
+				"kind": "budget",
+				"match": {"tool_name": {"glob": ["*"]}},
+				"effect": {"budget": {"scope": "run", "limit_calls": 3, "on_exceed": "BLOCK"}}
+			}
+		]
+	}`
+
+	startShim := func(serverName string, tools ...string) *testharness.TestHarness {
+		h := testharness.NewTestHarness(testharness.HarnessConfig{
+			ShimPath: shimPath,
+			ShimArgs: []string{"--server-name=" + serverName},
+			ShimEnv: []string{
+				"SUB_POLICY_JSON=" + policyJSON,
+				"SUB_RUN_ID=pol-015-run",
+				"SUB_COORDINATOR_ADDR=unix://" + sockPath,
+			},
+		})
+		for _, tool := range tools {
+			h.AddTool(tool, "A test tool", nil)
+		}
+		if err := h.Start(); err != nil {
+			t.Fatalf("failed to start %s shim: %v", serverName, err)
+		}
+		h.Initialize()
+		return h
+	}
+	call := func(h *testharness.TestHarness, tool string) *testharness.ToolCallResponse {
+		resp, err := h.CallTool(tool, nil)
+		if err != nil {
+			t.Fatalf("call %s failed: %v", tool, err)
+		}
+		return testharness.WrapResponse(resp)
+	}
+
+	t.Run("shared_budget", func(t *testing.T) {
+		ln, err := net.Listen("unix", sockPath)
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		server := coord.NewServer(coord.MemoryStores())
+		go server.Serve(ln)
+		defer server.Close()
+
+		git := startShim("git", "write_a")
+		defer git.Stop()
+		fs := startShim("fs", "write_b")
+		defer fs.Stop()
+
+		within := []struct {
+			h    *testharness.TestHarness
+			tool string
+		}{{git, "write_a"}, {fs, "write_b"}, {git, "write_a"}}
+		for i, c := range within {
+			if r := call(c.h, c.tool); !r.IsSuccess() {
+				t.Fatalf("POL-015 FAILED: run call %d should be within budget: %s", i+1, r.ErrorMessage())
+			}
+		}
+		if r := call(fs, "write_b"); r.IsSuccess() {
+			t.Error("POL-015 FAILED: call 4 of the run should be blocked on the second server")
+		}
+	})
+
+	t.Run("coordinator_unreachable", func(t *testing.T) {
+		h := startShim("git", "write_a", "read_a")
+		defer h.Stop()
+
+		if r := call(h, "read_a"); !r.IsSuccess() {
+			t.Errorf("POL-015 FAILED: read_like tool should fail open: %s", r.ErrorMessage())
+		}
+		if r := call(h, "write_a"); r.IsSuccess() {
+			t.Error("POL-015 FAILED: write tool should follow decision_on_error BLOCK")
+		}
+
+		if err := h.Stop(); err != nil {
+			t.Fatalf("failed to stop harness: %v", err)
+		}
+		if !h.EventSink.WaitForTypeCount("tool_call_decision", 2, 2*time.Second) {
+			t.Fatal("POL-015 FAILED: expected 2 decisions")
+		}
+		decision := h.EventSink.ByType("tool_call_decision")[1]
+		if reason := testharness.GetString(decision, "decision.explain.reason_code"); reason != "POLICY_STATE_UNAVAILABLE" {
+			t.Errorf("POL-015 FAILED: expected POLICY_STATE_UNAVAILABLE, got %q", reason)
+		}
+	})
+}
+
+// =============================================================================
+// POL-016: Cost-Unit Budgets Report Remaining Budget
+// Contract: A limit_cost_units budget charges cost_arg's value per call,
+// refuses a call that would overspend without charging it, and reports the
+// remaining budget in decision.explain.budgets and the hint.
+// =============================================================================
+
+func TestPOL016_CostUnitBudgetReportsRemaining(t *testing.T) {
+	skipIfNoShim(t)
+
+	policyJSON := `{
+		"mode": "control",
+		"policy_id": "test-pol-016",
+		"policy_version": "1.0.0",
+		"rules": [
+			{
+				"rule_id": "fetch-cost",
+				"kind": "budget",
+				"match": {"tool_name": {"glob": ["fetch_rows"]}},
+				"effect": {"budget": {"scope": "run", "limit_cost_units": 100, "cost_arg": "limit", "on_exceed": "REJECT_WITH_HINT"}}
+			}
+		]
+	}`
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimEnv:  []string{"SUB_POLICY_JSON=" + policyJSON},
+	})
+	h.AddTool("fetch_rows", "Fetch rows", nil)
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+	h.Initialize()
+
+	for i, limit := range []int{60, 50, 40} {
+		resp, err := h.CallTool("fetch_rows", map[string]any{"limit": limit})
+		if err != nil {
+			t.Fatalf("Call %d failed: %v", i+1, err)
+		}
+		result := testharness.WrapResponse(resp)
+		if ok := i != 1; result.IsSuccess() != ok {
+			t.Errorf("POL-016 FAILED: call %d (limit=%d) success=%v, want %v", i+1, limit, result.IsSuccess(), ok)
+		}
+	}
+
+	if err := h.Stop(); err != nil {
+		t.Fatalf("Failed to stop harness: %v", err)
+	}
+	if !h.EventSink.WaitForTypeCount("tool_call_decision", 3, 2*time.Second) {
+		t.Fatal("POL-016 FAILED: expected 3 decisions")
+	}
+	decisions := h.EventSink.ByType("tool_call_decision")
+
+	remaining := func(evt testharness.CapturedEvent) any {
+		budgets, _ := testharness.GetField(evt, "decision.explain.budgets").([]any)
+		if len(budgets) != 1 {
+			return nil
+		}
+		budget, _ := budgets[0].(map[string]any)
+		return budget["remaining"]
+	}
+
+	if got := remaining(decisions[0]); got != float64(40) {
+		t.Errorf("POL-016 FAILED: expected 40 remaining after first call, got %v", got)
+	}
+	if hint := testharness.GetString(decisions[1], "decision.hint.hint_text"); !strings.Contains(hint, "40 of 100 cost units remaining") {
+		t.Errorf("POL-016 FAILED: expected remaining budget in hint, got %q", hint)
+	}
+	if got := remaining(decisions[2]); got != float64(0) {
+		t.Errorf("POL-016 FAILED: expected refused call uncharged and 0 remaining, got %v", got)
+	}
+}
+
+// =============================================================================
+// POL-017: Outcome Breaker Opens After Upstream Errors
+// Contract: A breaker with error_threshold counts failed calls within
+// window_ms and, once tripped, refuses further calls with BREAKER_OPEN until
+// cooldown_ms has passed.
+// =============================================================================
+
+func TestPOL017_ErrorBreakerOpensCircuit(t *testing.T) {
+	skipIfNoShim(t)
+
+	policyJSON := `{
+		"mode": "guardrails",
+		"policy_id": "test-pol-017",
+		"policy_version": "1.0.0",
+		"rules": [
+			{
+				"rule_id": "flaky-upstream",
+				"kind": "breaker",
+				"match": {"tool_name": {"glob": ["error_tool"]}},
+				"effect": {"breaker": {"scope": "tool", "error_threshold": 2, "window_ms": 60000, "cooldown_ms": 60000, "on_trip": "BLOCK"}}
+			}
+		]
+	}`
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimEnv:  []string{"SUB_POLICY_JSON=" + policyJSON},
+		ErrorOn:  "error_tool",
+	})
+	h.AddTool("error_tool", "Always fails", nil)
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+	h.Initialize()
+
+	for i := 0; i < 3; i++ {
+		if _, err := h.CallTool("error_tool", map[string]any{"attempt": i}); err != nil {
+			t.Fatalf("Call %d failed: %v", i+1, err)
+		}
+	}
+
+	if err := h.Stop(); err != nil {
+		t.Fatalf("Failed to stop harness: %v", err)
+	}
+	if !h.EventSink.WaitForTypeCount("tool_call_decision", 3, 2*time.Second) {
+		t.Fatal("POL-017 FAILED: expected 3 decisions")
+	}
+	decisions := h.EventSink.ByType("tool_call_decision")
+
+	for i, want := range []string{"ALLOW", "ALLOW", "BLOCK"} {
+		if got := testharness.GetString(decisions[i], "decision.action"); got != want {
+			t.Errorf("POL-017 FAILED: call %d decision %s, want %s", i+1, got, want)
+		}
+	}
+	if reason := testharness.GetString(decisions[2], "decision.explain.reason_code"); reason != "BREAKER_OPEN" {
+		t.Errorf("POL-017 FAILED: expected BREAKER_OPEN, got %q", reason)
+	}
+}
+
+// =============================================================================
+// POL-018: Argument Predicates on Nested Keys and Paths
+// Contract: match.args supports JSON-pointer keys, globs, path-prefix
+// containment with ".." resolved, and not/any_of combinators.
+// =============================================================================
+
+func TestPOL018_ArgsPredicates(t *testing.T) {
+	skipIfNoShim(t)
+
+	policyJSON := `{
+		"mode": "guardrails",
+		"policy_id": "test-pol-018",
+		"policy_version": "1.0.0",
+		"rules": [
+			{
+				"rule_id": "protect-branches",
+				"kind": "deny",
+				"match": {
+					"tool_name": {"glob": ["git_push"]},
+					"args": {"any_of": [
+						{"key_glob": {"branch": ["main", "release/*"]}},
+						{"key_equals": {"/options/force": true}}
+					]}
+				}
+			},
+			{
+				"rule_id": "stay-in-repo",
+				"kind": "deny",
+				"match": {
+					"tool_name": {"glob": ["write_file"]},
+					"args": {"not": {"path_prefix": {"path": ["/repo"]}}}
+				}
+			}
+		]
+	}`
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimEnv:  []string{"SUB_POLICY_JSON=" + policyJSON},
+	})
+	h.AddTool("git_push", "Push", nil)
+	h.AddTool("write_file", "Write", nil)
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+	h.Initialize()
+
+	calls := []struct {
+		tool    string
+		args    map[string]any
+		allowed bool
+	}{
+		{"git_push", map[string]any{"branch": "feature/x"}, true},
+		{"git_push", map[string]any{"branch": "release/1.2"}, false},
+		{"git_push", map[string]any{"branch": "feature/x", "options": map[string]any{"force": true}}, false},
+		{"write_file", map[string]any{"path": "/repo/src/main.go"}, true},
+		{"write_file", map[string]any{"path": "/repo/../etc/passwd"}, false},
+	}
+	for i, call := range calls {
+		resp, err := h.CallTool(call.tool, call.args)
+		if err != nil {
+			t.Fatalf("Call %d failed: %v", i+1, err)
+		}
+		if got := testharness.WrapResponse(resp).IsSuccess(); got != call.allowed {
+			t.Errorf("POL-018 FAILED: call %d %s(%v) success=%v, want %v", i+1, call.tool, call.args, got, call.allowed)
+		}
+	}
+}
+
+// =============================================================================
+// POL-019: Rule Conditions (when)
+// Contract: A rule's when expression is evaluated against tool, args and
+// identity; the rule applies only when it is true.
+// =============================================================================
+
+func TestPOL019_WhenExpressionGatesRule(t *testing.T) {
+	skipIfNoShim(t)
+
+	policyJSON := `{
+		"mode": "guardrails",
+		"policy_id": "test-pol-019",
+		"policy_version": "1.0.0",
+		"rules": [
+			{
+				"rule_id": "triage-may-delete",
+				"kind": "allow",
+				"match": {"tool_name": {"glob": ["delete_issue"]}},
+				"when": "identity.agent_id.startsWith('triage-') && args.issue_id.startsWith('BUG-')"
+			},
+			{
+				"rule_id": "no-delete",
+				"kind": "deny",
+				"match": {"tool_name": {"glob": ["delete_issue"]}}
+			}
+		]
+	}`
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimEnv:  []string{"SUB_POLICY_JSON=" + policyJSON, "SUB_AGENT_ID=triage-bot"},
+	})
+	h.AddTool("delete_issue", "Delete an issue", nil)
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+	h.Initialize()
+
+	for i, call := range []struct {
+		issueID string
+		allowed bool
+	}{
+		{"BUG-1", true},
+		{"FEAT-2", false},
+	} {
+		resp, err := h.CallTool("delete_issue", map[string]any{"issue_id": call.issueID})
+		if err != nil {
+			t.Fatalf("Call %d failed: %v", i+1, err)
+		}
+		if got := testharness.WrapResponse(resp).IsSuccess(); got != call.allowed {
+			t.Errorf("POL-019 FAILED: delete_issue(%s) success=%v, want %v", call.issueID, got, call.allowed)
+		}
+	}
+}
+
+// =============================================================================
+// POL-020: Session-Scoped Promotion
+// Contract: A rule promoted into a run's state (sub policy promote) unblocks
+// the promoted call in the running shim without a restart; other calls stay
+// blocked.
+// =============================================================================
+
+func TestPOL020_PromotedRuleUnblocksRunningShim(t *testing.T) {
+	skipIfNoShim(t)
+
+	policyJSON := `{
+		"mode": "control",
+		"policy_id": "test-pol-020",
+		"policy_version": "1.0.0",
+		"rules": [
+			{
+				"rule_id": "no-push",
+				"kind": "deny",
+				"match": {"tool_name": {"glob": ["push"]}}
+			}
+		]
+	}`
+	stateDir := t.TempDir()
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimEnv: []string{
+			"SUB_POLICY_JSON=" + policyJSON,
+			"SUB_RUN_ID=pol-020-run",
+			"SUB_STATE_DIR=" + stateDir,
+		},
+	})
+	h.AddTool("push", "Push a branch", nil)
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+	h.Initialize()
+
+	push := func(branch string) bool {
+		t.Helper()
+		resp, err := h.CallTool("push", map[string]any{"branch": branch})
+		if err != nil {
+			t.Fatalf("push(%s) failed: %v", branch, err)
+		}
+		return testharness.WrapResponse(resp).IsSuccess()
+	}
+
+	if push("main") {
+		t.Fatal("POL-020 FAILED: push should be rejected before promotion")
+	}
+
+	store, err := policy.NewFileStateStore(stateDir, "pol-020-run")
+	if err != nil {
+		t.Fatalf("state store: %v", err)
+	}
+	rule := policy.PromoteRule(policy.PromotedRuleID("call-1"), "test", "push", map[string]any{"branch": "main"})
+	if err := policy.AddPromotion(store, policy.Promotion{CallID: "call-1", Rule: rule}); err != nil {
+		t.Fatalf("AddPromotion: %v", err)
+	}
+
+	if !push("main") {
+		t.Error("POL-020 FAILED: promoted push(main) should be allowed")
+	}
+	if push("release") {
+		t.Error("POL-020 FAILED: push(release) was not promoted and should stay rejected")
+	}
+
+	if !h.EventSink.WaitForTypeCount("tool_call_decision", 3, 2*time.Second) {
+		t.Fatal("expected 3 tool_call_decision events")
+	}
+	decisions := h.EventSink.ByType("tool_call_decision")
+	if reason := testharness.GetString(decisions[1], "decision.explain.reason_code"); reason != "PROMOTED_ALLOW" {
+		t.Errorf("POL-020 FAILED: expected reason_code PROMOTED_ALLOW, got %q", reason)
+	}
+}
+
+// =============================================================================
+// POL-021: Layered Bundles
+// Contract: With a layer set, any applicable layer can deny; the decision
+// event names the layer and its policy_hash, while decision.policy stays the
+// layer set's.
+// =============================================================================
+
+func TestPOL021_LayerSetNamesDecidingLayer(t *testing.T) {
+	skipIfNoShim(t)
+
+	policyJSON := `{
+		"policy_id": "test-pol-021",
+		"version": "1.0.0",
+		"layers": [
+			{"name": "global", "bundle": {
+				"policy_id": "global",
+				"mode": "control",
+				"rules": [{"rule_id": "allow-all", "kind": "allow", "match": {"tool_name": {"glob": ["*"]}}}]
+			}},
+			{"name": "repo", "bundle": {
+				"policy_id": "repo",
+				"mode": "control",
+				"rules": [{"rule_id": "no-drop", "kind": "deny", "match": {"tool_name": {"glob": ["drop_table"]}}}]
+			}},
+			{"name": "kill-switch", "bundle": {
+				"policy_id": "kill",
+				"mode": "control",
+				"selectors": {"env": ["prod"]},
+				"rules": [{"rule_id": "stop", "kind": "deny", "match": {"tool_name": {"glob": ["*"]}}}]
+			}}
+		]
+	}`
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimEnv:  []string{"SUB_POLICY_JSON=" + policyJSON, "SUB_ENV=dev"},
+	})
+	h.AddTool("query", "Run a query", nil)
+	h.AddTool("drop_table", "Drop a table", nil)
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+	h.Initialize()
+
+	for i, call := range []struct {
+		tool    string
+		allowed bool
+	}{
+		{"query", true},
+		{"drop_table", false},
+	} {
+		resp, err := h.CallTool(call.tool, map[string]any{})
+		if err != nil {
+			t.Fatalf("Call %d failed: %v", i+1, err)
+		}
+		if got := testharness.WrapResponse(resp).IsSuccess(); got != call.allowed {
+			t.Errorf("POL-021 FAILED: %s success=%v, want %v", call.tool, got, call.allowed)
+		}
+	}
+
+	if !h.EventSink.WaitForTypeCount("tool_call_decision", 2, 2*time.Second) {
+		t.Fatal("expected 2 tool_call_decision events")
+	}
+	decisions := h.EventSink.ByType("tool_call_decision")
+	for i, want := range []struct{ layer, ruleID string }{
+		{"global", "allow-all"},
+		{"repo", "no-drop"},
+	} {
+		evt := decisions[i]
+		if got := testharness.GetString(evt, "decision.layer.name"); got != want.layer {
+			t.Errorf("POL-021 FAILED: decision %d layer = %q, want %q", i+1, got, want.layer)
+		}
+		if got := testharness.GetString(evt, "decision.rule_id"); got != want.ruleID {
+			t.Errorf("POL-021 FAILED: decision %d rule_id = %q, want %q", i+1, got, want.ruleID)
+		}
+		layerHash := testharness.GetString(evt, "decision.layer.policy_hash")
+		if layerHash == "" || layerHash == testharness.GetString(evt, "decision.policy.policy_hash") {
+			t.Errorf("POL-021 FAILED: decision %d layer policy_hash %q should be set and differ from the layer set's", i+1, layerHash)
+		}
+		if got := testharness.GetString(evt, "decision.policy.policy_id"); got != "test-pol-021" {
+			t.Errorf("POL-021 FAILED: decision %d policy_id = %q, want the layer set's", i+1, got)
+		}
+	}
+}
+
+// =============================================================================
+// POL-022: Signed Policy Snapshots
+// Contract: With SUB_POLICY_TRUSTED_KEYS set, an unsigned SUB_POLICY_FILE is
+//           refused and every call is blocked (fail_closed); a
+//           policy_verification event records each result. A reload that
+//           fails verification keeps the active policy.
+// Reference: Interface-Pack.md §2.11
+// =============================================================================
+
+func TestPOL022_SignedPolicySnapshots(t *testing.T) {
+	skipIfNoShim(t)
+
+	dir := t.TempDir()
+	keyDir := filepath.Join(dir, "keys")
+	if _, err := policy.GenerateKey(keyDir, "ci"); err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	key, err := policy.LoadSigningKey(filepath.Join(keyDir, "ci.key"))
+	if err != nil {
+		t.Fatalf("LoadSigningKey: %v", err)
+	}
+	compiled, err := policy.CompileBundle(policy.BundleSpec{PolicyID: "test-pol-022", Mode: "guardrails"})
+	if err != nil {
+		t.Fatalf("CompileBundle: %v", err)
+	}
+	snapshotPath := filepath.Join(dir, "snapshot.json")
+	if err := os.WriteFile(snapshotPath, compiled.Snapshot, 0o600); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimArgs: []string{"--policy-reload-interval=50ms"},
+		ShimEnv: []string{
+			"SUB_POLICY_FILE=" + snapshotPath,
+			"SUB_POLICY_TRUSTED_KEYS=" + keyDir,
+		},
+	})
+	h.AddTool("query", "Run a query", nil)
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+	h.Initialize()
+
+	expectVerification := func(n int, result, fallback string) {
+		t.Helper()
+		if !h.EventSink.WaitForTypeCount("policy_verification", n, 3*time.Second) {
+			t.Fatalf("POL-022 FAILED: expected %d policy_verification events", n)
+		}
+		evt := h.EventSink.ByType("policy_verification")[n-1]
+		if got := testharness.GetString(evt, "verification.result"); got != result {
+			t.Errorf("POL-022 FAILED: verification %d result = %q, want %q", n, got, result)
+		}
+		if got := testharness.GetString(evt, "verification.fallback"); got != fallback {
+			t.Errorf("POL-022 FAILED: verification %d fallback = %q, want %q", n, got, fallback)
+		}
+	}
+	callAllowed := func() bool {
+		t.Helper()
+		resp, err := h.CallTool("query", map[string]any{})
+		if err != nil {
+			t.Fatalf("Failed to call tool: %v", err)
+		}
+		return testharness.WrapResponse(resp).IsSuccess()
+	}
+
+	expectVerification(1, "UNSIGNED", "fail_closed")
+	if callAllowed() {
+		t.Error("POL-022 FAILED: an unsigned snapshot should block every call")
+	}
+
+	// Signing the snapshot lets the reload through.
+	if _, err := policy.SignFile(snapshotPath, key); err != nil {
+		t.Fatalf("SignFile: %v", err)
+	}
+	expectVerification(2, "VERIFIED", "")
+	if got := testharness.GetString(h.EventSink.ByType("policy_verification")[1], "verification.policy.policy_hash"); got != compiled.Hash {
+		t.Errorf("POL-022 FAILED: verified policy_hash = %q, want %q", got, compiled.Hash)
+	}
+	if !callAllowed() {
+		t.Error("POL-022 FAILED: the verified snapshot should allow the call")
+	}
+
+	// Tampering is refused and the verified policy stays active.
+	if err := os.WriteFile(snapshotPath, append(compiled.Snapshot, ' '), 0o600); err != nil {
+		t.Fatalf("Failed to tamper snapshot: %v", err)
+	}
+	expectVerification(3, "BAD_SIGNATURE", "keep_current")
+	if !callAllowed() {
+		t.Error("POL-022 FAILED: a tampered reload should keep the verified policy")
+	}
+}
+
+// =============================================================================
+// POL-023: Workload Context Reaches Policy
+// Contract: SUB_WORKLOAD is visible to workload selectors and to when
+// expressions (workload.*), like the identity fields.
+// =============================================================================
+
+func TestPOL023_WorkloadSelectorsAndWhen(t *testing.T) {
+	skipIfNoShim(t)
+
+	policyJSON := `{
+		"mode": "guardrails",
+		"policy_id": "test-pol-023",
+		"policy_version": "1.0.0",
+		"selectors": {"workload": {"repo": ["infra"]}},
+		"rules": [
+			{
+				"rule_id": "core-main-frozen",
+				"kind": "deny",
+				"match": {"tool_name": {"glob": ["deploy"]}},
+				"when": "workload.branch == 'main' && workload.labels.team == 'core'"
+			}
+		]
+	}`
+
+	deployAllowed := func(workload string) bool {
+		t.Helper()
+		env := []string{"SUB_POLICY_JSON=" + policyJSON}
+		if workload != "" {
+			env = append(env, "SUB_WORKLOAD="+workload)
+		}
+		h := testharness.NewTestHarness(testharness.HarnessConfig{ShimPath: shimPath, ShimEnv: env})
+		h.AddTool("deploy", "Deploy a service", nil)
+		if err := h.Start(); err != nil {
+			t.Fatalf("Failed to start harness: %v", err)
+		}
+		defer h.Stop()
+		h.Initialize()
+
+		resp, err := h.CallTool("deploy", map[string]any{})
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		return testharness.WrapResponse(resp).IsSuccess()
+	}
+
+	for _, run := range []struct {
+		workload string
+		allowed  bool
+	}{
+		{`{"repo":"infra","branch":"main","labels":{"team":"core"}}`, false},
+		{`{"repo":"infra","branch":"feature","labels":{"team":"core"}}`, true},
+		{`{"repo":"web","branch":"main","labels":{"team":"core"}}`, true},
+		{"", true},
+	} {
+		if got := deployAllowed(run.workload); got != run.allowed {
+			t.Errorf("POL-023 FAILED: SUB_WORKLOAD=%s deploy success=%v, want %v", run.workload, got, run.allowed)
+		}
+	}
+}
+
+// =============================================================================
+// POL-024: Oversized Arguments Cannot Slip Past a Deny's when
+// Contract: A when expression that exceeds its cost limit on a huge
+// argument fails closed: the deny rule blocks with WHEN_EVAL_ERROR.
+// Reference: Interface-Pack.md §2.4.1
+// =============================================================================
+
+func TestPOL024_WhenCostLimitFailsClosed(t *testing.T) {
+	skipIfNoShim(t)
+
+	policyJSON := `{
+		"mode": "guardrails",
+		"policy_id": "test-pol-024",
+		"policy_version": "1.0.0",
+		"rules": [
+			{
+				"rule_id": "no-drop",
+				"kind": "deny",
+				"match": {"tool_name": {"glob": ["query"]}},
+				"when": "args.sql.contains('DROP') || args.sql.contains('drop')"
+			}
+		]
+	}`
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimEnv:  []string{"SUB_POLICY_JSON=" + policyJSON},
+	})
+	h.AddTool("query", "Run SQL", nil)
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+	h.Initialize()
+
+	huge := strings.Repeat("x", 6<<20) + " drop table users"
+	resp, err := h.CallTool("query", map[string]any{"sql": huge})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if testharness.WrapResponse(resp).IsSuccess() {
+		t.Fatal("POL-024 FAILED: a 6 MiB argument containing drop was allowed")
+	}
+
+	if !h.EventSink.WaitForTypeCount("tool_call_decision", 1, 2*time.Second) {
+		t.Fatal("POL-024 FAILED: no tool_call_decision event")
+	}
+	decisions := h.EventSink.ByType("tool_call_decision")
+	if got := testharness.GetString(decisions[0], "decision.explain.reason_code"); got != "WHEN_EVAL_ERROR" {
+		t.Errorf("POL-024 FAILED: reason_code = %q, want WHEN_EVAL_ERROR", got)
+	}
+}
@@ -1,11 +1,18 @@
 // Package contract contains integration tests for Subluminal contracts.
 //
 // This file tests PROC-* contracts (process supervision).
-// Reference: Contract-Test-Checklist.md PROC-001/002/003
+// Reference: Contract-Test-Checklist.md PROC-001/002/003, Interface-Pack.md §7.5, §7.6, §7.7
 package contract
 
 import (
+	"bytes"
+	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -145,33 +152,393 @@ func TestPROC003_UpstreamCrashHandledGracefully(t *testing.T) {
 
 	// Execute: Call tool that crashes
 	// This should not hang (no deadlock) - the shim should detect upstream exit
-	done := make(chan bool, 1)
+	done := make(chan *testharness.JSONRPCResponse, 1)
 	go func() {
-		h.CallTool("crasher", nil)
-		done <- true
+		resp, _ := h.CallTool("crasher", nil)
+		done <- resp
 	}()
 
 	// Assert: Call completes (no deadlock) within timeout
+	var resp *testharness.JSONRPCResponse
 	select {
-	case <-done:
-		// Good - call completed (shim detected upstream crash and shut down)
+	case resp = <-done:
+		// Good - call completed (shim detected upstream crash and answered)
 	case <-time.After(5 * time.Second):
 		t.Fatal("PROC-003 FAILED: Tool call deadlocked after upstream crash\n" +
 			"  Per contract, upstream crash should not cause deadlock")
 	}
 
+	// Assert: The agent got a JSON-RPC error for the orphaned call
+	if resp == nil || testharness.WrapResponse(resp).ErrorCode() != -32002 {
+		t.Errorf("PROC-003 FAILED: expected error -32002 for the orphaned call, got %+v", resp)
+	}
+
 	// Stop harness to ensure all events are captured
 	h.Stop()
 
-	// Assert: run_end was emitted (shim shut down gracefully)
+	// Assert: The orphaned call ended with a transport error
+	if !h.EventSink.WaitForTypeCount("tool_call_end", 1, 2*time.Second) {
+		t.Fatal("PROC-003 FAILED: No tool_call_end for the call in flight when upstream crashed")
+	}
+	end := h.EventSink.ByType("tool_call_end")[0]
+	if got := testharness.GetString(end, "status"); got != "ERROR" {
+		t.Errorf("PROC-003 FAILED: tool_call_end status = %q, want ERROR", got)
+	}
+	if got := testharness.GetString(end, "error.class"); got != "transport" {
+		t.Errorf("PROC-003 FAILED: tool_call_end error.class = %q, want transport", got)
+	}
+
+	// Assert: run_end was emitted (shim shut down gracefully) and reports the crash
 	runEnds := h.EventSink.ByType("run_end")
 	if len(runEnds) == 0 {
-		t.Error("PROC-003 FAILED: No run_end event after upstream crash\n" +
+		t.Fatal("PROC-003 FAILED: No run_end event after upstream crash\n" +
 			"  Per contract, shim should emit run_end even after crash")
 	}
+	if got := testharness.GetString(runEnds[0], "run.status"); got != "FAILED" {
+		t.Errorf("PROC-003 FAILED: run_end status = %q, want FAILED", got)
+	}
+	if got := testharness.GetInt(runEnds[0], "run.upstream.exit_code"); got != 1 {
+		t.Errorf("PROC-003 FAILED: run_end upstream.exit_code = %d, want 1", got)
+	}
+	if got := testharness.GetInt(runEnds[0], "run.summary.errors_total"); got != 1 {
+		t.Errorf("PROC-003 FAILED: run_end errors_total = %d, want 1", got)
+	}
+}
+
+// =============================================================================
+// PROC-004: Upstream Stderr Drained and Ledgered
+// Contract: The shim drains upstream stderr, emitting each line as an
+//           upstream_log event; when the upstream exits non-zero, run_end
+//           carries its exit code and last stderr lines.
+// Reference: Interface-Pack.md §7.5
+// =============================================================================
+
+func TestPROC004_UpstreamStderrDrainedAndLedgered(t *testing.T) {
+	skipIfNoShim(t)
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath:    shimPath,
+		CrashOn:     "crasher",
+		StderrLines: 3,
+	})
+	h.AddTool("crasher", "A tool that crashes", nil)
+
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+
+	h.Initialize()
+	h.CallTool("crasher", nil)
+
+	if !h.EventSink.WaitForTypeCount("run_end", 1, 5*time.Second) {
+		t.Fatal("PROC-004 FAILED: no run_end after upstream crash")
+	}
+
+	logs := h.EventSink.ByType("upstream_log")
+	if len(logs) != 4 {
+		t.Fatalf("PROC-004 FAILED: expected 4 upstream_log events, got %d", len(logs))
+	}
+	if got := testharness.GetString(logs[0], "log.line"); got != "fakemcp: log line 1" {
+		t.Errorf("PROC-004 FAILED: first upstream_log line = %q", got)
+	}
+
+	runEnd := h.EventSink.ByType("run_end")[0]
+	if got := testharness.GetInt(runEnd, "run.upstream.exit_code"); got != 1 {
+		t.Errorf("PROC-004 FAILED: run_end upstream.exit_code = %d, want 1", got)
+	}
+	tail, _ := testharness.GetField(runEnd, "run.upstream.stderr_tail").([]any)
+	if len(tail) != 4 || tail[3] != "fakemcp: crashing on crasher" {
+		t.Errorf("PROC-004 FAILED: run_end upstream.stderr_tail = %v", tail)
+	}
+}
+
+// =============================================================================
+// PROC-005: Shim Signal Ends Run CANCELLED
+// Contract: When the shim is interrupted, a call still in flight ends with a
+//           transport error and run_end status is CANCELLED.
+// Reference: Interface-Pack.md §1.8
+// =============================================================================
+
+func TestPROC005_ShimSignalEndsRunCancelled(t *testing.T) {
+	skipIfNoShim(t)
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath:  shimPath,
+		SlowOn:    "long_running",
+		SlowDelay: 10 * time.Second,
+	})
+	h.AddTool("long_running", "A long-running tool", nil)
+
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
 
-	// Note: tool_call_end may or may not be present depending on timing
-	// The critical assertion is that the shim doesn't hang and emits run_end
+	h.Initialize()
+	go h.CallTool("long_running", nil)
+	if !h.EventSink.WaitForTypeCount("tool_call_start", 1, 2*time.Second) {
+		t.Fatal("PROC-005 FAILED: long_running call never started")
+	}
+
+	shimPID := getShimPID(h)
+	if shimPID <= 0 {
+		t.Skip("PROC-005: shim PID unavailable")
+	}
+	if err := syscall.Kill(shimPID, syscall.SIGINT); err != nil {
+		t.Fatalf("PROC-005: signal shim: %v", err)
+	}
+
+	if !h.EventSink.WaitForTypeCount("run_end", 1, 5*time.Second) {
+		t.Fatal("PROC-005 FAILED: No run_end after SIGINT")
+	}
+	if got := testharness.GetString(h.EventSink.ByType("run_end")[0], "run.status"); got != "CANCELLED" {
+		t.Errorf("PROC-005 FAILED: run_end status = %q, want CANCELLED", got)
+	}
+	ends := h.EventSink.ByType("tool_call_end")
+	if len(ends) != 1 || testharness.GetString(ends[0], "error.class") != "transport" {
+		t.Errorf("PROC-005 FAILED: expected one transport tool_call_end, got %d", len(ends))
+	}
+}
+
+// =============================================================================
+// PROC-006: Supervisor Restarts a Crashed Upstream
+// Contract: With --restart-upstream, a call in flight when the upstream
+//           crashes fails as retryable, the upstream restarts with the
+//           initialize handshake replayed, and later calls succeed. Past
+//           --restart-max restarts the shim gives up and the run FAILS.
+// Reference: Interface-Pack.md §7.6
+// =============================================================================
+
+func TestPROC006_SupervisorRestartsCrashedUpstream(t *testing.T) {
+	skipIfNoShim(t)
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimArgs: []string{"--restart-upstream", "--restart-max=1"},
+		CrashOn:  "crasher",
+	})
+	h.AddTool("crasher", "A tool that crashes", nil)
+	h.AddTool("test_tool", "A test tool", nil)
+
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+
+	h.Initialize()
+
+	// Crash once: the call fails as retryable and the upstream restarts
+	resp, err := h.CallTool("crasher", nil)
+	if err != nil || testharness.WrapResponse(resp).ErrorCode() != -32002 {
+		t.Fatalf("PROC-006 FAILED: expected error -32002 for the crashed call, got %+v (%v)", resp, err)
+	}
+	if !h.EventSink.WaitForTypeCount("upstream_restart", 1, 5*time.Second) {
+		t.Fatal("PROC-006 FAILED: No upstream_restart after the crash")
+	}
+	restart := h.EventSink.ByType("upstream_restart")[0]
+	if got := testharness.GetString(restart, "restart.result"); got != "RESTARTED" {
+		t.Errorf("PROC-006 FAILED: restart.result = %q, want RESTARTED", got)
+	}
+	if got := testharness.GetInt(restart, "restart.exit_code"); got != 1 {
+		t.Errorf("PROC-006 FAILED: restart.exit_code = %d, want 1", got)
+	}
+	if got := testharness.GetInt(restart, "restart.calls_failed"); got != 1 {
+		t.Errorf("PROC-006 FAILED: restart.calls_failed = %d, want 1", got)
+	}
+	if !h.EventSink.WaitForTypeCount("tool_call_end", 1, 2*time.Second) {
+		t.Fatal("PROC-006 FAILED: No tool_call_end for the crashed call")
+	}
+	if !testharness.GetBool(h.EventSink.ByType("tool_call_end")[0], "error.retryable") {
+		t.Error("PROC-006 FAILED: expected the crashed call to be retryable")
+	}
+
+	// The restarted upstream serves calls
+	resp, err = h.CallTool("test_tool", nil)
+	if err != nil || !testharness.WrapResponse(resp).IsSuccess() {
+		t.Fatalf("PROC-006 FAILED: call after restart failed: %+v (%v)", resp, err)
+	}
+
+	// Crash again: the restart budget is spent
+	h.CallTool("crasher", nil)
+	if !h.EventSink.WaitForTypeCount("run_end", 1, 5*time.Second) {
+		t.Fatal("PROC-006 FAILED: No run_end after the crash loop")
+	}
+	restarts := h.EventSink.ByType("upstream_restart")
+	if len(restarts) != 2 || testharness.GetString(restarts[1], "restart.result") != "GAVE_UP" {
+		t.Errorf("PROC-006 FAILED: expected a second upstream_restart with GAVE_UP, got %d events", len(restarts))
+	}
+	if got := testharness.GetString(h.EventSink.ByType("run_end")[0], "run.status"); got != "FAILED" {
+		t.Errorf("PROC-006 FAILED: run_end status = %q, want FAILED", got)
+	}
+}
+
+// =============================================================================
+// PROC-007: CPU Limit Breach Is Reported
+// Contract: With --limit-cpu, an upstream that uses up its CPU time is
+//           stopped, an upstream_limit event names the cpu limit, and
+//           run_end reports the killing signal.
+// Reference: Interface-Pack.md §7.7
+// =============================================================================
+
+func TestPROC007_CPULimitBreachReported(t *testing.T) {
+	skipIfNoShim(t)
+
+	h := testharness.NewTestHarness(testharness.HarnessConfig{
+		ShimPath: shimPath,
+		ShimArgs: []string{"--limit-cpu=1s"},
+		SpinOn:   "spinner",
+	})
+	h.AddTool("spinner", "A tool that burns CPU", nil)
+
+	if err := h.Start(); err != nil {
+		t.Fatalf("Failed to start harness: %v", err)
+	}
+	defer h.Stop()
+
+	h.Initialize()
+
+	resp, err := h.CallTool("spinner", nil)
+	if err != nil || testharness.WrapResponse(resp).ErrorCode() != -32002 {
+		t.Fatalf("PROC-007 FAILED: expected error -32002 once the upstream is stopped, got %+v (%v)", resp, err)
+	}
+
+	if !h.EventSink.WaitForTypeCount("run_end", 1, 5*time.Second) {
+		t.Fatal("PROC-007 FAILED: No run_end after the CPU limit")
+	}
+	limits := h.EventSink.ByType("upstream_limit")
+	if len(limits) != 1 {
+		t.Fatalf("PROC-007 FAILED: expected one upstream_limit event, got %d", len(limits))
+	}
+	if got := testharness.GetString(limits[0], "limit.resource"); got != "cpu" {
+		t.Errorf("PROC-007 FAILED: limit.resource = %q, want cpu", got)
+	}
+	if got := testharness.GetString(limits[0], "limit.source"); got != "signal" {
+		t.Errorf("PROC-007 FAILED: limit.source = %q, want signal", got)
+	}
+	if got := testharness.GetInt(limits[0], "limit.limit"); got != 1 {
+		t.Errorf("PROC-007 FAILED: limit.limit = %d, want 1", got)
+	}
+
+	runEnd := h.EventSink.ByType("run_end")[0]
+	if got := testharness.GetString(runEnd, "run.status"); got != "FAILED" {
+		t.Errorf("PROC-007 FAILED: run_end status = %q, want FAILED", got)
+	}
+	if got := testharness.GetString(runEnd, "run.upstream.signal"); got != "SIGXCPU" && got != "SIGKILL" {
+		t.Errorf("PROC-007 FAILED: run.upstream.signal = %q, want SIGXCPU or SIGKILL", got)
+	}
+}
+
+// =============================================================================
+// PROC-008: Killed Parent Leaves Nothing Running
+// Contract: When the agent client is SIGKILLed while its stdin pipe stays
+//           open elsewhere, the shim notices the parent is gone and exits,
+//           stopping the upstream. No shim or upstream remains.
+// Reference: Subliminal-Design.md (no orphan processes)
+// =============================================================================
+
+func TestPROC008_ParentKilledLeavesNothingRunning(t *testing.T) {
+	skipIfNoShim(t)
+	if runtime.GOOS != "linux" {
+		t.Skip("PROC-008: finds the upstream through /proc")
+	}
+
+	fakemcp := filepath.Join(filepath.Dir(shimPath), "fakemcp")
+	if p := os.Getenv("SUBLUMINAL_FAKEMCP_PATH"); p != "" {
+		fakemcp = p
+	}
+
+	// A shell stands in for the agent client. The test holds the shim's
+	// stdin open, like a descriptor inherited by another process. (A
+	// background job's stdin is /dev/null unless passed on explicitly.)
+	parent := exec.Command("sh", "-c", `exec 3<&0; "$0" --server-name=test -- "$1" <&3 3<&- & echo $!; wait`, shimPath, fakemcp)
+	// An os.Pipe rather than StdinPipe, which Wait would close
+	stdinRead, stdin, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("PROC-008: stdin pipe: %v", err)
+	}
+	defer stdin.Close()
+	parent.Stdin = stdinRead
+	stdout, err := parent.StdoutPipe()
+	if err != nil {
+		t.Fatalf("PROC-008: stdout pipe: %v", err)
+	}
+	if err := parent.Start(); err != nil {
+		t.Fatalf("PROC-008: start parent: %v", err)
+	}
+	stdinRead.Close()
+
+	var shimPID int
+	if _, err := fmt.Fscan(stdout, &shimPID); err != nil {
+		parent.Process.Kill()
+		t.Fatalf("PROC-008: read shim PID: %v", err)
+	}
+	upstreamPID := waitForChild(shimPID, 5*time.Second)
+	if upstreamPID <= 0 {
+		parent.Process.Kill()
+		t.Fatal("PROC-008: upstream did not start")
+	}
+
+	if err := parent.Process.Kill(); err != nil {
+		t.Fatalf("PROC-008: kill parent: %v", err)
+	}
+	parent.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for processExists(shimPID) || processExists(upstreamPID) {
+		if time.Now().After(deadline) {
+			shimLeft, upstreamLeft := processExists(shimPID), processExists(upstreamPID)
+			syscall.Kill(shimPID, syscall.SIGKILL)
+			syscall.Kill(upstreamPID, syscall.SIGKILL)
+			t.Fatalf("PROC-008 FAILED: still running after the parent was killed (shim %v, upstream %v)", shimLeft, upstreamLeft)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// =============================================================================
+// PROC-009: Rlimits Are Set Before the Upstream Runs
+// Contract: A process the upstream forks as its first act already has the
+//           --limit-* rlimits; there is no window after exec without them.
+// Reference: Interface-Pack.md §7.7
+// =============================================================================
+
+func TestPROC009_LimitsSetBeforeUpstreamRuns(t *testing.T) {
+	skipIfNoShim(t)
+	if runtime.GOOS != "linux" {
+		t.Skip("PROC-009: limits are Linux only")
+	}
+
+	out := filepath.Join(t.TempDir(), "nofile")
+	// The upstream forks at once; the child reports its open-files limit
+	shim := exec.Command(shimPath, "--server-name=test", "--limit-files=64", "--",
+		"sh", "-c", `(ulimit -n > "$0.tmp" && mv "$0.tmp" "$0") & exec cat`, out)
+	stdin, err := shim.StdinPipe()
+	if err != nil {
+		t.Fatalf("PROC-009: stdin pipe: %v", err)
+	}
+	if err := shim.Start(); err != nil {
+		t.Fatalf("PROC-009: start shim: %v", err)
+	}
+	defer func() {
+		stdin.Close()
+		shim.Wait()
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := os.ReadFile(out)
+		if err == nil {
+			if limit := strings.TrimSpace(string(got)); limit != "64" {
+				t.Fatalf("PROC-009 FAILED: forked child has open-files limit %s, want 64", limit)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("PROC-009 FAILED: forked child did not report its limit")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
 }
 
 // =============================================================================
@@ -180,9 +547,30 @@ func TestPROC003_UpstreamCrashHandledGracefully(t *testing.T) {
 
 // getShimPID extracts the shim process ID from the harness.
 // Returns 0 if not available.
-func getShimPID(_ *testharness.TestHarness) int {
-	// Note: This would need access to harness internals
-	// For now, return 0 (tests will skip PID-based checks)
+func getShimPID(h *testharness.TestHarness) int {
+	return h.ShimPID()
+}
+
+// waitForChild returns the PID of a child of pid, waiting up to timeout
+// for one to appear. Returns 0 if none does.
+func waitForChild(pid int, timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+		for _, path := range stats {
+			stat, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			// pid (comm) state ppid ...
+			fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+			if len(fields) > 1 && fields[1] == strconv.Itoa(pid) {
+				child, _ := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+				return child
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
 	return 0
 }
 
@@ -196,6 +584,14 @@ func processExists(pid int) bool {
 		return false
 	}
 	// On Unix, FindProcess always succeeds. Send signal 0 to check existence.
-	err = process.Signal(syscall.Signal(0))
-	return err == nil
+	if err := process.Signal(syscall.Signal(0)); err != nil {
+		return false
+	}
+	// A zombie has exited and only awaits reaping by the harness
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
 }
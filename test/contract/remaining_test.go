@@ -7,6 +7,7 @@ package contract
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -205,6 +206,9 @@ func TestLED001_LedgerIngestionDurability(t *testing.T) {
 	if actual := sqliteQuery(t, dbPath, "SELECT COUNT(*) FROM previews;"); actual != expectedPreviews {
 		t.Fatalf("LED-001 FAILED: preview count=%s, expected %s", actual, expectedPreviews)
 	}
+	if actual := sqliteQuery(t, dbPath, "SELECT COUNT(*) FROM previews WHERE result_preview IS NULL OR result_preview = '';"); actual != "0" {
+		t.Fatalf("LED-001 FAILED: previews missing result_preview=%s, expected 0", actual)
+	}
 
 	expectedHints := fmt.Sprintf("%d", runCount*callsPerRun)
 	if actual := sqliteQuery(t, dbPath, "SELECT COUNT(*) FROM hints;"); actual != expectedHints {
@@ -1150,10 +1154,41 @@ func appendEvent(t *testing.T, buf *bytes.Buffer, evt any) {
 
 func sqliteQuery(t *testing.T, dbPath, query string) string {
 	t.Helper()
-	cmd := exec.Command("sqlite3", "-batch", dbPath, query)
-	output, err := cmd.CombinedOutput()
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("LED-001 FAILED: open ledger: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("LED-001 FAILED: sqlite error: %v", err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
 	if err != nil {
-		t.Fatalf("LED-001 FAILED: sqlite3 error: %v (%s)", err, strings.TrimSpace(string(output)))
+		t.Fatalf("LED-001 FAILED: sqlite error: %v", err)
+	}
+
+	// Render like the sqlite3 CLI: "|" between columns, one row per line.
+	var lines []string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			t.Fatalf("LED-001 FAILED: sqlite error: %v", err)
+		}
+		fields := make([]string, len(values))
+		for i, value := range values {
+			fields[i] = value.String
+		}
+		lines = append(lines, strings.Join(fields, "|"))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("LED-001 FAILED: sqlite error: %v", err)
 	}
-	return strings.TrimSpace(string(output))
+	return strings.TrimSpace(strings.Join(lines, "\n"))
 }